@@ -1,6 +1,9 @@
 package contract
 
-import "github.com/hpmalinova/Money-Manager/model"
+import (
+	"github.com/hpmalinova/Money-Manager/model"
+	"time"
+)
 
 type UserRepo interface {
 	Find(start, count int) ([]model.User, error)
@@ -8,6 +11,16 @@ type UserRepo interface {
 	FindByUsername(username string) (*model.User, error)
 	FindNamesByIDs(ids []int) ([]string, error)
 	Create(user *model.User) (*model.User, error)
+	UpdateCurrency(userID int, currency string) error
+}
+
+type SessionRepo interface {
+	Create(session *model.Session) error
+	FindByID(id string) (*model.Session, error)
+	Refresh(id, oldHash, newHash string, expiresAt time.Time) error
+	Extend(id string, expiresAt time.Time) error
+	Revoke(id string) error
+	RevokeAll(userID int) error
 }
 
 type FriendshipRepo interface {
@@ -16,41 +29,99 @@ type FriendshipRepo interface {
 	FindPending(start, count, userID int) ([]int, error)
 	AcceptInvite(userOne, userTwo, actionUser int) error
 	DeclineInvite(userOne, userTwo int) error
+	AreFriends(userOne, userTwo int) (bool, error)
 }
 
 type GroupRepo interface {
-	Create(name string, participants []int) error
-	Find(start, count, ownerID int) ([]model.Group, error)
+	Create(name string, ownerID int, invited []int) (*model.Group, error)
+	Find(start, count, userID int) ([]model.Group, error)
+	FindInvites(userID int) ([]model.Group, error)
+	FindByID(groupID int) (*model.Group, error)
+	Rename(groupID int, name string) error
+	Invite(groupID, userID int) error
+	Join(groupID, userID int) error
+	Leave(groupID, userID int) error
+}
+
+type RecurringRepo interface {
+	Create(r *model.Recurring) (*model.Recurring, error)
+	FindByUser(userID int) ([]model.Recurring, error)
+	FindByID(userID, id int) (*model.Recurring, error)
+	FindActive() ([]model.Recurring, error)
+	Pause(userID, id int) error
+	Resume(userID, id, done int) error
+	Advance(id, done int) error
+	Delete(userID, id int) error
+}
+
+type BudgetRepo interface {
+	Set(budget *model.Budget) error
+	Find(userID int, at time.Time) ([]model.Budget, error)
+	FindByCategory(userID, categoryID int, at time.Time) (*model.Budget, error)
+	Delete(userID, categoryID int) error
 }
 
 type CategoryRepo interface {
-	FindByName(categoryName string) (*model.Category, error)
-	FindExpenses() ([]model.Category, error)
-	FindIncomes() ([]model.Category, error)
-	FindAll() ([]model.Category, error)
+	FindByID(userID, id int) (*model.Category, error)
+	FindByName(userID int, categoryName string) (*model.Category, error)
+	FindExpenses(userID int) ([]model.Category, error)
+	FindIncomes(userID int) ([]model.Category, error)
+	FindAll(userID int) ([]model.Category, error)
+	Create(category *model.Category) (*model.Category, error)
+	Rename(userID, id int, name string) error
+	Archive(userID, id int, archived bool) error
+}
+
+type ImportRuleRepo interface {
+	Create(rule *model.ImportRule) (*model.ImportRule, error)
+	Find(userID int) ([]model.ImportRule, error)
+	Delete(userID, id int) error
+}
+
+type RateRepo interface {
+	Find(currency string) (*model.Rate, error)
+	FindAll() ([]model.Rate, error)
+	Update(rate *model.Rate) error
 }
 
 type PaymentRepo interface {
-	CheckBalance(userID int) (int, error)
+	CheckBalance(userID int) (*model.Balance, error)
 	CreateWallet(userID int) error
+	CreateAccount(userID int, name string) error
+	Transfer(t *model.AccountTransfer) error
 
 	Pay(h *model.History) error
 	Earn(h *model.History) error
+	Import(entries []model.History) error
 	GiveLoan(t *model.TransferLoan) error
 	Split(t *model.TransferSplit) error
+	SplitExpense(e *model.SplitExpense) error
+	FindOpenDebts(scope model.DebtScope) ([]model.OpenDebt, error)
+	Settle(scope model.DebtScope) error
 
 	FindActiveDebts(debtorID int) ([]model.DebtExt, error)
-	FindActiveLoans(creditorID int) ([]model.Loan, error)
-	RequestRepay(debtID, amount int) error
+	FindActiveLoans(creditorID int) ([]model.LoanExt, error)
+	RequestRepay(debtorID, debtID int, amount model.Amount, account string) error
 
 	FindPendingDebts(debtorID int) ([]model.Debt, error)
 	FindPendingRequests(creditorID int) ([]model.LoanExt, error)
 
-	AcceptPayment(a *model.Accept) error
-	DeclinePayment(statusID int) error
+	FindProposedDebts(debtorID int) ([]model.Proposal, error)
+	FindProposedLoans(creditorID int) ([]model.Proposal, error)
+	AcceptProposal(debtorID int, c *model.Consent) error
+	RejectProposal(userID, statusID int) error
+
+	AcceptPayment(creditorID int, a *model.Accept) error
+	DeclinePayment(creditorID, statusID int) error
+
+	Forgive(creditorID int, f *model.Forgive) error
+	FindForgiven(debtorID int) ([]model.Forgiveness, error)
+	DismissForgiven(debtorID, id int) error
 
-	FindHistory(userID int) (*model.HistoryShowAll, error)
-	FindStatistics(userID int, t bool) (*model.Statistics, error)
+	FindHistory(userID int, period model.Period) (*model.HistoryShowAll, error)
+	UpdateEntry(h *model.History) error
+	DeleteEntry(userID, entryID int) error
+	FindStatistics(userID int, t bool, period model.Period) (*model.Statistics, error)
 
-	FindCategoryName(statusID int) (categoryName string, err error)
+	FindCategoryName(creditorID, statusID int) (categoryName string, err error)
 }
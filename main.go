@@ -1,27 +1,130 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
+	"github.com/hpmalinova/Money-Manager/migrations"
+	"github.com/hpmalinova/Money-Manager/repository"
 	"github.com/hpmalinova/Money-Manager/rest"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strings"
 )
 
-func main() {
-	fmt.Println("Staring Service ...")
+const usage = `Usage:
+  money-manager                 start the service
+  money-manager migrate up      apply the pending migrations
+  money-manager migrate status  list the migrations`
 
+func main() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Error loading .env file")
 	}
 
+	config, err := repository.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" || len(os.Args) != 3 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		db := open(config)
+		defer db.Close()
+		migrate(db, config.Driver, os.Args[2])
+		return
+	}
+
+	fmt.Println("Staring Service ...")
+
 	port := os.Getenv("PORT")
-	user := os.Getenv("USER")
-	password := os.Getenv("PASSWORD")
-	dbname := os.Getenv("DBNAME")
 
-	a := rest.App{}
-	a.Init(user, password, dbname)
+	keys, err := rest.NewKeySet(rest.KeyConfig{
+		Algorithm:      os.Getenv("JWT_ALGORITHM"),
+		KeyID:          os.Getenv("JWT_KEY_ID"),
+		Secret:         os.Getenv("JWT_SECRET"),
+		PrivateKeyFile: os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		PreviousKeys:   os.Getenv("JWT_PREVIOUS_KEYS"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cookies, err := rest.NewCookieConfig(os.Getenv("COOKIE_SECURE"), os.Getenv("COOKIE_SAMESITE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a := rest.App{Keys: keys, Cookies: cookies, CSRFKey: []byte(os.Getenv("CSRF_SECRET")), Admins: admins()}
+	if config.Driver == repository.Memory {
+		log.Println("The data is kept in memory and lost when the service stops.")
+		a.InitMemory()
+	} else {
+		db := open(config)
+		defer db.Close()
+
+		pending, err := migrations.Pending(db, config.Driver)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(pending) > 0 {
+			log.Fatalf("The database schema is out of date: %d pending migrations. Run `%s migrate up`.", len(pending), os.Args[0])
+		}
+		a.Init(db, config.Driver)
+	}
 	a.Run(port)
 }
+
+// admins returns the comma-separated usernames of ADMINS
+func admins() []string {
+	names := []string{}
+	for _, name := range strings.Split(os.Getenv("ADMINS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func open(config repository.Config) *sql.DB {
+	db, err := repository.Open(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func migrate(db *sql.DB, dialect string, command string) {
+	switch command {
+	case "up":
+		done, err := migrations.Up(db, dialect)
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("The database schema is up to date.")
+		}
+	case "status":
+		statuses, err := migrations.GetStatus(db, dialect)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-24s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,222 @@
+// Package migrations keeps the database schema up to date.
+//
+// The migrations are SQL files named <version>_<name>.sql, embedded in the binary,
+// one directory per database. They are applied in order and only forward;
+// the applied versions are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The dialects, named as the directories of their migrations.
+// Every schema change is written once for each of them, under the same version.
+const (
+	MySQL  = "mysql"
+	SQLite = "sqlite"
+)
+
+//go:embed mysql/*.sql sqlite/*.sql
+var files embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load returns the migrations of the dialect sorted by version
+func Load(dialect string) ([]Migration, error) {
+	entries, err := files.ReadDir(dialect)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %v: %v", dialect, err)
+	}
+
+	migrations := []Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimSuffix(name, ".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name: %v", name)
+		}
+
+		content, err := files.ReadFile(path.Join(dialect, name))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: parts[1], SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version: %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// statements splits a migration into statements, which end with a semicolon at the end of a line
+func statements(script string) []string {
+	stmts := []string{}
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
+
+func createTable(ctx context.Context, db *sql.DB) error {
+	statement := `CREATE TABLE IF NOT EXISTS schema_migrations (
+					version INT PRIMARY KEY,
+					name VARCHAR(128) NOT NULL,
+					applied_at DATETIME NOT NULL
+				)`
+	_, err := db.ExecContext(ctx, statement)
+	return err
+}
+
+// applied returns the time when each applied version was applied
+func applied(ctx context.Context, db *sql.DB) (map[int]time.Time, error) {
+	if err := createTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetStatus lists all migrations and whether they are applied
+func GetStatus(db *sql.DB, dialect string) ([]Status, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	versions, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := versions[m.Version]
+		statuses = append(statuses, Status{Migration: m, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations which are not applied yet
+func Pending(db *sql.DB, dialect string) ([]Migration, error) {
+	statuses, err := GetStatus(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations in order and returns them.
+// It stops at the first migration that fails.
+func Up(db *sql.DB, dialect string) ([]Migration, error) {
+	pending, err := Pending(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, m := range pending {
+		if err := apply(db, m); err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// apply runs the statements of the migration and records it.
+// MySQL commits each schema change on its own, so a failed migration may be partly applied.
+func apply(db *sql.DB, m Migration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// BEGIN TRANSACTION
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	for _, statement := range statements(m.SQL) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	statement := "INSERT INTO schema_migrations(version, name, applied_at) VALUES(?, ?, ?)"
+	if _, err := tx.ExecContext(ctx, statement, m.Version, m.Name, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	mysql, err := Load(MySQL)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, mysql)
+	for i, m := range mysql {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, statements(m.SQL))
+	}
+
+	// The dialects must have the same migrations
+	sqlite, err := Load(SQLite)
+	assert.NoError(t, err)
+	assert.Len(t, sqlite, len(mysql))
+	for i, m := range sqlite {
+		assert.Equal(t, mysql[i].Version, m.Version)
+		assert.Equal(t, mysql[i].Name, m.Name)
+		assert.NotEmpty(t, statements(m.SQL))
+	}
+
+	_, err = Load("oracle")
+	assert.Error(t, err)
+}
+
+func TestStatements(t *testing.T) {
+	script := `-- comment; not a statement
+CREATE TABLE a (
+    id INT -- no end
+);
+
+INSERT INTO a VALUES (1),
+                     (2);`
+
+	stmts := statements(script)
+	assert.Len(t, stmts, 2)
+	assert.Equal(t, "CREATE TABLE a (\n    id INT -- no end\n);", stmts[0])
+}
+
+func TestUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	migrations, err := Load(MySQL)
+	assert.NoError(t, err)
+	last := migrations[len(migrations)-1]
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, m := range migrations[:len(migrations)-1] {
+		rows.AddRow(m.Version, time.Now())
+	}
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(rows)
+
+	mock.ExpectBegin()
+	for range statements(last.SQL) {
+		mock.ExpectExec(".+").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("INSERT INTO schema_migrations").
+		WithArgs(last.Version, last.Name, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	done, err := Up(db, MySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{last}, done)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUp_Forgiveness(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	migrations, err := Load(SQLite)
+	assert.NoError(t, err)
+	assert.NoError(t, createTable(context.Background(), db))
+	for _, m := range migrations {
+		if m.Name == "forgiveness" {
+			break
+		}
+		assert.NoError(t, apply(db, m))
+	}
+
+	// The users' own categories named as the shared ones are renamed
+	_, err = db.Exec(`INSERT INTO categories (id, c_type, name, user_id)
+						VALUES (20, 'expense', 'forgive', 1), (21, 'income', 'forgiven', 2), (22, 'expense', 'gifts', 1)`)
+	assert.NoError(t, err)
+	_, err = Up(db, SQLite)
+	assert.NoError(t, err)
+
+	names := map[int]string{}
+	rows, err := db.Query("SELECT id, name FROM categories WHERE user_id IS NOT NULL OR name LIKE 'forgive%'")
+	assert.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name string
+		assert.NoError(t, rows.Scan(&id, &name))
+		names[id] = name
+	}
+	assert.NoError(t, rows.Err())
+	assert.Len(t, names, 5)
+	assert.Equal(t, "forgive (20)", names[20])
+	assert.Equal(t, "forgiven (21)", names[21])
+	assert.Equal(t, "gifts", names[22])
+}
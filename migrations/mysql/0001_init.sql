@@ -1,8 +1,7 @@
-DROP DATABASE money_manager;
-CREATE DATABASE money_manager;
-USE money_manager;
+-- The tables that used to be created by hand with sql/create.sql.
+-- Existing tables are kept, so such databases are adopted without losing data.
 
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     username  VARCHAR (32) NOT NULL,
     password VARCHAR(256) NOT NULL,
@@ -12,7 +11,7 @@ CREATE TABLE users (
 -- The action_user_id represent the id of the user
 -- who has performed the most recent status field update.
 -- user_one_id is smaller than user_two_id
-CREATE TABLE friendship (
+CREATE TABLE IF NOT EXISTS friendship (
     user_one_id INT NOT NULL,
     user_two_id INT NOT NULL,
     status enum('pending','accepted','declined') NOT NULL,
@@ -20,28 +19,27 @@ CREATE TABLE friendship (
     UNIQUE (user_one_id, user_two_id)
 );
 
-CREATE TABLE categories (
+CREATE TABLE IF NOT EXISTS categories (
     id INT AUTO_INCREMENT PRIMARY KEY,
     c_type enum('expense','income') NOT NULL,
     name  VARCHAR (32) NOT NULL,
     UNIQUE(name)
 );
 
--- TODO add Date
-CREATE TABLE money_history (
+CREATE TABLE IF NOT EXISTS money_history (
     uid INT NOT NULL,
     amount INT NOT NULL,
     category_id INT NOT NULL,
     description  VARCHAR (128)
 );
 
-CREATE TABLE debt_status (
+CREATE TABLE IF NOT EXISTS debt_status (
     id INT AUTO_INCREMENT PRIMARY KEY,
     status enum('ongoing','pending') NOT NULL,
     amount INT NOT NULL
 );
 
-CREATE TABLE debts (
+CREATE TABLE IF NOT EXISTS debts (
     creditor INT NOT NULL,
     debtor INT NOT NULL,
     amount INT NOT NULL,
@@ -50,16 +48,21 @@ CREATE TABLE debts (
     status_id INT NOT NULL
 );
 
-CREATE TABLE wallet (
+CREATE TABLE IF NOT EXISTS wallet (
     user_id INT PRIMARY KEY,
     balance INT DEFAULT 0
     CONSTRAINT non_negative CHECK (balance >= 0)
 );
 
--- TODO rename Groups
--- CREATE TABLE groups (
---     id INT AUTO_INCREMENT PRIMARY KEY,
---     name  VARCHAR (32) NOT NULL,
---     participant_id INT NOT NULL,
---     UNIQUE (name, participant_id)
--- );
\ No newline at end of file
+-- loan, repay, debt and receive are used by the loans and repayments
+INSERT IGNORE INTO categories (id, c_type, name)
+VALUES  (1, 'expense', 'loan'),
+        (2, 'expense', 'repay'),
+        (3, 'expense', 'food'),
+        (4, 'expense', 'home'),
+        (5, 'expense', 'car'),
+        (6, 'income', 'debt'),
+        (7, 'income', 'receive'),
+        (8, 'income', 'salary'),
+        (9, 'income', 'savings'),
+        (10, 'income', 'lottery');
@@ -0,0 +1,7 @@
+-- The entries of the history get an id, so that they can be edited and deleted,
+-- and the date on which they happened. The existing entries are dated now.
+
+ALTER TABLE money_history
+    ADD COLUMN id INT AUTO_INCREMENT PRIMARY KEY FIRST,
+    ADD COLUMN occurred_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD INDEX (uid, occurred_at);
@@ -0,0 +1,12 @@
+-- Amounts are stored in minor units (stotinki), so that 12.49lv can be recorded.
+-- The existing whole amounts are converted.
+
+ALTER TABLE money_history MODIFY amount BIGINT NOT NULL;
+ALTER TABLE debt_status MODIFY amount BIGINT NOT NULL;
+ALTER TABLE debts MODIFY amount BIGINT NOT NULL;
+ALTER TABLE wallet MODIFY balance BIGINT DEFAULT 0;
+
+UPDATE money_history SET amount = amount * 100;
+UPDATE debt_status SET amount = amount * 100;
+UPDATE debts SET amount = amount * 100;
+UPDATE wallet SET balance = balance * 100;
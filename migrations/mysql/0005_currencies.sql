@@ -0,0 +1,19 @@
+-- Wallets, history entries and debts carry an ISO 4217 currency code,
+-- so a user has a wallet per currency. The existing amounts are in leva.
+
+ALTER TABLE users ADD currency CHAR(3) NOT NULL DEFAULT 'BGN';
+ALTER TABLE money_history ADD currency CHAR(3) NOT NULL DEFAULT 'BGN';
+ALTER TABLE debts ADD currency CHAR(3) NOT NULL DEFAULT 'BGN';
+ALTER TABLE wallet ADD currency CHAR(3) NOT NULL DEFAULT 'BGN', DROP PRIMARY KEY, ADD PRIMARY KEY (user_id, currency);
+
+-- The rate is the value of one unit of the currency in leva.
+-- Only the currencies with a rate can be used.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency CHAR(3) PRIMARY KEY,
+    rate DECIMAL(18, 8) NOT NULL,
+    CONSTRAINT positive_rate CHECK (rate > 0)
+);
+
+INSERT IGNORE INTO exchange_rates (currency, rate)
+VALUES  ('BGN', 1),
+        ('EUR', 1.95583);
@@ -0,0 +1,5 @@
+-- A user keeps money in named accounts, such as cash, bank, card and savings,
+-- each with a wallet per currency. The existing money is in cash.
+
+ALTER TABLE money_history ADD account VARCHAR(32) NOT NULL DEFAULT 'cash';
+ALTER TABLE wallet ADD account VARCHAR(32) NOT NULL DEFAULT 'cash', DROP PRIMARY KEY, ADD PRIMARY KEY (user_id, account, currency);
@@ -0,0 +1,18 @@
+-- Groups of friends who share expenses.
+-- The table is not named groups, which is a reserved word since MySQL 8.0.2.
+CREATE TABLE IF NOT EXISTS money_groups (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(32) NOT NULL
+);
+
+-- An invited user is a member after joining the group
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INT NOT NULL,
+    user_id INT NOT NULL,
+    status enum('invited','member') NOT NULL,
+    PRIMARY KEY (group_id, user_id),
+    INDEX (user_id)
+);
+
+-- The debts of the expenses of a group belong to it
+ALTER TABLE debts ADD group_id INT NULL;
@@ -0,0 +1,21 @@
+-- Rules which record a payment or an income periodically, such as rent, salary and subscriptions.
+-- done is the number of occurrences recorded so far. A rule ends at ends_at or after max_count occurrences.
+CREATE TABLE IF NOT EXISTS recurring (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'BGN',
+    account VARCHAR(32) NOT NULL DEFAULT 'cash',
+    category_id INT NOT NULL,
+    description VARCHAR(128),
+    frequency enum('daily','weekly','monthly','yearly') NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NULL,
+    max_count INT NOT NULL DEFAULT 0,
+    done INT NOT NULL DEFAULT 0,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX (user_id)
+);
+
+-- An entry recorded by a rule keeps its occurrence, so that it is never recorded twice
+ALTER TABLE money_history ADD recurring_id INT NULL, ADD occurrence INT NULL, ADD UNIQUE (recurring_id, occurrence);
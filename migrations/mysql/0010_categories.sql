@@ -0,0 +1,9 @@
+-- Users create, rename, archive and nest their own categories.
+-- The categories without a user_id are shared by all users and cannot be changed.
+-- A subcategory has the id of its top level category in parent_id.
+ALTER TABLE categories
+    ADD user_id INT NULL,
+    ADD parent_id INT NULL,
+    ADD archived BOOLEAN NOT NULL DEFAULT FALSE,
+    DROP INDEX name,
+    ADD UNIQUE (user_id, name);
@@ -0,0 +1,8 @@
+-- Rules which assign a category to the imported bank transactions whose description contains the pattern
+CREATE TABLE IF NOT EXISTS import_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    pattern VARCHAR(64) NOT NULL,
+    category_id INT NOT NULL,
+    INDEX (user_id)
+);
@@ -0,0 +1,6 @@
+-- Loans may have a due date and a simple interest rate in percent per year.
+-- The interest accrues on the amount from accrues_from, the date of the loan or of its last accepted repayment.
+ALTER TABLE debts
+    ADD due_date DATE NULL,
+    ADD interest_rate DECIMAL(5, 2) NOT NULL DEFAULT 0,
+    ADD accrues_from DATETIME NULL;
@@ -0,0 +1,7 @@
+-- New loans and splits are proposed until the debtor accepts them, and no money moves before that.
+-- While a debt is proposed, debt_status.amount is what the creditor pays: the loan or the whole split expense.
+-- account is the account of the creditor which pays, and expense_id the expense category of a split.
+ALTER TABLE debt_status MODIFY status enum('ongoing','pending','proposed') NOT NULL;
+ALTER TABLE debts
+    ADD account VARCHAR(32) NULL,
+    ADD expense_id INT NULL;
@@ -0,0 +1,21 @@
+-- Creditors forgive a debt, or a part of it. No money moves: the creditor records the forgiven amount in forgive,
+-- the debtor in forgiven, and the debtor is notified of it until they dismiss the notice.
+-- The own categories of the users with these names are renamed, so that they keep their entries.
+UPDATE categories SET name = CONCAT(name, ' (', id, ')')
+WHERE user_id IS NOT NULL AND name IN ('forgive', 'forgiven');
+
+INSERT INTO categories (c_type, name)
+VALUES  ('expense', 'forgive'),
+        ('income', 'forgiven');
+
+CREATE TABLE IF NOT EXISTS forgiven_debts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    creditor INT NOT NULL,
+    debtor INT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    description VARCHAR(128),
+    forgiven_at DATETIME NOT NULL,
+    closed BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX (debtor)
+);
@@ -0,0 +1,4 @@
+-- The interest of a loan is simple: it accrues on the amount lent, never on interest.
+-- A repayment or a forgiveness pays the interest accrued until then first; what is left unpaid
+-- is kept in accrued_interest, apart from the amount.
+ALTER TABLE debts ADD accrued_interest BIGINT NOT NULL DEFAULT 0;
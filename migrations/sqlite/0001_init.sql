@@ -0,0 +1,66 @@
+-- The schema of migrations/mysql/0001_init.sql for SQLite.
+-- The enums of MySQL are CHECK constraints.
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(32) NOT NULL UNIQUE,
+    password VARCHAR(256) NOT NULL
+);
+
+-- The action_user_id represent the id of the user
+-- who has performed the most recent status field update.
+-- user_one_id is smaller than user_two_id
+CREATE TABLE IF NOT EXISTS friendship (
+    user_one_id INTEGER NOT NULL,
+    user_two_id INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'accepted', 'declined')),
+    action_user_id INTEGER NOT NULL,
+    UNIQUE (user_one_id, user_two_id)
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    c_type VARCHAR(16) NOT NULL CHECK (c_type IN ('expense', 'income')),
+    name VARCHAR(32) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS money_history (
+    uid INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    description VARCHAR(128)
+);
+
+CREATE TABLE IF NOT EXISTS debt_status (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('ongoing', 'pending')),
+    amount INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS debts (
+    creditor INTEGER NOT NULL,
+    debtor INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    category VARCHAR(32) NOT NULL,
+    description VARCHAR(128),
+    status_id INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS wallet (
+    user_id INTEGER PRIMARY KEY,
+    balance INTEGER DEFAULT 0,
+    CONSTRAINT non_negative CHECK (balance >= 0)
+);
+
+-- loan, repay, debt and receive are used by the loans and repayments
+INSERT OR IGNORE INTO categories (id, c_type, name)
+VALUES  (1, 'expense', 'loan'),
+        (2, 'expense', 'repay'),
+        (3, 'expense', 'food'),
+        (4, 'expense', 'home'),
+        (5, 'expense', 'car'),
+        (6, 'income', 'debt'),
+        (7, 'income', 'receive'),
+        (8, 'income', 'salary'),
+        (9, 'income', 'savings'),
+        (10, 'income', 'lottery');
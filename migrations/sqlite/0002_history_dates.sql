@@ -0,0 +1,20 @@
+-- The entries of the history get an id and the date on which they happened.
+-- SQLite cannot add a primary key to a table, so the table is copied.
+
+CREATE TABLE money_history_dated (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    uid INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    description VARCHAR(128),
+    occurred_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO money_history_dated (uid, amount, category_id, description)
+SELECT uid, amount, category_id, description FROM money_history;
+
+DROP TABLE money_history;
+
+ALTER TABLE money_history_dated RENAME TO money_history;
+
+CREATE INDEX money_history_uid_occurred_at ON money_history (uid, occurred_at);
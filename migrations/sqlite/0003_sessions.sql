@@ -0,0 +1,10 @@
+-- A login of a user. Only the SHA-256 hash of the refresh token is stored.
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    refresh_hash VARCHAR(64) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
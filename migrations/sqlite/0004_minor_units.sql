@@ -0,0 +1,7 @@
+-- Amounts are stored in minor units (stotinki), so that 12.49lv can be recorded.
+-- The existing whole amounts are converted. INTEGER columns of SQLite are already 64-bit.
+
+UPDATE money_history SET amount = amount * 100;
+UPDATE debt_status SET amount = amount * 100;
+UPDATE debts SET amount = amount * 100;
+UPDATE wallet SET balance = balance * 100;
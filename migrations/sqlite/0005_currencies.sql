@@ -0,0 +1,31 @@
+-- Wallets, history entries and debts carry an ISO 4217 currency code,
+-- so a user has a wallet per currency. The existing amounts are in leva.
+
+ALTER TABLE users ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'BGN';
+ALTER TABLE money_history ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'BGN';
+ALTER TABLE debts ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'BGN';
+
+-- The primary key of a SQLite table cannot be altered, so wallet is copied.
+CREATE TABLE wallet_by_currency (
+    user_id INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'BGN',
+    balance INTEGER DEFAULT 0,
+    PRIMARY KEY (user_id, currency),
+    CONSTRAINT non_negative CHECK (balance >= 0)
+);
+
+INSERT INTO wallet_by_currency (user_id, balance) SELECT user_id, balance FROM wallet;
+DROP TABLE wallet;
+ALTER TABLE wallet_by_currency RENAME TO wallet;
+
+-- The rate is the value of one unit of the currency in leva.
+-- Only the currencies with a rate can be used.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency CHAR(3) PRIMARY KEY,
+    rate REAL NOT NULL,
+    CONSTRAINT positive_rate CHECK (rate > 0)
+);
+
+INSERT OR IGNORE INTO exchange_rates (currency, rate)
+VALUES  ('BGN', 1),
+        ('EUR', 1.95583);
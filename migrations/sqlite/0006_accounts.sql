@@ -0,0 +1,18 @@
+-- A user keeps money in named accounts, such as cash, bank, card and savings,
+-- each with a wallet per currency. The existing money is in cash.
+
+ALTER TABLE money_history ADD COLUMN account VARCHAR(32) NOT NULL DEFAULT 'cash';
+
+-- The primary key of a SQLite table cannot be altered, so wallet is copied.
+CREATE TABLE wallet_by_account (
+    user_id INTEGER NOT NULL,
+    account VARCHAR(32) NOT NULL DEFAULT 'cash',
+    currency CHAR(3) NOT NULL DEFAULT 'BGN',
+    balance INTEGER DEFAULT 0,
+    PRIMARY KEY (user_id, account, currency),
+    CONSTRAINT non_negative CHECK (balance >= 0)
+);
+
+INSERT INTO wallet_by_account (user_id, currency, balance) SELECT user_id, currency, balance FROM wallet;
+DROP TABLE wallet;
+ALTER TABLE wallet_by_account RENAME TO wallet;
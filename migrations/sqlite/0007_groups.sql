@@ -0,0 +1,19 @@
+-- Groups of friends who share expenses.
+-- The table is not named groups, which is a reserved word since MySQL 8.0.2.
+CREATE TABLE IF NOT EXISTS money_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(32) NOT NULL
+);
+
+-- An invited user is a member after joining the group
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('invited', 'member')),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_members_user ON group_members (user_id);
+
+-- The debts of the expenses of a group belong to it
+ALTER TABLE debts ADD COLUMN group_id INTEGER NULL;
@@ -0,0 +1,24 @@
+-- Rules which record a payment or an income periodically, such as rent, salary and subscriptions.
+-- done is the number of occurrences recorded so far. A rule ends at ends_at or after max_count occurrences.
+CREATE TABLE IF NOT EXISTS recurring (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'BGN',
+    account VARCHAR(32) NOT NULL DEFAULT 'cash',
+    category_id INTEGER NOT NULL,
+    description VARCHAR(128),
+    frequency VARCHAR(16) NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly', 'yearly')),
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NULL,
+    max_count INTEGER NOT NULL DEFAULT 0,
+    done INTEGER NOT NULL DEFAULT 0,
+    paused BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS recurring_user ON recurring (user_id);
+
+-- An entry recorded by a rule keeps its occurrence, so that it is never recorded twice
+ALTER TABLE money_history ADD COLUMN recurring_id INTEGER NULL;
+ALTER TABLE money_history ADD COLUMN occurrence INTEGER NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS money_history_occurrence ON money_history (recurring_id, occurrence);
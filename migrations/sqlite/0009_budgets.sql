@@ -0,0 +1,11 @@
+-- A budget limits the spending of a user in an expense category per week, month or year.
+-- A blocking budget refuses a payment which would exceed it; the others only warn.
+CREATE TABLE IF NOT EXISTS budgets (
+    user_id INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'BGN',
+    period VARCHAR(16) NOT NULL CHECK (period IN ('weekly', 'monthly', 'yearly')),
+    blocking BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (user_id, category_id)
+);
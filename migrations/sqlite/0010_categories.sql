@@ -0,0 +1,21 @@
+-- Users create, rename, archive and nest their own categories.
+-- The categories without a user_id are shared by all users and cannot be changed.
+-- A subcategory has the id of its top level category in parent_id.
+-- SQLite cannot drop the unique constraint on name, so the table is rebuilt.
+CREATE TABLE categories_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    c_type VARCHAR(16) NOT NULL CHECK (c_type IN ('expense', 'income')),
+    name VARCHAR(32) NOT NULL,
+    user_id INTEGER NULL,
+    parent_id INTEGER NULL,
+    archived BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO categories_new (id, c_type, name)
+SELECT id, c_type, name FROM categories;
+
+DROP TABLE categories;
+
+ALTER TABLE categories_new RENAME TO categories;
+
+CREATE UNIQUE INDEX IF NOT EXISTS categories_user_name ON categories (user_id, name);
@@ -0,0 +1,9 @@
+-- Rules which assign a category to the imported bank transactions whose description contains the pattern
+CREATE TABLE IF NOT EXISTS import_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    pattern VARCHAR(64) NOT NULL,
+    category_id INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS import_rules_user ON import_rules (user_id);
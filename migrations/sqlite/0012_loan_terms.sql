@@ -0,0 +1,5 @@
+-- Loans may have a due date and a simple interest rate in percent per year.
+-- The interest accrues on the amount from accrues_from, the date of the loan or of its last accepted repayment.
+ALTER TABLE debts ADD COLUMN due_date DATE NULL;
+ALTER TABLE debts ADD COLUMN interest_rate NUMERIC(5, 2) NOT NULL DEFAULT 0;
+ALTER TABLE debts ADD COLUMN accrues_from DATETIME NULL;
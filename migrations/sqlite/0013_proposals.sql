@@ -0,0 +1,19 @@
+-- New loans and splits are proposed until the debtor accepts them, and no money moves before that.
+-- While a debt is proposed, debt_status.amount is what the creditor pays: the loan or the whole split expense.
+-- account is the account of the creditor which pays, and expense_id the expense category of a split.
+-- SQLite cannot change the check of status, so debt_status is rebuilt.
+CREATE TABLE debt_status_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('ongoing', 'pending', 'proposed')),
+    amount INTEGER NOT NULL
+);
+
+INSERT INTO debt_status_new (id, status, amount)
+SELECT id, status, amount FROM debt_status;
+
+DROP TABLE debt_status;
+
+ALTER TABLE debt_status_new RENAME TO debt_status;
+
+ALTER TABLE debts ADD COLUMN account VARCHAR(32) NULL;
+ALTER TABLE debts ADD COLUMN expense_id INTEGER NULL;
@@ -0,0 +1,3 @@
+-- A pending repayment is paid from an account of the debtor, which debt_status.account keeps
+-- until the creditor accepts it into an account of theirs.
+ALTER TABLE debt_status ADD COLUMN account VARCHAR(32) NOT NULL DEFAULT 'cash';
@@ -0,0 +1,33 @@
+package model
+
+// DefaultAccount is the account of the money recorded before users had accounts,
+// and of the entries which do not name one.
+const DefaultAccount = "cash"
+
+// Account is the balance of one account of a user, such as cash, bank, card or savings,
+// with a wallet per currency
+type Account struct {
+	Name    string  `json:"name"`
+	Wallets []Money `json:"wallets"`
+	Total   Money   `json:"total"` // in the base currency of the user
+}
+
+// String returns the name and the balances of the wallets, such as "bank: 40.00 BGN, 10.00 EUR"
+func (a Account) String() string {
+	return a.Name + ": " + Balance{Wallets: a.Wallets, Total: a.Total}.String()
+}
+
+// NewAccount names a new account, received by the API
+type NewAccount struct {
+	Name string `json:"name" validate:"required,min=2,max=32"`
+}
+
+// AccountTransfer moves money between two accounts of a user.
+// It is neither an income nor an expense.
+type AccountTransfer struct {
+	UserID   int    `json:"-"`
+	From     string `json:"from" validate:"required,max=32"`
+	To       string `json:"to" validate:"required,max=32,nefield=From"`
+	Amount   Amount `json:"amount" validate:"numeric,gt=0"`
+	Currency string `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"` // the base currency of the user if not set
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount is an amount of money in the minor units of its currency (stotinki, cents, fils), so that it is
+// always exact. The currency tells how many digits the minor units have: it is written as a decimal with
+// that many fractional digits, such as 12.49 BGN, 500 JPY or 1.250 KWD, in the forms and the templates.
+// JSON carries the minor units themselves, such as 1249, which need no currency to be exact.
+type Amount int64
+
+// Unit is the number of minor units in one unit of a currency with two digits, such as DefaultCurrency
+const Unit Amount = 100
+
+var errInvalidAmount = errors.New("invalid amount")
+
+// ParseAmount reads a decimal in a currency with two digits, such as "12", "12.4" or "12.49"
+func ParseAmount(s string) (Amount, error) {
+	return parseAmount(s, 2)
+}
+
+// ParseAmountIn reads a decimal in the currency, which has at most as many fractional digits as it.
+// A comma is accepted as the decimal separator. More fractional digits are an error,
+// because they cannot be stored without rounding.
+func ParseAmountIn(s, currency string) (Amount, error) {
+	return parseAmount(s, MinorDigits(currency))
+}
+
+func parseAmount(s string, minorDigits int) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction := s, ""
+	separated := false
+	if i := strings.IndexAny(s, ".,"); i >= 0 {
+		whole, fraction, separated = s[:i], s[i+1:], true
+	}
+	if whole == "" || len(fraction) > minorDigits || (separated && minorDigits == 0) || !digits(whole) || !digits(fraction) {
+		return 0, fmt.Errorf("%w: %q", errInvalidAmount, s)
+	}
+
+	fraction += strings.Repeat("0", minorDigits-len(fraction))
+	minor, _ := strconv.ParseInt("0"+fraction, 10, 64)
+	unit := unitOf(minorDigits)
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > int64((maxAmount-Amount(minor))/unit) {
+		return 0, fmt.Errorf("%w: %q is too large", errInvalidAmount, s)
+	}
+
+	a := Amount(units)*unit + Amount(minor)
+	if negative {
+		a = -a
+	}
+	return a, nil
+}
+
+const maxAmount = Amount(1<<63 - 1)
+
+// unitOf returns the number of minor units with the digits in one unit
+func unitOf(minorDigits int) Amount {
+	unit := Amount(1)
+	for i := 0; i < minorDigits; i++ {
+		unit *= 10
+	}
+	return unit
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount in a currency with two digits, such as 12.49 or -0.50
+func (a Amount) String() string {
+	return a.format(2)
+}
+
+// In formats the amount in the currency with its digits, such as 12.49 BGN, 500 JPY or 1.250 KWD
+func (a Amount) In(currency string) string {
+	return a.format(MinorDigits(currency))
+}
+
+func (a Amount) format(minorDigits int) string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+	unit := unitOf(minorDigits)
+	if minorDigits == 0 {
+		return fmt.Sprintf("%s%d", sign, a)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, a/unit, minorDigits, a%unit)
+}
+
+// Split divides the amount into n parts which differ by at most one minor unit and add up to the amount.
+// The remainder goes to the first parts, so the result is always the same.
+func (a Amount) Split(n int) []Amount {
+	parts := make([]Amount, n)
+	share, remainder := a/Amount(n), a%Amount(n)
+	for i := range parts {
+		parts[i] = share
+		if Amount(i) < remainder {
+			parts[i]++
+		}
+	}
+	return parts
+}
+
+// Weigh divides the amount into parts in proportion to the weights, which must not all be zero.
+// Like Split, the parts add up to the amount and the remainder goes to the first parts with a weight.
+// The products of the amount and the weights are exact, however large they are.
+func (a Amount) Weigh(weights []int64) []Amount {
+	total := new(big.Int)
+	for _, w := range weights {
+		total.Add(total, big.NewInt(w))
+	}
+
+	parts := make([]Amount, len(weights))
+	remainder := a
+	part := new(big.Int)
+	for i, w := range weights {
+		part.Mul(big.NewInt(int64(a)), big.NewInt(w))
+		parts[i] = Amount(part.Quo(part, total).Int64())
+		remainder -= parts[i]
+	}
+	for i := 0; remainder > 0; i++ {
+		if weights[i] > 0 {
+			parts[i]++
+			remainder--
+		}
+	}
+	return parts
+}
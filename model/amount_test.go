@@ -0,0 +1,95 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	valid := map[string]Amount{
+		"12":     1200,
+		"12.4":   1240,
+		"12.49":  1249,
+		"12,49":  1249,
+		" 0.05 ": 5,
+		"-3.5":   -350,
+	}
+	for s, want := range valid {
+		got, err := ParseAmount(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+
+	for _, s := range []string{"", ".5", "12.495", "1e3", "12.4.9", "abc", "99999999999999999999", "92233720368547758.08"} {
+		_, err := ParseAmount(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseAmountIn(t *testing.T) {
+	a, err := ParseAmountIn("500", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(500), a, "the yen has no minor units")
+	a, err = ParseAmountIn("1,25", "KWD")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(1250), a, "a dinar has 1000 fils")
+	a, err = ParseAmountIn("12.49", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(1249), a)
+
+	_, err = ParseAmountIn("500.5", "JPY")
+	assert.Error(t, err)
+	_, err = ParseAmountIn("500.", "JPY")
+	assert.Error(t, err)
+	_, err = ParseAmountIn("1.2345", "KWD")
+	assert.Error(t, err)
+}
+
+func TestAmount_String(t *testing.T) {
+	assert.Equal(t, "12.49", Amount(1249).String())
+	assert.Equal(t, "0.05", Amount(5).String())
+	assert.Equal(t, "-0.50", Amount(-50).String())
+}
+
+func TestAmount_In(t *testing.T) {
+	assert.Equal(t, "12.49", Amount(1249).In("BGN"))
+	assert.Equal(t, "1249", Amount(1249).In("JPY"))
+	assert.Equal(t, "-1.249", Amount(-1249).In("KWD"))
+	assert.Equal(t, "0.005", Amount(5).In("KWD"))
+	assert.Equal(t, "500 JPY", Money{Amount: 500, Currency: "JPY"}.String())
+}
+
+func TestAmount_Split(t *testing.T) {
+	assert.Equal(t, []Amount{3, 2}, Amount(5).Split(2))
+	assert.Equal(t, []Amount{34, 33, 33}, Amount(100).Split(3))
+
+	parts := Amount(1001).Split(7)
+	var sum Amount
+	for _, p := range parts {
+		sum += p
+	}
+	assert.Equal(t, Amount(1001), sum)
+}
+
+func TestAmount_Weigh(t *testing.T) {
+	assert.Equal(t, []Amount{50, 25, 25}, Amount(100).Weigh([]int64{2, 1, 1}))
+	assert.Equal(t, []Amount{0, 34, 33, 33}, Amount(100).Weigh([]int64{0, 1, 1, 1}), "no remainder without a weight")
+	assert.Equal(t, []Amount{1, 0}, Amount(1).Weigh([]int64{1, 1}))
+
+	// The amount times a weight does not fit in 64 bits
+	large := Amount(1 << 62)
+	assert.Equal(t, []Amount{large / 2, large / 2}, large.Weigh([]int64{1 << 40, 1 << 40}))
+	assert.Equal(t, []Amount{large/3 + 1, large / 3, large / 3}, large.Weigh([]int64{100, 100, 100}))
+}
+
+func TestAmount_JSON(t *testing.T) {
+	p := &Pay{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount": 1249}`), p))
+	assert.Equal(t, Amount(1249), p.Amount)
+	assert.Error(t, json.Unmarshal([]byte(`{"amount": 12.49}`), p), "JSON carries the minor units")
+
+	data, err := json.Marshal(DLTemplate{Amount: 500, Currency: "JPY"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": 500, "currency": "JPY"}`, string(data))
+}
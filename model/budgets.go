@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Budget limits the spending of a user in an expense category per week, month or year
+type Budget struct {
+	UserID       int    `json:"-"`
+	CategoryID   int    `json:"-"`
+	CategoryName string `json:"categoryName"`
+	Amount       Amount `json:"amount"`
+	Currency     string `json:"currency"`
+	Period       string `json:"period"` // Weekly, Monthly or Yearly
+	Block        bool   `json:"block"`  // a payment which would exceed the budget is refused instead of warned about
+	Spent        Amount `json:"spent"`  // in the current period, converted to Currency
+	Current      Period `json:"current"`
+}
+
+// BudgetRequest is a budget received by the API
+type BudgetRequest struct {
+	Amount   Amount `json:"amount" validate:"numeric,gt=0"`
+	Currency string `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"` // the base currency of the user if not set
+	Period   string `json:"period" validate:"oneof=weekly monthly yearly"`
+	Block    bool   `json:"block"`
+}
+
+// Remaining returns the amount which can still be spent in the current period; it is negative when overspent
+func (b Budget) Remaining() Amount {
+	return b.Amount - b.Spent
+}
+
+// Percent returns the spent part of the budget in percent, rounded down
+func (b Budget) Percent() int64 {
+	return int64(b.Spent) * 100 / int64(b.Amount)
+}
+
+// Overspent reports whether more than the budget is spent
+func (b Budget) Overspent() bool {
+	return b.Spent > b.Amount
+}
+
+// Overspending returns how much more than the budget is spent
+func (b Budget) Overspending() Amount {
+	return b.Spent - b.Amount
+}
+
+// Exceeded returns a message about a payment of amount, in the currency of the budget,
+// which would exceed the budget, or "" if it would not
+func (b Budget) Exceeded(amount Amount) string {
+	if b.Spent+amount <= b.Amount {
+		return ""
+	}
+	after := b
+	after.Spent += amount
+	return fmt.Sprintf("the payment exceeds the %s budget of %s by %s %s", b.Period, b.CategoryName,
+		after.Overspending().In(b.Currency), b.Currency)
+}
+
+// BudgetPeriod returns the week, month or year which contains t, in the location of t.
+// Weeks start on Monday.
+func BudgetPeriod(period string, t time.Time) Period {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case Weekly:
+		from := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return Period{From: from, To: from.AddDate(0, 0, 7)}
+	case Yearly:
+		from := time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+		return Period{From: from, To: from.AddDate(1, 0, 0)}
+	default:
+		from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return Period{From: from, To: from.AddDate(0, 1, 0)}
+	}
+}
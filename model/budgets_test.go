@@ -0,0 +1,35 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBudgetPeriod(t *testing.T) {
+	// Sunday
+	at := time.Date(2024, time.March, 10, 18, 30, 0, 0, time.UTC)
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	assert.Equal(t, Period{From: date(2024, time.March, 4), To: date(2024, time.March, 11)}, BudgetPeriod(Weekly, at))
+	assert.Equal(t, Period{From: date(2024, time.March, 1), To: date(2024, time.April, 1)}, BudgetPeriod(Monthly, at))
+	assert.Equal(t, Period{From: date(2024, time.January, 1), To: date(2025, time.January, 1)}, BudgetPeriod(Yearly, at))
+
+	monday := date(2024, time.March, 11)
+	assert.Equal(t, monday, BudgetPeriod(Weekly, monday).From)
+}
+
+func TestBudget_Exceeded(t *testing.T) {
+	b := Budget{CategoryName: "food", Amount: 300 * Unit, Currency: "BGN", Period: Monthly, Spent: 250 * Unit}
+	assert.Equal(t, 50*Unit, b.Remaining())
+	assert.Equal(t, int64(83), b.Percent())
+	assert.Empty(t, b.Exceeded(50*Unit), "the whole budget may be spent")
+	assert.Equal(t, "the payment exceeds the monthly budget of food by 10.50 BGN", b.Exceeded(6050))
+
+	b.Spent = 301 * Unit
+	assert.True(t, b.Overspent())
+	assert.Equal(t, 1*Unit, b.Overspending())
+	assert.Equal(t, -1*Unit, b.Remaining())
+}
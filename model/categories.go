@@ -1,7 +1,74 @@
 package model
 
+// Category is shared by all users, when UserID is zero, or created by a user.
+// A user nests their subcategories under a top level category, shared or their own, of the same type.
 type Category struct {
-	ID    int    `json:"id" validate:"numeric,gte=0"`
-	CType string `json:"cType"`
-	Name  string `json:"name" validate:"required,min=3,max=32"`
+	ID       int        `json:"id" validate:"numeric,gte=0"`
+	CType    string     `json:"cType"`
+	Name     string     `json:"name" validate:"required,min=3,max=32"`
+	UserID   int        `json:"-"`
+	ParentID int        `json:"parentID,omitempty"`
+	Archived bool       `json:"archived,omitempty"` // hidden from the lists, but kept for the history
+	Children []Category `json:"children,omitempty"`
+}
+
+// Shared tells whether the category belongs to all users; such categories cannot be changed
+func (c Category) Shared() bool {
+	return c.UserID == 0
+}
+
+// CategoryRequest is a new category received by the API
+type CategoryRequest struct {
+	Name   string `json:"name" validate:"required,min=3,max=32"`
+	CType  string `json:"cType" validate:"oneof=expense income"`
+	Parent string `json:"parent,omitempty"` // the name of the parent, a top level category
+}
+
+// CategoryTree nests the categories under their parents, keeping their order.
+// Categories whose parent is not among them are left out.
+func CategoryTree(categories []Category) []Category {
+	tree := []Category{}
+	for _, c := range categories {
+		if c.ParentID == 0 {
+			c.Children = nil
+			tree = append(tree, c)
+		}
+	}
+	for _, c := range categories {
+		if c.ParentID == 0 {
+			continue
+		}
+		for i := range tree {
+			if tree[i].ID == c.ParentID {
+				c.Children = nil
+				tree[i].Children = append(tree[i].Children, c)
+			}
+		}
+	}
+	return tree
+}
+
+// Category types
+const (
+	ExpenseType = "expense"
+	IncomeType  = "income"
+)
+
+// System categories are used by loans, repayments and forgiven debts.
+// Entries in them are managed by the payment flows and cannot be edited by hand.
+const (
+	LoanCategory     = "loan"
+	RepayCategory    = "repay"
+	DebtCategory     = "debt"
+	ReceiveCategory  = "receive"
+	ForgiveCategory  = "forgive"
+	ForgivenCategory = "forgiven"
+)
+
+func IsSystemCategory(name string) bool {
+	switch name {
+	case LoanCategory, RepayCategory, DebtCategory, ReceiveCategory, ForgiveCategory, ForgivenCategory:
+		return true
+	}
+	return false
 }
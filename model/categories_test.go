@@ -0,0 +1,23 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCategoryTree(t *testing.T) {
+	categories := []Category{
+		{ID: 3, Name: "food"},
+		{ID: 4, Name: "home"},
+		{ID: 11, Name: "groceries", ParentID: 3},
+		{ID: 12, Name: "rent", ParentID: 4},
+		{ID: 13, Name: "restaurants", ParentID: 3},
+		{ID: 14, Name: "orphan", ParentID: 5},
+	}
+
+	tree := CategoryTree(categories)
+	assert.Equal(t, []Category{
+		{ID: 3, Name: "food", Children: []Category{{ID: 11, Name: "groceries", ParentID: 3}, {ID: 13, Name: "restaurants", ParentID: 3}}},
+		{ID: 4, Name: "home", Children: []Category{{ID: 12, Name: "rent", ParentID: 4}}},
+	}, tree, "the subcategories of a missing parent are left out")
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DefaultCurrency is the currency of the amounts recorded before wallets had currencies,
+// and of the entries which do not name one.
+const DefaultCurrency = "BGN"
+
+// minorDigits are the ISO 4217 exponents of the currencies whose minor units do not have two digits
+var minorDigits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// MinorDigits returns the number of digits of the minor units of the currency, such as 2 for BGN and EUR,
+// 0 for JPY and 3 for KWD
+func MinorDigits(currency string) int {
+	if d, ok := minorDigits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// Rate is the value of one unit of an ISO 4217 currency in the reference currency of the exchange-rate table,
+// which is DefaultCurrency
+type Rate struct {
+	Currency string  `json:"currency" validate:"len=3,uppercase"`
+	Rate     float64 `json:"rate" validate:"gt=0"`
+}
+
+// Rates are the exchange rates by currency
+type Rates map[string]float64
+
+// Convert converts the amount from the minor units of one currency to those of another,
+// rounded to the nearest minor unit
+func (r Rates) Convert(amount Amount, from, to string) (Amount, error) {
+	if from == to {
+		return amount, nil
+	}
+	fromRate, ok := r[from]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %v", from)
+	}
+	toRate, ok := r[to]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %v", to)
+	}
+	scale := float64(unitOf(MinorDigits(to))) / float64(unitOf(MinorDigits(from)))
+	return Amount(math.Round(float64(amount) * scale * fromRate / toRate)), nil
+}
+
+// Money is an amount in a currency
+type Money struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) String() string {
+	return m.Amount.In(m.Currency) + " " + m.Currency
+}
+
+// Balance is the balance of every account of a user, the balance in every currency of all accounts
+// and their total in the base currency of the user
+type Balance struct {
+	Accounts []Account `json:"accounts,omitempty"`
+	Wallets  []Money   `json:"wallets"`
+	Total    Money     `json:"total"`
+}
+
+// String returns the balances of the wallets, such as "40.00 BGN, 10.00 EUR (59.56 BGN)"
+func (b Balance) String() string {
+	if len(b.Wallets) == 0 {
+		return b.Total.String()
+	}
+	wallets := make([]string, 0, len(b.Wallets))
+	for _, w := range b.Wallets {
+		wallets = append(wallets, w.String())
+	}
+	s := strings.Join(wallets, ", ")
+	if len(b.Wallets) > 1 || b.Wallets[0].Currency != b.Total.Currency {
+		s += " (" + b.Total.String() + ")"
+	}
+	return s
+}
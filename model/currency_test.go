@@ -0,0 +1,46 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRates_Convert(t *testing.T) {
+	rates := Rates{"BGN": 1, "EUR": 1.95583}
+
+	a, err := rates.Convert(1000, "EUR", "BGN")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(1956), a)
+
+	a, err = rates.Convert(1000, "BGN", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(511), a)
+
+	a, err = rates.Convert(1000, "USD", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(1000), a, "no rate is needed within a currency")
+
+	_, err = rates.Convert(1000, "USD", "BGN")
+	assert.Error(t, err)
+
+	// The minor units of the currencies differ
+	rates = Rates{"BGN": 1, "JPY": 0.012, "KWD": 5.9}
+	a, err = rates.Convert(1000, "JPY", "BGN")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(1200), a, "1000 JPY are 12.00 BGN")
+	a, err = rates.Convert(1200, "BGN", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(1000), a)
+	a, err = rates.Convert(1000, "KWD", "BGN")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(590), a, "1.000 KWD is 5.90 BGN")
+}
+
+func TestBalance_String(t *testing.T) {
+	b := Balance{Wallets: []Money{{Amount: 4000, Currency: "BGN"}}, Total: Money{Amount: 4000, Currency: "BGN"}}
+	assert.Equal(t, "40.00 BGN", b.String())
+
+	b.Wallets = append(b.Wallets, Money{Amount: 1000, Currency: "EUR"})
+	b.Total.Amount = 5956
+	assert.Equal(t, "40.00 BGN, 10.00 EUR (59.56 BGN)", b.String())
+}
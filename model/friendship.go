@@ -8,10 +8,10 @@ type Friendship struct {
 }
 
 type Friends struct {
-	Usernames []string
+	Usernames []string `json:"usernames"`
 }
 
 type GetFriends struct {
-	Friends        Friends
-	PendingFriends Friends
+	Friends        Friends `json:"friends"`
+	PendingFriends Friends `json:"pending"`
 }
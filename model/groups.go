@@ -1,12 +1,59 @@
 package model
 
+const (
+	InvitedStatus = "invited"
+	MemberStatus  = "member"
+)
+
 type Group struct {
-	ID             int    `json:"id" validate:"numeric,gte=0"`
-	Name           string `json:"name" validate:"required,min=1,max=32"`
-	ParticipantIDs []int  `json:"participantIDs"` //todo check if okay
+	ID      int           `json:"id" validate:"numeric,gte=0"`
+	Name    string        `json:"name" validate:"required,min=1,max=32"`
+	Members []GroupMember `json:"members,omitempty"`
+}
+
+// GroupMember is a member or an invited user of a group
+type GroupMember struct {
+	UserID   int    `json:"userID"`
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	// What the other members owe to the member per currency, negative if the member owes them
+	Balance []Money `json:"balance"`
 }
 
+// Member returns the member with the given ID, or nil if the user is neither a member nor invited
+func (g *Group) Member(userID int) *GroupMember {
+	for i := range g.Members {
+		if g.Members[i].UserID == userID {
+			return &g.Members[i]
+		}
+	}
+	return nil
+}
+
+// IsMember tells whether the user has joined the group
+func (g *Group) IsMember(userID int) bool {
+	m := g.Member(userID)
+	return m != nil && m.Status == MemberStatus
+}
+
+// MemberIDs returns the IDs of the users who have joined the group
+func (g *Group) MemberIDs() []int {
+	ids := []int{}
+	for _, m := range g.Members {
+		if m.Status == MemberStatus {
+			ids = append(ids, m.UserID)
+		}
+	}
+	return ids
+}
+
+// CreateGroup is a new group with the usernames of the friends to invite, received by the API
 type CreateGroup struct {
-	Name         string   `json:"name"`
+	Name         string   `json:"name" validate:"required,min=1,max=32"`
 	Participants []string `json:"participants"`
 }
+
+// GroupInvite names the friend to invite to a group, received by the API
+type GroupInvite struct {
+	Username string `json:"username" validate:"required,min=3,max=32"`
+}
@@ -0,0 +1,386 @@
+package model
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statement formats
+const (
+	CSVFormat = "csv"
+	OFXFormat = "ofx" // OFX 1 (SGML) and 2 (XML), as well as QFX
+)
+
+// DefaultDateLayout is the layout of the dates of a CSV statement if the mapping does not set one
+const DefaultDateLayout = "2006-01-02"
+
+// ImportMapping tells which columns of a CSV statement hold the fields of a transaction.
+// A column is named by its header, or numbered from 1.
+// The amount is either in one column, negative for payments, or in separate Debit and Credit columns.
+type ImportMapping struct {
+	Date        string `json:"date" validate:"required"`
+	Amount      string `json:"amount,omitempty" validate:"required_without_all=Debit Credit"`
+	Debit       string `json:"debit,omitempty"`  // the payments
+	Credit      string `json:"credit,omitempty"` // the incomes
+	Description string `json:"description,omitempty"`
+	Currency    string `json:"currency,omitempty"`   // the currency of the import if not set
+	DateLayout  string `json:"dateLayout,omitempty"` // a Go time layout, DefaultDateLayout if not set
+	Comma       string `json:"comma,omitempty"`      // the field separator, "," if not set
+	NoHeader    bool   `json:"noHeader,omitempty"`   // the first line is a transaction
+}
+
+// ImportRow is a transaction of a bank statement
+type ImportRow struct {
+	Date        time.Time `json:"date"`
+	Amount      Amount    `json:"amount" validate:"gt=0"`
+	CType       string    `json:"cType" validate:"oneof=expense income"`
+	Currency    string    `json:"currency" validate:"len=3,uppercase"`
+	Description string    `json:"description,omitempty" validate:"max=128"`
+	Category    string    `json:"category,omitempty"`  // by the rules of the user, or chosen in the preview
+	Duplicate   bool      `json:"duplicate,omitempty"` // the history has an entry with the same day, amount, currency and type
+	Accept      bool      `json:"accept"`              // imported on commit; the preview does not accept the duplicates
+}
+
+// Statement is a bank statement which is previewed and then imported into the account of the user
+type Statement struct {
+	Account string      `json:"account,omitempty"` // DefaultAccount if not set
+	Rows    []ImportRow `json:"rows" validate:"dive"`
+}
+
+// ImportRule assigns a category to the imported transactions whose description contains Pattern, ignoring case.
+// It applies to the transactions of the type of the category.
+type ImportRule struct {
+	ID         int    `json:"id"`
+	UserID     int    `json:"-"`
+	Pattern    string `json:"pattern" validate:"required,max=64"`
+	CategoryID int    `json:"-"`
+	Category   string `json:"category" validate:"required"`
+	CType      string `json:"cType"`
+}
+
+// ParseCSV reads the transactions of a CSV statement in the currency, unless the mapping has a currency column.
+// Rows with a zero amount, such as balance lines, are skipped.
+func ParseCSV(r io.Reader, m ImportMapping, currency string) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if m.Comma != "" {
+		if len([]rune(m.Comma)) != 1 {
+			return nil, fmt.Errorf("invalid separator %q", m.Comma)
+		}
+		reader.Comma = []rune(m.Comma)[0]
+	}
+	layout := m.DateLayout
+	if layout == "" {
+		layout = DefaultDateLayout
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var header []string
+	if !m.NoHeader && len(records) > 0 {
+		header, records = records[0], records[1:]
+	}
+	// The columns are looked up in order, so that the first missing one is reported
+	columns := map[string]int{}
+	for _, c := range []struct{ field, name string }{{"date", m.Date}, {"amount", m.Amount}, {"debit", m.Debit},
+		{"credit", m.Credit}, {"description", m.Description}, {"currency", m.Currency}} {
+		if columns[c.field], err = column(header, c.name); err != nil {
+			return nil, err
+		}
+	}
+
+	rows := []ImportRow{}
+	for i, record := range records {
+		line := i + 1
+		if header != nil {
+			line++
+		}
+		value := func(field string) string {
+			c := columns[field]
+			if c < 0 || c >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[c])
+		}
+
+		row := ImportRow{Currency: currency, Description: description(value("description"))}
+		if row.Date, err = time.Parse(layout, value("date")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, value("date"))
+		}
+		if c := value("currency"); c != "" {
+			row.Currency = strings.ToUpper(c)
+		}
+		var amount Amount
+		if columns["amount"] >= 0 {
+			amount, err = statementAmount(value("amount"), row.Currency)
+		} else {
+			amount, err = debitCredit(value("debit"), value("credit"), row.Currency)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if amount == 0 {
+			continue
+		}
+		row.Amount, row.CType = signed(amount)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// column returns the index of the column named by its header or by its number, or -1 if the name is empty
+func column(header []string, name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return -1, nil
+	}
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return n - 1, nil
+	}
+	return -1, fmt.Errorf("there is no column %s", name)
+}
+
+// statementAmount reads an amount in the currency as banks write it, such as "-1 234,56" or "1,234.56".
+// When both a dot and a comma appear, the first one separates the thousands.
+func statementAmount(s, currency string) (Amount, error) {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(s)
+	if strings.Contains(s, ".") && strings.Contains(s, ",") {
+		thousands := ","
+		if strings.Index(s, ".") < strings.Index(s, ",") {
+			thousands = "."
+		}
+		s = strings.ReplaceAll(s, thousands, "")
+	}
+	return ParseAmountIn(s, currency)
+}
+
+// debitCredit returns the amount of a transaction with separate debit and credit columns, negative for a debit
+func debitCredit(debit, credit, currency string) (Amount, error) {
+	var d, c Amount
+	var err error
+	if debit != "" {
+		if d, err = statementAmount(debit, currency); err != nil {
+			return 0, err
+		}
+	}
+	if credit != "" {
+		if c, err = statementAmount(credit, currency); err != nil {
+			return 0, err
+		}
+	}
+	if d < 0 {
+		d = -d
+	}
+	return c - d, nil
+}
+
+// signed returns the amount and the type of a transaction from its signed amount
+func signed(amount Amount) (Amount, string) {
+	if amount < 0 {
+		return -amount, ExpenseType
+	}
+	return amount, IncomeType
+}
+
+// maxDescription is the length of the description column of money_history
+const maxDescription = 128
+
+// description shortens the description of a transaction to fit in the history
+func description(s string) string {
+	if r := []rune(s); len(r) > maxDescription {
+		return string(r[:maxDescription])
+	}
+	return s
+}
+
+var errNoTransactions = errors.New("the statement has no transactions")
+
+// ParseOFX reads the transactions of an OFX or QFX statement. Their currency is the default currency
+// of the statement, or the given currency if the statement has none.
+// Both the SGML of OFX 1, whose elements need not be closed, and the XML of OFX 2 are accepted.
+func ParseOFX(r io.Reader, currency string) ([]ImportRow, error) {
+	rows := []ImportRow{}
+	var row *ImportRow
+	var name, memo, amount string
+	found := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(scanTags)
+	for scanner.Scan() {
+		tag, value := ofxElement(scanner.Text())
+		switch tag {
+		case "CURDEF":
+			currency = strings.ToUpper(value)
+		case "BANKTRANLIST":
+			found = true
+		case "STMTTRN":
+			row = &ImportRow{Currency: currency}
+			name, memo, amount = "", "", ""
+		case "/STMTTRN":
+			if row == nil {
+				continue
+			}
+			row.Description = description(strings.TrimSpace(name + " " + memo))
+			if name == memo {
+				row.Description = description(name)
+			}
+			if row.Date.IsZero() {
+				return nil, fmt.Errorf("transaction %d: no date", len(rows)+1)
+			}
+			// The currency of the transaction may follow its amount
+			if amount != "" {
+				a, err := statementAmount(amount, row.Currency)
+				if err != nil {
+					return nil, fmt.Errorf("transaction %d: %v", len(rows)+1, err)
+				}
+				row.Amount, row.CType = signed(a)
+			}
+			if row.Amount != 0 {
+				rows = append(rows, *row)
+			}
+			row = nil
+		}
+		if row == nil {
+			continue
+		}
+
+		var err error
+		switch tag {
+		case "DTPOSTED":
+			row.Date, err = ofxDate(value)
+		case "TRNAMT":
+			amount = value
+		case "CURSYM": // of the CURRENCY or ORIGCURRENCY of the transaction
+			row.Currency = strings.ToUpper(value)
+		case "NAME", "PAYEE":
+			name = value
+		case "MEMO":
+			memo = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", len(rows)+1, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errNoTransactions
+	}
+	return rows, nil
+}
+
+// scanTags splits OFX into elements, each a tag with the text which follows it up to the next tag
+func scanTags(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) && data[start] != '<' {
+		start++
+	}
+	if start == len(data) {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return start, nil, nil
+	}
+	for i := start + 1; i < len(data); i++ {
+		if data[i] == '<' {
+			return i, data[start:i], nil
+		}
+	}
+	if atEOF {
+		return len(data), data[start:], nil
+	}
+	return start, nil, nil
+}
+
+// ofxElement returns the name of the tag of an element, such as "TRNAMT" or "/STMTTRN", and its text
+func ofxElement(element string) (tag, value string) {
+	end := strings.IndexByte(element, '>')
+	if end < 0 {
+		return "", ""
+	}
+	tag = strings.ToUpper(strings.TrimSpace(element[1:end]))
+	if i := strings.IndexAny(tag, " \t\r\n"); i >= 0 {
+		tag = tag[:i]
+	}
+	value = strings.TrimSpace(element[end+1:])
+	value = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">").Replace(value)
+	return tag, value
+}
+
+// ofxDate reads an OFX date, such as 20240131, 20240131120000 or 20240131120000.000[-5:EST].
+// The time zone is ignored and the day is kept.
+func ofxDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
+
+// Categorize sets the category of the rows without one by the first rule, in order, which matches them
+func Categorize(rows []ImportRow, rules []ImportRule) {
+	for i := range rows {
+		if rows[i].Category != "" {
+			continue
+		}
+		description := strings.ToLower(rows[i].Description)
+		for _, rule := range rules {
+			if rule.CType == rows[i].CType && strings.Contains(description, strings.ToLower(rule.Pattern)) {
+				rows[i].Category = rule.Category
+				break
+			}
+		}
+	}
+}
+
+// MarkDuplicates marks the rows which are already in the history: an entry of the same day, in the time zone
+// of the row, amount, currency and type. An entry is the duplicate of one row only, so that repeated transactions are kept.
+// The rows which are not duplicates are accepted.
+func MarkDuplicates(rows []ImportRow, history []HistoryShow) {
+	matched := make([]bool, len(history))
+	for i := range rows {
+		rows[i].Duplicate = false
+		day := rows[i].Date.Format(DefaultDateLayout)
+		for j, h := range history {
+			if !matched[j] && h.Amount == rows[i].Amount && h.Currency == rows[i].Currency &&
+				h.CategoryType == rows[i].CType && h.Date.In(rows[i].Date.Location()).Format(DefaultDateLayout) == day {
+				matched[j], rows[i].Duplicate = true, true
+				break
+			}
+		}
+		rows[i].Accept = !rows[i].Duplicate
+	}
+}
+
+// StatementPeriod returns the period of the days of the rows, in their time zone
+func StatementPeriod(rows []ImportRow) Period {
+	var period Period
+	for _, row := range rows {
+		day := time.Date(row.Date.Year(), row.Date.Month(), row.Date.Day(), 0, 0, 0, 0, row.Date.Location())
+		if period.From.IsZero() || day.Before(period.From) {
+			period.From = day
+		}
+		if next := day.AddDate(0, 0, 1); next.After(period.To) {
+			period.To = next
+		}
+	}
+	return period
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSV(t *testing.T) {
+	date := func(day int) time.Time {
+		return time.Date(2024, time.March, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	statement := `Date,Details,Amount
+2024-03-01,Salary,"1,500.00"
+2024-03-02,LIDL SOFIA,-12.49
+2024-03-03,Balance,0
+`
+	rows, err := ParseCSV(strings.NewReader(statement), ImportMapping{Date: "date", Amount: "Amount", Description: "details"}, "BGN")
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportRow{
+		{Date: date(1), Amount: 1500 * Unit, CType: IncomeType, Currency: "BGN", Description: "Salary"},
+		{Date: date(2), Amount: 1249, CType: ExpenseType, Currency: "BGN", Description: "LIDL SOFIA"},
+	}, rows)
+
+	// Separate debit and credit columns, numbered, without a header
+	statement = "02.03.2024;12,49;;EUR;LIDL\n05.03.2024;;1 000,50;EUR;Refund\n"
+	m := ImportMapping{Date: "1", Debit: "2", Credit: "3", Currency: "4", Description: "5",
+		DateLayout: "02.01.2006", Comma: ";", NoHeader: true}
+	rows, err = ParseCSV(strings.NewReader(statement), m, "BGN")
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportRow{
+		{Date: date(2), Amount: 1249, CType: ExpenseType, Currency: "EUR", Description: "LIDL"},
+		{Date: date(5), Amount: 100050, CType: IncomeType, Currency: "EUR", Description: "Refund"},
+	}, rows)
+
+	_, err = ParseCSV(strings.NewReader(statement), ImportMapping{Date: "date", Amount: "amount"}, "BGN")
+	assert.EqualError(t, err, "there is no column date")
+
+	_, err = ParseCSV(strings.NewReader("date,amount\n2024-03-01,12.499\n"), ImportMapping{Date: "date", Amount: "amount"}, "BGN")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+
+	_, err = ParseCSV(strings.NewReader("date,amount\n03/01/2024,12\n"), ImportMapping{Date: "date", Amount: "amount"}, "BGN")
+	assert.EqualError(t, err, `line 2: invalid date "03/01/2024"`)
+}
+
+func TestParseOFX(t *testing.T) {
+	sgml := `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>EUR
+<BANKTRANLIST>
+<DTSTART>20240301
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240302120000.000[-5:EST]
+<TRNAMT>-12.49
+<FITID>1
+<NAME>LIDL
+<MEMO>Groceries &amp; more
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240305
+<TRNAMT>100.00
+<FITID>2
+<NAME>Refund
+<CURRENCY><CURRATE>1.95583<CURSYM>BGN</CURRENCY>
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+	rows, err := ParseOFX(strings.NewReader(sgml), "BGN")
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportRow{
+		{Date: time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC), Amount: 1249, CType: ExpenseType,
+			Currency: "EUR", Description: "LIDL Groceries & more"},
+		{Date: time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC), Amount: 100 * Unit, CType: IncomeType,
+			Currency: "BGN", Description: "Refund"},
+	}, rows)
+
+	xml := `<?xml version="1.0"?><OFX><BANKTRANLIST><STMTTRN><DTPOSTED>20240302</DTPOSTED>` +
+		`<TRNAMT>-5</TRNAMT><NAME>Bakery</NAME><MEMO>Bakery</MEMO></STMTTRN></BANKTRANLIST></OFX>`
+	rows, err = ParseOFX(strings.NewReader(xml), "BGN")
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportRow{{Date: time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC), Amount: 5 * Unit,
+		CType: ExpenseType, Currency: "BGN", Description: "Bakery"}}, rows)
+
+	_, err = ParseOFX(strings.NewReader("date,amount\n"), "BGN")
+	assert.Equal(t, errNoTransactions, err)
+	_, err = ParseOFX(strings.NewReader("<BANKTRANLIST><STMTTRN><DTPOSTED>2024<TRNAMT>1</STMTTRN>"), "BGN")
+	assert.EqualError(t, err, `transaction 1: invalid date "2024"`)
+}
+
+func TestCategorize(t *testing.T) {
+	rows := []ImportRow{
+		{CType: ExpenseType, Description: "LIDL SOFIA"},
+		{CType: IncomeType, Description: "Refund LIDL"},
+		{CType: ExpenseType, Description: "Shell"},
+		{CType: ExpenseType, Description: "Lidl", Category: "home"},
+	}
+	Categorize(rows, []ImportRule{
+		{Pattern: "lidl", Category: "food", CType: ExpenseType},
+		{Pattern: "shell", Category: "car", CType: ExpenseType},
+		{Pattern: "s", Category: "home", CType: ExpenseType},
+	})
+	assert.Equal(t, "food", rows[0].Category)
+	assert.Equal(t, "", rows[1].Category, "the rules are of expense categories")
+	assert.Equal(t, "car", rows[2].Category, "the first rule which matches")
+	assert.Equal(t, "home", rows[3].Category, "chosen in the preview")
+}
+
+func TestMarkDuplicates(t *testing.T) {
+	day := time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC)
+	coffee := ImportRow{Date: day, Amount: 250, CType: ExpenseType, Currency: "BGN"}
+	rows := []ImportRow{coffee, coffee, {Date: day, Amount: 250, CType: IncomeType, Currency: "BGN"}}
+
+	MarkDuplicates(rows, []HistoryShow{
+		{Amount: 250, Currency: "BGN", CategoryType: ExpenseType, Date: day.Add(9 * time.Hour)},
+		{Amount: 250, Currency: "EUR", CategoryType: ExpenseType, Date: day},
+	})
+	assert.True(t, rows[0].Duplicate)
+	assert.False(t, rows[0].Accept)
+	assert.False(t, rows[1].Duplicate, "the entry is the duplicate of one coffee only")
+	assert.True(t, rows[1].Accept)
+	assert.False(t, rows[2].Duplicate)
+
+	period := StatementPeriod([]ImportRow{{Date: day}, {Date: day.AddDate(0, 0, -3)}})
+	assert.Equal(t, Period{From: day.AddDate(0, 0, -3), To: day.AddDate(0, 0, 1)}, period)
+}
@@ -1,10 +1,30 @@
 package model
 
+import (
+	"math"
+	"time"
+)
+
 type Pay struct {
-	UserID       int    `json:"userID" validate:"numeric,gte=0"` // TODO is needed?
-	Amount       int    `json:"amount" validate:"numeric,gte=0"`
-	CategoryName string `json:"categoryName" validate:"required,min=3,max=32"`
-	Description  string `json:"description,omitempty"`
+	UserID       int       `json:"userID" validate:"numeric,gte=0"` // TODO is needed?
+	Amount       Amount    `json:"amount" validate:"numeric,gt=0"`
+	Currency     string    `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"` // the base currency of the user if not set
+	Account      string    `json:"account,omitempty" validate:"omitempty,max=32"`           // DefaultAccount if not set
+	CategoryName string    `json:"categoryName" validate:"required,min=3,max=32"`
+	Description  string    `json:"description,omitempty"`
+	Date         time.Time `json:"date"`
+}
+
+// LoanRequest is a loan or a split with a friend, received by the API
+type LoanRequest struct {
+	Friend       string    `json:"friend" validate:"required,min=3,max=32"`
+	Amount       Amount    `json:"amount" validate:"numeric,gt=0"`
+	Currency     string    `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"` // the base currency of the user if not set
+	Account      string    `json:"account,omitempty" validate:"omitempty,max=32"`           // DefaultAccount if not set
+	CategoryName string    `json:"categoryName,omitempty"`                                  // expense category of a split
+	Description  string    `json:"description,omitempty"`
+	Date         time.Time `json:"date"`
+	Terms                  // of a loan; splits have none
 }
 
 type TransferLoan struct {
@@ -15,19 +35,62 @@ type TransferLoan struct {
 
 type TransferSplit struct {
 	Expense Category
+	// The shared category of the expense, in which the debtor records their share when repaying it
+	DebtCategoryName string
 	Transfer
 }
 
 type Transfer struct {
-	CreditorID     int `json:"debtorID" validate:"numeric,gte=0"`
-	LoanCategoryID int `json:"loanCategoryID" validate:"numeric,gte=0"`
+	CreditorID     int       `json:"debtorID" validate:"numeric,gte=0"`
+	Account        string    `json:"account"` // of the creditor; the debtor receives in DefaultAccount
+	LoanCategoryID int       `json:"loanCategoryID" validate:"numeric,gte=0"`
+	Date           time.Time `json:"date"`
 	Loan
 }
 
+// Terms are the due date and the interest agreed for a loan
+type Terms struct {
+	DueDate      time.Time `json:"dueDate"`                               // zero if the loan has no due date
+	InterestRate float64   `json:"interestRate" validate:"gte=0,lte=100"` // simple interest, in percent per year
+}
+
+// Accrue returns the simple interest on the amount for the whole days from since until now
+func (t Terms) Accrue(amount Amount, since, now time.Time) Amount {
+	days := int64(now.Sub(since) / (24 * time.Hour))
+	if t.InterestRate <= 0 || days <= 0 {
+		return 0
+	}
+	return Amount(math.Round(float64(amount) * t.InterestRate / 100 * float64(days) / 365))
+}
+
+// PayInterestFirst applies a payment to the interest and then to the amount of a debt,
+// and returns what is left of both. The amount only shrinks once the interest is paid.
+func PayInterestFirst(amount, interest, paid Amount) (Amount, Amount) {
+	if paid <= interest {
+		return amount, interest - paid
+	}
+	return amount - (paid - interest), 0
+}
+
+// OverdueAt reports whether the due date has passed at now. The due date is a day,
+// so the loan is overdue from the next day on.
+func (t Terms) OverdueAt(now time.Time) bool {
+	return !t.DueDate.IsZero() && now.Format(DefaultDateLayout) > t.DueDate.Format(DefaultDateLayout)
+}
+
+// Accrued is the interest and the state of an active debt, computed when it is read
+type Accrued struct {
+	Interest Amount `json:"interest"` // not included in the amount
+	Overdue  bool   `json:"overdue"`
+}
+
 type Debt struct {
 	CreditorID  int    `json:"creditorID" validate:"numeric,gte=0"`
-	Amount      int    `json:"amount" validate:"numeric,gte=0"`
+	Amount      Amount `json:"amount" validate:"numeric,gte=0"`
+	Currency    string `json:"currency"`
 	Description string `json:"description,omitempty"`
+	Terms
+	Accrued
 }
 
 type DebtExt struct {
@@ -38,8 +101,11 @@ type DebtExt struct {
 
 type Loan struct {
 	DebtorID    int    `json:"debtorID" validate:"numeric,gte=0"`
-	Amount      int    `json:"amount" validate:"numeric,gte=0"`
+	Amount      Amount `json:"amount" validate:"numeric,gte=0"`
+	Currency    string `json:"currency"` // DefaultCurrency if not set
 	Description string `json:"description,omitempty"`
+	Terms
+	Accrued
 }
 
 type LoanExt struct {
@@ -47,14 +113,44 @@ type LoanExt struct {
 	Loan
 }
 
+// Proposal is a loan or a split which awaits the consent of the debtor. Only the own share of
+// the payer of a split is spent before it.
+type Proposal struct {
+	StatusID    int       `json:"statusID" validate:"numeric,gte=0"`
+	CreditorID  int       `json:"creditorID" validate:"numeric,gte=0"`
+	DebtorID    int       `json:"debtorID" validate:"numeric,gte=0"`
+	Amount      Amount    `json:"amount" validate:"numeric,gte=0"` // owed by the debtor once accepted
+	Total       Amount    `json:"total" validate:"numeric,gte=0"`  // paid by the creditor on acceptance
+	Currency    string    `json:"currency"`
+	Description string    `json:"description,omitempty"`
+	Split       bool      `json:"split"`
+	Date        time.Time `json:"date"` // of the loan or the expense
+	Terms
+}
+
+// Consent is the acceptance of a proposed loan or split by the debtor
+type Consent struct {
+	StatusID       int       `json:"statusID" validate:"numeric,gte=0"`
+	LoanCategoryID int       `json:"loanCategoryID" validate:"numeric,gte=0"` // in which the creditor records the loan
+	DebtCategoryID int       `json:"debtCategoryID" validate:"numeric,gte=0"` // in which the debtor records a received loan
+	Account        string    `json:"account"`                                 // of the debtor, which receives a loan
+	Date           time.Time `json:"date"`                                    // of the acceptance, from which the interest accrues
+}
+
 type Give struct {
 	CategoryName string `json:"categoryName" validate:"required,min=3,max=32"`
 	Loan
 }
 
 type RepayRequest struct {
-	DebtID int `json:"debtID" validate:"numeric,gte=0"`
-	Amount int `json:"amount" validate:"numeric,gte=0"`
+	DebtID  int    `json:"debtID" validate:"numeric,gte=0"`
+	Amount  Amount `json:"amount" validate:"numeric,gte=0"`
+	Account string `json:"account,omitempty" validate:"omitempty,max=32"` // which pays, DefaultAccount if not set
+}
+
+// AcceptRequest is the optional body of the acceptance of a loan or of a repayment
+type AcceptRequest struct {
+	Account string `json:"account,omitempty" validate:"omitempty,max=32"` // which receives, DefaultAccount if not set
 }
 
 type Split struct {
@@ -63,49 +159,101 @@ type Split struct {
 }
 
 type History struct {
-	UserID      int    `json:"userID" validate:"numeric,gte=0"`
-	Amount      int    `json:"amount" validate:"numeric,gte=0"`
-	CategoryID  int    `json:"categoryID" validate:"numeric,gte=0"`
-	Description string `json:"description,omitempty"`
+	ID          int       `json:"id" validate:"numeric,gte=0"`
+	UserID      int       `json:"userID" validate:"numeric,gte=0"`
+	Amount      Amount    `json:"amount" validate:"numeric,gte=0"`
+	Currency    string    `json:"currency"` // DefaultCurrency if not set; the currency of an entry is not edited
+	Account     string    `json:"account"`  // DefaultAccount if not set; the account of an entry is not edited
+	CategoryID  int       `json:"categoryID" validate:"numeric,gte=0"`
+	Description string    `json:"description,omitempty"`
+	Date        time.Time `json:"date"` // when the entry occurred; now if not set
+	RecurringID int       `json:"-"`    // the rule which recorded the entry, if any
+	Occurrence  int       `json:"-"`    // the occurrence of the rule
+}
+
+// Period bounds the history and statistics queries.
+// From is inclusive, To is exclusive. A zero value leaves that side open.
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
 }
 
 type HistoryAndStatistics struct {
 	HistoryShowAll
-	Expense Statistics
-	Income Statistics
+	Expense Statistics `json:"expense"`
+	Income  Statistics `json:"income"`
+	Budgets []Budget   `json:"budgets"` // in their current periods
+	From    string     `json:"-"`
+	To      string     `json:"-"`
 }
 
-
 type HistoryShow struct {
-	Amount       int
-	CategoryName string
-	CategoryType string
-	Description  string
+	ID           int       `json:"id"`
+	Amount       Amount    `json:"amount"`
+	Currency     string    `json:"currency"`
+	Account      string    `json:"account"`
+	CategoryName string    `json:"categoryName"`
+	CategoryType string    `json:"categoryType"`
+	Description  string    `json:"description,omitempty"`
+	Date         time.Time `json:"date"`
+	Editable     bool      `json:"editable"`
 }
 
 type HistoryShowAll struct {
-	HistoryShowAll []HistoryShow
+	HistoryShowAll []HistoryShow `json:"history"`
 }
 
+// Statistics are the shares of the categories in the total of the period,
+// converted to the base currency of the user
 type Statistics struct {
-	Ratios []Ratio
+	Ratios []Ratio `json:"ratios"`
+	Totals []Money `json:"totals"` // per currency
+	Total  Money   `json:"total"`
 }
 
 type Ratio struct {
-	Percent      string
-	CategoryName string
+	Percent      string `json:"percent"`
+	CategoryName string `json:"categoryName"`
 }
 
 type Accept struct {
-	StatusID int      `json:"statusID" validate:"numeric,gte=0"`
-	RepayC   Category `json:"repayC"`
-	ExpenseC Category `json:"expenseC"`
+	StatusID int       `json:"statusID" validate:"numeric,gte=0"`
+	RepayC   Category  `json:"repayC"`
+	ExpenseC Category  `json:"expenseC"`
+	Account  string    `json:"account"` // of the creditor, which receives the repayment
+	Date     time.Time `json:"date"`
+}
+
+// Forgive is the forgiveness of a debt, or of a part of it, by the creditor
+type Forgive struct {
+	StatusID  int       `json:"statusID" validate:"numeric,gte=0"`
+	Amount    Amount    `json:"amount" validate:"numeric,gte=0"` // the whole debt with its interest if zero
+	ForgiveC  Category  `json:"forgiveC"`                        // in which the creditor records the forgiven amount
+	ForgivenC Category  `json:"forgivenC"`                       // in which the debtor records it
+	Date      time.Time `json:"date"`
+}
+
+// ForgiveRequest is a forgiveness received by the API
+type ForgiveRequest struct {
+	Amount Amount `json:"amount,omitempty" validate:"numeric,gte=0"` // the whole debt with its interest if not set
+}
+
+// Forgiveness notifies the debtor of an amount which the creditor forgave them, until the debtor dismisses it
+type Forgiveness struct {
+	ID          int       `json:"id" validate:"numeric,gte=0"`
+	CreditorID  int       `json:"creditorID" validate:"numeric,gte=0"`
+	DebtorID    int       `json:"debtorID" validate:"numeric,gte=0"`
+	Amount      Amount    `json:"amount" validate:"numeric,gte=0"`
+	Currency    string    `json:"currency"`
+	Description string    `json:"description,omitempty"`
+	Date        time.Time `json:"date"`
+	Closed      bool      `json:"closed"` // the whole debt was forgiven
 }
 
 type AcceptPayment struct {
 	CreditorID  int    `json:"creditorID" validate:"numeric,gte=0"`
 	DebtorID    int    `json:"debtorID" validate:"numeric,gte=0"`
-	DebtAmount  int    `json:"debtAmount" validate:"numeric,gte=0"`
+	DebtAmount  Amount `json:"debtAmount" validate:"numeric,gte=0"`
 	Description string `json:"description,omitempty"`
 	Status
 }
@@ -113,5 +261,5 @@ type AcceptPayment struct {
 type Status struct {
 	StatusID      int    `json:"statusID" validate:"numeric,gte=0"`
 	Status        string `json:"status"`
-	PendingAmount int    `json:"pendingAmount" validate:"numeric,gte=0"`
+	PendingAmount Amount `json:"pendingAmount" validate:"numeric,gte=0"`
 }
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTerms(t *testing.T) {
+	lent := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	terms := Terms{DueDate: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), InterestRate: 7.5}
+
+	assert.Equal(t, Amount(0), terms.Accrue(100*Unit, lent, lent.Add(23*time.Hour)), "less than a day")
+	assert.Equal(t, Amount(62), terms.Accrue(100*Unit, lent, lent.AddDate(0, 0, 30)), "7.5% of 100.00 for 30 days")
+	assert.Equal(t, Amount(750), terms.Accrue(100*Unit, lent, lent.AddDate(0, 0, 365)))
+	assert.Equal(t, Amount(0), Terms{}.Accrue(100*Unit, lent, lent.AddDate(1, 0, 0)), "no interest")
+
+	assert.False(t, terms.OverdueAt(time.Date(2024, time.March, 1, 23, 59, 0, 0, time.UTC)), "due on that day")
+	assert.True(t, terms.OverdueAt(time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, Terms{}.OverdueAt(lent.AddDate(10, 0, 0)), "no due date")
+}
+
+func TestPayInterestFirst(t *testing.T) {
+	amount, interest := PayInterestFirst(100, 10, 4)
+	assert.Equal(t, []Amount{100, 6}, []Amount{amount, interest}, "only a part of the interest is paid")
+	amount, interest = PayInterestFirst(100, 10, 10)
+	assert.Equal(t, []Amount{100, 0}, []Amount{amount, interest})
+	amount, interest = PayInterestFirst(100, 10, 30)
+	assert.Equal(t, []Amount{80, 0}, []Amount{amount, interest})
+}
@@ -0,0 +1,91 @@
+package model
+
+import "time"
+
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Yearly  = "yearly"
+)
+
+// Recurring is a rule which records a payment or an income periodically.
+// The first occurrence is at StartsAt. The rule ends at EndsAt or after Count occurrences,
+// whichever comes first, or never if neither is set.
+type Recurring struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"-"`
+	Amount       Amount     `json:"amount"`
+	Currency     string     `json:"currency"`
+	Account      string     `json:"account"`
+	CategoryID   int        `json:"-"`
+	CategoryName string     `json:"categoryName"`
+	CategoryType string     `json:"categoryType"` // ExpenseType is recorded as a payment, IncomeType as an income
+	Description  string     `json:"description,omitempty"`
+	Frequency    string     `json:"frequency"`
+	StartsAt     time.Time  `json:"startsAt"`
+	EndsAt       time.Time  `json:"endsAt"` // zero if the rule has no end date
+	Count        int        `json:"count"`  // 0 if the number of occurrences is not limited
+	Done         int        `json:"done"`   // the number of occurrences recorded or skipped so far
+	Paused       bool       `json:"paused"`
+	Next         *time.Time `json:"next,omitempty"` // the next occurrence; nil when the rule has ended
+}
+
+// RecurringRequest is a recurring rule received by the API
+type RecurringRequest struct {
+	Amount       Amount    `json:"amount" validate:"numeric,gt=0"`
+	Currency     string    `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"` // the base currency of the user if not set
+	Account      string    `json:"account,omitempty" validate:"omitempty,max=32"`           // DefaultAccount if not set
+	CategoryName string    `json:"categoryName" validate:"required,min=3,max=32"`
+	Description  string    `json:"description,omitempty"`
+	Frequency    string    `json:"frequency" validate:"oneof=daily weekly monthly yearly"`
+	StartsAt     time.Time `json:"startsAt"` // now if not set
+	EndsAt       time.Time `json:"endsAt"`
+	Count        int       `json:"count" validate:"numeric,gte=0"`
+}
+
+// Occurrence returns the date of the n-th occurrence, counting from 0.
+// Monthly and yearly occurrences keep the day of StartsAt, or the last day of shorter months.
+func (r *Recurring) Occurrence(n int) time.Time {
+	switch r.Frequency {
+	case Daily:
+		return r.StartsAt.AddDate(0, 0, n)
+	case Weekly:
+		return r.StartsAt.AddDate(0, 0, 7*n)
+	case Yearly:
+		return addMonths(r.StartsAt, 12*n)
+	default:
+		return addMonths(r.StartsAt, n)
+	}
+}
+
+// Ended reports whether the rule has no n-th occurrence
+func (r *Recurring) Ended(n int) bool {
+	if r.Count > 0 && n >= r.Count {
+		return true
+	}
+	return !r.EndsAt.IsZero() && r.Occurrence(n).After(r.EndsAt)
+}
+
+// Due reports whether the n-th occurrence should be recorded at now
+func (r *Recurring) Due(n int, now time.Time) bool {
+	return !r.Ended(n) && !r.Occurrence(n).After(now)
+}
+
+// Upcoming returns the number of the first occurrence after now
+func (r *Recurring) Upcoming(now time.Time) int {
+	n := r.Done
+	for !r.Ended(n) && !r.Occurrence(n).After(now) {
+		n++
+	}
+	return n
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := t.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
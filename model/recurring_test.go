@@ -0,0 +1,50 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecurring_Occurrence(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+	}
+
+	daily := Recurring{Frequency: Daily, StartsAt: start}
+	assert.Equal(t, date(2024, time.February, 1), daily.Occurrence(1))
+
+	weekly := Recurring{Frequency: Weekly, StartsAt: start}
+	assert.Equal(t, date(2024, time.February, 14), weekly.Occurrence(2))
+
+	// The end of the month is kept in shorter months
+	monthly := Recurring{Frequency: Monthly, StartsAt: start}
+	assert.Equal(t, date(2024, time.February, 29), monthly.Occurrence(1))
+	assert.Equal(t, date(2024, time.March, 31), monthly.Occurrence(2))
+	assert.Equal(t, date(2025, time.January, 31), monthly.Occurrence(12))
+
+	leap := Recurring{Frequency: Yearly, StartsAt: date(2024, time.February, 29)}
+	assert.Equal(t, date(2025, time.February, 28), leap.Occurrence(1))
+	assert.Equal(t, date(2028, time.February, 29), leap.Occurrence(4))
+}
+
+func TestRecurring_Due(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	open := Recurring{Frequency: Monthly, StartsAt: start}
+	assert.True(t, open.Due(3, now), "June 1")
+	assert.False(t, open.Due(4, now), "July 1 is not due yet")
+	assert.Equal(t, 4, open.Upcoming(now))
+
+	count := Recurring{Frequency: Monthly, StartsAt: start, Count: 2}
+	assert.True(t, count.Due(1, now))
+	assert.False(t, count.Due(2, now), "two occurrences only")
+	assert.True(t, count.Ended(2))
+
+	until := Recurring{Frequency: Monthly, StartsAt: start, EndsAt: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)}
+	assert.True(t, until.Due(2, now), "the end date is inclusive")
+	assert.False(t, until.Due(3, now))
+	assert.Equal(t, 3, until.Upcoming(now))
+}
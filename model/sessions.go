@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Session is a login of a user on one device.
+// It is referenced by the access tokens and renewed with the refresh token,
+// of which only a hash is stored.
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      int       `json:"userID"`
+	RefreshHash string    `json:"-"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Revoked     bool      `json:"revoked"`
+}
+
+func (s *Session) Active(now time.Time) bool {
+	return !s.Revoked && now.Before(s.ExpiresAt)
+}
+
+type Tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	Username     string `json:"username"`
+	ID           string `json:"id"`
+}
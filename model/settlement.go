@@ -0,0 +1,106 @@
+package model
+
+import "sort"
+
+// OpenDebt is a debt which is not repaid yet
+type OpenDebt struct {
+	StatusID   int
+	CreditorID int
+	DebtorID   int
+	Amount     Amount
+	Currency   string
+	Pending    bool // the debtor has requested to repay it
+}
+
+// DebtScope selects the debts of a group, or the debts outside of groups between the given users
+type DebtScope struct {
+	GroupID int
+	UserIDs []int
+	PartyID int // if set, only the debts of this user, whose friend circle is settled
+}
+
+// Settlement is a payment of a settlement plan
+type Settlement struct {
+	FromID   int    `json:"-"`
+	ToID     int    `json:"-"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// SettlementPlan replaces the open debts of a group or a friend circle with fewer payments
+// which leave everyone with the same net balance
+type SettlementPlan struct {
+	Name        string       `json:"name"`    // the group, or the user whose friends form the circle
+	Debts       int          `json:"debts"`   // the number of open debts which the plan replaces
+	Pending     bool         `json:"pending"` // a repayment is pending, so the plan cannot be applied
+	Settlements []Settlement `json:"settlements"`
+	Action      string       `json:"-"` // the path which applies the plan
+}
+
+// Simplify returns the payments which clear the net balances of the debts in every currency.
+// The largest debtor pays the largest creditor until all balances are zero, so there are fewer payments
+// than people with a balance in the currency. The result does not depend on the order of the debts.
+func Simplify(debts []OpenDebt) []Settlement {
+	net := map[string]map[int]Amount{}
+	for _, d := range debts {
+		if net[d.Currency] == nil {
+			net[d.Currency] = map[int]Amount{}
+		}
+		net[d.Currency][d.CreditorID] += d.Amount
+		net[d.Currency][d.DebtorID] -= d.Amount
+	}
+
+	currencies := make([]string, 0, len(net))
+	for currency := range net {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	settlements := []Settlement{}
+	for _, currency := range currencies {
+		type balance struct {
+			userID int
+			amount Amount
+		}
+		var creditors, debtors []balance
+		for userID, amount := range net[currency] {
+			if amount > 0 {
+				creditors = append(creditors, balance{userID, amount})
+			} else if amount < 0 {
+				debtors = append(debtors, balance{userID, -amount})
+			}
+		}
+		byAmount := func(b []balance) func(i, j int) bool {
+			return func(i, j int) bool {
+				if b[i].amount != b[j].amount {
+					return b[i].amount > b[j].amount
+				}
+				return b[i].userID < b[j].userID
+			}
+		}
+
+		for len(creditors) > 0 && len(debtors) > 0 {
+			sort.Slice(creditors, byAmount(creditors))
+			sort.Slice(debtors, byAmount(debtors))
+
+			amount := creditors[0].amount
+			if debtors[0].amount < amount {
+				amount = debtors[0].amount
+			}
+			settlements = append(settlements, Settlement{FromID: debtors[0].userID, ToID: creditors[0].userID,
+				Amount: amount, Currency: currency})
+
+			creditors[0].amount -= amount
+			debtors[0].amount -= amount
+			if creditors[0].amount == 0 {
+				creditors = creditors[1:]
+			}
+			if debtors[0].amount == 0 {
+				debtors = debtors[1:]
+			}
+		}
+	}
+	return settlements
+}
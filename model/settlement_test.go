@@ -0,0 +1,46 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	const peter, george, lily = 1, 2, 3
+
+	// A cycle cancels out
+	cycle := []OpenDebt{
+		{CreditorID: george, DebtorID: peter, Amount: 10, Currency: "BGN"},
+		{CreditorID: lily, DebtorID: george, Amount: 10, Currency: "BGN"},
+		{CreditorID: peter, DebtorID: lily, Amount: 10, Currency: "BGN"},
+	}
+	assert.Empty(t, Simplify(cycle))
+
+	// Peter settles his circle without the debt between George and Lily: Lily pays George instead of him
+	assert.Equal(t, []Settlement{{FromID: lily, ToID: george, Amount: 10, Currency: "BGN"}}, Simplify([]OpenDebt{cycle[0], cycle[2]}))
+
+	// Peter pays Lily instead of George
+	chain := []OpenDebt{
+		{CreditorID: george, DebtorID: peter, Amount: 10, Currency: "BGN"},
+		{CreditorID: lily, DebtorID: george, Amount: 10, Currency: "BGN"},
+		{CreditorID: lily, DebtorID: peter, Amount: 5, Currency: "EUR"},
+		{CreditorID: george, DebtorID: lily, Amount: 5, Currency: "EUR"},
+		{CreditorID: george, DebtorID: lily, Amount: 3, Currency: "EUR"},
+	}
+	assert.Equal(t, []Settlement{
+		{FromID: peter, ToID: lily, Amount: 10, Currency: "BGN"},
+		{FromID: peter, ToID: george, Amount: 5, Currency: "EUR"},
+		{FromID: lily, ToID: george, Amount: 3, Currency: "EUR"},
+	}, Simplify(chain))
+
+	// The largest debtor pays the largest creditor first
+	star := []OpenDebt{
+		{CreditorID: peter, DebtorID: george, Amount: 30, Currency: "BGN"},
+		{CreditorID: lily, DebtorID: george, Amount: 20, Currency: "BGN"},
+		{CreditorID: lily, DebtorID: peter, Amount: 10, Currency: "BGN"},
+	}
+	assert.Equal(t, []Settlement{
+		{FromID: george, ToID: lily, Amount: 30, Currency: "BGN"},
+		{FromID: george, ToID: peter, Amount: 20, Currency: "BGN"},
+	}, Simplify(star))
+}
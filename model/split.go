@@ -0,0 +1,107 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// The ways to divide a split expense between its participants
+const (
+	EqualSplit   = "equal"
+	ExactSplit   = "exact"
+	PercentSplit = "percent"
+	SharesSplit  = "shares"
+)
+
+// SplitParticipant is a user who shares an expense. Only the field of the split method is used.
+type SplitParticipant struct {
+	Username string  `json:"username" validate:"required,min=3,max=32"`
+	Amount   Amount  `json:"amount,omitempty" validate:"gte=0"`          // exact
+	Percent  float64 `json:"percent,omitempty" validate:"gte=0,lte=100"` // percent
+	Shares   int     `json:"shares,omitempty" validate:"gte=0"`          // shares
+}
+
+// SplitRequest is an expense paid by the user and shared with other participants, received by the API.
+// The user takes part only if listed as a participant.
+type SplitRequest struct {
+	Amount       Amount             `json:"amount" validate:"numeric,gt=0"`
+	Currency     string             `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"` // the base currency of the user if not set
+	Account      string             `json:"account,omitempty" validate:"omitempty,max=32"`           // DefaultAccount if not set
+	CategoryName string             `json:"categoryName" validate:"required,min=3,max=32"`
+	Description  string             `json:"description,omitempty"`
+	Date         time.Time          `json:"date"`
+	Method       string             `json:"method,omitempty" validate:"omitempty,oneof=equal exact percent shares"` // EqualSplit if not set
+	Participants []SplitParticipant `json:"participants" validate:"dive"`
+}
+
+// Allocate divides the amount in the currency between the participants by the method.
+// The shares add up to the amount. The minor units left over by percents and shares
+// go to the first participants, as with Amount.Split.
+func Allocate(method string, amount Amount, currency string, participants []SplitParticipant) ([]Amount, error) {
+	if len(participants) == 0 {
+		return nil, fmt.Errorf("there must be at least one participant")
+	}
+
+	weights := make([]int64, len(participants))
+	var total int64
+	switch method {
+	case EqualSplit, "":
+		return amount.Split(len(participants)), nil
+	case ExactSplit:
+		shares := make([]Amount, len(participants))
+		var sum Amount
+		for i, p := range participants {
+			shares[i] = p.Amount
+			sum += p.Amount
+		}
+		if sum != amount {
+			return nil, fmt.Errorf("the amounts add up to %s, not %s", sum.In(currency), amount.In(currency))
+		}
+		return shares, nil
+	case PercentSplit:
+		// In hundredths of a percent, so that 33.33 is exact
+		for i, p := range participants {
+			weights[i] = int64(math.Round(p.Percent * 100))
+			total += weights[i]
+		}
+		if total != 100*100 {
+			return nil, fmt.Errorf("the percents add up to %.2f, not 100", float64(total)/100)
+		}
+	case SharesSplit:
+		for i, p := range participants {
+			weights[i] = int64(p.Shares)
+			total += weights[i]
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("there must be at least one share")
+		}
+	default:
+		return nil, fmt.Errorf("unknown split method: %v", method)
+	}
+	return amount.Weigh(weights), nil
+}
+
+// Share is the part of a split expense which a debtor owes to the payer
+type Share struct {
+	DebtorID int
+	Amount   Amount
+}
+
+// SplitExpense is an expense which the payer paid for several participants.
+// The payer spends their own share and lends every debtor their share.
+type SplitExpense struct {
+	GroupID        int // zero outside of groups
+	PayerID        int
+	Account        string
+	LoanCategoryID int
+	Expense        Category
+	// The shared category of the expense, in which the debtors record their shares when repaying them
+	DebtCategoryName string
+	Amount           Amount
+	Currency         string
+	Description      string
+	Date             time.Time
+	Own              Amount // the share of the payer
+	Shares           []Share
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	three := []SplitParticipant{{Username: "a"}, {Username: "b"}, {Username: "c"}}
+	shares, err := Allocate("", 1000, "BGN", three)
+	assert.NoError(t, err)
+	assert.Equal(t, []Amount{334, 333, 333}, shares)
+
+	exact := []SplitParticipant{{Amount: 600}, {Amount: 250}, {Amount: 150}}
+	shares, err = Allocate(ExactSplit, 1000, "BGN", exact)
+	assert.NoError(t, err)
+	assert.Equal(t, []Amount{600, 250, 150}, shares)
+	_, err = Allocate(ExactSplit, 1001, "BGN", exact)
+	assert.EqualError(t, err, "the amounts add up to 10.00, not 10.01")
+
+	percent := []SplitParticipant{{Percent: 33.34}, {Percent: 33.33}, {Percent: 33.33}}
+	shares, err = Allocate(PercentSplit, 1000, "BGN", percent)
+	assert.NoError(t, err)
+	assert.Equal(t, []Amount{334, 333, 333}, shares)
+	_, err = Allocate(PercentSplit, 1000, "BGN", percent[1:])
+	assert.EqualError(t, err, "the percents add up to 66.66, not 100")
+
+	weighted := []SplitParticipant{{Shares: 1}, {Shares: 2}, {Shares: 0}}
+	shares, err = Allocate(SharesSplit, 1000, "BGN", weighted)
+	assert.NoError(t, err)
+	assert.Equal(t, []Amount{334, 666, 0}, shares)
+	_, err = Allocate(SharesSplit, 1000, "BGN", weighted[2:])
+	assert.Error(t, err)
+
+	_, err = Allocate(EqualSplit, 1000, "BGN", nil)
+	assert.Error(t, err)
+	_, err = Allocate("half", 1000, "BGN", three)
+	assert.Error(t, err)
+}
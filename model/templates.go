@@ -1,35 +1,107 @@
 package model
 
+import "time"
+
 type PayTemplate struct {
-	Balance    int
+	Username   string // the current user, who may take part in a split
+	Warning    string // the budget which the last payment exceeded
+	Balance    Balance
 	Categories []Category
 	Friends    []string
+	Currencies []string
+	Currency   string // the base currency of the user
+	Account    string // the account chosen by default
 }
 
 type DLTemplate struct {
-	StatusID    int
-	Amount      int
-	Description string
+	StatusID    int    `json:"statusID,omitempty"`
+	Amount      Amount `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description,omitempty"`
+	// The terms of an active loan and its interest accrued until now
+	DueDate      *time.Time `json:"dueDate,omitempty"`
+	InterestRate float64    `json:"interestRate,omitempty"`
+	Interest     Amount     `json:"interest,omitempty"`
+	Overdue      bool       `json:"overdue,omitempty"`
+	// The share of the debtor which the payer of a proposed split has paid
+	Total Amount `json:"total,omitempty"`
 }
 
 type DebtsTemplate struct {
-	Active  []DebtTemplate
-	Pending []DebtTemplate
-	Balance int
+	Active   []DebtTemplate     `json:"active"`
+	Pending  []DebtTemplate     `json:"pending"`
+	Proposed []DebtTemplate     `json:"proposed"` // the loans and splits which await the consent of the user
+	Forgiven []ForgivenTemplate `json:"forgiven"` // the notices of the debts which the creditors forgave
+	Balance  Balance            `json:"balance"`
+	Account  string             `json:"-"` // chosen in the forms to receive loans and to repay
+}
+
+type ForgivenTemplate struct {
+	ID          int       `json:"id"`
+	Creditor    string    `json:"creditor"`
+	Amount      Amount    `json:"amount"`
+	Currency    string    `json:"currency"`
+	Description string    `json:"description,omitempty"`
+	Date        time.Time `json:"date"`
+	Closed      bool      `json:"closed"` // the whole debt was forgiven
 }
 
 type DebtTemplate struct {
-	Creditor string
+	Creditor string `json:"creditor"`
 	DLTemplate
 }
 
 type LoansTemplate struct {
-	Active  []LoanTemplate
-	Pending []LoanTemplate
-	Balance int
+	Active   []LoanTemplate `json:"active"`
+	Pending  []LoanTemplate `json:"pending"`
+	Proposed []LoanTemplate `json:"proposed"` // the loans and splits which await the consent of the debtor
+	Balance  Balance        `json:"balance"`
+	Account  string         `json:"-"` // chosen in the forms to receive repayments
 }
 
 type LoanTemplate struct {
-	Debtor string
+	Debtor string `json:"debtor"`
 	DLTemplate
 }
+
+type GroupsTemplate struct {
+	Groups  []Group  `json:"groups"`
+	Invites []Group  `json:"invites"`
+	Friends []string `json:"-"` // the friends who can be invited to a new group
+}
+
+type GroupTemplate struct {
+	Group
+	UserID     int // the current user
+	Balance    Balance
+	Categories []Category
+	Friends    []string // the friends who are not in the group
+	Currencies []string
+	Currency   string // the base currency of the user
+	Account    string // the account chosen by default
+}
+
+type CategoriesTemplate struct {
+	Categories []Category // the shared categories and the ones of the user, with their subcategories
+	Parents    []Category // the categories which a new category can be nested under
+}
+
+type RecurringTemplate struct {
+	Rules      []Recurring
+	Balance    Balance
+	Categories []Category // the expense and income categories which a rule can record
+	Currencies []string
+	Currency   string // the base currency of the user
+	Account    string // the account chosen by default
+}
+
+type ImportTemplate struct {
+	Rules      []ImportRule
+	Statement  Statement  // the previewed statement
+	Expenses   []Category // the categories which a payment or a rule can be in
+	Incomes    []Category // the categories which an income or a rule can be in
+	Balance    Balance
+	Currencies []string
+	Currency   string // the base currency of the user
+	Account    string // the account chosen by default
+}
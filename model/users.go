@@ -6,6 +6,8 @@ type User struct {
 	ID       int    `json:"id" validate:"numeric,gte=0"`
 	Username string `json:"username" validate:"required,min=3,max=32"`
 	Password string `json:"password,omitempty"` //todo better password
+	// The base currency of the balance and statistics, DefaultCurrency if not set
+	Currency string `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"`
 }
 
 type UserToken struct {
@@ -24,6 +26,9 @@ type Users struct {
 }
 
 type UserWallet struct {
-	Username string
-	Balance  int
+	Username   string
+	Balance    Balance
+	Budgets    []Budget
+	Categories []Category // the expense categories which can have a budget
+	Currencies []string
 }
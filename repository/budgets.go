@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/hpmalinova/Money-Manager/model"
+	"time"
+)
+
+type BudgetRepoMysql struct {
+	db *sql.DB
+}
+
+func NewBudgetRepoMysql(db *sql.DB) *BudgetRepoMysql {
+	return &BudgetRepoMysql{db: db}
+}
+
+// Set creates the budget of the user for the category, or replaces it
+func (b *BudgetRepoMysql) Set(budget *model.Budget) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	var count int
+	statement := "SELECT COUNT(*) FROM budgets WHERE user_id = ? AND category_id = ?"
+	if err = tx.QueryRowContext(ctx, statement, budget.UserID, budget.CategoryID).Scan(&count); err != nil {
+		return err
+	}
+
+	currency := currencyOf(budget.Currency)
+	if count == 0 {
+		statement = "INSERT INTO budgets(user_id, category_id, amount, currency, period, blocking) VALUES(?, ?, ?, ?, ?, ?)"
+		_, err = tx.ExecContext(ctx, statement, budget.UserID, budget.CategoryID, budget.Amount, currency, budget.Period, budget.Block)
+	} else {
+		statement = "UPDATE budgets SET amount = ?, currency = ?, period = ?, blocking = ? WHERE user_id = ? AND category_id = ?"
+		_, err = tx.ExecContext(ctx, statement, budget.Amount, currency, budget.Period, budget.Block, budget.UserID, budget.CategoryID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Find returns the budgets of the user, sorted by category,
+// with their spending in the periods which contain the time at
+func (b *BudgetRepoMysql) Find(userID int, at time.Time) ([]model.Budget, error) {
+	statement := `SELECT b.category_id, c.name, b.amount, b.currency, b.period, b.blocking
+					FROM budgets AS b
+					INNER JOIN categories AS c
+						ON b.category_id = c.id
+					WHERE b.user_id = ?
+					ORDER BY c.name`
+	return b.find(userID, at, statement, userID)
+}
+
+// FindByCategory returns the budget of the user for the category,
+// with its spending in the period which contains the time at
+func (b *BudgetRepoMysql) FindByCategory(userID, categoryID int, at time.Time) (*model.Budget, error) {
+	statement := `SELECT b.category_id, c.name, b.amount, b.currency, b.period, b.blocking
+					FROM budgets AS b
+					INNER JOIN categories AS c
+						ON b.category_id = c.id
+					WHERE b.user_id = ? AND b.category_id = ?`
+	budgets, err := b.find(userID, at, statement, userID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &budgets[0], nil
+}
+
+func (b *BudgetRepoMysql) find(userID int, at time.Time, statement string, args ...interface{}) ([]model.Budget, error) {
+	rows, err := b.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []model.Budget{}
+	for rows.Next() {
+		budget := model.Budget{UserID: userID}
+		err := rows.Scan(&budget.CategoryID, &budget.CategoryName, &budget.Amount, &budget.Currency, &budget.Period, &budget.Block)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		return budgets, nil
+	}
+
+	rates, _, err := findRates(b.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range budgets {
+		if err := b.spend(&budgets[i], rates, at); err != nil {
+			return nil, err
+		}
+	}
+	return budgets, nil
+}
+
+// spend sums the entries of the category of the budget, and of its subcategories,
+// in its period which contains the time at
+func (b *BudgetRepoMysql) spend(budget *model.Budget, rates model.Rates, at time.Time) error {
+	budget.Current = model.BudgetPeriod(budget.Period, at)
+	condition, args := periodCondition(budget.Current)
+	args = append([]interface{}{budget.UserID, budget.CategoryID, budget.CategoryID}, args...)
+
+	statement := `SELECT m.currency, SUM(m.amount)
+					FROM money_history AS m
+					INNER JOIN categories AS c
+						ON m.category_id = c.id
+					WHERE m.uid = ? AND (c.id = ? OR c.parent_id = ?)` + condition + `
+					GROUP BY m.currency`
+	rows, err := b.db.Query(statement, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sums := []model.Money{}
+	for rows.Next() {
+		var sum model.Money
+		if err := rows.Scan(&sum.Currency, &sum.Amount); err != nil {
+			return err
+		}
+		sums = append(sums, sum)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return spentOf(budget, sums, rates)
+}
+
+// spentOf sets the spending of the budget to the sums, converted to the currency of the budget
+func spentOf(budget *model.Budget, sums []model.Money, rates model.Rates) error {
+	budget.Spent = 0
+	for _, sum := range sums {
+		amount, err := rates.Convert(sum.Amount, sum.Currency, budget.Currency)
+		if err != nil {
+			return err
+		}
+		budget.Spent += amount
+	}
+	return nil
+}
+
+// Delete deletes the budget of the user for the category
+func (b *BudgetRepoMysql) Delete(userID, categoryID int) error {
+	statement := "DELETE FROM budgets WHERE user_id = ? AND category_id = ?"
+	result, err := b.db.Exec(statement, userID, categoryID)
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
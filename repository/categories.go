@@ -1,10 +1,10 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/hpmalinova/Money-Manager/model"
-	"log"
+	"time"
 )
 
 type CategoryRepoMysql struct {
@@ -16,44 +16,73 @@ const (
 	income  = "income"
 )
 
-func NewCategoryRepoMysql(user, password, dbname string) *CategoryRepoMysql {
-	connectionString := fmt.Sprintf("%s:%s@/%s", user, password, dbname)
-	repo := &CategoryRepoMysql{}
-	var err error
-	repo.db, err = sql.Open("mysql", connectionString)
-	if err != nil {
-		log.Fatal(err)
-	}
+const categoryColumns = "id, c_type, name, user_id, parent_id, archived"
+
+// visibleTo is the condition on the categories which the user sees: the shared ones and their own
+const visibleTo = "(user_id IS NULL OR user_id = ?)"
 
-	return repo
+func NewCategoryRepoMysql(db *sql.DB) *CategoryRepoMysql {
+	return &CategoryRepoMysql{db: db}
 }
 
 func (c *CategoryRepoMysql) Close() {
 	_ = c.db.Close()
 }
 
-func (c *CategoryRepoMysql) FindByName(categoryName string) (*model.Category, error) {
-	category := &model.Category{}
-	statement := `SELECT id, c_type, name FROM categories WHERE name = ?`
-	err := c.db.QueryRow(statement, categoryName).Scan(&category.ID, &category.CType, &category.Name)
+// FindByID returns the category, shared or of the user, with the given ID
+func (c *CategoryRepoMysql) FindByID(userID, id int) (*model.Category, error) {
+	statement := `SELECT ` + categoryColumns + ` FROM categories WHERE id = ? AND ` + visibleTo
+	return c.findOne(statement, id, userID)
+}
+
+// FindByName returns the category, shared or of the user, with the given name
+func (c *CategoryRepoMysql) FindByName(userID int, categoryName string) (*model.Category, error) {
+	statement := `SELECT ` + categoryColumns + ` FROM categories WHERE name = ? AND ` + visibleTo
+	return c.findOne(statement, categoryName, userID)
+}
+
+func (c *CategoryRepoMysql) findOne(statement string, args ...interface{}) (*model.Category, error) {
+	categories, err := c.find(statement, args...)
 	if err != nil {
 		return nil, err
 	}
-	return category, nil
+	if len(categories) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &categories[0], nil
+}
+
+// FindExpenses returns the tree of the expense categories which the user sees, without the archived ones
+func (c *CategoryRepoMysql) FindExpenses(userID int) ([]model.Category, error) {
+	return c.findByType(userID, expense)
 }
 
-func (c *CategoryRepoMysql) FindExpenses() ([]model.Category, error) {
-	statement := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
-	return c.findByType(statement, expense)
+// FindIncomes returns the tree of the income categories which the user sees, without the archived ones
+func (c *CategoryRepoMysql) FindIncomes(userID int) ([]model.Category, error) {
+	return c.findByType(userID, income)
 }
 
-func (c *CategoryRepoMysql) FindIncomes() ([]model.Category, error) {
-	statement := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
-	return c.findByType(statement, income)
+func (c *CategoryRepoMysql) findByType(userID int, cType string) ([]model.Category, error) {
+	statement := `SELECT ` + categoryColumns + ` FROM categories WHERE c_type = ? AND archived = ? AND ` + visibleTo + ` ORDER BY id`
+	categories, err := c.find(statement, cType, false, userID)
+	if err != nil {
+		return nil, err
+	}
+	return model.CategoryTree(categories), nil
+}
+
+// FindAll returns the tree of all categories which the user sees, the archived ones included
+func (c *CategoryRepoMysql) FindAll(userID int) ([]model.Category, error) {
+	statement := `SELECT ` + categoryColumns + ` FROM categories WHERE ` + visibleTo + ` ORDER BY id`
+	categories, err := c.find(statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	return model.CategoryTree(categories), nil
 }
 
-func (c *CategoryRepoMysql) findByType(statement string, cType string) ([]model.Category, error) {
-	rows, err := c.db.Query(statement, cType)
+func (c *CategoryRepoMysql) find(statement string, args ...interface{}) ([]model.Category, error) {
+	rows, err := c.db.Query(statement, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -62,10 +91,12 @@ func (c *CategoryRepoMysql) findByType(statement string, cType string) ([]model.
 	categories := []model.Category{}
 	for rows.Next() {
 		var category model.Category
-		err := rows.Scan(&category.ID, &category.CType, &category.Name)
+		var userID, parentID sql.NullInt64
+		err := rows.Scan(&category.ID, &category.CType, &category.Name, &userID, &parentID, &category.Archived)
 		if err != nil {
 			return nil, err
 		}
+		category.UserID, category.ParentID = int(userID.Int64), int(parentID.Int64)
 		categories = append(categories, category)
 	}
 	_ = rows.Close()
@@ -75,27 +106,123 @@ func (c *CategoryRepoMysql) findByType(statement string, cType string) ([]model.
 	return categories, nil
 }
 
-func (c *CategoryRepoMysql) FindAll() ([]model.Category, error) {
-	statement := `SELECT id, c_type, name FROM categories`
+// Create stores a category of the user. Its name must differ from the names of the categories which the user sees.
+// The caller checks that the parent is a top level category of the same type.
+func (c *CategoryRepoMysql) Create(category *model.Category) (*model.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
 
-	rows, err := c.db.Query(statement)
+	conn, err := c.db.Conn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer conn.Close()
 
-	categories := []model.Category{}
-	for rows.Next() {
-		var category model.Category
-		err := rows.Scan(&category.ID, &category.CType, &category.Name)
-		if err != nil {
-			return nil, err
-		}
-		categories = append(categories, category)
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
 	}
-	_ = rows.Close()
-	if err = rows.Err(); err != nil {
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	if err := checkCategoryName(ctx, tx, category.UserID, 0, category.Name); err != nil {
 		return nil, err
 	}
-	return categories, nil
+
+	parentID := sql.NullInt64{Int64: int64(category.ParentID), Valid: category.ParentID != 0}
+	statement := "INSERT INTO categories(c_type, name, user_id, parent_id) VALUES(?, ?, ?, ?)"
+	result, err := tx.ExecContext(ctx, statement, category.CType, category.Name, category.UserID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	created := *category
+	created.ID, created.Archived, created.Children = int(id), false, nil
+	return &created, nil
+}
+
+// Rename renames a category of the user. The new name must differ from the names of the other categories which the user sees.
+func (c *CategoryRepoMysql) Rename(userID, id int, name string) error {
+	return c.change(userID, id, func(ctx context.Context, tx *sql.Tx) error {
+		if err := checkCategoryName(ctx, tx, userID, id, name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE categories SET name = ? WHERE id = ?", name, id)
+		return err
+	})
+}
+
+// Archive hides a category of the user, and its subcategories, from the lists of categories or shows it again.
+// The entries in an archived category are kept.
+func (c *CategoryRepoMysql) Archive(userID, id int, archived bool) error {
+	return c.change(userID, id, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE categories SET archived = ? WHERE id = ?", archived, id)
+		return err
+	})
+}
+
+// change applies a change to a category of the user in a transaction.
+// It fails with sql.ErrNoRows if the user does not see the category, and with a BadRequestError if the category is shared.
+func (c *CategoryRepoMysql) change(userID, id int, change func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	var owner sql.NullInt64
+	statement := "SELECT user_id FROM categories WHERE id = ? AND " + visibleTo
+	if err := tx.QueryRowContext(ctx, statement, id, userID).Scan(&owner); err != nil {
+		return err
+	}
+	if !owner.Valid {
+		return badRequest("the shared categories cannot be changed")
+	}
+
+	if err := change(ctx, tx); err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkCategoryName fails with a BadRequestError if a category, other than the one with the given ID,
+// which the user sees already has the name
+func checkCategoryName(ctx context.Context, tx *sql.Tx, userID, id int, name string) error {
+	var count int
+	statement := "SELECT COUNT(*) FROM categories WHERE name = ? AND id <> ? AND " + visibleTo
+	if err := tx.QueryRowContext(ctx, statement, name, id, userID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return badRequest("there is already a category %s", name)
+	}
+	return nil
 }
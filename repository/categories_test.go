@@ -9,6 +9,9 @@ import (
 
 )
 
+// userID sees the shared categories and their own
+const userID = 1
+
 func NewMock() (*sql.DB, sqlmock.Sqlmock) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -26,15 +29,15 @@ func TestCategoryRepoMysql_FindByName(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := "SELECT id, c_type, name FROM categories WHERE name = ?"
+		query := "SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE name = ?"
 
 		categoryName := "food"
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"}).
-			AddRow(1, "expense", categoryName)
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"}).
+			AddRow(1, "expense", categoryName, nil, nil, false)
 
-		mock.ExpectQuery(query).WithArgs(categoryName).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(categoryName, userID).WillReturnRows(rows)
 
-		category, err := repo.FindByName(categoryName)
+		category, err := repo.FindByName(userID, categoryName)
 		assert.NotNil(t, category)
 		assert.NoError(t, err)
 	})
@@ -45,14 +48,14 @@ func TestCategoryRepoMysql_FindByName(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := "SELECT id, c_type, name FROM categories WHERE name = ?"
+		query := "SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE name = ?"
 
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"})
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"})
 
 		categoryName := "food"
-		mock.ExpectQuery(query).WithArgs(categoryName).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(categoryName, userID).WillReturnRows(rows)
 
-		category, err := repo.FindByName(categoryName)
+		category, err := repo.FindByName(userID, categoryName)
 		assert.Empty(t, category)
 		assert.Error(t, err)
 	})
@@ -66,15 +69,15 @@ func TestCategoryRepoMysql_FindIncomes(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE c_type = ?`
 
 		cType := "income"
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"}).
-			AddRow(1, "income", "salary").AddRow(2,"income", "savings")
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"}).
+			AddRow(1, "income", "salary", nil, nil, false).AddRow(2,"income", "savings", nil, nil, false)
 
-		mock.ExpectQuery(query).WithArgs(cType).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(cType, false, userID).WillReturnRows(rows)
 
-		incomes, err := repo.FindIncomes()
+		incomes, err := repo.FindIncomes(userID)
 		assert.NotNil(t, incomes)
 		assert.NoError(t, err)
 	})
@@ -85,14 +88,14 @@ func TestCategoryRepoMysql_FindIncomes(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE c_type = ?`
 
 		cType := "income"
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"})
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"})
 
-		mock.ExpectQuery(query).WithArgs(cType).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(cType, false, userID).WillReturnRows(rows)
 
-		categories, _ := repo.FindIncomes()
+		categories, _ := repo.FindIncomes(userID)
 		assert.Empty(t, categories)
 	})
 	t.Run("no income categories", func(t *testing.T) {
@@ -102,14 +105,14 @@ func TestCategoryRepoMysql_FindIncomes(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE c_type = ?`
 
 		cType := "income"
 		rows := sqlmock.NewRows([]string{"id", "name", "email", "phone"})
 
-		mock.ExpectQuery(query).WithArgs(cType).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(cType, false, userID).WillReturnRows(rows)
 
-		categories, _ := repo.FindIncomes()
+		categories, _ := repo.FindIncomes(userID)
 		assert.Empty(t, categories)
 	})
 }
@@ -123,14 +126,14 @@ func TestCategoryRepoMysql_FindExpenses(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE c_type = ?`
 
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"}).
-			AddRow(1, "expense", "food").AddRow(2,"expense", "home")
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"}).
+			AddRow(1, "expense", "food", nil, nil, false).AddRow(2,"expense", "home", nil, nil, false)
 
-		mock.ExpectQuery(query).WithArgs(cType).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(cType, false, userID).WillReturnRows(rows)
 
-		incomes, err := repo.FindExpenses()
+		incomes, err := repo.FindExpenses(userID)
 		assert.NotNil(t, incomes)
 		assert.NoError(t, err)
 	})
@@ -141,13 +144,13 @@ func TestCategoryRepoMysql_FindExpenses(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE c_type = ?`
 
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"})
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"})
 
-		mock.ExpectQuery(query).WithArgs(cType).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(cType, false, userID).WillReturnRows(rows)
 
-		categories, _ := repo.FindExpenses()
+		categories, _ := repo.FindExpenses(userID)
 		assert.Empty(t, categories)
 	})
 	t.Run("no expense categories", func(t *testing.T) {
@@ -157,13 +160,13 @@ func TestCategoryRepoMysql_FindExpenses(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories WHERE c_type = ?`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories WHERE c_type = ?`
 
 		rows := sqlmock.NewRows([]string{"id", "name", "email", "phone"})
 
-		mock.ExpectQuery(query).WithArgs(cType).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(cType, false, userID).WillReturnRows(rows)
 
-		categories, _ := repo.FindExpenses()
+		categories, _ := repo.FindExpenses(userID)
 		assert.Empty(t, categories)
 	})
 }
@@ -176,14 +179,14 @@ func TestCategoryRepoMysql_FindAll(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories`
 
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"}).
-			AddRow(1, "income", "salary").AddRow(2,"expense", "food")
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"}).
+			AddRow(1, "income", "salary", nil, nil, false).AddRow(2,"expense", "food", 1, 1, true)
 
-		mock.ExpectQuery(query).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(userID).WillReturnRows(rows)
 
-		incomes, err := repo.FindAll()
+		incomes, err := repo.FindAll(userID)
 		assert.NotNil(t, incomes)
 		assert.NoError(t, err)
 	})
@@ -194,13 +197,13 @@ func TestCategoryRepoMysql_FindAll(t *testing.T) {
 			repo.Close()
 		}()
 
-		query := `SELECT id, c_type, name FROM categories`
+		query := `SELECT id, c_type, name, user_id, parent_id, archived FROM categories`
 
-		rows := sqlmock.NewRows([]string{"id", "c_type","name"})
+		rows := sqlmock.NewRows([]string{"id", "c_type","name", "user_id", "parent_id", "archived"})
 
-		mock.ExpectQuery(query).WillReturnRows(rows)
+		mock.ExpectQuery(query).WithArgs(userID).WillReturnRows(rows)
 
-		categories, _ := repo.FindAll()
+		categories, _ := repo.FindAll(userID)
 		assert.Empty(t, categories)
 	})
 }
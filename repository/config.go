@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The supported databases. They are also the dialects of the migrations.
+// Memory keeps the data in memory, without a database (see MemoryStore).
+const (
+	MySQL  = "mysql"
+	SQLite = "sqlite"
+	Memory = "memory"
+)
+
+// Config describes the database shared by all repositories.
+// If DSN is set it is used as it is, otherwise the DSN is built from the discrete fields.
+type Config struct {
+	Driver string // mysql by default, sqlite or memory
+	DSN    string
+
+	// SQLite
+	Path string
+
+	// MySQL
+
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+	TLS      string // true, false, skip-verify or preferred
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// ConfigFromEnv reads the database configuration from the environment.
+// DB_USER, DB_PASSWORD and DB_NAME fall back to USER, PASSWORD and DBNAME.
+func ConfigFromEnv() (Config, error) {
+	c := Config{
+		Driver:          getenv("DB_DRIVER", MySQL),
+		DSN:             os.Getenv("DB_DSN"),
+		Path:            getenv("DB_PATH", "money-manager.db"),
+		User:            getenv("DB_USER", os.Getenv("USER")),
+		Password:        getenv("DB_PASSWORD", os.Getenv("PASSWORD")),
+		Host:            getenv("DB_HOST", "127.0.0.1"),
+		Port:            getenv("DB_PORT", "3306"),
+		Name:            getenv("DB_NAME", os.Getenv("DBNAME")),
+		TLS:             os.Getenv("DB_TLS"),
+		MaxOpenConns:    10,
+		MaxIdleConns:    10,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: 3 * time.Minute,
+	}
+
+	if c.Driver != MySQL && c.Driver != SQLite && c.Driver != Memory {
+		return c, fmt.Errorf("DB_DRIVER must be %s, %s or %s: %v", MySQL, SQLite, Memory, c.Driver)
+	}
+
+	var err error
+	if c.MaxOpenConns, err = envInt("DB_MAX_OPEN_CONNS", c.MaxOpenConns); err != nil {
+		return c, err
+	}
+	if c.MaxIdleConns, err = envInt("DB_MAX_IDLE_CONNS", c.MaxIdleConns); err != nil {
+		return c, err
+	}
+	if c.ConnMaxLifetime, err = envDuration("DB_CONN_MAX_LIFETIME", c.ConnMaxLifetime); err != nil {
+		return c, err
+	}
+	if c.ConnMaxIdleTime, err = envDuration("DB_CONN_MAX_IDLE_TIME", c.ConnMaxIdleTime); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %v", key, v)
+	}
+	return n, nil
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as 5m: %v", key, v)
+	}
+	return d, nil
+}
+
+// mysqlConfig returns the driver configuration.
+// Times are always parsed, because the repositories scan DATETIME columns into time.Time.
+func (c Config) mysqlConfig() (*mysql.Config, error) {
+	if c.DSN != "" {
+		mc, err := mysql.ParseDSN(c.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DB_DSN: %v", err)
+		}
+		mc.ParseTime = true
+		return mc, nil
+	}
+
+	mc := mysql.NewConfig()
+	mc.User = c.User
+	mc.Passwd = c.Password
+	mc.Net = "tcp"
+	mc.Addr = net.JoinHostPort(c.Host, c.Port)
+	mc.DBName = c.Name
+	mc.TLSConfig = c.TLS
+	mc.ParseTime = true
+	return mc, nil
+}
+
+// sqliteDSN returns the DSN of the SQLite file.
+// Write transactions take the lock when they begin, so that concurrent ones wait
+// for each other instead of failing, as serializable transactions on MySQL would.
+func (c Config) sqliteDSN() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+	params := url.Values{}
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_txlock", "immediate")
+	return "file:" + c.Path + "?" + params.Encode()
+}
+
+// Open connects to the database and checks that it is reachable
+func Open(c Config) (*sql.DB, error) {
+	var db *sql.DB
+	var name string
+	var err error
+	switch c.Driver {
+	case "", MySQL:
+		var mc *mysql.Config
+		if mc, err = c.mysqlConfig(); err != nil {
+			return nil, err
+		}
+		name = fmt.Sprintf("%q at %s", mc.DBName, mc.Addr)
+		db, err = sql.Open("mysql", mc.FormatDSN())
+	case SQLite:
+		name = c.sqliteDSN()
+		db, err = sql.Open("sqlite3", name)
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %v", c.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("cannot connect to database %s: %v", name, err)
+	}
+	return db, nil
+}
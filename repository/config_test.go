@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConfig_mysqlConfig(t *testing.T) {
+	t.Run("discrete fields", func(t *testing.T) {
+		c := Config{User: "root", Password: "1234", Host: "db", Port: "3307", Name: "money_manager", TLS: "skip-verify"}
+
+		mc, err := c.mysqlConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, "tcp", mc.Net)
+		assert.Equal(t, "db:3307", mc.Addr)
+		assert.Equal(t, "skip-verify", mc.TLSConfig)
+		assert.True(t, mc.ParseTime)
+	})
+	t.Run("DSN always parses time", func(t *testing.T) {
+		c := Config{DSN: "root:1234@tcp(localhost:3306)/money_manager"}
+
+		mc, err := c.mysqlConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, "money_manager", mc.DBName)
+		assert.True(t, mc.ParseTime)
+	})
+	t.Run("invalid DSN", func(t *testing.T) {
+		_, err := Config{DSN: "root@localhost"}.mysqlConfig()
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	_ = os.Setenv("DB_MAX_OPEN_CONNS", "25")
+	_ = os.Setenv("DB_CONN_MAX_LIFETIME", "1m")
+	defer os.Unsetenv("DB_MAX_OPEN_CONNS")
+	defer os.Unsetenv("DB_CONN_MAX_LIFETIME")
+
+	c, err := ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, 25, c.MaxOpenConns)
+	assert.Equal(t, time.Minute, c.ConnMaxLifetime)
+
+	_ = os.Setenv("DB_MAX_OPEN_CONNS", "many")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestConfig_sqliteDSN(t *testing.T) {
+	dsn := Config{Driver: SQLite, Path: "/tmp/money.db"}.sqliteDSN()
+	assert.Contains(t, dsn, "file:/tmp/money.db?")
+	assert.Contains(t, dsn, "_txlock=immediate")
+
+	_ = os.Setenv("DB_DRIVER", "oracle")
+	defer os.Unsetenv("DB_DRIVER")
+	_, err := ConfigFromEnv()
+	assert.Error(t, err)
+}
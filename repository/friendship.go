@@ -3,9 +3,7 @@ package repository
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/hpmalinova/Money-Manager/model"
-	"log"
 )
 
 const (
@@ -18,15 +16,8 @@ type FriendshipRepoMysql struct {
 	db *sql.DB
 }
 
-func NewFriendRepoMysql(user, password, dbname string) *FriendshipRepoMysql {
-	connectionString := fmt.Sprintf("%s:%s@/%s", user, password, dbname)
-	repo := &FriendshipRepoMysql{}
-	var err error
-	repo.db, err = sql.Open("mysql", connectionString)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return repo
+func NewFriendRepoMysql(db *sql.DB) *FriendshipRepoMysql {
+	return &FriendshipRepoMysql{db: db}
 }
 
 func (f *FriendshipRepoMysql) Add(friends *model.Friendship) error {
@@ -134,3 +125,13 @@ func (f FriendshipRepoMysql) DeclineInvite(userOne, userTwo int) error {
 	_, err := f.db.Exec(statement, userOne, userTwo)
 	return err
 }
+
+// AreFriends tells whether the users have accepted a friendship. userOne is smaller than userTwo.
+func (f FriendshipRepoMysql) AreFriends(userOne, userTwo int) (bool, error) {
+	var count int
+	statement := "SELECT COUNT(*) FROM friendship WHERE user_one_id = ? AND user_two_id = ? AND status = ?"
+	if err := f.db.QueryRow(statement, userOne, userTwo, accepted).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hpmalinova/Money-Manager/model"
-	"log"
+	"sort"
 	"time"
 )
 
@@ -14,76 +14,88 @@ type GroupRepoMysql struct {
 	db *sql.DB
 }
 
-func NewGroupRepoMysql(user, password, dbname string) *GroupRepoMysql {
-	connectionString := fmt.Sprintf("%s:%s@/%s", user, password, dbname)
-	repo := &GroupRepoMysql{}
-	var err error
-	repo.db, err = sql.Open("mysql", connectionString)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	repo.db.SetConnMaxLifetime(time.Minute * 5) // todo add to others?
-	repo.db.SetMaxOpenConns(10)
-	repo.db.SetMaxIdleConns(10)
-	repo.db.SetConnMaxIdleTime(time.Minute * 3)
-
-	return repo
+func NewGroupRepoMysql(db *sql.DB) *GroupRepoMysql {
+	return &GroupRepoMysql{db: db}
 }
 
-func (g *GroupRepoMysql) Create(name string, participants []int) error {
+// Create creates a group with the owner as its first member and invites the other users
+func (g *GroupRepoMysql) Create(name string, ownerID int, invited []int) (*model.Group, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
 	conn, err := g.db.Conn(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer conn.Close()
 
 	// BEGIN TRANSACTION
 	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// DEFER ROLLBACK
 	defer tx.Rollback()
 
-	statement, err := tx.Prepare(`INSERT INTO groups(name, participant_id) VALUES( ?, ?)`)
+	result, err := tx.ExecContext(ctx, "INSERT INTO money_groups(name) VALUES(?)", name)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	groupID := int(id)
+
+	statement, err := tx.PrepareContext(ctx, "INSERT INTO group_members(group_id, user_id, status) VALUES(?, ?, ?)")
+	if err != nil {
+		return nil, err
 	}
 	defer statement.Close()
 
-	for uid := range participants {
-		result, err := statement.Exec(name, uid)
-		if err != nil {
-			prefix := "Bad Request: "
-			msg := fmt.Sprintf("%sUser: %d already participates in %s", prefix, uid, name)
-			return errors.New(msg)
-		}
-		numRows, err := result.RowsAffected()
-		if err != nil || numRows != 1 {
-			msg := fmt.Sprintf("error inserting participantID: %v, %s\n", uid, err)
-			return errors.New(msg)
+	if _, err := statement.ExecContext(ctx, groupID, ownerID, model.MemberStatus); err != nil {
+		return nil, err
+	}
+	for _, uid := range invited {
+		if _, err := statement.ExecContext(ctx, groupID, uid, model.InvitedStatus); err != nil {
+			return nil, badRequest("User: %d already participates in %s", uid, name)
 		}
 	}
 
 	// COMMIT TRANSACTION
 	if err := tx.Commit(); err != nil {
 		msg := fmt.Sprintf("error in creating group: %s\n", err)
-		return errors.New(msg)
+		return nil, errors.New(msg)
 	}
-	return nil
+	return &model.Group{ID: groupID, Name: name}, nil
+}
+
+// Find returns the groups which the user has joined
+func (g *GroupRepoMysql) Find(start, count, userID int) ([]model.Group, error) {
+	statement := `SELECT g.id, g.name 
+					FROM money_groups AS g
+					INNER JOIN group_members AS m
+						ON g.id = m.group_id
+					WHERE m.user_id = ? AND m.status = ?
+					ORDER BY g.id
+					LIMIT ? OFFSET ?`
+	return g.find(statement, userID, model.MemberStatus, count, start)
 }
 
-func (g *GroupRepoMysql) Find(start, count, ownerID int) ([]model.Group, error) {
-	statement := `SELECT id, name, participant_id FROM groups 
-					WHERE participant_id = ?
-					LIMIT ? OFFSET ?` // TODO fix stmt // change to groupID-groupNAME + groupID-userID
+// FindInvites returns the groups which the user is invited to
+func (g *GroupRepoMysql) FindInvites(userID int) ([]model.Group, error) {
+	statement := `SELECT g.id, g.name 
+					FROM money_groups AS g
+					INNER JOIN group_members AS m
+						ON g.id = m.group_id
+					WHERE m.user_id = ? AND m.status = ?
+					ORDER BY g.id`
+	return g.find(statement, userID, model.InvitedStatus)
+}
 
-	rows, err := g.db.Query(statement, ownerID, count, start)
+func (g *GroupRepoMysql) find(statement string, args ...interface{}) ([]model.Group, error) {
+	rows, err := g.db.Query(statement, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -92,8 +104,7 @@ func (g *GroupRepoMysql) Find(start, count, ownerID int) ([]model.Group, error)
 	groups := []model.Group{}
 	for rows.Next() {
 		var group model.Group
-		err := rows.Scan(&group.ID, &group.Name, &group.ParticipantIDs)
-		if err != nil {
+		if err := rows.Scan(&group.ID, &group.Name); err != nil {
 			return nil, err
 		}
 		groups = append(groups, group)
@@ -104,3 +115,186 @@ func (g *GroupRepoMysql) Find(start, count, ownerID int) ([]model.Group, error)
 	}
 	return groups, nil
 }
+
+// FindByID returns the group with its members and invited users, sorted by username,
+// and the balances of their debts in the group
+func (g *GroupRepoMysql) FindByID(groupID int) (*model.Group, error) {
+	group := &model.Group{}
+	statement := "SELECT id, name FROM money_groups WHERE id = ?"
+	if err := g.db.QueryRow(statement, groupID).Scan(&group.ID, &group.Name); err != nil {
+		return nil, err
+	}
+
+	statement = `SELECT m.user_id, u.username, m.status
+					FROM group_members AS m
+					INNER JOIN users AS u
+						ON m.user_id = u.id
+					WHERE m.group_id = ?
+					ORDER BY u.username`
+	rows, err := g.db.Query(statement, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := model.GroupMember{Balance: []model.Money{}}
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Status); err != nil {
+			return nil, err
+		}
+		group.Members = append(group.Members, m)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The proposed shares are not owed until their debtors accept them
+	statement = `SELECT d.creditor, d.debtor, d.currency, SUM(d.amount)
+					FROM debts AS d
+					INNER JOIN debt_status AS s
+						ON d.status_id = s.id
+					WHERE d.group_id = ? AND s.status <> ?
+					GROUP BY d.creditor, d.debtor, d.currency`
+	rows, err = g.db.Query(statement, groupID, proposedStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var creditor, debtor int
+		var debt model.Money
+		if err := rows.Scan(&creditor, &debtor, &debt.Currency, &debt.Amount); err != nil {
+			return nil, err
+		}
+		addGroupDebt(group, creditor, debtor, debt)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// addGroupDebt adds a debt to the balances of the creditor and the debtor in the group
+func addGroupDebt(group *model.Group, creditor, debtor int, debt model.Money) {
+	add := func(userID int, amount model.Amount) {
+		m := group.Member(userID)
+		if m == nil {
+			return
+		}
+		for i := range m.Balance {
+			if m.Balance[i].Currency == debt.Currency {
+				m.Balance[i].Amount += amount
+				return
+			}
+		}
+		m.Balance = append(m.Balance, model.Money{Amount: amount, Currency: debt.Currency})
+		sort.Slice(m.Balance, func(i, j int) bool { return m.Balance[i].Currency < m.Balance[j].Currency })
+	}
+	add(creditor, debt.Amount)
+	add(debtor, -debt.Amount)
+}
+
+func (g *GroupRepoMysql) Rename(groupID int, name string) error {
+	statement := "UPDATE money_groups SET name = ? WHERE id = ?"
+	_, err := g.db.Exec(statement, name, groupID)
+	return err
+}
+
+// Invite invites a user who is neither a member nor invited yet
+func (g *GroupRepoMysql) Invite(groupID, userID int) error {
+	var count int
+	statement := "SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?"
+	if err := g.db.QueryRow(statement, groupID, userID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return badRequest("the user is already in the group")
+	}
+
+	statement = "INSERT INTO group_members(group_id, user_id, status) VALUES(?, ?, ?)"
+	_, err := g.db.Exec(statement, groupID, userID, model.InvitedStatus)
+	return err
+}
+
+// Join accepts the invitation of the user to the group
+func (g *GroupRepoMysql) Join(groupID, userID int) error {
+	statement := "UPDATE group_members SET status = ? WHERE group_id = ? AND user_id = ? AND status = ?"
+	result, err := g.db.Exec(statement, model.MemberStatus, groupID, userID, model.InvitedStatus)
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Leave removes a member, who has no debts in the group, or declines an invitation.
+// The group is deleted when its last member leaves.
+func (g *GroupRepoMysql) Leave(groupID, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := g.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	var count int
+	statement := "SELECT COUNT(*) FROM debts WHERE group_id = ? AND (creditor = ? OR debtor = ?)"
+	if err = tx.QueryRowContext(ctx, statement, groupID, userID, userID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return badRequest("the debts in the group must be repaid before leaving it")
+	}
+
+	statement = "DELETE FROM group_members WHERE group_id = ? AND user_id = ?"
+	result, err := tx.ExecContext(ctx, statement, groupID, userID)
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
+
+	statement = "SELECT COUNT(*) FROM group_members WHERE group_id = ? AND status = ?"
+	if err = tx.QueryRowContext(ctx, statement, groupID, model.MemberStatus).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM group_members WHERE group_id = ?", groupID); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM money_groups WHERE id = ?", groupID); err != nil {
+			return err
+		}
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/hpmalinova/Money-Manager/model"
+)
+
+type ImportRuleRepoMysql struct {
+	db *sql.DB
+}
+
+func NewImportRuleRepoMysql(db *sql.DB) *ImportRuleRepoMysql {
+	return &ImportRuleRepoMysql{db: db}
+}
+
+// Create stores a rule of the user. The caller checks that the user sees its category.
+func (i *ImportRuleRepoMysql) Create(rule *model.ImportRule) (*model.ImportRule, error) {
+	statement := "INSERT INTO import_rules(user_id, pattern, category_id) VALUES(?, ?, ?)"
+	result, err := i.db.Exec(statement, rule.UserID, rule.Pattern, rule.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	created := *rule
+	created.ID = int(id)
+	return &created, nil
+}
+
+// Find returns the rules of the user in the order of their creation, in which they are applied
+func (i *ImportRuleRepoMysql) Find(userID int) ([]model.ImportRule, error) {
+	statement := `SELECT r.id, r.pattern, r.category_id, c.name, c.c_type
+					FROM import_rules AS r
+					INNER JOIN categories AS c
+						ON r.category_id = c.id
+					WHERE r.user_id = ?
+					ORDER BY r.id`
+	rows, err := i.db.Query(statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []model.ImportRule{}
+	for rows.Next() {
+		rule := model.ImportRule{UserID: userID}
+		if err := rows.Scan(&rule.ID, &rule.Pattern, &rule.CategoryID, &rule.Category, &rule.CType); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Delete deletes the rule of the user
+func (i *ImportRuleRepoMysql) Delete(userID, id int) error {
+	statement := "DELETE FROM import_rules WHERE id = ? AND user_id = ?"
+	result, err := i.db.Exec(statement, id, userID)
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,1084 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hpmalinova/Money-Manager/model"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps all data in memory, for tests and for running the service without a database.
+// It is shared by the memory repositories, as a *sql.DB is shared by the MySQL ones.
+// A single lock guards all of it, so that every method is atomic, like a transaction.
+//
+// Missing rows are reported with sql.ErrNoRows, as the MySQL repositories report them.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	users       []model.User
+	sessions    map[string]model.Session
+	friendships []model.Friendship
+	groups      []model.Group
+	recurring   []model.Recurring
+	budgets     []model.Budget
+	categories  []model.Category
+	importRules []model.ImportRule
+	history     []model.History
+	forgiven    []model.Forgiveness
+	wallets     map[walletKey]model.Amount
+	debts       map[int]*memoryDebt
+	rates       model.Rates
+
+	nextUserID       int
+	nextGroupID      int
+	nextRecurringID  int
+	nextCategoryID   int
+	nextImportRuleID int
+	nextHistoryID    int
+	nextStatusID     int
+	nextForgivenID   int
+}
+
+// walletKey is the primary key of wallet
+type walletKey struct {
+	userID   int
+	account  string
+	currency string
+}
+
+// memoryDebt is a row of debts joined with its debt_status
+type memoryDebt struct {
+	creditor    int
+	debtor      int
+	amount      model.Amount
+	currency    string
+	category    string
+	description string
+	status      string
+	groupID     int // zero outside of groups
+	// The amount of a pending repayment and the account of the debtor which pays it,
+	// or what the creditor pays for a proposed debt
+	statusAmount  model.Amount
+	statusAccount string
+	// The due date, a day in UTC, and the interest rate of a loan
+	terms model.Terms
+	// The interest accrues from the loan or its last accepted repayment or forgiveness.
+	// The interest which accrued before that and is not paid yet is kept in interest.
+	accruesFrom time.Time
+	interest    model.Amount
+	// The account of the creditor which pays a proposed debt, and the expense category of a split
+	account   string
+	expenseID int
+}
+
+// NewMemoryStore returns an empty store with the categories and the exchange rates of the migrations
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]model.Session{},
+		categories: []model.Category{
+			{ID: 1, CType: expense, Name: model.LoanCategory},
+			{ID: 2, CType: expense, Name: model.RepayCategory},
+			{ID: 3, CType: expense, Name: "food"},
+			{ID: 4, CType: expense, Name: "home"},
+			{ID: 5, CType: expense, Name: "car"},
+			{ID: 6, CType: income, Name: model.DebtCategory},
+			{ID: 7, CType: income, Name: model.ReceiveCategory},
+			{ID: 8, CType: income, Name: "salary"},
+			{ID: 9, CType: income, Name: "savings"},
+			{ID: 10, CType: income, Name: "lottery"},
+			{ID: 11, CType: expense, Name: model.ForgiveCategory},
+			{ID: 12, CType: income, Name: model.ForgivenCategory},
+		},
+		wallets:          map[walletKey]model.Amount{},
+		debts:            map[int]*memoryDebt{},
+		rates:            model.Rates{"BGN": 1, "EUR": 1.95583},
+		nextUserID:       1,
+		nextGroupID:      1,
+		nextRecurringID:  1,
+		nextCategoryID:   13,
+		nextImportRuleID: 1,
+		nextHistoryID:    1,
+		nextStatusID:     1,
+		nextForgivenID:   1,
+	}
+}
+
+// page returns the bounds of the page of n items, as LIMIT count OFFSET start would
+func page(n, start, count int) (int, int) {
+	if start > n {
+		start = n
+	}
+	end := start + count
+	if end > n || count < 0 {
+		end = n
+	}
+	return start, end
+}
+
+// USERS
+
+type UserRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewUserRepoMemory(s *MemoryStore) *UserRepoMemory {
+	return &UserRepoMemory{s: s}
+}
+
+func (u *UserRepoMemory) Find(start, count int) ([]model.User, error) {
+	u.s.mu.RLock()
+	defer u.s.mu.RUnlock()
+
+	from, to := page(len(u.s.users), start, count)
+	users := make([]model.User, to-from)
+	copy(users, u.s.users[from:to])
+	return users, nil
+}
+
+func (u *UserRepoMemory) FindByID(id int) (*model.User, error) {
+	u.s.mu.RLock()
+	defer u.s.mu.RUnlock()
+
+	for _, user := range u.s.users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// FindNamesByIDs returns an empty name for unknown IDs, as the MySQL repository does
+func (u *UserRepoMemory) FindNamesByIDs(ids []int) ([]string, error) {
+	u.s.mu.RLock()
+	defer u.s.mu.RUnlock()
+
+	usernames := []string{}
+	for _, id := range ids {
+		username := ""
+		for _, user := range u.s.users {
+			if user.ID == id {
+				username = user.Username
+				break
+			}
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, nil
+}
+
+func (u *UserRepoMemory) FindByUsername(username string) (*model.User, error) {
+	u.s.mu.RLock()
+	defer u.s.mu.RUnlock()
+
+	for _, user := range u.s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Create creates and returns new user with autogenerated ID
+func (u *UserRepoMemory) Create(user *model.User) (*model.User, error) {
+	u.s.mu.Lock()
+	defer u.s.mu.Unlock()
+
+	for _, other := range u.s.users {
+		if other.Username == user.Username {
+			return nil, fmt.Errorf("duplicate username: %v", user.Username)
+		}
+	}
+
+	if user.Currency == "" {
+		user.Currency = model.DefaultCurrency
+	}
+	user.ID = u.s.nextUserID
+	u.s.nextUserID++
+	u.s.users = append(u.s.users, *user)
+	return user, nil
+}
+
+// UpdateCurrency changes the base currency of the user
+func (u *UserRepoMemory) UpdateCurrency(userID int, currency string) error {
+	u.s.mu.Lock()
+	defer u.s.mu.Unlock()
+
+	for i := range u.s.users {
+		if u.s.users[i].ID == userID {
+			u.s.users[i].Currency = currency
+		}
+	}
+	return nil
+}
+
+// user returns the user with the given ID. The caller holds the lock.
+func (s *MemoryStore) user(id int) (model.User, error) {
+	for _, user := range s.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return model.User{}, sql.ErrNoRows
+}
+
+// SESSIONS
+
+type SessionRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewSessionRepoMemory(s *MemoryStore) *SessionRepoMemory {
+	return &SessionRepoMemory{s: s}
+}
+
+func (r *SessionRepoMemory) Create(session *model.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.sessions[session.ID]; ok {
+		return fmt.Errorf("duplicate session ID: %v", session.ID)
+	}
+	stored := *session
+	stored.Revoked = false
+	r.s.sessions[session.ID] = stored
+	return nil
+}
+
+func (r *SessionRepoMemory) FindByID(id string) (*model.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &session, nil
+}
+
+// Refresh replaces the refresh token of an active session and extends it.
+// It fails if oldHash is not the hash of the current refresh token.
+func (r *SessionRepoMemory) Refresh(id, oldHash, newHash string, expiresAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.sessions[id]
+	if !ok || session.RefreshHash != oldHash || !session.Active(time.Now()) {
+		return errors.New("invalid refresh token")
+	}
+	session.RefreshHash = newHash
+	session.ExpiresAt = expiresAt
+	r.s.sessions[id] = session
+	return nil
+}
+
+// Extend moves the expiry of an active session
+func (r *SessionRepoMemory) Extend(id string, expiresAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if session, ok := r.s.sessions[id]; ok && !session.Revoked {
+		session.ExpiresAt = expiresAt
+		r.s.sessions[id] = session
+	}
+	return nil
+}
+
+func (r *SessionRepoMemory) Revoke(id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if session, ok := r.s.sessions[id]; ok {
+		session.Revoked = true
+		r.s.sessions[id] = session
+	}
+	return nil
+}
+
+// RevokeAll logs the user out on every device
+func (r *SessionRepoMemory) RevokeAll(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, session := range r.s.sessions {
+		if session.UserID == userID {
+			session.Revoked = true
+			r.s.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+// FRIENDSHIP
+
+type FriendshipRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewFriendRepoMemory(s *MemoryStore) *FriendshipRepoMemory {
+	return &FriendshipRepoMemory{s: s}
+}
+
+func (f *FriendshipRepoMemory) Add(friends *model.Friendship) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for _, other := range f.s.friendships {
+		if other.UserOne == friends.UserOne && other.UserTwo == friends.UserTwo {
+			if other.Status == accepted {
+				return errors.New("you are already friends")
+			}
+			return errors.New("the invitation is already sent")
+		}
+	}
+
+	stored := *friends
+	stored.Status = pending
+	f.s.friendships = append(f.s.friendships, stored)
+	return nil
+}
+
+// find returns the other users of the friendships of userID which match
+func (f *FriendshipRepoMemory) find(start, count, userID int, match func(model.Friendship) bool) []int {
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+
+	friends := []int{}
+	for _, friendship := range f.s.friendships {
+		if !match(friendship) {
+			continue
+		}
+		if friendship.UserOne == userID {
+			friends = append(friends, friendship.UserTwo)
+		} else if friendship.UserTwo == userID {
+			friends = append(friends, friendship.UserOne)
+		}
+	}
+	from, to := page(len(friends), start, count)
+	return friends[from:to]
+}
+
+func (f *FriendshipRepoMemory) Find(start, count, userID int) ([]int, error) {
+	return f.find(start, count, userID, func(friendship model.Friendship) bool {
+		return friendship.Status == accepted
+	}), nil
+}
+
+func (f *FriendshipRepoMemory) FindPending(start, count, userID int) ([]int, error) {
+	return f.find(start, count, userID, func(friendship model.Friendship) bool {
+		return friendship.Status == pending && friendship.ActionUser != userID
+	}), nil
+}
+
+func (f *FriendshipRepoMemory) AcceptInvite(userOne, userTwo, actionUser int) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for i, friendship := range f.s.friendships {
+		if friendship.UserOne == userOne && friendship.UserTwo == userTwo {
+			f.s.friendships[i].Status = accepted
+			f.s.friendships[i].ActionUser = actionUser
+		}
+	}
+	return nil
+}
+
+func (f *FriendshipRepoMemory) DeclineInvite(userOne, userTwo int) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	friendships := f.s.friendships[:0]
+	for _, friendship := range f.s.friendships {
+		if friendship.UserOne != userOne || friendship.UserTwo != userTwo {
+			friendships = append(friendships, friendship)
+		}
+	}
+	f.s.friendships = friendships
+	return nil
+}
+
+// AreFriends tells whether the users have accepted a friendship. userOne is smaller than userTwo.
+func (f *FriendshipRepoMemory) AreFriends(userOne, userTwo int) (bool, error) {
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+
+	for _, friendship := range f.s.friendships {
+		if friendship.UserOne == userOne && friendship.UserTwo == userTwo {
+			return friendship.Status == accepted, nil
+		}
+	}
+	return false, nil
+}
+
+// GROUPS
+
+type GroupRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewGroupRepoMemory(s *MemoryStore) *GroupRepoMemory {
+	return &GroupRepoMemory{s: s}
+}
+
+// Create creates a group with the owner as its first member and invites the other users
+func (g *GroupRepoMemory) Create(name string, ownerID int, invited []int) (*model.Group, error) {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+
+	group := model.Group{ID: g.s.nextGroupID, Name: name,
+		Members: []model.GroupMember{{UserID: ownerID, Status: model.MemberStatus}}}
+	for _, uid := range invited {
+		if group.Member(uid) != nil {
+			return nil, badRequest("User: %d already participates in %s", uid, name)
+		}
+		group.Members = append(group.Members, model.GroupMember{UserID: uid, Status: model.InvitedStatus})
+	}
+
+	g.s.groups = append(g.s.groups, group)
+	g.s.nextGroupID++
+	return &model.Group{ID: group.ID, Name: group.Name}, nil
+}
+
+// Find returns the groups which the user has joined
+func (g *GroupRepoMemory) Find(start, count, userID int) ([]model.Group, error) {
+	groups := g.find(userID, model.MemberStatus)
+	from, to := page(len(groups), start, count)
+	return groups[from:to], nil
+}
+
+// FindInvites returns the groups which the user is invited to
+func (g *GroupRepoMemory) FindInvites(userID int) ([]model.Group, error) {
+	return g.find(userID, model.InvitedStatus), nil
+}
+
+func (g *GroupRepoMemory) find(userID int, status string) []model.Group {
+	g.s.mu.RLock()
+	defer g.s.mu.RUnlock()
+
+	groups := []model.Group{}
+	for _, group := range g.s.groups {
+		if m := group.Member(userID); m != nil && m.Status == status {
+			groups = append(groups, model.Group{ID: group.ID, Name: group.Name})
+		}
+	}
+	return groups
+}
+
+// group returns the index of the group in the store. The caller holds the lock.
+func (s *MemoryStore) group(groupID int) (int, error) {
+	for i, group := range s.groups {
+		if group.ID == groupID {
+			return i, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+// FindByID returns the group with its members and invited users, sorted by username,
+// and the balances of their debts in the group
+func (g *GroupRepoMemory) FindByID(groupID int) (*model.Group, error) {
+	g.s.mu.RLock()
+	defer g.s.mu.RUnlock()
+
+	i, err := g.s.group(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &model.Group{ID: groupID, Name: g.s.groups[i].Name}
+	for _, m := range g.s.groups[i].Members {
+		user, err := g.s.user(m.UserID)
+		if err != nil {
+			return nil, err
+		}
+		group.Members = append(group.Members, model.GroupMember{UserID: m.UserID, Username: user.Username,
+			Status: m.Status, Balance: []model.Money{}})
+	}
+	sort.Slice(group.Members, func(i, j int) bool { return group.Members[i].Username < group.Members[j].Username })
+
+	for _, id := range g.s.statusIDs() {
+		d := g.s.debts[id]
+		if d.groupID == groupID && d.status != proposedStatus {
+			addGroupDebt(group, d.creditor, d.debtor, model.Money{Amount: d.amount, Currency: d.currency})
+		}
+	}
+	return group, nil
+}
+
+func (g *GroupRepoMemory) Rename(groupID int, name string) error {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+
+	i, err := g.s.group(groupID)
+	if err != nil {
+		return err
+	}
+	g.s.groups[i].Name = name
+	return nil
+}
+
+// Invite invites a user who is neither a member nor invited yet
+func (g *GroupRepoMemory) Invite(groupID, userID int) error {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+
+	i, err := g.s.group(groupID)
+	if err != nil {
+		return err
+	}
+	if g.s.groups[i].Member(userID) != nil {
+		return badRequest("the user is already in the group")
+	}
+	g.s.groups[i].Members = append(g.s.groups[i].Members, model.GroupMember{UserID: userID, Status: model.InvitedStatus})
+	return nil
+}
+
+// Join accepts the invitation of the user to the group
+func (g *GroupRepoMemory) Join(groupID, userID int) error {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+
+	i, err := g.s.group(groupID)
+	if err != nil {
+		return err
+	}
+	m := g.s.groups[i].Member(userID)
+	if m == nil || m.Status != model.InvitedStatus {
+		return sql.ErrNoRows
+	}
+	m.Status = model.MemberStatus
+	return nil
+}
+
+// Leave removes a member, who has no debts in the group, or declines an invitation.
+// The group is deleted when its last member leaves.
+func (g *GroupRepoMemory) Leave(groupID, userID int) error {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+
+	i, err := g.s.group(groupID)
+	if err != nil {
+		return err
+	}
+	for _, d := range g.s.debts {
+		if d.groupID == groupID && (d.creditor == userID || d.debtor == userID) {
+			return badRequest("the debts in the group must be repaid before leaving it")
+		}
+	}
+
+	group := &g.s.groups[i]
+	if group.Member(userID) == nil {
+		return sql.ErrNoRows
+	}
+	members := []model.GroupMember{}
+	for _, m := range group.Members {
+		if m.UserID != userID {
+			members = append(members, m)
+		}
+	}
+	group.Members = members
+
+	if len(group.MemberIDs()) == 0 {
+		g.s.groups = append(g.s.groups[:i], g.s.groups[i+1:]...)
+	}
+	return nil
+}
+
+// CATEGORIES
+
+type CategoryRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewCategoryRepoMemory(s *MemoryStore) *CategoryRepoMemory {
+	return &CategoryRepoMemory{s: s}
+}
+
+// FindByID returns the category, shared or of the user, with the given ID
+func (c *CategoryRepoMemory) FindByID(userID, id int) (*model.Category, error) {
+	c.s.mu.RLock()
+	defer c.s.mu.RUnlock()
+
+	category, err := c.s.category(id)
+	if err != nil || !visible(category, userID) {
+		return nil, sql.ErrNoRows
+	}
+	return &category, nil
+}
+
+// FindByName returns the category, shared or of the user, with the given name
+func (c *CategoryRepoMemory) FindByName(userID int, categoryName string) (*model.Category, error) {
+	c.s.mu.RLock()
+	defer c.s.mu.RUnlock()
+
+	for _, category := range c.s.categories {
+		if category.Name == categoryName && visible(category, userID) {
+			return &category, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (c *CategoryRepoMemory) FindExpenses(userID int) ([]model.Category, error) {
+	return c.findByType(userID, expense), nil
+}
+
+func (c *CategoryRepoMemory) FindIncomes(userID int) ([]model.Category, error) {
+	return c.findByType(userID, income), nil
+}
+
+func (c *CategoryRepoMemory) findByType(userID int, cType string) []model.Category {
+	c.s.mu.RLock()
+	defer c.s.mu.RUnlock()
+
+	categories := []model.Category{}
+	for _, category := range c.s.categories {
+		if category.CType == cType && !category.Archived && visible(category, userID) {
+			categories = append(categories, category)
+		}
+	}
+	return model.CategoryTree(categories)
+}
+
+func (c *CategoryRepoMemory) FindAll(userID int) ([]model.Category, error) {
+	c.s.mu.RLock()
+	defer c.s.mu.RUnlock()
+
+	categories := []model.Category{}
+	for _, category := range c.s.categories {
+		if visible(category, userID) {
+			categories = append(categories, category)
+		}
+	}
+	return model.CategoryTree(categories), nil
+}
+
+// Create stores a category of the user. Its name must differ from the names of the categories which the user sees.
+func (c *CategoryRepoMemory) Create(category *model.Category) (*model.Category, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	if err := c.s.checkCategoryName(category.UserID, 0, category.Name); err != nil {
+		return nil, err
+	}
+
+	created := *category
+	created.ID, created.Archived, created.Children = c.s.nextCategoryID, false, nil
+	c.s.nextCategoryID++
+	c.s.categories = append(c.s.categories, created)
+	return &created, nil
+}
+
+// Rename renames a category of the user. The new name must differ from the names of the other categories which the user sees.
+func (c *CategoryRepoMemory) Rename(userID, id int, name string) error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	i, err := c.s.ownCategory(userID, id)
+	if err != nil {
+		return err
+	}
+	if err := c.s.checkCategoryName(userID, id, name); err != nil {
+		return err
+	}
+	c.s.categories[i].Name = name
+	return nil
+}
+
+// Archive hides a category of the user, and its subcategories, from the lists of categories or shows it again
+func (c *CategoryRepoMemory) Archive(userID, id int, archived bool) error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	i, err := c.s.ownCategory(userID, id)
+	if err != nil {
+		return err
+	}
+	c.s.categories[i].Archived = archived
+	return nil
+}
+
+// visible tells whether the user sees the category: it is shared or their own
+func visible(category model.Category, userID int) bool {
+	return category.UserID == 0 || category.UserID == userID
+}
+
+// ownCategory returns the index of the category of the user.
+// It fails with sql.ErrNoRows if the user does not see the category, and with a BadRequestError if the category is shared.
+// The caller holds the lock.
+func (s *MemoryStore) ownCategory(userID, id int) (int, error) {
+	for i, category := range s.categories {
+		if category.ID != id || !visible(category, userID) {
+			continue
+		}
+		if category.Shared() {
+			return 0, badRequest("the shared categories cannot be changed")
+		}
+		return i, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
+// checkCategoryName fails with a BadRequestError if a category, other than the one with the given ID,
+// which the user sees already has the name. The caller holds the lock.
+func (s *MemoryStore) checkCategoryName(userID, id int, name string) error {
+	for _, category := range s.categories {
+		if category.Name == name && category.ID != id && visible(category, userID) {
+			return badRequest("there is already a category %s", name)
+		}
+	}
+	return nil
+}
+
+// category returns the category with the given ID. The caller holds the lock.
+func (s *MemoryStore) category(id int) (model.Category, error) {
+	for _, category := range s.categories {
+		if category.ID == id {
+			return category, nil
+		}
+	}
+	return model.Category{}, sql.ErrNoRows
+}
+
+// EXCHANGE RATES
+
+type RateRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewRateRepoMemory(s *MemoryStore) *RateRepoMemory {
+	return &RateRepoMemory{s: s}
+}
+
+func (r *RateRepoMemory) Find(currency string) (*model.Rate, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	rate, ok := r.s.rates[currency]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &model.Rate{Currency: currency, Rate: rate}, nil
+}
+
+func (r *RateRepoMemory) FindAll() ([]model.Rate, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	rates := []model.Rate{}
+	for currency, rate := range r.s.rates {
+		rates = append(rates, model.Rate{Currency: currency, Rate: rate})
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Currency < rates[j].Currency })
+	return rates, nil
+}
+
+// Update sets the rate of the currency, adding the currency if it has no rate yet
+func (r *RateRepoMemory) Update(rate *model.Rate) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.rates[rate.Currency] = rate.Rate
+	return nil
+}
+
+// findRates returns the exchange rates and the base currency of the user. The caller holds the lock.
+func (s *MemoryStore) findRates(userID int) (model.Rates, string, error) {
+	user, err := s.user(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.rates, user.Currency, nil
+}
+
+// BUDGETS
+
+type BudgetRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewBudgetRepoMemory(s *MemoryStore) *BudgetRepoMemory {
+	return &BudgetRepoMemory{s: s}
+}
+
+// Set creates the budget of the user for the category, or replaces it
+func (b *BudgetRepoMemory) Set(budget *model.Budget) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+
+	stored := model.Budget{UserID: budget.UserID, CategoryID: budget.CategoryID, Amount: budget.Amount,
+		Currency: currencyOf(budget.Currency), Period: budget.Period, Block: budget.Block}
+	for i := range b.s.budgets {
+		if b.s.budgets[i].UserID == budget.UserID && b.s.budgets[i].CategoryID == budget.CategoryID {
+			b.s.budgets[i] = stored
+			return nil
+		}
+	}
+	b.s.budgets = append(b.s.budgets, stored)
+	return nil
+}
+
+// Find returns the budgets of the user, sorted by category,
+// with their spending in the periods which contain the time at
+func (b *BudgetRepoMemory) Find(userID int, at time.Time) ([]model.Budget, error) {
+	return b.find(userID, at, func(budget model.Budget) bool { return true })
+}
+
+// FindByCategory returns the budget of the user for the category,
+// with its spending in the period which contains the time at
+func (b *BudgetRepoMemory) FindByCategory(userID, categoryID int, at time.Time) (*model.Budget, error) {
+	budgets, err := b.find(userID, at, func(budget model.Budget) bool { return budget.CategoryID == categoryID })
+	if err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &budgets[0], nil
+}
+
+func (b *BudgetRepoMemory) find(userID int, at time.Time, match func(budget model.Budget) bool) ([]model.Budget, error) {
+	b.s.mu.RLock()
+	defer b.s.mu.RUnlock()
+
+	budgets := []model.Budget{}
+	for _, budget := range b.s.budgets {
+		if budget.UserID != userID || !match(budget) {
+			continue
+		}
+		category, err := b.s.category(budget.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+		budget.CategoryName = category.Name
+		budgets = append(budgets, budget)
+	}
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].CategoryName < budgets[j].CategoryName })
+	if len(budgets) == 0 {
+		return budgets, nil
+	}
+
+	rates, _, err := b.s.findRates(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range budgets {
+		budgets[i].Current = model.BudgetPeriod(budgets[i].Period, at)
+		sums := []model.Money{}
+		for _, h := range b.s.history {
+			if h.UserID != userID || !inPeriod(h, budgets[i].Current) {
+				continue
+			}
+			// The subcategories count to the budget of their parent
+			if c, err := b.s.category(h.CategoryID); err == nil && (c.ID == budgets[i].CategoryID || c.ParentID == budgets[i].CategoryID) {
+				sums = append(sums, model.Money{Amount: h.Amount, Currency: h.Currency})
+			}
+		}
+		if err := spentOf(&budgets[i], sums, rates); err != nil {
+			return nil, err
+		}
+	}
+	return budgets, nil
+}
+
+// Delete deletes the budget of the user for the category
+func (b *BudgetRepoMemory) Delete(userID, categoryID int) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+
+	for i, budget := range b.s.budgets {
+		if budget.UserID == userID && budget.CategoryID == categoryID {
+			b.s.budgets = append(b.s.budgets[:i], b.s.budgets[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// RECURRING
+
+type RecurringRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewRecurringRepoMemory(s *MemoryStore) *RecurringRepoMemory {
+	return &RecurringRepoMemory{s: s}
+}
+
+// Create stores a rule. Its first occurrence is at StartsAt.
+func (rr *RecurringRepoMemory) Create(r *model.Recurring) (*model.Recurring, error) {
+	rr.s.mu.Lock()
+	defer rr.s.mu.Unlock()
+
+	rule := model.Recurring{ID: rr.s.nextRecurringID, UserID: r.UserID, Amount: r.Amount,
+		Currency: currencyOf(r.Currency), Account: accountOf(r.Account), CategoryID: r.CategoryID,
+		Description: r.Description, Frequency: r.Frequency, StartsAt: occurredAt(r.StartsAt), Count: r.Count}
+	if !r.EndsAt.IsZero() {
+		rule.EndsAt = r.EndsAt.UTC()
+	}
+	rr.s.recurring = append(rr.s.recurring, rule)
+	rr.s.nextRecurringID++
+
+	rule.CategoryName, rule.CategoryType = r.CategoryName, r.CategoryType
+	return &rule, nil
+}
+
+// FindByUser returns the rules of the user
+func (rr *RecurringRepoMemory) FindByUser(userID int) ([]model.Recurring, error) {
+	return rr.find(func(r model.Recurring) bool { return r.UserID == userID })
+}
+
+// FindByID returns a rule of the user
+func (rr *RecurringRepoMemory) FindByID(userID, id int) (*model.Recurring, error) {
+	rules, err := rr.find(func(r model.Recurring) bool { return r.UserID == userID && r.ID == id })
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &rules[0], nil
+}
+
+// FindActive returns the rules which are not paused, of all users
+func (rr *RecurringRepoMemory) FindActive() ([]model.Recurring, error) {
+	return rr.find(func(r model.Recurring) bool { return !r.Paused })
+}
+
+func (rr *RecurringRepoMemory) find(match func(r model.Recurring) bool) ([]model.Recurring, error) {
+	rr.s.mu.RLock()
+	defer rr.s.mu.RUnlock()
+
+	rules := []model.Recurring{}
+	for _, r := range rr.s.recurring {
+		if !match(r) {
+			continue
+		}
+		category, err := rr.s.category(r.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+		r.CategoryName, r.CategoryType = category.Name, category.CType
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// rule returns the index of the rule of the user in the store. The caller holds the lock.
+func (s *MemoryStore) rule(userID, id int) (int, error) {
+	for i, r := range s.recurring {
+		if r.ID == id && r.UserID == userID {
+			return i, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+// Pause stops the scheduler from recording the rule of the user
+func (rr *RecurringRepoMemory) Pause(userID, id int) error {
+	rr.s.mu.Lock()
+	defer rr.s.mu.Unlock()
+
+	if i, err := rr.s.rule(userID, id); err == nil {
+		rr.s.recurring[i].Paused = true
+	}
+	return nil
+}
+
+// Resume lets the scheduler record the rule of the user again, from the occurrence done.
+// The occurrences before it, which fell into the pause, are skipped.
+func (rr *RecurringRepoMemory) Resume(userID, id, done int) error {
+	rr.s.mu.Lock()
+	defer rr.s.mu.Unlock()
+
+	if i, err := rr.s.rule(userID, id); err == nil {
+		rr.s.recurring[i].Paused = false
+		if rr.s.recurring[i].Done < done {
+			rr.s.recurring[i].Done = done
+		}
+	}
+	return nil
+}
+
+// Advance records that the occurrences of the rule before done are recorded.
+// The counter never goes back, so that a slower run of the scheduler does not undo a faster one.
+func (rr *RecurringRepoMemory) Advance(id, done int) error {
+	rr.s.mu.Lock()
+	defer rr.s.mu.Unlock()
+
+	for i := range rr.s.recurring {
+		if rr.s.recurring[i].ID == id && rr.s.recurring[i].Done < done {
+			rr.s.recurring[i].Done = done
+		}
+	}
+	return nil
+}
+
+// Delete deletes the rule of the user. The entries which it recorded are kept.
+func (rr *RecurringRepoMemory) Delete(userID, id int) error {
+	rr.s.mu.Lock()
+	defer rr.s.mu.Unlock()
+
+	i, err := rr.s.rule(userID, id)
+	if err != nil {
+		return err
+	}
+	rr.s.recurring = append(rr.s.recurring[:i], rr.s.recurring[i+1:]...)
+	return nil
+}
+
+// IMPORT RULES
+
+type ImportRuleRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewImportRuleRepoMemory(s *MemoryStore) *ImportRuleRepoMemory {
+	return &ImportRuleRepoMemory{s: s}
+}
+
+func (i *ImportRuleRepoMemory) Create(rule *model.ImportRule) (*model.ImportRule, error) {
+	i.s.mu.Lock()
+	defer i.s.mu.Unlock()
+
+	created := *rule
+	created.ID = i.s.nextImportRuleID
+	i.s.nextImportRuleID++
+	i.s.importRules = append(i.s.importRules, created)
+	return &created, nil
+}
+
+// Find returns the rules of the user in the order of their creation, with the names and types of their categories
+func (i *ImportRuleRepoMemory) Find(userID int) ([]model.ImportRule, error) {
+	i.s.mu.RLock()
+	defer i.s.mu.RUnlock()
+
+	rules := []model.ImportRule{}
+	for _, rule := range i.s.importRules {
+		if rule.UserID != userID {
+			continue
+		}
+		category, err := i.s.category(rule.CategoryID)
+		if err != nil {
+			continue
+		}
+		rule.Category, rule.CType = category.Name, category.CType
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (i *ImportRuleRepoMemory) Delete(userID, id int) error {
+	i.s.mu.Lock()
+	defer i.s.mu.Unlock()
+
+	for j, rule := range i.s.importRules {
+		if rule.ID == id && rule.UserID == userID {
+			i.s.importRules = append(i.s.importRules[:j], i.s.importRules[j+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
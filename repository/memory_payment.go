@@ -0,0 +1,916 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hpmalinova/Money-Manager/model"
+	"sort"
+	"time"
+)
+
+type PaymentRepoMemory struct {
+	s *MemoryStore
+}
+
+func NewPaymentRepoMemory(s *MemoryStore) *PaymentRepoMemory {
+	return &PaymentRepoMemory{s: s}
+}
+
+var errNegativeBalance = errors.New("balance cannot be negative")
+
+// hasAccount tells whether the user has the account. The caller holds the lock.
+func (s *MemoryStore) hasAccount(userID int, account string) bool {
+	for key := range s.wallets {
+		if key.userID == userID && key.account == account {
+			return true
+		}
+	}
+	return false
+}
+
+// addToWallets changes the balances of the wallets by the given amounts.
+// Like the non_negative check of wallet, it changes nothing if a balance would become negative.
+// As addToWallet does, it fails for a missing account, an income opens a missing wallet
+// and spending fails without one. The caller holds the lock.
+func (s *MemoryStore) addToWallets(changes map[walletKey]model.Amount) error {
+	for key, amount := range changes {
+		if !s.hasAccount(key.userID, key.account) {
+			return badRequest("there is no account %s", key.account)
+		}
+		balance, ok := s.wallets[key]
+		if !ok && amount < 0 {
+			return fmt.Errorf("no %s wallet in %s", key.currency, key.account)
+		}
+		if balance+amount < 0 {
+			return errNegativeBalance
+		}
+	}
+	for key, amount := range changes {
+		s.wallets[key] += amount
+	}
+	return nil
+}
+
+// addHistory records an entry. The caller holds the lock.
+func (s *MemoryStore) addHistory(h model.History) {
+	h.ID = s.nextHistoryID
+	h.Currency = currencyOf(h.Currency)
+	h.Account = accountOf(h.Account)
+	h.Date = occurredAt(h.Date)
+	s.nextHistoryID++
+	s.history = append(s.history, h)
+}
+
+// recorded reports whether the entry is an occurrence of a recurring rule which is already recorded.
+// The caller holds the lock.
+func (s *MemoryStore) recorded(h *model.History) bool {
+	if h.RecurringID == 0 {
+		return false
+	}
+	for _, entry := range s.history {
+		if entry.RecurringID == h.RecurringID && entry.Occurrence == h.Occurrence {
+			return true
+		}
+	}
+	return false
+}
+
+// addDebt records an ongoing debt and returns its status ID. The caller holds the lock.
+func (s *MemoryStore) addDebt(d memoryDebt) int {
+	d.status = ongoingStatus
+	d.statusAmount = d.amount
+	statusID := s.nextStatusID
+	s.nextStatusID++
+	s.debts[statusID] = &d
+	return statusID
+}
+
+// CheckBalance returns the balances of the accounts of the user, the balance in every currency
+// and their total in the base currency of the user
+func (p *PaymentRepoMemory) CheckBalance(userID int) (*model.Balance, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	rates, currency, err := p.s.findRates(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets := []accountWallet{}
+	for key, balance := range p.s.wallets {
+		if key.userID == userID {
+			wallets = append(wallets, accountWallet{account: key.account,
+				Money: model.Money{Amount: balance, Currency: key.currency}})
+		}
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		if wallets[i].account != wallets[j].account {
+			return wallets[i].account < wallets[j].account
+		}
+		return wallets[i].Currency < wallets[j].Currency
+	})
+	return balanceOf(wallets, rates, currency)
+}
+
+func (p *PaymentRepoMemory) CreateWallet(userID int) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	key := walletKey{userID: userID, account: model.DefaultAccount, currency: model.DefaultCurrency}
+	if _, ok := p.s.wallets[key]; ok {
+		return fmt.Errorf("duplicate wallet of user: %d", userID)
+	}
+	p.s.wallets[key] = 0
+	return nil
+}
+
+// CreateAccount opens an empty account of the user with a wallet in the base currency of the user
+func (p *PaymentRepoMemory) CreateAccount(userID int, name string) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if p.s.hasAccount(userID, name) {
+		return badRequest("account %s already exists", name)
+	}
+	u, err := p.s.user(userID)
+	if err != nil {
+		return err
+	}
+	p.s.wallets[walletKey{userID: userID, account: name, currency: currencyOf(u.Currency)}] = 0
+	return nil
+}
+
+// Transfer moves money between two accounts of the user without recording an income or an expense
+func (p *PaymentRepoMemory) Transfer(t *model.AccountTransfer) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if !p.s.hasAccount(t.UserID, t.To) {
+		return badRequest("there is no account %s", t.To)
+	}
+	currency := currencyOf(t.Currency)
+	err := p.s.addToWallets(map[walletKey]model.Amount{
+		{userID: t.UserID, account: t.From, currency: currency}: -t.Amount,
+		{userID: t.UserID, account: t.To, currency: currency}:   t.Amount,
+	})
+	if err != nil {
+		return fmt.Errorf("not enough money: %v", err)
+	}
+	return nil
+}
+
+func (p *PaymentRepoMemory) Pay(h *model.History) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if p.s.recorded(h) {
+		return ErrRecorded
+	}
+	key := walletKey{userID: h.UserID, account: accountOf(h.Account), currency: currencyOf(h.Currency)}
+	if err := p.s.addToWallets(map[walletKey]model.Amount{key: -h.Amount}); err != nil {
+		return fmt.Errorf("not enough money: %v", err)
+	}
+	p.s.addHistory(*h)
+	return nil
+}
+
+func (p *PaymentRepoMemory) Earn(h *model.History) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if p.s.recorded(h) {
+		return ErrRecorded
+	}
+	key := walletKey{userID: h.UserID, account: accountOf(h.Account), currency: currencyOf(h.Currency)}
+	if err := p.s.addToWallets(map[walletKey]model.Amount{key: h.Amount}); err != nil {
+		return err
+	}
+	p.s.addHistory(*h)
+	return nil
+}
+
+// Import records the payments and incomes of a bank statement, in their order, as Pay and Earn do.
+// If one of them fails, none is recorded.
+func (p *PaymentRepoMemory) Import(entries []model.History) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	wallets := make(map[walletKey]model.Amount, len(p.s.wallets))
+	for key, balance := range p.s.wallets {
+		wallets[key] = balance
+	}
+	history, nextHistoryID := len(p.s.history), p.s.nextHistoryID
+	rollback := func() {
+		p.s.wallets, p.s.history, p.s.nextHistoryID = wallets, p.s.history[:history], nextHistoryID
+	}
+
+	for i := range entries {
+		h := &entries[i]
+		category, err := p.s.category(h.CategoryID)
+		if err != nil {
+			rollback()
+			return err
+		}
+		amount := signedAmount(h.Amount, category.CType)
+		key := walletKey{userID: h.UserID, account: accountOf(h.Account), currency: currencyOf(h.Currency)}
+		if err := p.s.addToWallets(map[walletKey]model.Amount{key: amount}); err != nil {
+			rollback()
+			if amount < 0 {
+				return fmt.Errorf("not enough money: %v", err)
+			}
+			return err
+		}
+		p.s.addHistory(*h)
+	}
+	return nil
+}
+
+// GiveLoan proposes the loan to the debtor. No money moves until the debtor accepts it with AcceptProposal.
+func (p *PaymentRepoMemory) GiveLoan(t *model.TransferLoan) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	currency, account := currencyOf(t.Currency), accountOf(t.Account)
+	if err := p.s.checkFunds(walletKey{userID: t.CreditorID, account: account, currency: currency}, t.Amount); err != nil {
+		return err
+	}
+
+	p.s.addProposal(memoryDebt{creditor: t.CreditorID, debtor: t.DebtorID, amount: t.Amount, currency: currency,
+		category: t.RepayCategoryName, description: t.Description, terms: dueDay(t.Terms), accruesFrom: occurredAt(t.Date),
+		account: account}, t.Amount)
+	return nil
+}
+
+// checkFunds fails as the SQL checkFunds does. The caller holds the lock.
+func (s *MemoryStore) checkFunds(key walletKey, amount model.Amount) error {
+	balance, ok := s.wallets[key]
+	if !ok {
+		return fmt.Errorf("not enough money: no %s wallet in %s", key.currency, key.account)
+	}
+	if balance < amount {
+		return fmt.Errorf("not enough money: %s has %s %s", key.account, balance.In(key.currency), key.currency)
+	}
+	return nil
+}
+
+// addProposal records a proposed debt, for which the creditor pays the total, and returns its status ID.
+// The caller holds the lock.
+func (s *MemoryStore) addProposal(d memoryDebt, total model.Amount) int {
+	statusID := s.addDebt(d)
+	s.debts[statusID].status = proposedStatus
+	s.debts[statusID].statusAmount = total
+	return statusID
+}
+
+// dueDay keeps the day of the due date of the terms, as the due_date column does
+func dueDay(terms model.Terms) model.Terms {
+	if !terms.DueDate.IsZero() {
+		y, m, d := terms.DueDate.Date()
+		terms.DueDate = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	return terms
+}
+
+// accrued returns the interest of the debt accrued until now and its state
+// reduce pays off a part of the debt at the date, as reduceDebt does
+func (d *memoryDebt) reduce(interest, paid model.Amount, date time.Time) {
+	d.amount, d.interest = model.PayInterestFirst(d.amount, interest, paid)
+	d.accruesFrom = date
+	d.statusAmount = d.amount
+}
+
+func (d *memoryDebt) accrued(now time.Time) model.Accrued {
+	return model.Accrued{Interest: d.interest + d.terms.Accrue(d.amount, d.accruesFrom, now), Overdue: d.terms.OverdueAt(now)}
+}
+
+// activeDebts returns the status IDs of the active debts which the filter accepts, by their due date.
+// Those without one come last. The caller holds the lock.
+func (s *MemoryStore) activeDebts(filter func(d *memoryDebt) bool) []int {
+	ids := []int{}
+	for _, id := range s.statusIDs() {
+		if d := s.debts[id]; d.status == ongoingStatus && filter(d) {
+			ids = append(ids, id)
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := s.debts[ids[i]].terms.DueDate, s.debts[ids[j]].terms.DueDate
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+	return ids
+}
+
+// Split shares the expense in halves with the debtor, as SplitExpense does: the creditor spends their half at once,
+// and pays and lends the debtor the other half when the debtor accepts it with AcceptProposal.
+func (p *PaymentRepoMemory) Split(t *model.TransferSplit) error {
+	return p.SplitExpense(splitOf(t))
+}
+
+// SplitExpense records an expense which the payer paid for several participants, as the SQL SplitExpense does
+func (p *PaymentRepoMemory) SplitExpense(e *model.SplitExpense) error {
+	if err := checkShares(e); err != nil {
+		return err
+	}
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	currency, account := currencyOf(e.Currency), accountOf(e.Account)
+	key := walletKey{userID: e.PayerID, account: account, currency: currency}
+	if err := p.s.checkFunds(key, e.Amount); err != nil {
+		return err
+	}
+
+	date := occurredAt(e.Date)
+	if e.Own > 0 {
+		if err := p.s.addToWallets(map[walletKey]model.Amount{key: -e.Own}); err != nil {
+			return fmt.Errorf("not enough money: %v", err)
+		}
+		p.s.addHistory(model.History{UserID: e.PayerID, Amount: e.Own, Currency: currency, Account: account,
+			CategoryID: e.Expense.ID, Description: e.Description, Date: date})
+	}
+	for _, share := range e.Shares {
+		if share.Amount == 0 {
+			continue
+		}
+		p.s.addProposal(memoryDebt{creditor: e.PayerID, debtor: share.DebtorID, amount: share.Amount, currency: currency,
+			category: e.DebtCategoryName, description: e.Description, groupID: e.GroupID, accruesFrom: date,
+			account: account, expenseID: e.Expense.ID}, share.Amount)
+	}
+	return nil
+}
+
+// openDebts returns the debts of the scope in the order of their creation, as findOpenDebts does.
+// The caller holds the lock.
+func (s *MemoryStore) openDebts(scope model.DebtScope) []model.OpenDebt {
+	inCircle := map[int]bool{}
+	for _, id := range scope.UserIDs {
+		inCircle[id] = true
+	}
+
+	debts := []model.OpenDebt{}
+	for _, id := range s.statusIDs() {
+		d := s.debts[id]
+		if scope.GroupID != 0 && d.groupID != scope.GroupID {
+			continue
+		}
+		if d.status == proposedStatus {
+			continue
+		}
+		if scope.GroupID == 0 && (d.groupID != 0 || d.terms.InterestRate > 0 || !inCircle[d.creditor] || !inCircle[d.debtor]) {
+			continue
+		}
+		if scope.PartyID != 0 && d.creditor != scope.PartyID && d.debtor != scope.PartyID {
+			continue
+		}
+		debts = append(debts, model.OpenDebt{StatusID: id, CreditorID: d.creditor, DebtorID: d.debtor,
+			Amount: d.amount, Currency: d.currency, Pending: d.status == pendingStatus})
+	}
+	return debts
+}
+
+// FindOpenDebts returns the debts of a group, or the debts outside of groups between the given users
+func (p *PaymentRepoMemory) FindOpenDebts(scope model.DebtScope) ([]model.OpenDebt, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	return p.s.openDebts(scope), nil
+}
+
+// Settle replaces the debts of the scope with the payments of their settlement plan
+func (p *PaymentRepoMemory) Settle(scope model.DebtScope) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	debts := p.s.openDebts(scope)
+	if err := checkSettlement(debts); err != nil {
+		return err
+	}
+
+	for _, d := range debts {
+		delete(p.s.debts, d.StatusID)
+	}
+	for _, s := range model.Simplify(debts) {
+		p.s.addDebt(memoryDebt{creditor: s.ToID, debtor: s.FromID, amount: s.Amount, currency: s.Currency,
+			category: model.RepayCategory, description: settlementDescription, groupID: scope.GroupID})
+	}
+	return nil
+}
+
+// statusIDs returns the status IDs of the debts in the order of their creation. The caller holds the lock.
+func (s *MemoryStore) statusIDs() []int {
+	ids := make([]int, 0, len(s.debts))
+	for id := range s.debts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (p *PaymentRepoMemory) FindActiveDebts(debtorID int) ([]model.DebtExt, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	now := time.Now()
+	debts := []model.DebtExt{}
+	for _, id := range p.s.activeDebts(func(d *memoryDebt) bool { return d.debtor == debtorID }) {
+		d := p.s.debts[id]
+		debts = append(debts, model.DebtExt{
+			StatusID:     id,
+			CategoryName: d.category,
+			Debt: model.Debt{CreditorID: d.creditor, Amount: d.amount, Currency: d.currency,
+				Description: d.description, Terms: d.terms, Accrued: d.accrued(now)},
+		})
+	}
+	return debts, nil
+}
+
+func (p *PaymentRepoMemory) FindActiveLoans(creditorID int) ([]model.LoanExt, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	now := time.Now()
+	loans := []model.LoanExt{}
+	for _, id := range p.s.activeDebts(func(d *memoryDebt) bool { return d.creditor == creditorID }) {
+		d := p.s.debts[id]
+		loans = append(loans, model.LoanExt{
+			StatusID: id,
+			Loan: model.Loan{DebtorID: d.debtor, Amount: d.amount, Currency: d.currency,
+				Description: d.description, Terms: d.terms, Accrued: d.accrued(now)},
+		})
+	}
+	return loans, nil
+}
+
+func (p *PaymentRepoMemory) RequestRepay(debtorID, debtID int, amount model.Amount, account string) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	d, ok := p.s.debts[debtID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if d.debtor != debtorID {
+		return ErrNotParty
+	}
+	if d.status == proposedStatus {
+		return errProposed
+	}
+
+	// You can`t repay more than you've received, with its interest
+	if owed := d.amount + d.accrued(time.Now()).Interest; amount > owed {
+		amount = owed
+	}
+	d.status = pendingStatus
+	d.statusAmount = amount
+	d.statusAccount = accountOf(account)
+	return nil
+}
+
+func (p *PaymentRepoMemory) FindPendingDebts(debtorID int) ([]model.Debt, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	debts := []model.Debt{}
+	for _, id := range p.s.statusIDs() {
+		d := p.s.debts[id]
+		if d.debtor == debtorID && d.status == pendingStatus {
+			debts = append(debts, model.Debt{CreditorID: d.creditor, Amount: d.statusAmount, Currency: d.currency,
+				Description: d.description})
+		}
+	}
+	return debts, nil
+}
+
+func (p *PaymentRepoMemory) FindPendingRequests(creditorID int) ([]model.LoanExt, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	loans := []model.LoanExt{}
+	for _, id := range p.s.statusIDs() {
+		d := p.s.debts[id]
+		if d.creditor == creditorID && d.status == pendingStatus {
+			loans = append(loans, model.LoanExt{
+				StatusID: id,
+				Loan: model.Loan{DebtorID: d.debtor, Amount: d.statusAmount, Currency: d.currency,
+					Description: d.description},
+			})
+		}
+	}
+	return loans, nil
+}
+
+func (p *PaymentRepoMemory) AcceptPayment(creditorID int, a *model.Accept) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	d, err := p.s.pendingDebt(creditorID, a.StatusID)
+	if err != nil {
+		return err
+	}
+	paid := d.statusAmount
+	date := occurredAt(a.Date)
+	account := accountOf(a.Account)
+	if !p.s.hasAccount(d.creditor, account) {
+		return badRequest("there is no account %s", account)
+	}
+
+	// Move the money from the debtor to the creditor
+	err = p.s.addToWallets(map[walletKey]model.Amount{
+		{userID: d.debtor, account: d.statusAccount, currency: d.currency}: -paid,
+		{userID: d.creditor, account: account, currency: d.currency}:       paid,
+	})
+	if err != nil {
+		return fmt.Errorf("not enough money: %v", err)
+	}
+
+	// Decrease or delete the debt
+	if interest := d.accrued(date).Interest; paid < d.amount+interest {
+		d.reduce(interest, paid, date)
+		d.status = ongoingStatus
+	} else {
+		delete(p.s.debts, a.StatusID)
+	}
+
+	p.s.addHistory(model.History{UserID: d.creditor, Amount: paid, Currency: d.currency, Account: account,
+		CategoryID: a.RepayC.ID, Description: d.description, Date: date})
+	p.s.addHistory(model.History{UserID: d.debtor, Amount: paid, Currency: d.currency, Account: d.statusAccount,
+		CategoryID: a.ExpenseC.ID, Description: d.description, Date: date})
+	return nil
+}
+
+func (p *PaymentRepoMemory) DeclinePayment(creditorID, statusID int) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	d, err := p.s.pendingDebt(creditorID, statusID)
+	if err != nil {
+		return err
+	}
+	d.status = ongoingStatus
+	d.statusAmount = d.amount
+	return nil
+}
+
+// pendingDebt returns the debt with the status ID, as checkPending checks it. The caller holds the lock.
+func (s *MemoryStore) pendingDebt(creditorID, statusID int) (*memoryDebt, error) {
+	d, ok := s.debts[statusID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if d.creditor != creditorID {
+		return nil, ErrNotParty
+	}
+	if d.status != pendingStatus {
+		return nil, errNotPending
+	}
+	return d, nil
+}
+
+// Forgive forgives the debtor a part of the debt, or the whole debt, as the SQL Forgive does
+func (p *PaymentRepoMemory) Forgive(creditorID int, f *model.Forgive) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	d, ok := p.s.debts[f.StatusID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if d.creditor != creditorID {
+		return ErrNotParty
+	}
+	switch d.status {
+	case proposedStatus:
+		return errProposed
+	case pendingStatus:
+		return errPending
+	}
+	date := occurredAt(f.Date)
+
+	// Decrease or delete the debt
+	interest := d.accrued(date).Interest
+	owed := d.amount + interest
+	if f.Amount < 0 || f.Amount > owed {
+		return errForgiveAmount
+	}
+	forgiven := f.Amount
+	if forgiven == 0 {
+		forgiven = owed
+	}
+	if forgiven < owed {
+		d.reduce(interest, forgiven, date)
+	} else {
+		delete(p.s.debts, f.StatusID)
+	}
+
+	p.s.addHistory(model.History{UserID: d.creditor, Amount: forgiven, Currency: d.currency, CategoryID: f.ForgiveC.ID,
+		Description: d.description, Date: date})
+	p.s.addHistory(model.History{UserID: d.debtor, Amount: forgiven, Currency: d.currency, CategoryID: f.ForgivenC.ID,
+		Description: d.description, Date: date})
+
+	p.s.forgiven = append(p.s.forgiven, model.Forgiveness{ID: p.s.nextForgivenID, CreditorID: d.creditor,
+		DebtorID: d.debtor, Amount: forgiven, Currency: d.currency, Description: d.description, Date: date,
+		Closed: forgiven == owed})
+	p.s.nextForgivenID++
+	return nil
+}
+
+// FindForgiven returns the notices of the debts forgiven to the debtor, in the order of forgiveness
+func (p *PaymentRepoMemory) FindForgiven(debtorID int) ([]model.Forgiveness, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	notices := []model.Forgiveness{}
+	for _, f := range p.s.forgiven {
+		if f.DebtorID == debtorID {
+			notices = append(notices, f)
+		}
+	}
+	return notices, nil
+}
+
+// DismissForgiven deletes the notice of a forgiven debt once the debtor has read it
+func (p *PaymentRepoMemory) DismissForgiven(debtorID, id int) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	for i, f := range p.s.forgiven {
+		if f.ID == id && f.DebtorID == debtorID {
+			p.s.forgiven = append(p.s.forgiven[:i], p.s.forgiven[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// FindProposedDebts returns the loans and splits proposed to the debtor
+func (p *PaymentRepoMemory) FindProposedDebts(debtorID int) ([]model.Proposal, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	return p.s.proposals(func(d *memoryDebt) bool { return d.debtor == debtorID }), nil
+}
+
+// FindProposedLoans returns the loans and splits which the creditor proposed
+func (p *PaymentRepoMemory) FindProposedLoans(creditorID int) ([]model.Proposal, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	return p.s.proposals(func(d *memoryDebt) bool { return d.creditor == creditorID }), nil
+}
+
+// proposals returns the proposed debts which the filter accepts, in the order of their creation.
+// The caller holds the lock.
+func (s *MemoryStore) proposals(filter func(d *memoryDebt) bool) []model.Proposal {
+	proposals := []model.Proposal{}
+	for _, id := range s.statusIDs() {
+		if d := s.debts[id]; d.status == proposedStatus && filter(d) {
+			proposals = append(proposals, model.Proposal{StatusID: id, CreditorID: d.creditor, DebtorID: d.debtor,
+				Amount: d.amount, Total: d.statusAmount, Currency: d.currency, Description: d.description,
+				Split: d.expenseID != 0, Date: d.accruesFrom, Terms: d.terms})
+		}
+	}
+	return proposals
+}
+
+// AcceptProposal accepts a loan or a split proposed to the debtor, as the SQL AcceptProposal does
+func (p *PaymentRepoMemory) AcceptProposal(debtorID int, c *model.Consent) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	d, err := p.s.proposedDebt(debtorID, c.StatusID, false)
+	if err != nil {
+		return err
+	}
+
+	changes := map[walletKey]model.Amount{{userID: d.creditor, account: d.account, currency: d.currency}: -d.statusAmount}
+	if d.expenseID == 0 {
+		changes[walletKey{userID: d.debtor, account: accountOf(c.Account), currency: d.currency}] = d.amount
+	}
+	if err := p.s.addToWallets(changes); err != nil {
+		return badRequest("not enough money: %v", err)
+	}
+
+	if d.expenseID == 0 {
+		p.s.addHistory(model.History{UserID: d.debtor, Amount: d.amount, Currency: d.currency, Account: c.Account,
+			CategoryID: c.DebtCategoryID, Description: d.description, Date: d.accruesFrom})
+	}
+	p.s.addHistory(model.History{UserID: d.creditor, Amount: d.amount, Currency: d.currency, Account: d.account,
+		CategoryID: c.LoanCategoryID, Description: d.description, Date: d.accruesFrom})
+
+	// The debt accrues interest from its acceptance
+	d.status = ongoingStatus
+	d.statusAmount = d.amount
+	d.accruesFrom = occurredAt(c.Date)
+	return nil
+}
+
+// RejectProposal deletes a proposed loan or split. The debtor rejects it, or the creditor withdraws it.
+func (p *PaymentRepoMemory) RejectProposal(userID, statusID int) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if _, err := p.s.proposedDebt(userID, statusID, true); err != nil {
+		return err
+	}
+	delete(p.s.debts, statusID)
+	return nil
+}
+
+// proposedDebt returns the debt with the status ID, as checkProposed checks it. The caller holds the lock.
+func (s *MemoryStore) proposedDebt(userID, statusID int, creditorToo bool) (*memoryDebt, error) {
+	d, ok := s.debts[statusID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if d.debtor != userID && !(creditorToo && d.creditor == userID) {
+		return nil, ErrNotParty
+	}
+	if d.status != proposedStatus {
+		return nil, errNotProposed
+	}
+	return d, nil
+}
+
+func (p *PaymentRepoMemory) FindCategoryName(creditorID, statusID int) (string, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	d, ok := p.s.debts[statusID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	if d.creditor != creditorID {
+		return "", ErrNotParty
+	}
+	return d.category, nil
+}
+
+// inPeriod tells whether the entry is within the period, as periodCondition does in SQL
+func inPeriod(h model.History, period model.Period) bool {
+	if !period.From.IsZero() && h.Date.Before(period.From) {
+		return false
+	}
+	if !period.To.IsZero() && !h.Date.Before(period.To) {
+		return false
+	}
+	return true
+}
+
+func (p *PaymentRepoMemory) FindHistory(userID int, period model.Period) (*model.HistoryShowAll, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	aps := []model.HistoryShow{}
+	for _, h := range p.s.history {
+		if h.UserID != userID || !inPeriod(h, period) {
+			continue
+		}
+		c, err := p.s.category(h.CategoryID)
+		if err != nil {
+			// An INNER JOIN skips entries without a category
+			continue
+		}
+		aps = append(aps, model.HistoryShow{ID: h.ID, Amount: h.Amount, Currency: h.Currency, Account: h.Account,
+			CategoryName: c.Name, CategoryType: c.CType, Description: h.Description, Date: h.Date})
+	}
+
+	// The newest first
+	sort.SliceStable(aps, func(i, j int) bool { return aps[i].Date.After(aps[j].Date) })
+	return &model.HistoryShowAll{HistoryShowAll: aps}, nil
+}
+
+// entry returns the index of the entry of the user. The caller holds the lock.
+func (s *MemoryStore) entry(userID, entryID int) (int, error) {
+	for i, h := range s.history {
+		if h.ID == entryID && h.UserID == userID {
+			return i, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+// UpdateEntry changes the amount, category, description and date of a history entry
+// and adjusts the wallet balance by the difference.
+// A zero CategoryID or Date keeps the current value.
+func (p *PaymentRepoMemory) UpdateEntry(h *model.History) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	i, err := p.s.entry(h.UserID, h.ID)
+	if err != nil {
+		return err
+	}
+	old := p.s.history[i]
+	oldC, err := p.s.category(old.CategoryID)
+	if err != nil {
+		return err
+	}
+	if model.IsSystemCategory(oldC.Name) {
+		return badRequest("entries of loans and repayments cannot be edited")
+	}
+
+	categoryID, date := h.CategoryID, h.Date
+	if categoryID == 0 {
+		categoryID = old.CategoryID
+	}
+	if date.IsZero() {
+		date = old.Date
+	}
+
+	newC, err := p.s.category(categoryID)
+	if err != nil || !visible(newC, h.UserID) {
+		return sql.ErrNoRows
+	}
+	if model.IsSystemCategory(newC.Name) {
+		return badRequest("category %s is reserved for loans", newC.Name)
+	}
+
+	// Apply the difference to the wallet
+	delta := signedAmount(h.Amount, newC.CType) - signedAmount(old.Amount, oldC.CType)
+	key := walletKey{userID: h.UserID, account: old.Account, currency: old.Currency}
+	if err := p.s.addToWallets(map[walletKey]model.Amount{key: delta}); err != nil {
+		return badRequest("not enough money: %v", err)
+	}
+
+	p.s.history[i] = model.History{ID: old.ID, UserID: old.UserID, Amount: h.Amount, Currency: old.Currency,
+		Account: old.Account, CategoryID: categoryID, Description: h.Description, Date: date.UTC(),
+		RecurringID: old.RecurringID, Occurrence: old.Occurrence}
+	return nil
+}
+
+// DeleteEntry removes a history entry and reverts its effect on the wallet balance
+func (p *PaymentRepoMemory) DeleteEntry(userID, entryID int) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	i, err := p.s.entry(userID, entryID)
+	if err != nil {
+		return err
+	}
+	h := p.s.history[i]
+	c, err := p.s.category(h.CategoryID)
+	if err != nil {
+		return err
+	}
+	if model.IsSystemCategory(c.Name) {
+		return badRequest("entries of loans and repayments cannot be deleted")
+	}
+
+	// Revert the entry
+	key := walletKey{userID: userID, account: h.Account, currency: h.Currency}
+	if err := p.s.addToWallets(map[walletKey]model.Amount{key: -signedAmount(h.Amount, c.CType)}); err != nil {
+		return badRequest("not enough money: %v", err)
+	}
+
+	p.s.history = append(p.s.history[:i], p.s.history[i+1:]...)
+	return nil
+}
+
+// t: true == "expense" or false == "income"
+func (p *PaymentRepoMemory) FindStatistics(userID int, t bool, period model.Period) (*model.Statistics, error) {
+	p.s.mu.RLock()
+	defer p.s.mu.RUnlock()
+
+	rates, currency, err := p.s.findRates(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cType := income
+	if t {
+		cType = expense
+	}
+
+	// GROUP BY COALESCE(p.name, c.name), m.currency: subcategories count to their parent
+	type group struct{ name, currency string }
+	amounts := map[group]model.Amount{}
+	for _, h := range p.s.history {
+		if h.UserID != userID || !inPeriod(h, period) {
+			continue
+		}
+		c, err := p.s.category(h.CategoryID)
+		if err != nil || c.CType != cType {
+			continue
+		}
+		if parent, err := p.s.category(c.ParentID); err == nil {
+			c = parent
+		}
+		amounts[group{c.Name, h.Currency}] += h.Amount
+	}
+
+	sums := make([]categorySum, 0, len(amounts))
+	for g, amount := range amounts {
+		sums = append(sums, categorySum{name: g.name, Money: model.Money{Amount: amount, Currency: g.currency}})
+	}
+	sort.Slice(sums, func(i, j int) bool {
+		if sums[i].name != sums[j].name {
+			return sums[i].name < sums[j].name
+		}
+		return sums[i].Currency < sums[j].Currency
+	})
+	return statisticsOf(sums, rates, currency, cType)
+}
@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/hpmalinova/Money-Manager/model"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMemoryUsers creates users with IDs from 1 to n
+func newMemoryUsers(t *testing.T, s *MemoryStore, n int) {
+	t.Helper()
+
+	for i := 1; i <= n; i++ {
+		if _, err := NewUserRepoMemory(s).Create(&model.User{Username: "user" + strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPaymentRepoMemory(t *testing.T) {
+	s := NewMemoryStore()
+	newMemoryUsers(t, s, 2)
+	repo := NewPaymentRepoMemory(s)
+	assert.NoError(t, repo.CreateWallet(1))
+	assert.NoError(t, repo.CreateWallet(2))
+	assert.NoError(t, repo.Earn(&model.History{UserID: 1, Amount: 100, CategoryID: 8}))
+
+	t.Run("balance cannot be negative", func(t *testing.T) {
+		loan := &model.TransferLoan{
+			DebtCategoryID: 6,
+			Transfer: model.Transfer{
+				CreditorID:     1,
+				LoanCategoryID: 1,
+				Loan:           model.Loan{DebtorID: 2, Amount: 101},
+			},
+		}
+		assert.Error(t, repo.GiveLoan(loan))
+
+		// Nothing is changed
+		balance, _ := repo.CheckBalance(2)
+		assert.Equal(t, model.Amount(0), balance.Total.Amount)
+		debts, _ := repo.FindActiveDebts(2)
+		assert.Empty(t, debts)
+	})
+	t.Run("repay part of a loan", func(t *testing.T) {
+		loan := &model.TransferLoan{
+			DebtCategoryID:    6,
+			RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{
+				CreditorID:     1,
+				LoanCategoryID: 1,
+				Loan:           model.Loan{DebtorID: 2, Amount: 40},
+			},
+		}
+		assert.NoError(t, repo.GiveLoan(loan))
+		acceptProposed(t, repo, 2)
+		debts, _ := repo.FindActiveDebts(2)
+		statusID := debts[0].StatusID
+
+		// More than the debt is capped
+		assert.NoError(t, repo.RequestRepay(2, statusID, 100, ""))
+		assert.NoError(t, repo.DeclinePayment(1, statusID))
+		assert.NoError(t, repo.RequestRepay(2, statusID, 15, ""))
+		assert.Equal(t, ErrNotParty, repo.DeclinePayment(2, statusID), "the debtor cannot decline")
+		assert.NoError(t, repo.AcceptPayment(1, &model.Accept{StatusID: statusID, RepayC: model.Category{ID: 7},
+			ExpenseC: model.Category{ID: 2}}))
+
+		loans, _ := repo.FindActiveLoans(1)
+		assert.Equal(t, []model.LoanExt{{StatusID: statusID, Loan: model.Loan{DebtorID: 2, Amount: 25, Currency: "BGN"}}}, loans)
+		balance, _ := repo.CheckBalance(1)
+		assert.Equal(t, model.Amount(75), balance.Total.Amount)
+	})
+	t.Run("wallet per currency", func(t *testing.T) {
+		pay := &model.History{UserID: 2, Amount: 10, Currency: "EUR", CategoryID: 3}
+		assert.Error(t, repo.Pay(pay), "there is no EUR wallet")
+
+		assert.NoError(t, repo.Earn(&model.History{UserID: 2, Amount: 100, Currency: "EUR", CategoryID: 8}))
+		assert.NoError(t, repo.Pay(pay))
+
+		balance, err := repo.CheckBalance(2)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Money{{Amount: 25, Currency: "BGN"}, {Amount: 90, Currency: "EUR"}}, balance.Wallets)
+		assert.Equal(t, model.Money{Amount: 201, Currency: "BGN"}, balance.Total)
+
+		s, err := repo.FindStatistics(2, false, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Money{{Amount: 40, Currency: "BGN"}, {Amount: 100, Currency: "EUR"}}, s.Totals)
+		assert.Equal(t, model.Money{Amount: 236, Currency: "BGN"}, s.Total)
+	})
+	t.Run("accounts", func(t *testing.T) {
+		assert.NoError(t, repo.CreateAccount(1, "bank"))
+		assert.Error(t, repo.CreateAccount(1, "bank"), "the account exists")
+
+		assert.NoError(t, repo.Transfer(&model.AccountTransfer{UserID: 1, From: "cash", To: "bank", Amount: 50}))
+		assert.Error(t, repo.Transfer(&model.AccountTransfer{UserID: 1, From: "cash", To: "card", Amount: 5}),
+			"there is no card account")
+		assert.NoError(t, repo.Pay(&model.History{UserID: 1, Amount: 20, Account: "bank", CategoryID: 3}))
+
+		balance, err := repo.CheckBalance(1)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Account{
+			{Name: "bank", Wallets: []model.Money{{Amount: 30, Currency: "BGN"}}, Total: model.Money{Amount: 30, Currency: "BGN"}},
+			{Name: "cash", Wallets: []model.Money{{Amount: 25, Currency: "BGN"}}, Total: model.Money{Amount: 25, Currency: "BGN"}},
+		}, balance.Accounts)
+		assert.Equal(t, model.Money{Amount: 55, Currency: "BGN"}, balance.Total)
+
+		// A transfer is neither an expense nor an income
+		h, err := repo.FindHistory(1, model.Period{})
+		assert.NoError(t, err)
+		assert.Len(t, h.HistoryShowAll, 4)
+		assert.Contains(t, h.HistoryShowAll, model.HistoryShow{ID: 8, Amount: 20, Currency: "BGN", Account: "bank",
+			CategoryName: "food", CategoryType: expense, Date: h.HistoryShowAll[0].Date})
+	})
+	t.Run("loan with interest", func(t *testing.T) {
+		loan := &model.TransferLoan{
+			DebtCategoryID:    6,
+			RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{
+				CreditorID:     1,
+				LoanCategoryID: 1,
+				Date:           time.Now().Add(-73 * 24 * time.Hour),
+				Loan: model.Loan{DebtorID: 2, Amount: 20, Terms: model.Terms{InterestRate: 50,
+					DueDate: time.Now().AddDate(0, 0, -1)}},
+			},
+		}
+		assert.NoError(t, repo.GiveLoan(loan))
+		acceptProposedOn(t, repo, 2, loan.Date)
+
+		// The overdue loan comes first
+		debts, _ := repo.FindActiveDebts(2)
+		assert.Len(t, debts, 2)
+		assert.Equal(t, model.Accrued{Interest: 2, Overdue: true}, debts[0].Accrued, "50% of 0.20 for 73 days")
+		statusID := debts[0].StatusID
+
+		accept := &model.Accept{StatusID: statusID, RepayC: model.Category{ID: 7}, ExpenseC: model.Category{ID: 2}}
+		assert.NoError(t, repo.RequestRepay(2, statusID, 1, ""))
+		assert.EqualError(t, repo.AcceptPayment(1, &model.Accept{StatusID: statusID, Account: "card"}),
+			"there is no account card")
+		assert.NoError(t, repo.AcceptPayment(1, accept))
+		debts, _ = repo.FindActiveDebts(2)
+		assert.Equal(t, model.Amount(20), debts[0].Amount, "the repayment pays the interest first")
+		assert.Equal(t, model.Amount(1), debts[0].Interest)
+
+		assert.NoError(t, repo.RequestRepay(2, statusID, 100, ""))
+		assert.NoError(t, repo.AcceptPayment(1, accept))
+		loans, _ := repo.FindActiveLoans(1)
+		assert.Equal(t, []model.LoanExt{{StatusID: debts[1].StatusID, Loan: model.Loan{DebtorID: 2, Amount: 25, Currency: "BGN"}}}, loans)
+		balance, _ := repo.CheckBalance(1)
+		assert.Equal(t, model.Amount(57), balance.Total.Amount)
+	})
+	t.Run("split proposal", func(t *testing.T) {
+		split := &model.TransferSplit{
+			Expense:          model.Category{ID: 3, Name: "food"},
+			DebtCategoryName: "food",
+			Transfer: model.Transfer{
+				CreditorID:     1,
+				LoanCategoryID: 1,
+				Loan:           model.Loan{DebtorID: 2, Amount: 11},
+			},
+		}
+		assert.NoError(t, repo.Split(split))
+		debts, _ := repo.FindProposedDebts(2)
+		assert.Len(t, debts, 1)
+		assert.Equal(t, model.Amount(5), debts[0].Amount, "the payer pays the odd minor unit")
+		statusID := debts[0].StatusID
+
+		// The money is checked again when the debtor accepts
+		balance, _ := repo.CheckBalance(1)
+		cash := balance.Accounts[1].Total.Amount
+		assert.NoError(t, repo.Transfer(&model.AccountTransfer{UserID: 1, From: "cash", To: "bank", Amount: cash}))
+		consent := &model.Consent{StatusID: statusID, LoanCategoryID: 1, DebtCategoryID: 6}
+		assert.Error(t, repo.AcceptProposal(2, consent))
+		assert.NoError(t, repo.Transfer(&model.AccountTransfer{UserID: 1, From: "bank", To: "cash", Amount: cash}))
+
+		assert.NoError(t, repo.RejectProposal(2, statusID))
+		loans, _ := repo.FindProposedLoans(1)
+		assert.Empty(t, loans)
+		balance, _ = repo.CheckBalance(1)
+		assert.Equal(t, model.Amount(51), balance.Total.Amount, "the own share stays paid")
+	})
+	t.Run("forgive", func(t *testing.T) {
+		assert.NoError(t, repo.GiveLoan(&model.TransferLoan{DebtCategoryID: 6,
+			Transfer: model.Transfer{CreditorID: 1, LoanCategoryID: 1, Loan: model.Loan{DebtorID: 2, Amount: 10}}}))
+		acceptProposed(t, repo, 2)
+		loans, _ := repo.FindActiveLoans(1)
+		statusID := loans[len(loans)-1].StatusID
+
+		forgive := &model.Forgive{StatusID: statusID, Amount: 4, ForgiveC: model.Category{ID: 11},
+			ForgivenC: model.Category{ID: 12}}
+		assert.Equal(t, ErrNotParty, repo.Forgive(2, forgive))
+		assert.NoError(t, repo.Forgive(1, forgive))
+		forgive.Amount = 100
+		assert.Equal(t, errForgiveAmount, repo.Forgive(1, forgive), "no more than the debt is forgiven")
+		forgive.Amount = -1
+		assert.Equal(t, errForgiveAmount, repo.Forgive(1, forgive))
+		forgive.Amount = 0
+		assert.NoError(t, repo.Forgive(1, forgive))
+		assert.Equal(t, sql.ErrNoRows, repo.Forgive(1, forgive))
+
+		notices, _ := repo.FindForgiven(2)
+		assert.Len(t, notices, 2)
+		assert.Equal(t, model.Amount(6), notices[1].Amount)
+		assert.True(t, notices[1].Closed)
+		assert.Equal(t, sql.ErrNoRows, repo.DismissForgiven(1, notices[0].ID))
+		assert.NoError(t, repo.DismissForgiven(2, notices[0].ID))
+		notices, _ = repo.FindForgiven(2)
+		assert.Len(t, notices, 1)
+		balance, _ := repo.CheckBalance(1)
+		assert.Equal(t, model.Amount(41), balance.Total.Amount)
+	})
+	t.Run("missing rows", func(t *testing.T) {
+		_, err := repo.CheckBalance(3)
+		assert.Equal(t, sql.ErrNoRows, err)
+		assert.Equal(t, sql.ErrNoRows, repo.DeleteEntry(2, 1))
+	})
+}
+
+func TestGroupRepoMemory(t *testing.T) {
+	s := NewMemoryStore()
+	newMemoryUsers(t, s, 3)
+	repo := NewGroupRepoMemory(s)
+	payment := NewPaymentRepoMemory(s)
+	for id := 1; id <= 3; id++ {
+		assert.NoError(t, payment.CreateWallet(id))
+	}
+
+	group, err := repo.Create("Trip", 1, []int{2, 3})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Join(group.ID, 2))
+	assert.Equal(t, sql.ErrNoRows, repo.Join(group.ID, 2), "the invitation is accepted")
+
+	t.Run("shared expense", func(t *testing.T) {
+		assert.NoError(t, payment.Earn(&model.History{UserID: 2, Amount: 100, CategoryID: 8}))
+		expense := &model.SplitExpense{GroupID: group.ID, PayerID: 2, LoanCategoryID: 1,
+			Expense: model.Category{ID: 3, Name: "food"}, DebtCategoryName: "food", Amount: 40, Currency: "BGN",
+			Own: 20, Shares: []model.Share{{DebtorID: 1, Amount: 20}}}
+		assert.NoError(t, payment.SplitExpense(expense))
+		g, err := repo.FindByID(group.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, g.Members[0].Balance, "the share is not owed before it is accepted")
+		acceptProposed(t, payment, 1)
+
+		g, err = repo.FindByID(group.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.GroupMember{
+			{UserID: 1, Username: "user1", Status: model.MemberStatus, Balance: []model.Money{{Amount: -20, Currency: "BGN"}}},
+			{UserID: 2, Username: "user2", Status: model.MemberStatus, Balance: []model.Money{{Amount: 20, Currency: "BGN"}}},
+			{UserID: 3, Username: "user3", Status: model.InvitedStatus, Balance: []model.Money{}},
+		}, g.Members)
+	})
+	t.Run("settle", func(t *testing.T) {
+		expense := &model.SplitExpense{GroupID: group.ID, PayerID: 1, LoanCategoryID: 1,
+			Expense: model.Category{ID: 3, Name: "food"}, DebtCategoryName: "food", Amount: 10, Currency: "BGN",
+			Shares: []model.Share{{DebtorID: 2, Amount: 10}}}
+		assert.NoError(t, payment.Earn(&model.History{UserID: 1, Amount: 10, CategoryID: 8}))
+		assert.NoError(t, payment.SplitExpense(expense))
+		acceptProposed(t, payment, 2)
+		assert.NoError(t, payment.Settle(model.DebtScope{GroupID: group.ID}))
+
+		debts, err := payment.FindOpenDebts(model.DebtScope{GroupID: group.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.OpenDebt{{StatusID: debts[0].StatusID, CreditorID: 2, DebtorID: 1, Amount: 10,
+			Currency: "BGN"}}, debts)
+	})
+	t.Run("leave", func(t *testing.T) {
+		assert.Error(t, repo.Leave(group.ID, 1), "user1 owes user2")
+		assert.NoError(t, repo.Leave(group.ID, 3))
+		assert.Equal(t, sql.ErrNoRows, repo.Leave(group.ID, 3))
+
+		invites, err := repo.FindInvites(3)
+		assert.NoError(t, err)
+		assert.Empty(t, invites)
+	})
+}
+
+func TestRecurringRepoMemory(t *testing.T) {
+	s := NewMemoryStore()
+	newMemoryUsers(t, s, 2)
+	repo := NewRecurringRepoMemory(s)
+	payment := NewPaymentRepoMemory(s)
+	assert.NoError(t, payment.CreateWallet(1))
+
+	rule, err := repo.Create(&model.Recurring{UserID: 1, Amount: 50, CategoryID: 4, Frequency: model.Weekly})
+	assert.NoError(t, err)
+
+	t.Run("an occurrence is recorded once", func(t *testing.T) {
+		assert.NoError(t, payment.Earn(&model.History{UserID: 1, Amount: 100, CategoryID: 8}))
+		h := &model.History{UserID: 1, Amount: 50, CategoryID: 4, RecurringID: rule.ID, Occurrence: 3}
+		assert.NoError(t, payment.Pay(h))
+		assert.Equal(t, ErrRecorded, payment.Pay(h))
+
+		balance, _ := payment.CheckBalance(1)
+		assert.Equal(t, model.Amount(50), balance.Total.Amount)
+	})
+	t.Run("rules of the user", func(t *testing.T) {
+		rules, err := repo.FindByUser(1)
+		assert.NoError(t, err)
+		if assert.Len(t, rules, 1) {
+			assert.Equal(t, "home", rules[0].CategoryName)
+			assert.Equal(t, model.ExpenseType, rules[0].CategoryType)
+		}
+
+		_, err = repo.FindByID(2, rule.ID)
+		assert.Equal(t, sql.ErrNoRows, err)
+		assert.Equal(t, sql.ErrNoRows, repo.Delete(2, rule.ID))
+		assert.NoError(t, repo.Delete(1, rule.ID))
+	})
+}
+
+func TestCategoryRepoMemory(t *testing.T) {
+	s := NewMemoryStore()
+	newMemoryUsers(t, s, 2)
+	repo := NewCategoryRepoMemory(s)
+	payment := NewPaymentRepoMemory(s)
+	assert.NoError(t, payment.CreateWallet(1))
+
+	restaurants, err := repo.Create(&model.Category{UserID: 1, CType: model.ExpenseType, Name: "restaurants", ParentID: 3})
+	assert.NoError(t, err)
+	_, err = repo.Create(&model.Category{UserID: 1, CType: model.ExpenseType, Name: "restaurants"})
+	assert.Error(t, err)
+
+	t.Run("a subcategory counts to its parent", func(t *testing.T) {
+		assert.NoError(t, payment.Earn(&model.History{UserID: 1, Amount: 100, CategoryID: 8}))
+		assert.NoError(t, payment.Pay(&model.History{UserID: 1, Amount: 25, CategoryID: restaurants.ID}))
+		stats, err := payment.FindStatistics(1, true, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Ratio{{Percent: "1.00", CategoryName: "food"}}, stats.Ratios)
+	})
+	t.Run("only the user sees and changes their categories", func(t *testing.T) {
+		_, err := repo.FindByName(2, "restaurants")
+		assert.Equal(t, sql.ErrNoRows, err)
+		assert.Equal(t, sql.ErrNoRows, repo.Archive(2, restaurants.ID, true))
+		assert.Error(t, repo.Archive(1, 1, true), "the system categories are shared")
+
+		assert.NoError(t, repo.Archive(1, restaurants.ID, true))
+		expenses, err := repo.FindExpenses(1)
+		assert.NoError(t, err)
+		assert.Empty(t, expenses[2].Children)
+	})
+}
+
+func TestImportMemory(t *testing.T) {
+	s := NewMemoryStore()
+	newMemoryUsers(t, s, 1)
+	payment := NewPaymentRepoMemory(s)
+	rules := NewImportRuleRepoMemory(s)
+	assert.NoError(t, payment.CreateWallet(1))
+
+	_, err := rules.Create(&model.ImportRule{UserID: 1, Pattern: "shell", CategoryID: 5})
+	assert.NoError(t, err)
+	found, err := rules.Find(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "car", found[0].Category)
+	assert.Equal(t, model.ExpenseType, found[0].CType)
+
+	assert.NoError(t, payment.Import([]model.History{
+		{UserID: 1, Amount: 100, CategoryID: 8},
+		{UserID: 1, Amount: 40, CategoryID: 5},
+	}))
+	assert.Error(t, payment.Import([]model.History{
+		{UserID: 1, Amount: 10, CategoryID: 5},
+		{UserID: 1, Amount: 100, CategoryID: 5},
+	}))
+
+	// Only the first import is recorded
+	balance, _ := payment.CheckBalance(1)
+	assert.Equal(t, model.Amount(60), balance.Total.Amount)
+	h, _ := payment.FindHistory(1, model.Period{})
+	assert.Len(t, h.HistoryShowAll, 2)
+}
+
+func TestPaymentRepoMemory_Concurrent(t *testing.T) {
+	s := NewMemoryStore()
+	newMemoryUsers(t, s, 1)
+	repo := NewPaymentRepoMemory(s)
+	assert.NoError(t, repo.CreateWallet(1))
+	assert.NoError(t, repo.Earn(&model.History{UserID: 1, Amount: 50, CategoryID: 8}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = repo.Pay(&model.History{UserID: 1, Amount: 1, CategoryID: 3})
+		}()
+	}
+	wg.Wait()
+
+	// Only 50 payments fit in the balance
+	balance, err := repo.CheckBalance(1)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Amount(0), balance.Total.Amount)
+	h, err := repo.FindHistory(1, model.Period{})
+	assert.NoError(t, err)
+	assert.Len(t, h.HistoryShowAll, 51)
+}
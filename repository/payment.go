@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hpmalinova/Money-Manager/model"
-	"log"
+	"sort"
 	"time"
 )
 
@@ -14,51 +14,257 @@ type PaymentRepoMysql struct {
 	db *sql.DB
 }
 
-func NewPaymentRepoMysql(user, password, dbname string) *PaymentRepoMysql {
-	connectionString := fmt.Sprintf("%s:%s@/%s", user, password, dbname)
-	repo := &PaymentRepoMysql{}
-	var err error
-	repo.db, err = sql.Open("mysql", connectionString)
+func NewPaymentRepoMysql(db *sql.DB) *PaymentRepoMysql {
+	return &PaymentRepoMysql{db: db}
+}
+
+const (
+	ongoingStatus  = "ongoing"
+	pendingStatus  = "pending"
+	proposedStatus = "proposed"
+)
+
+// ErrRecorded is returned when an occurrence of a recurring rule is already recorded
+var ErrRecorded = errors.New("the occurrence is already recorded")
+
+// ErrNotParty is returned when a user acts on a debt of which they are not the debtor or the creditor, as the action requires
+var ErrNotParty = errors.New("the user is not a party to the debt")
+
+// BadRequestError is returned when a request cannot be carried out because of the data it acts on,
+// such as repaying a debt which is not accepted yet or paying more than an account has
+type BadRequestError struct {
+	Message string
+}
+
+func (e *BadRequestError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &BadRequestError{Message: fmt.Sprintf(format, a...)}
+}
+
+// errNotPending is returned when a creditor accepts or declines a repayment which is not requested
+var errNotPending = badRequest("there is no pending repayment of the debt")
+
+// errNotProposed is returned when a loan or a split which is not proposed is accepted or rejected
+var errNotProposed = badRequest("the debt is not proposed")
+
+// errProposed is returned when a debt is repaid or forgiven before the debtor has accepted it
+var errProposed = badRequest("the debt is not accepted yet")
+
+// errPending is returned when a debt is forgiven while a repayment of it awaits the creditor
+var errPending = badRequest("a repayment of the debt is pending")
+
+// errForgiveAmount is returned when more than the debt, or a negative amount, is forgiven
+var errForgiveAmount = badRequest("the forgiven amount must not be negative or more than the debt")
+
+// occurredAt returns t, or the current time if t is not set.
+// Times are stored in UTC: SQLite keeps them as text, which only sorts correctly in a single time zone.
+func occurredAt(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now().UTC()
+	}
+	return t.UTC()
+}
+
+// currencyOf returns the currency, or DefaultCurrency if it is not set, as the default of the currency columns
+func currencyOf(currency string) string {
+	if currency == "" {
+		return model.DefaultCurrency
+	}
+	return currency
+}
+
+// accountOf returns the account, or DefaultAccount if it is not set, as the default of the account columns
+func accountOf(account string) string {
+	if account == "" {
+		return model.DefaultAccount
+	}
+	return account
+}
+
+// checkOccurrence returns ErrRecorded if the entry is an occurrence of a recurring rule which is already recorded
+func checkOccurrence(ctx context.Context, tx *sql.Tx, h *model.History) error {
+	if h.RecurringID == 0 {
+		return nil
+	}
+	var count int
+	statement := "SELECT COUNT(*) FROM money_history WHERE recurring_id = ? AND occurrence = ?"
+	if err := tx.QueryRowContext(ctx, statement, h.RecurringID, h.Occurrence).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRecorded
+	}
+	return nil
+}
+
+// insertHistory records the entry of a payment or an income, with its occurrence if a recurring rule recorded it
+func insertHistory(ctx context.Context, tx *sql.Tx, h *model.History, currency, account string) error {
+	recurring := sql.NullInt64{Int64: int64(h.RecurringID), Valid: h.RecurringID != 0}
+	occurrence := sql.NullInt64{Int64: int64(h.Occurrence), Valid: h.RecurringID != 0}
+	statement := "INSERT INTO money_history(uid, amount, currency, account, category_id, description, occurred_at, recurring_id, occurrence) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := tx.ExecContext(ctx, statement, h.UserID, h.Amount, currency, account, h.CategoryID, h.Description, occurredAt(h.Date), recurring, occurrence)
+	return err
+}
+
+// addToWallet changes the balance of the wallet of the account of the user in the currency.
+// The account must exist. The first income in a currency opens a wallet in it; spending fails without one.
+func addToWallet(ctx context.Context, tx *sql.Tx, userID int, account, currency string, amount model.Amount) error {
+	statement := "SELECT currency FROM wallet WHERE user_id = ? AND account = ?"
+	rows, err := tx.QueryContext(ctx, statement, userID, account)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer rows.Close()
+
+	accountExists, walletExists := false, false
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return err
+		}
+		accountExists = true
+		walletExists = walletExists || c == currency
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if !accountExists {
+		return badRequest("there is no account %s", account)
+	}
+	if !walletExists {
+		if amount < 0 {
+			return fmt.Errorf("no %s wallet in %s", currency, account)
+		}
+		statement = "INSERT INTO wallet(user_id, account, currency, balance) VALUES(?, ?, ?, ?)"
+		_, err := tx.ExecContext(ctx, statement, userID, account, currency, amount)
+		return err
 	}
 
-	repo.db.SetConnMaxLifetime(time.Minute * 5)
-	repo.db.SetMaxOpenConns(10)
-	repo.db.SetMaxIdleConns(10)
-	repo.db.SetConnMaxIdleTime(time.Minute * 3)
+	statement = "UPDATE wallet SET balance = balance + ? WHERE user_id = ? AND account = ? AND currency = ?"
+	_, err = tx.ExecContext(ctx, statement, amount, userID, account, currency)
+	return err
+}
 
-	return repo
+// splitShares divides the amount of a split into the share of the payer and the share lent to the friend.
+// An odd minor unit is paid by the payer, so that the shares always add up to the amount.
+func splitShares(amount model.Amount) (own, lent model.Amount) {
+	shares := amount.Split(2)
+	return shares[0], shares[1]
 }
 
-const (
-	ongoingStatus = "ongoing"
-	pendingStatus = "pending"
-)
+// splitOf returns the expense of the split shared in halves by the creditor and the debtor
+func splitOf(t *model.TransferSplit) *model.SplitExpense {
+	own, lent := splitShares(t.Amount)
+	return &model.SplitExpense{PayerID: t.CreditorID, Account: t.Account, LoanCategoryID: t.LoanCategoryID,
+		Expense: t.Expense, DebtCategoryName: t.DebtCategoryName, Amount: t.Amount, Currency: t.Currency,
+		Description: t.Description, Date: t.Date, Own: own, Shares: []model.Share{{DebtorID: t.DebtorID, Amount: lent}}}
+}
+
+// periodCondition limits m.occurred_at to the given period.
+// It returns the condition to append to a WHERE clause and its arguments.
+func periodCondition(period model.Period) (string, []interface{}) {
+	condition := ""
+	args := []interface{}{}
+	if !period.From.IsZero() {
+		condition += " AND m.occurred_at >= ?"
+		args = append(args, period.From.UTC())
+	}
+	if !period.To.IsZero() {
+		condition += " AND m.occurred_at < ?"
+		args = append(args, period.To.UTC())
+	}
+	return condition, args
+}
+
+// CheckBalance returns the balances of the accounts of the user, the balance in every currency
+// and their total in the base currency of the user
+func (p *PaymentRepoMysql) CheckBalance(userID int) (*model.Balance, error) {
+	rates, currency, err := findRates(p.db, userID)
+	if err != nil {
+		return nil, err
+	}
 
-func (p *PaymentRepoMysql) CheckBalance(userID int) (int, error) {
-	var balance int
-	statement := "SELECT balance FROM wallet WHERE user_id= ?"
-	err := p.db.QueryRow(statement, userID).Scan(&balance)
+	statement := "SELECT account, currency, balance FROM wallet WHERE user_id= ? ORDER BY account, currency"
+	rows, err := p.db.Query(statement, userID)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallets := []accountWallet{}
+	for rows.Next() {
+		var w accountWallet
+		if err := rows.Scan(&w.account, &w.Currency, &w.Amount); err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, w)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return balanceOf(wallets, rates, currency)
+}
+
+// accountWallet is the balance of an account in a currency
+type accountWallet struct {
+	account string
+	model.Money
+}
+
+// balanceOf returns the balance of the accounts, the balance in every currency
+// and their total in the currency. The wallets are sorted by account and currency.
+func balanceOf(wallets []accountWallet, rates model.Rates, currency string) (*model.Balance, error) {
+	b := &model.Balance{Accounts: []model.Account{}, Wallets: []model.Money{}, Total: model.Money{Currency: currency}}
+	for _, w := range wallets {
+		amount, err := rates.Convert(w.Amount, w.Currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		b.Total.Amount += amount
+
+		n := len(b.Accounts)
+		if n == 0 || b.Accounts[n-1].Name != w.account {
+			b.Accounts = append(b.Accounts, model.Account{Name: w.account, Total: model.Money{Currency: currency}})
+			n++
+		}
+		b.Accounts[n-1].Wallets = append(b.Accounts[n-1].Wallets, w.Money)
+		b.Accounts[n-1].Total.Amount += amount
+
+		found := false
+		for i := range b.Wallets {
+			if b.Wallets[i].Currency == w.Currency {
+				b.Wallets[i].Amount += w.Amount
+				found = true
+			}
+		}
+		if !found {
+			b.Wallets = append(b.Wallets, w.Money)
+		}
 	}
-	return balance, nil
+	sort.Slice(b.Wallets, func(i, j int) bool { return b.Wallets[i].Currency < b.Wallets[j].Currency })
+	return b, nil
 }
 
 func (p *PaymentRepoMysql) CreateWallet(userID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	statement := "INSERT INTO wallet(user_id, balance) VALUES(?, ?)"
-	_, err := p.db.ExecContext(ctx, statement, userID, 0)
+	statement := "INSERT INTO wallet(user_id, account, currency, balance) VALUES(?, ?, ?, ?)"
+	_, err := p.db.ExecContext(ctx, statement, userID, model.DefaultAccount, model.DefaultCurrency, 0)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (p *PaymentRepoMysql) Pay(h *model.History) error {
+// CreateAccount opens an empty account of the user with a wallet in the base currency of the user
+func (p *PaymentRepoMysql) CreateAccount(userID int, name string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
@@ -77,21 +283,27 @@ func (p *PaymentRepoMysql) Pay(h *model.History) error {
 	// DEFER ROLLBACK
 	defer tx.Rollback()
 
-	// Decrease wallet
-	// TODO check if works for negative balance
-	statement := "UPDATE wallet SET balance = balance - ? WHERE user_id = ?"
-	_, err = tx.ExecContext(ctx, statement, h.Amount, h.UserID)
-	if err != nil {
-		msg := fmt.Sprintf("not enough money: %s", err.Error())
-		return errors.New(msg)
+	var count int
+	statement := "SELECT COUNT(*) FROM wallet WHERE user_id = ? AND account = ?"
+	if err = tx.QueryRowContext(ctx, statement, userID, name).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return badRequest("account %s already exists", name)
 	}
 
-	// Pay
-	statement = "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, h.UserID, h.Amount, h.CategoryID, h.Description)
+	statement = "INSERT INTO wallet(user_id, account, currency, balance) SELECT id, ?, currency, 0 FROM users WHERE id = ?"
+	result, err := tx.ExecContext(ctx, statement, name, userID)
 	if err != nil {
 		return err
 	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
 
 	// COMMIT TRANSACTION
 	if err := tx.Commit(); err != nil {
@@ -100,7 +312,8 @@ func (p *PaymentRepoMysql) Pay(h *model.History) error {
 	return nil
 }
 
-func (p *PaymentRepoMysql) Earn(h *model.History) error {
+// Transfer moves money between two accounts of the user without recording an income or an expense
+func (p *PaymentRepoMysql) Transfer(t *model.AccountTransfer) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
@@ -119,14 +332,15 @@ func (p *PaymentRepoMysql) Earn(h *model.History) error {
 	// DEFER ROLLBACK
 	defer tx.Rollback()
 
-	statement := "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, h.UserID, h.Amount, h.CategoryID, h.Description)
+	currency := currencyOf(t.Currency)
+
+	err = addToWallet(ctx, tx, t.UserID, t.From, currency, -t.Amount)
 	if err != nil {
-		return err
+		msg := fmt.Sprintf("not enough money: %s", err.Error())
+		return errors.New(msg)
 	}
 
-	statement = "UPDATE wallet SET balance = balance + ? WHERE user_id = ?"
-	_, err = tx.ExecContext(ctx, statement, h.Amount, h.UserID)
+	err = addToWallet(ctx, tx, t.UserID, t.To, currency, t.Amount)
 	if err != nil {
 		return err
 	}
@@ -138,7 +352,42 @@ func (p *PaymentRepoMysql) Earn(h *model.History) error {
 	return nil
 }
 
-func (p *PaymentRepoMysql) GiveLoan(t *model.TransferLoan) error {
+func (p *PaymentRepoMysql) Pay(h *model.History) error {
+	return p.record(func(ctx context.Context, tx *sql.Tx) error {
+		return pay(ctx, tx, h)
+	})
+}
+
+func (p *PaymentRepoMysql) Earn(h *model.History) error {
+	return p.record(func(ctx context.Context, tx *sql.Tx) error {
+		return earn(ctx, tx, h)
+	})
+}
+
+// Import records the payments and incomes of a bank statement in one transaction, in their order,
+// as Pay and Earn do. The type of an entry is the type of its category.
+func (p *PaymentRepoMysql) Import(entries []model.History) error {
+	return p.record(func(ctx context.Context, tx *sql.Tx) error {
+		for i := range entries {
+			var cType string
+			statement := "SELECT c_type FROM categories WHERE id = ?"
+			if err := tx.QueryRowContext(ctx, statement, entries[i].CategoryID).Scan(&cType); err != nil {
+				return err
+			}
+			record := earn
+			if cType == expense {
+				record = pay
+			}
+			if err := record(ctx, tx, &entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// record runs the recording of payments and incomes in a transaction
+func (p *PaymentRepoMysql) record(recording func(ctx context.Context, tx *sql.Tx) error) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
@@ -157,114 +406,118 @@ func (p *PaymentRepoMysql) GiveLoan(t *model.TransferLoan) error {
 	// DEFER ROLLBACK
 	defer tx.Rollback()
 
-	// Remove money from wallet (Creditor)
-	statement := "UPDATE wallet SET balance = balance - ? WHERE user_id = ?"
-	_, err = tx.ExecContext(ctx, statement, t.Amount, t.CreditorID)
-	if err != nil {
-		msg := fmt.Sprintf("not enough money: %s", err.Error())
-		return errors.New(msg)
-	}
-
-	// Add money to wallet (Debtor)
-	statement = "UPDATE wallet SET balance = balance + ? WHERE user_id = ?"
-	_, err = tx.ExecContext(ctx, statement, t.Amount, t.DebtorID)
-	if err != nil {
-		msg := fmt.Sprintf("not enough money: %s", err.Error())
-		return errors.New(msg)
-	}
-
-	// Add to expenses (Creditor)
-	statement = "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, t.CreditorID, t.Amount, t.LoanCategoryID, t.Description)
-	if err != nil {
+	if err := recording(ctx, tx); err != nil {
 		return err
 	}
 
-	// Add to incomes (Debtor)
-	statement = "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, t.DebtorID, t.Amount, t.DebtCategoryID, t.Description)
-	if err != nil {
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
 		return err
 	}
+	return nil
+}
 
-	// Add Debt
-	statement = "INSERT INTO debt_status(status, amount) VALUES(?, ?)"
-	result, err := tx.ExecContext(ctx, statement, ongoingStatus, t.Amount)
-	if err != nil {
+// pay records a payment and takes its amount from the wallet
+func pay(ctx context.Context, tx *sql.Tx, h *model.History) error {
+	if err := checkOccurrence(ctx, tx, h); err != nil {
 		return err
 	}
 
-	id, err := result.LastInsertId()
+	currency, account := currencyOf(h.Currency), accountOf(h.Account)
+
+	// Decrease wallet
+	// TODO check if works for negative balance
+	err := addToWallet(ctx, tx, h.UserID, account, currency, -h.Amount)
 	if err != nil {
-		return err
+		msg := fmt.Sprintf("not enough money: %s", err.Error())
+		return errors.New(msg)
 	}
-	statusID := int(id)
 
-	statement = "INSERT INTO debts(creditor, debtor, amount, category, description, status_id) VALUES(?, ?, ?, ?, ?, ?)"
-	result, err = tx.ExecContext(ctx, statement, t.CreditorID, t.DebtorID, t.Amount, t.RepayCategoryName, t.Description, statusID)
-	if err != nil {
+	// Pay
+	return insertHistory(ctx, tx, h, currency, account)
+}
+
+// earn records an income and adds its amount to the wallet
+func earn(ctx context.Context, tx *sql.Tx, h *model.History) error {
+	if err := checkOccurrence(ctx, tx, h); err != nil {
 		return err
 	}
 
-	numRows, err := result.RowsAffected()
-	if err != nil || numRows != 1 {
-		msg := fmt.Sprintf("error inserting debt: %s\n", err)
-		return errors.New(msg)
-	}
+	currency, account := currencyOf(h.Currency), accountOf(h.Account)
 
-	// COMMIT TRANSACTION
-	if err := tx.Commit(); err != nil {
+	if err := insertHistory(ctx, tx, h, currency, account); err != nil {
 		return err
 	}
-	return nil
+	return addToWallet(ctx, tx, h.UserID, account, currency, h.Amount)
 }
 
+// GiveLoan proposes the loan to the debtor. No money moves until the debtor accepts it with AcceptProposal.
+func (p *PaymentRepoMysql) GiveLoan(t *model.TransferLoan) error {
+	return p.record(func(ctx context.Context, tx *sql.Tx) error {
+		currency, account := currencyOf(t.Currency), accountOf(t.Account)
+		if err := checkFunds(ctx, tx, t.CreditorID, account, currency, t.Amount); err != nil {
+			return err
+		}
+
+		loan := t.Loan
+		loan.Currency = currency
+		return insertProposal(ctx, tx, t.CreditorID, loan, t.Amount, account, t.RepayCategoryName, 0, occurredAt(t.Date), 0)
+	})
+}
+
+// Split shares the expense in halves with the debtor, as SplitExpense does: the creditor spends their half at once,
+// and pays and lends the debtor the other half when the debtor accepts it with AcceptProposal.
 func (p *PaymentRepoMysql) Split(t *model.TransferSplit) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+	return p.SplitExpense(splitOf(t))
+}
 
-	conn, err := p.db.Conn(ctx)
-	if err != nil {
-		return err
+// checkFunds fails if the wallet of the account of the user has less than the amount
+func checkFunds(ctx context.Context, tx *sql.Tx, userID int, account, currency string, amount model.Amount) error {
+	var balance model.Amount
+	statement := "SELECT balance FROM wallet WHERE user_id = ? AND account = ? AND currency = ?"
+	err := tx.QueryRowContext(ctx, statement, userID, account, currency).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("not enough money: no %s wallet in %s", currency, account)
 	}
-	defer conn.Close()
-
-	// BEGIN TRANSACTION
-	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
 		return err
 	}
-
-	// DEFER ROLLBACK
-	defer tx.Rollback()
-
-	// Remove money from wallet (Creditor)
-	statement := "UPDATE wallet SET balance = balance - ? WHERE user_id = ?"
-	_, err = tx.ExecContext(ctx, statement, t.Amount, t.CreditorID)
-	if err != nil {
-		msg := fmt.Sprintf("not enough money: %s", err.Error())
-		return errors.New(msg)
+	if balance < amount {
+		return fmt.Errorf("not enough money: %s has %s %s", account, balance.In(currency), currency)
 	}
+	return nil
+}
 
-	halfAmount := t.Amount / 2
-
-	// Add to expenses (Creditor: Pay)
-	statement = "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, t.CreditorID, halfAmount, t.Expense.ID, t.Description)
+// insertProposal records the loan as a proposed debt. Once accepted, the creditor pays the total from the account.
+// A zero expenseID is a loan, otherwise it is a split of an expense in that category.
+// A zero groupID is a debt outside of groups.
+func insertProposal(ctx context.Context, tx *sql.Tx, creditorID int, l model.Loan, total model.Amount, account, category string,
+	expenseID int, date time.Time, groupID int) error {
+	statement := "INSERT INTO debt_status(status, amount) VALUES(?, ?)"
+	result, err := tx.ExecContext(ctx, statement, proposedStatus, total)
 	if err != nil {
 		return err
 	}
 
-	// Add to expenses (Creditor: Loan)
-	statement = "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, t.CreditorID, halfAmount, t.LoanCategoryID, t.Description)
+	id, err := result.LastInsertId()
 	if err != nil {
 		return err
 	}
+	statusID := int(id)
+
+	expense := sql.NullInt64{Int64: int64(expenseID), Valid: expenseID != 0}
+	group := sql.NullInt64{Int64: int64(groupID), Valid: groupID != 0}
+	statement = `INSERT INTO debts(creditor, debtor, amount, currency, category, description, status_id,
+					due_date, interest_rate, accrues_from, account, expense_id, group_id) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, statement, creditorID, l.DebtorID, l.Amount, l.Currency, category, l.Description, statusID,
+		dueDate(l.DueDate), l.InterestRate, date, account, expense, group)
+	return err
+}
 
-	// Add Debt
-	statement = "INSERT INTO debt_status(status, amount) VALUES(?, ?)"
-	result, err := tx.ExecContext(ctx, statement, ongoingStatus, halfAmount)
+// insertDebt records an ongoing debt of the loan. A zero groupID is a debt outside of groups.
+func insertDebt(ctx context.Context, tx *sql.Tx, creditorID int, l model.Loan, category string, groupID int) error {
+	statement := "INSERT INTO debt_status(status, amount) VALUES(?, ?)"
+	result, err := tx.ExecContext(ctx, statement, ongoingStatus, l.Amount)
 	if err != nil {
 		return err
 	}
@@ -275,44 +528,120 @@ func (p *PaymentRepoMysql) Split(t *model.TransferSplit) error {
 	}
 	statusID := int(id)
 
-	statement = "INSERT INTO debts(creditor, debtor, amount, category, description, status_id) VALUES(?, ?, ?, ?, ?, ?)"
-	result, err = tx.ExecContext(ctx, statement, t.CreditorID, t.DebtorID, halfAmount, t.Expense.Name, t.Description, statusID)
-	if err != nil {
+	group := sql.NullInt64{Int64: int64(groupID), Valid: groupID != 0}
+	statement = "INSERT INTO debts(creditor, debtor, amount, currency, category, description, status_id, group_id) VALUES(?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, statement, creditorID, l.DebtorID, l.Amount, l.Currency, category, l.Description, statusID, group)
+	return err
+}
+
+// SplitExpense records an expense which the payer paid for several participants.
+// The payer spends their own share at once and proposes to every debtor to owe their share. No share moves
+// until its debtor accepts it with AcceptProposal; then the payer pays it and lends it to the debtor.
+func (p *PaymentRepoMysql) SplitExpense(e *model.SplitExpense) error {
+	if err := checkShares(e); err != nil {
 		return err
 	}
 
-	numRows, err := result.RowsAffected()
-	if err != nil || numRows != 1 {
-		msg := fmt.Sprintf("error inserting debt: %s\n", err)
-		return errors.New(msg)
-	}
+	return p.record(func(ctx context.Context, tx *sql.Tx) error {
+		currency, account := currencyOf(e.Currency), accountOf(e.Account)
+		if err := checkFunds(ctx, tx, e.PayerID, account, currency, e.Amount); err != nil {
+			return err
+		}
 
-	// COMMIT TRANSACTION
-	if err := tx.Commit(); err != nil {
-		return err
+		date := occurredAt(e.Date)
+		if e.Own > 0 {
+			// Remove money from wallet (Payer)
+			if err := addToWallet(ctx, tx, e.PayerID, account, currency, -e.Own); err != nil {
+				return fmt.Errorf("not enough money: %v", err)
+			}
+
+			// Add to expenses (Payer: Pay)
+			statement := "INSERT INTO money_history(uid, amount, currency, account, category_id, description, occurred_at) VALUES(?, ?, ?, ?, ?, ?, ?)"
+			_, err := tx.ExecContext(ctx, statement, e.PayerID, e.Own, currency, account, e.Expense.ID, e.Description, date)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, share := range e.Shares {
+			if share.Amount == 0 {
+				continue
+			}
+
+			loan := model.Loan{DebtorID: share.DebtorID, Amount: share.Amount, Currency: currency, Description: e.Description}
+			err := insertProposal(ctx, tx, e.PayerID, loan, share.Amount, account, e.DebtCategoryName, e.Expense.ID, date,
+				e.GroupID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkShares tells whether the shares of the expense add up to its amount
+func checkShares(e *model.SplitExpense) error {
+	sum := e.Own
+	for _, share := range e.Shares {
+		if share.Amount < 0 || share.DebtorID == e.PayerID {
+			return badRequest("invalid share")
+		}
+		sum += share.Amount
+	}
+	if e.Own < 0 || sum != e.Amount {
+		return badRequest("the shares add up to %s, not %s", sum.In(e.Currency), e.Amount.In(e.Currency))
 	}
 	return nil
 }
 
+// activeDebtsOrder sorts the active debts and loans by their due date; those without one come last
+const activeDebtsOrder = " ORDER BY d.due_date IS NULL, d.due_date, d.status_id"
+
+// dueDate returns the due date of a loan as a column value; a zero time is NULL.
+// The column keeps the day of the due date, which is not shifted to UTC.
+func dueDate(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(model.DefaultDateLayout), Valid: true}
+}
+
+// accrue computes the interest and the state of an active debt at now.
+// The interest which accrued before since and is not paid yet is added to the interest since then.
+func accrue(amount, interest model.Amount, terms model.Terms, due, since sql.NullTime, now time.Time) (model.Terms, model.Accrued) {
+	terms.DueDate = due.Time
+	accrued := model.Accrued{Interest: interest, Overdue: terms.OverdueAt(now)}
+	if since.Valid {
+		accrued.Interest += terms.Accrue(amount, since.Time, now)
+	}
+	return terms, accrued
+}
+
 func (p *PaymentRepoMysql) FindActiveDebts(debtorID int) ([]model.DebtExt, error) {
-	statement := `SELECT d.status_id, d.creditor, d.amount, d.description, d.category 
+	statement := `SELECT d.status_id, d.creditor, d.amount, d.currency, d.description, d.category,
+						d.due_date, d.interest_rate, d.accrues_from, d.accrued_interest
 					FROM debts AS d
 					INNER JOIN debt_status AS s
 						ON d.status_id = s.id
-					WHERE d.debtor = ? AND s.status=?`
+					WHERE d.debtor = ? AND s.status=?` + activeDebtsOrder
 	rows, err := p.db.Query(statement, debtorID, ongoingStatus)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	now := time.Now()
 	debts := []model.DebtExt{}
 	for rows.Next() {
 		var debt model.DebtExt
-		err := rows.Scan(&debt.StatusID, &debt.CreditorID, &debt.Amount, &debt.Description, &debt.CategoryName)
+		var due, since sql.NullTime
+		var interest model.Amount
+		err := rows.Scan(&debt.StatusID, &debt.CreditorID, &debt.Amount, &debt.Currency, &debt.Description, &debt.CategoryName,
+			&due, &debt.InterestRate, &since, &interest)
 		if err != nil {
 			return nil, err
 		}
+		debt.Terms, debt.Accrued = accrue(debt.Amount, interest, debt.Terms, due, since, now)
 		debts = append(debts, debt)
 	}
 	rows.Close()
@@ -322,25 +651,31 @@ func (p *PaymentRepoMysql) FindActiveDebts(debtorID int) ([]model.DebtExt, error
 	return debts, nil
 }
 
-func (p *PaymentRepoMysql) FindActiveLoans(creditorID int) ([]model.Loan, error) {
-	statement := `SELECT d.debtor, d.amount, d.description 
+func (p *PaymentRepoMysql) FindActiveLoans(creditorID int) ([]model.LoanExt, error) {
+	statement := `SELECT d.status_id, d.debtor, d.amount, d.currency, d.description, d.due_date, d.interest_rate, d.accrues_from,
+						d.accrued_interest
 					FROM debts AS d
 					INNER JOIN debt_status AS s
 						ON d.status_id = s.id
-					WHERE d.creditor = ? AND s.status=?`
+					WHERE d.creditor = ? AND s.status=?` + activeDebtsOrder
 	rows, err := p.db.Query(statement, creditorID, ongoingStatus)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	loans := []model.Loan{}
+	now := time.Now()
+	loans := []model.LoanExt{}
 	for rows.Next() {
-		var loan model.Loan
-		err := rows.Scan(&loan.DebtorID, &loan.Amount, &loan.Description)
+		var loan model.LoanExt
+		var due, since sql.NullTime
+		var interest model.Amount
+		err := rows.Scan(&loan.StatusID, &loan.DebtorID, &loan.Amount, &loan.Currency, &loan.Description, &due, &loan.InterestRate,
+			&since, &interest)
 		if err != nil {
 			return nil, err
 		}
+		loan.Terms, loan.Accrued = accrue(loan.Amount, interest, loan.Terms, due, since, now)
 		loans = append(loans, loan)
 	}
 	rows.Close()
@@ -350,7 +685,48 @@ func (p *PaymentRepoMysql) FindActiveLoans(creditorID int) ([]model.Loan, error)
 	return loans, nil
 }
 
-func (p *PaymentRepoMysql) RequestRepay(debtID, amount int) error {
+// debtParties returns the creditor, the debtor and the status of the debt with the status ID
+func debtParties(ctx context.Context, tx *sql.Tx, statusID int) (creditorID, debtorID int, status string, err error) {
+	statement := `SELECT d.creditor, d.debtor, s.status
+					FROM debts AS d
+					INNER JOIN debt_status AS s
+						ON d.status_id = s.id
+					WHERE s.id = ?`
+	err = tx.QueryRowContext(ctx, statement, statusID).Scan(&creditorID, &debtorID, &status)
+	return creditorID, debtorID, status, err
+}
+
+// owed returns the amount of the debt with the status ID and its unpaid interest accrued until now
+func owed(ctx context.Context, tx *sql.Tx, statusID int, now time.Time) (amount, interest model.Amount, err error) {
+	statement := "SELECT amount, interest_rate, accrues_from, accrued_interest FROM debts WHERE status_id = ?"
+	var terms model.Terms
+	var since sql.NullTime
+	if err = tx.QueryRowContext(ctx, statement, statusID).Scan(&amount, &terms.InterestRate, &since, &interest); err != nil {
+		return 0, 0, err
+	}
+	if since.Valid {
+		interest += terms.Accrue(amount, since.Time, now)
+	}
+	return amount, interest, nil
+}
+
+// reduceDebt pays off a part of the debt with the status ID at the date. The payment pays the interest first,
+// and the amount which is left accrues interest anew from the date.
+func reduceDebt(ctx context.Context, tx *sql.Tx, statusID int, amount, interest, paid model.Amount, date time.Time) error {
+	amount, interest = model.PayInterestFirst(amount, interest, paid)
+
+	statement := "UPDATE debt_status SET status = ?, amount = ? WHERE id = ?"
+	if _, err := tx.ExecContext(ctx, statement, ongoingStatus, amount, statusID); err != nil {
+		return err
+	}
+
+	statement = "UPDATE debts SET amount = ?, accrued_interest = ?, accrues_from = ? WHERE status_id = ?"
+	_, err := tx.ExecContext(ctx, statement, amount, interest, date, statusID)
+	return err
+}
+
+// RequestRepay asks the creditor to accept a repayment of the debt of the debtor from the account
+func (p *PaymentRepoMysql) RequestRepay(debtorID, debtID int, amount model.Amount, account string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
@@ -369,21 +745,30 @@ func (p *PaymentRepoMysql) RequestRepay(debtID, amount int) error {
 	// DEFER ROLLBACK
 	defer tx.Rollback()
 
+	_, debtor, status, err := debtParties(ctx, tx, debtID)
+	if err != nil {
+		return err
+	}
+	if debtor != debtorID {
+		return ErrNotParty
+	}
+	if status == proposedStatus {
+		return errProposed
+	}
+
 	// Get Amount of Debt
-	statement := "SELECT amount FROM debt_status WHERE id = ?"
-	var debtAmount int
-	err = tx.QueryRowContext(ctx, statement, debtID).Scan(&debtAmount)
+	debtAmount, interest, err := owed(ctx, tx, debtID, time.Now())
 	if err != nil {
 		return err
 	}
 
-	// You can`t repay more than you've received
-	if amount > debtAmount {
-		amount = debtAmount
+	// You can`t repay more than you've received, with its interest
+	if amount > debtAmount+interest {
+		amount = debtAmount + interest
 	}
 
-	statement = "UPDATE debt_status SET status = ?, amount = ? WHERE id = ?"
-	if _, err = tx.ExecContext(ctx, statement, pendingStatus, amount, debtID); err != nil {
+	statement := "UPDATE debt_status SET status = ?, amount = ?, account = ? WHERE id = ?"
+	if _, err = tx.ExecContext(ctx, statement, pendingStatus, amount, accountOf(account), debtID); err != nil {
 		return err
 	}
 
@@ -395,7 +780,7 @@ func (p *PaymentRepoMysql) RequestRepay(debtID, amount int) error {
 }
 
 func (p *PaymentRepoMysql) FindPendingDebts(debtorID int) ([]model.Debt, error) {
-	statement := `SELECT d.creditor, s.amount, d.description 
+	statement := `SELECT d.creditor, s.amount, d.currency, d.description 
 					FROM debts AS d
 					INNER JOIN debt_status AS s
 						ON d.status_id = s.id
@@ -409,7 +794,7 @@ func (p *PaymentRepoMysql) FindPendingDebts(debtorID int) ([]model.Debt, error)
 	debts := []model.Debt{}
 	for rows.Next() {
 		var debt model.Debt
-		err := rows.Scan(&debt.CreditorID, &debt.Amount, &debt.Description)
+		err := rows.Scan(&debt.CreditorID, &debt.Amount, &debt.Currency, &debt.Description)
 		if err != nil {
 			return nil, err
 		}
@@ -423,7 +808,7 @@ func (p *PaymentRepoMysql) FindPendingDebts(debtorID int) ([]model.Debt, error)
 }
 
 func (p *PaymentRepoMysql) FindPendingRequests(creditorID int) ([]model.LoanExt, error) {
-	statement := `SELECT d.debtor, s.amount, d.description, d.status_id 
+	statement := `SELECT d.debtor, s.amount, d.currency, d.description, d.status_id 
 					FROM debts AS d
 					INNER JOIN debt_status AS s
 						ON d.status_id = s.id
@@ -437,7 +822,7 @@ func (p *PaymentRepoMysql) FindPendingRequests(creditorID int) ([]model.LoanExt,
 	loans := []model.LoanExt{}
 	for rows.Next() {
 		var loan model.LoanExt
-		err := rows.Scan(&loan.DebtorID, &loan.Amount, &loan.Description, &loan.StatusID)
+		err := rows.Scan(&loan.DebtorID, &loan.Amount, &loan.Currency, &loan.Description, &loan.StatusID)
 		if err != nil {
 			return nil, err
 		}
@@ -450,7 +835,8 @@ func (p *PaymentRepoMysql) FindPendingRequests(creditorID int) ([]model.LoanExt,
 	return loans, nil
 }
 
-func (p *PaymentRepoMysql) AcceptPayment(a *model.Accept) error {
+// AcceptPayment accepts the pending repayment of a debt to the creditor
+func (p *PaymentRepoMysql) AcceptPayment(creditorID int, a *model.Accept) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
@@ -469,49 +855,53 @@ func (p *PaymentRepoMysql) AcceptPayment(a *model.Accept) error {
 	// DEFER ROLLBACK
 	defer tx.Rollback()
 
+	if err := checkPending(ctx, tx, creditorID, a.StatusID); err != nil {
+		return err
+	}
+
 	ap := model.AcceptPayment{}
-	statement := `SELECT d.creditor, d.debtor, d.amount, d.description, s.amount
+	var currency, debtorAccount string
+	statement := `SELECT d.creditor, d.debtor, d.amount, d.currency, d.description, s.amount, s.account
 					FROM debts AS d
 					INNER JOIN debt_status AS s
 						ON d.status_id = s.id
 					WHERE s.id=?`
 	err = tx.QueryRowContext(ctx, statement, a.StatusID).Scan(&ap.CreditorID, &ap.DebtorID, &ap.DebtAmount,
-		&ap.Description, &ap.PendingAmount)
+		&currency, &ap.Description, &ap.PendingAmount, &debtorAccount)
+	if err != nil {
+		return err
+	}
+	date := occurredAt(a.Date)
+
+	// The repayment pays the interest first
+	amount, interest, err := owed(ctx, tx, a.StatusID, date)
 	if err != nil {
 		return err
 	}
+	ap.DebtAmount = amount + interest
+
+	creditorAccount := accountOf(a.Account)
 
 	// Remove money from Debtor`s wallet
-	statement = "UPDATE wallet SET balance = balance - ? WHERE user_id = ?"
-	_, err = tx.ExecContext(ctx, statement, ap.PendingAmount, ap.DebtorID)
+	err = addToWallet(ctx, tx, ap.DebtorID, debtorAccount, currency, -ap.PendingAmount)
 	if err != nil {
 		msg := fmt.Sprintf("not enough money: %s", err.Error())
 		return errors.New(msg)
 	}
 
 	// Receive money
-	statement = "UPDATE wallet SET balance = balance + ? WHERE user_id = ?"
-	_, err = tx.ExecContext(ctx, statement, ap.PendingAmount, ap.CreditorID)
+	err = addToWallet(ctx, tx, ap.CreditorID, creditorAccount, currency, ap.PendingAmount)
 	if err != nil {
-		msg := fmt.Sprintf("not enough money: %s", err.Error())
-		return errors.New(msg)
+		return err
 	}
 
 	// Update debt
 	if ap.PendingAmount < ap.DebtAmount {
 		// Decrease the debt
-		statement = "UPDATE debt_status SET status = ?, amount = ? WHERE id = ?"
-		_, err = tx.ExecContext(ctx, statement, ongoingStatus, ap.DebtAmount-ap.PendingAmount, a.StatusID)
-		if err != nil {
-			return err
-		}
-
-		statement = "UPDATE debts SET amount = ? WHERE status_id = ?"
-		_, err = tx.ExecContext(ctx, statement, ap.DebtAmount-ap.PendingAmount, a.StatusID)
-		if err != nil {
+		if err = reduceDebt(ctx, tx, a.StatusID, amount, interest, ap.PendingAmount, date); err != nil {
 			return err
 		}
-	} else if ap.PendingAmount == ap.DebtAmount {
+	} else {
 		// Delete the debt
 		statement := "DELETE FROM debt_status WHERE id=?"
 		if _, err := tx.ExecContext(ctx, statement, a.StatusID); err != nil {
@@ -525,17 +915,18 @@ func (p *PaymentRepoMysql) AcceptPayment(a *model.Accept) error {
 	}
 
 	// Update History
-
 	// Creditor
-	statement = "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, ap.CreditorID, ap.PendingAmount, a.RepayC.ID, ap.Description)
+	statement = "INSERT INTO money_history(uid, amount, currency, account, category_id, description, occurred_at) VALUES(?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, statement, ap.CreditorID, ap.PendingAmount, currency, creditorAccount, a.RepayC.ID,
+		ap.Description, date)
 	if err != nil {
 		return err
 	}
 
 	// Debtor
-	statement = "INSERT INTO money_history(uid, amount, category_id, description) VALUES(?, ?, ?, ?)"
-	_, err = tx.ExecContext(ctx, statement, ap.DebtorID, ap.PendingAmount, a.ExpenseC.ID, ap.Description)
+	statement = "INSERT INTO money_history(uid, amount, currency, account, category_id, description, occurred_at) VALUES(?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, statement, ap.DebtorID, ap.PendingAmount, currency, debtorAccount, a.ExpenseC.ID,
+		ap.Description, date)
 	if err != nil {
 		return err
 	}
@@ -547,7 +938,8 @@ func (p *PaymentRepoMysql) AcceptPayment(a *model.Accept) error {
 	return nil
 }
 
-func (p *PaymentRepoMysql) DeclinePayment(statusID int) error {
+// DeclinePayment declines the pending repayment of a debt to the creditor
+func (p *PaymentRepoMysql) DeclinePayment(creditorID, statusID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
@@ -566,8 +958,12 @@ func (p *PaymentRepoMysql) DeclinePayment(statusID int) error {
 	// DEFER ROLLBACK
 	defer tx.Rollback()
 
+	if err := checkPending(ctx, tx, creditorID, statusID); err != nil {
+		return err
+	}
+
 	statement := "SELECT amount FROM debts WHERE status_id = ?"
-	var debtAmount int
+	var debtAmount model.Amount
 	if err := tx.QueryRowContext(ctx, statement, statusID).Scan(&debtAmount); err != nil {
 		return err
 	}
@@ -584,86 +980,637 @@ func (p *PaymentRepoMysql) DeclinePayment(statusID int) error {
 	return nil
 }
 
-func (p *PaymentRepoMysql) FindCategoryName(statusID int) (categoryName string, err error) {
-	statement := `SELECT category FROM debts WHERE status_id=?`
-	err = p.db.QueryRow(statement, statusID).Scan(&categoryName)
-	return categoryName, err
-}
+// checkPending fails with sql.ErrNoRows if there is no debt with the status ID, with ErrNotParty
+// if the user is not its creditor and with a BadRequestError if no repayment of it is pending
+func checkPending(ctx context.Context, tx *sql.Tx, creditorID, statusID int) error {
+	creditor, _, status, err := debtParties(ctx, tx, statusID)
+	if err != nil {
+		return err
+	}
+	if creditor != creditorID {
+		return ErrNotParty
+	}
+	if status != pendingStatus {
+		return errNotPending
+	}
+	return nil
+}
+
+// Forgive forgives the debtor a part of the debt, or the whole debt, with the status ID. No money moves.
+// The accrued interest is added to the debt first, and the rest accrues anew from the forgiveness, as after a repayment.
+// Both users record the forgiven amount, and the debtor is notified of it.
+func (p *PaymentRepoMysql) Forgive(creditorID int, f *model.Forgive) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	creditor, debtorID, status, err := debtParties(ctx, tx, f.StatusID)
+	if err != nil {
+		return err
+	}
+	if creditor != creditorID {
+		return ErrNotParty
+	}
+	switch status {
+	case proposedStatus:
+		return errProposed
+	case pendingStatus:
+		return errPending
+	}
+
+	var currency, description string
+	statement := "SELECT currency, description FROM debts WHERE status_id = ?"
+	if err = tx.QueryRowContext(ctx, statement, f.StatusID).Scan(&currency, &description); err != nil {
+		return err
+	}
+	date := occurredAt(f.Date)
+	amount, interest, err := owed(ctx, tx, f.StatusID, date)
+	if err != nil {
+		return err
+	}
+	debtAmount := amount + interest
+
+	if f.Amount < 0 || f.Amount > debtAmount {
+		return errForgiveAmount
+	}
+	forgiven := f.Amount
+	if forgiven == 0 {
+		forgiven = debtAmount
+	}
+
+	// Update debt
+	if forgiven < debtAmount {
+		// Decrease the debt
+		if err = reduceDebt(ctx, tx, f.StatusID, amount, interest, forgiven, date); err != nil {
+			return err
+		}
+	} else {
+		// Delete the debt
+		statement = "DELETE FROM debt_status WHERE id=?"
+		if _, err := tx.ExecContext(ctx, statement, f.StatusID); err != nil {
+			return err
+		}
+
+		statement = "DELETE FROM debts WHERE status_id=?"
+		if _, err := tx.ExecContext(ctx, statement, f.StatusID); err != nil {
+			return err
+		}
+	}
+
+	// Update History
+	// Creditor
+	statement = "INSERT INTO money_history(uid, amount, currency, account, category_id, description, occurred_at) VALUES(?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, statement, creditorID, forgiven, currency, model.DefaultAccount, f.ForgiveC.ID, description, date)
+	if err != nil {
+		return err
+	}
+
+	// Debtor
+	_, err = tx.ExecContext(ctx, statement, debtorID, forgiven, currency, model.DefaultAccount, f.ForgivenC.ID, description, date)
+	if err != nil {
+		return err
+	}
+
+	// Notify the debtor
+	statement = `INSERT INTO forgiven_debts(creditor, debtor, amount, currency, description, forgiven_at, closed)
+					VALUES(?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, statement, creditorID, debtorID, forgiven, currency, description, date, forgiven == debtAmount)
+	if err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// FindForgiven returns the notices of the debts forgiven to the debtor, in the order of forgiveness
+func (p *PaymentRepoMysql) FindForgiven(debtorID int) ([]model.Forgiveness, error) {
+	statement := `SELECT id, creditor, debtor, amount, currency, description, forgiven_at, closed
+					FROM forgiven_debts
+					WHERE debtor = ?
+					ORDER BY id`
+	rows, err := p.db.Query(statement, debtorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notices := []model.Forgiveness{}
+	for rows.Next() {
+		var f model.Forgiveness
+		err := rows.Scan(&f.ID, &f.CreditorID, &f.DebtorID, &f.Amount, &f.Currency, &f.Description, &f.Date, &f.Closed)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, f)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+// DismissForgiven deletes the notice of a forgiven debt once the debtor has read it
+func (p *PaymentRepoMysql) DismissForgiven(debtorID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	statement := "DELETE FROM forgiven_debts WHERE id = ? AND debtor = ?"
+	result, err := p.db.ExecContext(ctx, statement, id, debtorID)
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FindProposedDebts returns the loans and splits proposed to the debtor
+func (p *PaymentRepoMysql) FindProposedDebts(debtorID int) ([]model.Proposal, error) {
+	return p.findProposals("debtor", debtorID)
+}
+
+// FindProposedLoans returns the loans and splits which the creditor proposed
+func (p *PaymentRepoMysql) FindProposedLoans(creditorID int) ([]model.Proposal, error) {
+	return p.findProposals("creditor", creditorID)
+}
+
+// findProposals returns the proposed debts of which the user is the party in the column, creditor or debtor
+func (p *PaymentRepoMysql) findProposals(party string, userID int) ([]model.Proposal, error) {
+	statement := `SELECT d.status_id, d.creditor, d.debtor, d.amount, s.amount, d.currency, d.description, d.expense_id,
+						d.accrues_from, d.due_date, d.interest_rate
+					FROM debts AS d
+					INNER JOIN debt_status AS s
+						ON d.status_id = s.id
+					WHERE d.` + party + ` = ? AND s.status = ?
+					ORDER BY d.status_id`
+	rows, err := p.db.Query(statement, userID, proposedStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	proposals := []model.Proposal{}
+	for rows.Next() {
+		var proposal model.Proposal
+		var expense sql.NullInt64
+		var date, due sql.NullTime
+		err := rows.Scan(&proposal.StatusID, &proposal.CreditorID, &proposal.DebtorID, &proposal.Amount, &proposal.Total,
+			&proposal.Currency, &proposal.Description, &expense, &date, &due, &proposal.InterestRate)
+		if err != nil {
+			return nil, err
+		}
+		proposal.Split = expense.Valid
+		proposal.Date = date.Time
+		proposal.DueDate = due.Time
+		proposals = append(proposals, proposal)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return proposals, nil
+}
+
+// AcceptProposal accepts a loan or a split proposed to the debtor, which becomes an ongoing debt.
+// The creditor pays the loan to the debtor, or pays the whole expense of the split, as it was proposed.
+// The entries are recorded on the date of the proposal, from which the interest accrues.
+func (p *PaymentRepoMysql) AcceptProposal(debtorID int, c *model.Consent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	if err := checkProposed(ctx, tx, debtorID, c.StatusID, false); err != nil {
+		return err
+	}
+
+	var creditorID int
+	var lent, total model.Amount
+	var currency, account, description string
+	var expense sql.NullInt64
+	var date sql.NullTime
+	statement := `SELECT d.creditor, d.amount, s.amount, d.currency, d.account, d.description, d.expense_id, d.accrues_from
+					FROM debts AS d
+					INNER JOIN debt_status AS s
+						ON d.status_id = s.id
+					WHERE s.id = ?`
+	err = tx.QueryRowContext(ctx, statement, c.StatusID).Scan(&creditorID, &lent, &total, &currency, &account,
+		&description, &expense, &date)
+	if err != nil {
+		return err
+	}
+
+	// Remove money from wallet (Creditor)
+	err = addToWallet(ctx, tx, creditorID, account, currency, -total)
+	if err != nil {
+		return badRequest("not enough money: %v", err)
+	}
+
+	statement = "INSERT INTO money_history(uid, amount, currency, account, category_id, description, occurred_at) VALUES(?, ?, ?, ?, ?, ?, ?)"
+	if !expense.Valid {
+		// Add money to wallet (Debtor)
+		err = addToWallet(ctx, tx, debtorID, accountOf(c.Account), currency, lent)
+		if err != nil {
+			return err
+		}
+
+		// Add to incomes (Debtor)
+		_, err = tx.ExecContext(ctx, statement, debtorID, lent, currency, accountOf(c.Account), c.DebtCategoryID, description,
+			date.Time)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Add to expenses (Creditor: Loan)
+	_, err = tx.ExecContext(ctx, statement, creditorID, lent, currency, account, c.LoanCategoryID, description, date.Time)
+	if err != nil {
+		return err
+	}
+
+	// Start the debt, which accrues interest from its acceptance
+	statement = "UPDATE debt_status SET status = ?, amount = ? WHERE id = ?"
+	if _, err = tx.ExecContext(ctx, statement, ongoingStatus, lent, c.StatusID); err != nil {
+		return err
+	}
 
-func (p *PaymentRepoMysql) FindHistory(userID int) (*model.HistoryShowAll, error) {
+	statement = "UPDATE debts SET accrues_from = ? WHERE status_id = ?"
+	if _, err = tx.ExecContext(ctx, statement, occurredAt(c.Date), c.StatusID); err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RejectProposal deletes a proposed loan or split. The debtor rejects it, or the creditor withdraws it.
+func (p *PaymentRepoMysql) RejectProposal(userID, statusID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	if err := checkProposed(ctx, tx, userID, statusID, true); err != nil {
+		return err
+	}
+
+	statement := "DELETE FROM debt_status WHERE id = ?"
+	if _, err := tx.ExecContext(ctx, statement, statusID); err != nil {
+		return err
+	}
+
+	statement = "DELETE FROM debts WHERE status_id = ?"
+	if _, err := tx.ExecContext(ctx, statement, statusID); err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkProposed fails with sql.ErrNoRows if there is no debt with the status ID, with ErrNotParty
+// if the user is not its debtor, or not its creditor either when the creditor may act on it,
+// and with a BadRequestError if the debt is not proposed
+func checkProposed(ctx context.Context, tx *sql.Tx, userID, statusID int, creditorToo bool) error {
+	creditor, debtor, status, err := debtParties(ctx, tx, statusID)
+	if err != nil {
+		return err
+	}
+	if debtor != userID && !(creditorToo && creditor == userID) {
+		return ErrNotParty
+	}
+	if status != proposedStatus {
+		return errNotProposed
+	}
+	return nil
+}
+
+// FindCategoryName returns the category in which the debtor records the repayment of a debt to the creditor
+func (p *PaymentRepoMysql) FindCategoryName(creditorID, statusID int) (categoryName string, err error) {
+	var creditor int
+	statement := `SELECT creditor, category FROM debts WHERE status_id=?`
+	if err = p.db.QueryRow(statement, statusID).Scan(&creditor, &categoryName); err != nil {
+		return "", err
+	}
+	if creditor != creditorID {
+		return "", ErrNotParty
+	}
+	return categoryName, nil
+}
+
+func (p *PaymentRepoMysql) FindHistory(userID int, period model.Period) (*model.HistoryShowAll, error) {
 	aps := []model.HistoryShow{}
-	statement := `SELECT m.amount, m.description, c.c_type, c.name
+	condition, args := periodCondition(period)
+	statement := `SELECT m.id, m.amount, m.currency, m.account, m.description, m.occurred_at, c.c_type, c.name
 					FROM money_history AS m
 					INNER JOIN categories AS c
 						ON m.category_id = c.id
-					WHERE m.uid=?`
-	results, err := p.db.Query(statement, userID)
+					WHERE m.uid=?` + condition + `
+					ORDER BY m.occurred_at DESC`
+	results, err := p.db.Query(statement, append([]interface{}{userID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
+	defer results.Close()
 
 	for results.Next() {
 		ap := model.HistoryShow{}
-		err = results.Scan(&ap.Amount, &ap.Description, &ap.CategoryType, &ap.CategoryName)
+		err = results.Scan(&ap.ID, &ap.Amount, &ap.Currency, &ap.Account, &ap.Description, &ap.Date, &ap.CategoryType,
+			&ap.CategoryName)
 		if err != nil {
 			return nil, err
 		}
 		aps = append(aps, ap)
 	}
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
 	return &model.HistoryShowAll{HistoryShowAll: aps}, nil
 }
 
+// signedAmount returns the amount with which an entry changes the wallet balance
+func signedAmount(amount model.Amount, cType string) model.Amount {
+	if cType == expense {
+		return -amount
+	}
+	return amount
+}
+
+// UpdateEntry changes the amount, category, description and date of a history entry
+// and adjusts the wallet balance by the difference.
+// A zero CategoryID or Date keeps the current value.
+func (p *PaymentRepoMysql) UpdateEntry(h *model.History) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	old := model.History{}
+	var oldType, oldName string
+	statement := `SELECT m.amount, m.currency, m.account, m.category_id, m.occurred_at, c.c_type, c.name
+					FROM money_history AS m
+					INNER JOIN categories AS c
+						ON m.category_id = c.id
+					WHERE m.id = ? AND m.uid = ?`
+	err = tx.QueryRowContext(ctx, statement, h.ID, h.UserID).Scan(&old.Amount, &old.Currency, &old.Account,
+		&old.CategoryID, &old.Date, &oldType, &oldName)
+	if err != nil {
+		return err
+	}
+	if model.IsSystemCategory(oldName) {
+		return badRequest("entries of loans and repayments cannot be edited")
+	}
+
+	categoryID, date := h.CategoryID, h.Date
+	if categoryID == 0 {
+		categoryID = old.CategoryID
+	}
+	if date.IsZero() {
+		date = old.Date
+	}
+
+	var newType, newName string
+	statement = "SELECT c_type, name FROM categories WHERE id = ? AND " + visibleTo
+	if err = tx.QueryRowContext(ctx, statement, categoryID, h.UserID).Scan(&newType, &newName); err != nil {
+		return err
+	}
+	if model.IsSystemCategory(newName) {
+		return badRequest("category %s is reserved for loans", newName)
+	}
+
+	// Apply the difference to the wallet
+	delta := signedAmount(h.Amount, newType) - signedAmount(old.Amount, oldType)
+	if err = addToWallet(ctx, tx, h.UserID, old.Account, old.Currency, delta); err != nil {
+		return badRequest("not enough money: %v", err)
+	}
+
+	statement = "UPDATE money_history SET amount = ?, category_id = ?, description = ?, occurred_at = ? WHERE id = ?"
+	if _, err = tx.ExecContext(ctx, statement, h.Amount, categoryID, h.Description, date, h.ID); err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteEntry removes a history entry and reverts its effect on the wallet balance
+func (p *PaymentRepoMysql) DeleteEntry(userID, entryID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	var amount model.Amount
+	var currency, account, cType, categoryName string
+	statement := `SELECT m.amount, m.currency, m.account, c.c_type, c.name
+					FROM money_history AS m
+					INNER JOIN categories AS c
+						ON m.category_id = c.id
+					WHERE m.id = ? AND m.uid = ?`
+	err = tx.QueryRowContext(ctx, statement, entryID, userID).Scan(&amount, &currency, &account, &cType, &categoryName)
+	if err != nil {
+		return err
+	}
+	if model.IsSystemCategory(categoryName) {
+		return badRequest("entries of loans and repayments cannot be deleted")
+	}
+
+	// Revert the entry
+	if err = addToWallet(ctx, tx, userID, account, currency, -signedAmount(amount, cType)); err != nil {
+		return badRequest("not enough money: %v", err)
+	}
+
+	statement = "DELETE FROM money_history WHERE id = ?"
+	if _, err = tx.ExecContext(ctx, statement, entryID); err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
 // t: true == "expense" or false == "income"
-func (p *PaymentRepoMysql) FindStatistics(userID int, t bool) (*model.Statistics, error) {
-	statement := `SELECT COALESCE(SUM(amount),0)
-					FROM money_history as m
-					JOIN categories as c 
-						ON m.category_id=c.id
-					WHERE uid=? AND c.c_type=?;`
+func (p *PaymentRepoMysql) FindStatistics(userID int, t bool, period model.Period) (*model.Statistics, error) {
+	rates, currency, err := findRates(p.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	condition, args := periodCondition(period)
 	var cType string
 	if t {
 		cType = "expense"
 	} else {
 		cType = "income"
 	}
-	var sum int
-	err := p.db.QueryRow(statement, userID, cType).Scan(&sum)
-	if err != nil {
-		return nil, err
-	}
-
-	if sum <= 0 {
-		rs := []model.Ratio{}
-		r := model.Ratio{
-			Percent:      "0",
-			CategoryName: "No "+cType+"s",
-		}
-		rs = append(rs, r)
-		return &model.Statistics{Ratios: rs}, nil
-	}
+	args = append([]interface{}{userID, cType}, args...)
 
-	statement = `SELECT c.name, SUM(amount) 
+	// Subcategories count to their parent
+	statement := `SELECT COALESCE(p.name, c.name), m.currency, SUM(amount)
 					FROM money_history as m
 					JOIN categories as c 
 						ON m.category_id=c.id
-					WHERE uid=? AND c.c_type=?
-					group by c.name;`
-	results, err := p.db.Query(statement, userID, cType)
+					LEFT JOIN categories as p
+						ON c.parent_id=p.id
+					WHERE uid=? AND c.c_type=?` + condition + `
+					GROUP BY COALESCE(p.name, c.name), m.currency
+					ORDER BY COALESCE(p.name, c.name), m.currency`
+	results, err := p.db.Query(statement, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer results.Close()
 
-	rs := []model.Ratio{}
+	sums := []categorySum{}
 	for results.Next() {
-		r := model.Ratio{}
-		var s int
-		err = results.Scan(&r.CategoryName, &s)
+		s := categorySum{}
+		err = results.Scan(&s.name, &s.Currency, &s.Amount)
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, s)
+	}
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+	return statisticsOf(sums, rates, currency, cType)
+}
+
+// categorySum is the sum of the entries of a category in a currency
+type categorySum struct {
+	name string
+	model.Money
+}
+
+// statisticsOf returns the ratios of the categories in the total of the sums, converted to the currency,
+// and the totals per currency. The sums are sorted by category.
+func statisticsOf(sums []categorySum, rates model.Rates, currency, cType string) (*model.Statistics, error) {
+	total := model.Money{Currency: currency}
+	converted := []categorySum{}
+	totals := []model.Money{}
+	for _, s := range sums {
+		amount, err := rates.Convert(s.Amount, s.Currency, currency)
 		if err != nil {
 			return nil, err
 		}
-		percent := float64(s) / float64(sum)
-		r.Percent = fmt.Sprintf("%.2f", percent)
-		rs = append(rs, r)
+		total.Amount += amount
+
+		if n := len(converted); n > 0 && converted[n-1].name == s.name {
+			converted[n-1].Amount += amount
+		} else {
+			converted = append(converted, categorySum{name: s.name, Money: model.Money{Amount: amount, Currency: currency}})
+		}
+
+		found := false
+		for i := range totals {
+			if totals[i].Currency == s.Currency {
+				totals[i].Amount += s.Amount
+				found = true
+			}
+		}
+		if !found {
+			totals = append(totals, s.Money)
+		}
 	}
-	return &model.Statistics{Ratios: rs}, nil
-}
\ No newline at end of file
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Currency < totals[j].Currency })
+
+	if total.Amount <= 0 {
+		rs := []model.Ratio{{Percent: "0", CategoryName: "No " + cType + "s"}}
+		return &model.Statistics{Ratios: rs, Totals: []model.Money{}, Total: total}, nil
+	}
+
+	rs := []model.Ratio{}
+	for _, c := range converted {
+		percent := float64(c.Amount) / float64(total.Amount)
+		rs = append(rs, model.Ratio{Percent: fmt.Sprintf("%.2f", percent), CategoryName: c.name})
+	}
+	return &model.Statistics{Ratios: rs, Totals: totals, Total: total}, nil
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hpmalinova/Money-Manager/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPaymentRepoMysql_FindHistory(t *testing.T) {
+	columns := []string{"id", "amount", "currency", "account", "description", "occurred_at", "c_type", "name"}
+	date := time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	t.Run("all time", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		rows := sqlmock.NewRows(columns).
+			AddRow(7, 20, "BGN", "cash", "Bread", date, "expense", "food")
+		mock.ExpectQuery("SELECT m.id, m.amount, m.currency, m.account, m.description, m.occurred_at").
+			WithArgs(1).WillReturnRows(rows)
+
+		h, err := repo.FindHistory(1, model.Period{})
+		assert.NoError(t, err)
+		assert.Len(t, h.HistoryShowAll, 1)
+		assert.Equal(t, 7, h.HistoryShowAll[0].ID)
+		assert.Equal(t, date, h.HistoryShowAll[0].Date)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("within period", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		from := date.AddDate(0, -1, 0)
+		rows := sqlmock.NewRows(columns)
+		mock.ExpectQuery("m.occurred_at >= \\? AND m.occurred_at < \\?").
+			WithArgs(1, from, date).WillReturnRows(rows)
+
+		h, err := repo.FindHistory(1, model.Period{From: from, To: date})
+		assert.NoError(t, err)
+		assert.Empty(t, h.HistoryShowAll)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// expectRates expects the queries of findRates
+func expectRates(mock sqlmock.Sqlmock, userID int, currency string) {
+	mock.ExpectQuery("SELECT currency FROM users").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow(currency))
+	mock.ExpectQuery("SELECT currency, rate FROM exchange_rates").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "rate"}).AddRow("BGN", 1).AddRow("EUR", 1.95583))
+}
+
+func TestPaymentRepoMysql_CheckBalance(t *testing.T) {
+	db, mock := NewMock()
+	repo := &PaymentRepoMysql{db}
+
+	expectRates(mock, 1, "EUR")
+	rows := sqlmock.NewRows([]string{"account", "currency", "balance"}).
+		AddRow("bank", "EUR", 300).
+		AddRow("cash", "BGN", 1000).
+		AddRow("cash", "EUR", 200)
+	mock.ExpectQuery("SELECT account, currency, balance FROM wallet").WithArgs(1).WillReturnRows(rows)
+
+	b, err := repo.CheckBalance(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Account{
+		{Name: "bank", Wallets: []model.Money{{Amount: 300, Currency: "EUR"}}, Total: model.Money{Amount: 300, Currency: "EUR"}},
+		// 10lv are 5.11 EUR
+		{Name: "cash", Wallets: []model.Money{{Amount: 1000, Currency: "BGN"}, {Amount: 200, Currency: "EUR"}},
+			Total: model.Money{Amount: 711, Currency: "EUR"}},
+	}, b.Accounts)
+	assert.Equal(t, []model.Money{{Amount: 1000, Currency: "BGN"}, {Amount: 500, Currency: "EUR"}}, b.Wallets)
+	assert.Equal(t, model.Money{Amount: 1011, Currency: "EUR"}, b.Total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentRepoMysql_Transfer(t *testing.T) {
+	t.Run("between accounts", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT currency FROM wallet").WithArgs(1, "bank").
+			WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("BGN"))
+		mock.ExpectExec("UPDATE wallet SET balance = balance \\+ \\?").WithArgs(-50, 1, "bank", "BGN").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT currency FROM wallet").WithArgs(1, "savings").
+			WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("EUR"))
+		mock.ExpectExec("INSERT INTO wallet").WithArgs(1, "savings", "BGN", 50).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.Transfer(&model.AccountTransfer{UserID: 1, From: "bank", To: "savings", Amount: 50}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT currency FROM wallet").WithArgs(1, "bank").
+			WillReturnRows(sqlmock.NewRows([]string{"currency"}))
+		mock.ExpectRollback()
+
+		assert.Error(t, repo.Transfer(&model.AccountTransfer{UserID: 1, From: "bank", To: "cash", Amount: 50}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPaymentRepoMysql_FindStatistics(t *testing.T) {
+	columns := []string{"name", "currency", "sum"}
+
+	t.Run("no expenses in period", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		from := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+		expectRates(mock, 1, "BGN")
+		mock.ExpectQuery("SELECT COALESCE\\(p.name, c.name\\), m.currency, SUM\\(amount\\)").
+			WithArgs(1, "expense", from).WillReturnRows(sqlmock.NewRows(columns))
+
+		s, err := repo.FindStatistics(1, true, model.Period{From: from})
+		assert.NoError(t, err)
+		assert.Equal(t, "No expenses", s.Ratios[0].CategoryName)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("converted to the base currency", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		expectRates(mock, 1, "BGN")
+		rows := sqlmock.NewRows(columns).
+			AddRow("car", "EUR", 1000).
+			AddRow("food", "BGN", 978).
+			AddRow("food", "EUR", 500)
+		mock.ExpectQuery("GROUP BY COALESCE\\(p.name, c.name\\), m.currency").
+			WithArgs(1, "expense").WillReturnRows(rows)
+
+		s, err := repo.FindStatistics(1, true, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Ratio{{Percent: "0.50", CategoryName: "car"}, {Percent: "0.50", CategoryName: "food"}}, s.Ratios)
+		assert.Equal(t, []model.Money{{Amount: 978, Currency: "BGN"}, {Amount: 1500, Currency: "EUR"}}, s.Totals)
+		assert.Equal(t, model.Money{Amount: 3912, Currency: "BGN"}, s.Total)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPaymentRepoMysql_DeleteEntry(t *testing.T) {
+	columns := []string{"amount", "currency", "account", "c_type", "name"}
+
+	t.Run("expense is refunded", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT m.amount, m.currency, m.account, c.c_type, c.name").WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(20, "EUR", "bank", "expense", "food"))
+		mock.ExpectQuery("SELECT currency FROM wallet").WithArgs(1, "bank").
+			WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("BGN").AddRow("EUR"))
+		mock.ExpectExec("UPDATE wallet SET balance = balance \\+ \\?").WithArgs(20, 1, "bank", "EUR").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM money_history").WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.DeleteEntry(1, 7))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("entry of another user", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT m.amount, m.currency, m.account, c.c_type, c.name").WithArgs(7, 2).
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectRollback()
+
+		assert.Equal(t, sql.ErrNoRows, repo.DeleteEntry(2, 7))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("loan entry", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &PaymentRepoMysql{db}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT m.amount, m.currency, m.account, c.c_type, c.name").WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(30, "BGN", "cash", "expense", "loan"))
+		mock.ExpectRollback()
+
+		assert.Error(t, repo.DeleteEntry(1, 7))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/hpmalinova/Money-Manager/model"
+	"time"
+)
+
+type RateRepoMysql struct {
+	db *sql.DB
+}
+
+func NewRateRepoMysql(db *sql.DB) *RateRepoMysql {
+	return &RateRepoMysql{db: db}
+}
+
+func (r *RateRepoMysql) Find(currency string) (*model.Rate, error) {
+	rate := &model.Rate{}
+	statement := "SELECT currency, rate FROM exchange_rates WHERE currency = ?"
+	err := r.db.QueryRow(statement, currency).Scan(&rate.Currency, &rate.Rate)
+	if err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (r *RateRepoMysql) FindAll() ([]model.Rate, error) {
+	statement := "SELECT currency, rate FROM exchange_rates ORDER BY currency"
+	rows, err := r.db.Query(statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []model.Rate{}
+	for rows.Next() {
+		var rate model.Rate
+		if err := rows.Scan(&rate.Currency, &rate.Rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// Update sets the rate of the currency, adding the currency if it has no rate yet
+func (r *RateRepoMysql) Update(rate *model.Rate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	var count int
+	statement := "SELECT COUNT(*) FROM exchange_rates WHERE currency = ?"
+	if err = tx.QueryRowContext(ctx, statement, rate.Currency).Scan(&count); err != nil {
+		return err
+	}
+
+	if count == 0 {
+		statement = "INSERT INTO exchange_rates(currency, rate) VALUES(?, ?)"
+		_, err = tx.ExecContext(ctx, statement, rate.Currency, rate.Rate)
+	} else {
+		statement = "UPDATE exchange_rates SET rate = ? WHERE currency = ?"
+		_, err = tx.ExecContext(ctx, statement, rate.Rate, rate.Currency)
+	}
+	if err != nil {
+		return err
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// findRates returns the exchange rates and the base currency of the user
+func findRates(db *sql.DB, userID int) (model.Rates, string, error) {
+	var currency string
+	statement := "SELECT currency FROM users WHERE id = ?"
+	if err := db.QueryRow(statement, userID).Scan(&currency); err != nil {
+		return nil, "", err
+	}
+
+	rows, err := db.Query("SELECT currency, rate FROM exchange_rates")
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	rates := model.Rates{}
+	for rows.Next() {
+		var code string
+		var rate float64
+		if err := rows.Scan(&code, &rate); err != nil {
+			return nil, "", err
+		}
+		rates[code] = rate
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+	return rates, currency, nil
+}
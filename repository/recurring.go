@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/hpmalinova/Money-Manager/model"
+	"time"
+)
+
+type RecurringRepoMysql struct {
+	db *sql.DB
+}
+
+func NewRecurringRepoMysql(db *sql.DB) *RecurringRepoMysql {
+	return &RecurringRepoMysql{db: db}
+}
+
+const recurringColumns = `r.id, r.user_id, r.amount, r.currency, r.account, r.category_id, c.name, c.c_type,
+							r.description, r.frequency, r.starts_at, r.ends_at, r.max_count, r.done, r.paused`
+
+// endsAt returns the end date of a rule as a column value; a zero time is NULL
+func endsAt(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// Create stores a rule. Its first occurrence is at StartsAt.
+func (rr *RecurringRepoMysql) Create(r *model.Recurring) (*model.Recurring, error) {
+	rule := *r
+	rule.Currency, rule.Account, rule.StartsAt = currencyOf(r.Currency), accountOf(r.Account), occurredAt(r.StartsAt)
+	statement := `INSERT INTO recurring(user_id, amount, currency, account, category_id, description, frequency, starts_at, ends_at, max_count)
+					VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := rr.db.Exec(statement, rule.UserID, rule.Amount, rule.Currency, rule.Account, rule.CategoryID,
+		rule.Description, rule.Frequency, rule.StartsAt, endsAt(rule.EndsAt), rule.Count)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	rule.ID = int(id)
+	return &rule, nil
+}
+
+// FindByUser returns the rules of the user
+func (rr *RecurringRepoMysql) FindByUser(userID int) ([]model.Recurring, error) {
+	statement := `SELECT ` + recurringColumns + `
+					FROM recurring AS r
+					INNER JOIN categories AS c
+						ON r.category_id = c.id
+					WHERE r.user_id = ?
+					ORDER BY r.id`
+	return rr.find(statement, userID)
+}
+
+// FindByID returns a rule of the user
+func (rr *RecurringRepoMysql) FindByID(userID, id int) (*model.Recurring, error) {
+	statement := `SELECT ` + recurringColumns + `
+					FROM recurring AS r
+					INNER JOIN categories AS c
+						ON r.category_id = c.id
+					WHERE r.user_id = ? AND r.id = ?`
+	rules, err := rr.find(statement, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &rules[0], nil
+}
+
+// FindActive returns the rules which are not paused, of all users
+func (rr *RecurringRepoMysql) FindActive() ([]model.Recurring, error) {
+	statement := `SELECT ` + recurringColumns + `
+					FROM recurring AS r
+					INNER JOIN categories AS c
+						ON r.category_id = c.id
+					WHERE r.paused = ?
+					ORDER BY r.id`
+	return rr.find(statement, false)
+}
+
+func (rr *RecurringRepoMysql) find(statement string, args ...interface{}) ([]model.Recurring, error) {
+	rows, err := rr.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []model.Recurring{}
+	for rows.Next() {
+		var r model.Recurring
+		var description sql.NullString
+		var ends sql.NullTime
+		err := rows.Scan(&r.ID, &r.UserID, &r.Amount, &r.Currency, &r.Account, &r.CategoryID, &r.CategoryName,
+			&r.CategoryType, &description, &r.Frequency, &r.StartsAt, &ends, &r.Count, &r.Done, &r.Paused)
+		if err != nil {
+			return nil, err
+		}
+		r.Description, r.EndsAt = description.String, ends.Time
+		rules = append(rules, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Pause stops the scheduler from recording the rule of the user.
+// Pausing a paused rule changes nothing, so that the caller finds the rule to tell whether it exists.
+func (rr *RecurringRepoMysql) Pause(userID, id int) error {
+	statement := "UPDATE recurring SET paused = ? WHERE id = ? AND user_id = ?"
+	_, err := rr.db.Exec(statement, true, id, userID)
+	return err
+}
+
+// Resume lets the scheduler record the rule of the user again, from the occurrence done.
+// The occurrences before it, which fell into the pause, are skipped.
+func (rr *RecurringRepoMysql) Resume(userID, id, done int) error {
+	statement := "UPDATE recurring SET paused = ?, done = CASE WHEN done < ? THEN ? ELSE done END WHERE id = ? AND user_id = ?"
+	_, err := rr.db.Exec(statement, false, done, done, id, userID)
+	return err
+}
+
+// Advance records that the occurrences of the rule before done are recorded.
+// The counter never goes back, so that a slower run of the scheduler does not undo a faster one.
+func (rr *RecurringRepoMysql) Advance(id, done int) error {
+	statement := "UPDATE recurring SET done = ? WHERE id = ? AND done < ?"
+	_, err := rr.db.Exec(statement, done, id, done)
+	return err
+}
+
+// Delete deletes the rule of the user. The entries which it recorded are kept.
+func (rr *RecurringRepoMysql) Delete(userID, id int) error {
+	statement := "DELETE FROM recurring WHERE id = ? AND user_id = ?"
+	result, err := rr.db.Exec(statement, id, userID)
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
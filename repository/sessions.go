@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/hpmalinova/Money-Manager/model"
+	"time"
+)
+
+type SessionRepoMysql struct {
+	db *sql.DB
+}
+
+func NewSessionRepoMysql(db *sql.DB) *SessionRepoMysql {
+	return &SessionRepoMysql{db: db}
+}
+
+func (s *SessionRepoMysql) Create(session *model.Session) error {
+	statement := "INSERT INTO sessions(id, user_id, refresh_hash, expires_at, revoked) VALUES(?, ?, ?, ?, ?)"
+	_, err := s.db.Exec(statement, session.ID, session.UserID, session.RefreshHash, session.ExpiresAt.UTC(), false)
+	return err
+}
+
+func (s *SessionRepoMysql) FindByID(id string) (*model.Session, error) {
+	session := &model.Session{}
+	statement := "SELECT id, user_id, refresh_hash, expires_at, revoked FROM sessions WHERE id = ?"
+	err := s.db.QueryRow(statement, id).Scan(&session.ID, &session.UserID, &session.RefreshHash,
+		&session.ExpiresAt, &session.Revoked)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Refresh replaces the refresh token of an active session and extends it.
+// It fails if oldHash is not the hash of the current refresh token.
+func (s *SessionRepoMysql) Refresh(id, oldHash, newHash string, expiresAt time.Time) error {
+	statement := `UPDATE sessions SET refresh_hash = ?, expires_at = ?
+					WHERE id = ? AND refresh_hash = ? AND revoked = ? AND expires_at > ?`
+	result, err := s.db.Exec(statement, newHash, expiresAt.UTC(), id, oldHash, false, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows != 1 {
+		return errors.New("invalid refresh token")
+	}
+	return nil
+}
+
+// Extend moves the expiry of an active session
+func (s *SessionRepoMysql) Extend(id string, expiresAt time.Time) error {
+	statement := "UPDATE sessions SET expires_at = ? WHERE id = ? AND revoked = ?"
+	_, err := s.db.Exec(statement, expiresAt.UTC(), id, false)
+	return err
+}
+
+func (s *SessionRepoMysql) Revoke(id string) error {
+	statement := "UPDATE sessions SET revoked = ? WHERE id = ?"
+	_, err := s.db.Exec(statement, true, id)
+	return err
+}
+
+// RevokeAll logs the user out on every device
+func (s *SessionRepoMysql) RevokeAll(userID int) error {
+	statement := "UPDATE sessions SET revoked = ? WHERE user_id = ?"
+	_, err := s.db.Exec(statement, true, userID)
+	return err
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSessionRepoMysql_Refresh(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC()
+
+	t.Run("current refresh token", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &SessionRepoMysql{db}
+
+		mock.ExpectExec("UPDATE sessions SET refresh_hash").
+			WithArgs("new", expiresAt, "s1", "old", false, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.Refresh("s1", "old", "new", expiresAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("reused refresh token", func(t *testing.T) {
+		db, mock := NewMock()
+		repo := &SessionRepoMysql{db}
+
+		mock.ExpectExec("UPDATE sessions SET refresh_hash").
+			WithArgs("new", expiresAt, "s1", "old", false, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.Error(t, repo.Refresh("s1", "old", "new", expiresAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
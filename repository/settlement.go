@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/hpmalinova/Money-Manager/model"
+	"strings"
+	"time"
+)
+
+// settlementDescription describes the debts which replace the settled ones
+const settlementDescription = "Settlement"
+
+// queryer runs queries on the database or in a transaction
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// findOpenDebts returns the debts of the scope in the order of their creation.
+// Proposed loans and splits are not debts yet, and loans with interest are repaid as agreed; neither is settled.
+func findOpenDebts(ctx context.Context, q queryer, scope model.DebtScope) ([]model.OpenDebt, error) {
+	statement := `SELECT d.status_id, d.creditor, d.debtor, d.amount, d.currency, s.status
+					FROM debts AS d
+					INNER JOIN debt_status AS s
+						ON d.status_id = s.id
+					WHERE s.status <> ? AND `
+	args := []interface{}{proposedStatus}
+	if scope.GroupID != 0 {
+		statement += "d.group_id = ?"
+		args = append(args, scope.GroupID)
+	} else {
+		if len(scope.UserIDs) == 0 {
+			return []model.OpenDebt{}, nil
+		}
+		in := strings.TrimSuffix(strings.Repeat("?, ", len(scope.UserIDs)), ", ")
+		statement += "d.group_id IS NULL AND d.interest_rate = 0 AND d.creditor IN (" + in + ") AND d.debtor IN (" + in + ")"
+		for i := 0; i < 2; i++ {
+			for _, id := range scope.UserIDs {
+				args = append(args, id)
+			}
+		}
+		if scope.PartyID != 0 {
+			statement += " AND (d.creditor = ? OR d.debtor = ?)"
+			args = append(args, scope.PartyID, scope.PartyID)
+		}
+	}
+	statement += " ORDER BY d.status_id"
+
+	rows, err := q.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	debts := []model.OpenDebt{}
+	for rows.Next() {
+		var d model.OpenDebt
+		var status string
+		if err := rows.Scan(&d.StatusID, &d.CreditorID, &d.DebtorID, &d.Amount, &d.Currency, &status); err != nil {
+			return nil, err
+		}
+		d.Pending = status == pendingStatus
+		debts = append(debts, d)
+	}
+	return debts, rows.Err()
+}
+
+// checkSettlement tells whether the debts can be settled
+func checkSettlement(debts []model.OpenDebt) error {
+	if len(debts) == 0 {
+		return badRequest("there are no debts to settle")
+	}
+	for _, d := range debts {
+		if d.Pending {
+			return badRequest("a repayment is pending, it must be accepted or declined first")
+		}
+	}
+	return nil
+}
+
+// FindOpenDebts returns the debts of a group, or the debts outside of groups between the given users
+func (p *PaymentRepoMysql) FindOpenDebts(scope model.DebtScope) ([]model.OpenDebt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	return findOpenDebts(ctx, p.db, scope)
+}
+
+// Settle replaces the debts of the scope with the payments of their settlement plan.
+// Nobody's money or net balance changes, there are only fewer debts to repay.
+func (p *PaymentRepoMysql) Settle(scope model.DebtScope) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// BEGIN TRANSACTION
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	// DEFER ROLLBACK
+	defer tx.Rollback()
+
+	debts, err := findOpenDebts(ctx, tx, scope)
+	if err != nil {
+		return err
+	}
+	if err = checkSettlement(debts); err != nil {
+		return err
+	}
+
+	// Close the debts
+	for _, d := range debts {
+		statement := "DELETE FROM debts WHERE status_id = ?"
+		if _, err = tx.ExecContext(ctx, statement, d.StatusID); err != nil {
+			return err
+		}
+
+		statement = "DELETE FROM debt_status WHERE id = ?"
+		if _, err = tx.ExecContext(ctx, statement, d.StatusID); err != nil {
+			return err
+		}
+	}
+
+	// Open the debts of the plan
+	for _, s := range model.Simplify(debts) {
+		loan := model.Loan{DebtorID: s.FromID, Amount: s.Amount, Currency: s.Currency, Description: settlementDescription}
+		if err = insertDebt(ctx, tx, s.ToID, loan, model.RepayCategory, scope.GroupID); err != nil {
+			return err
+		}
+	}
+
+	// COMMIT TRANSACTION
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The SQLite repositories keep the data in a local file, so that the service runs without a MySQL server.
+//
+// They run the statements of the MySQL repositories, which only use SQL that both databases understand:
+// no MySQL functions, no INSERT IGNORE or ON DUPLICATE KEY, and times bound as UTC parameters.
+// The schemas differ and are created by migrations/sqlite.
+// A method whose statement cannot be shared is overridden on the SQLite type.
+
+type UserRepoSqlite struct {
+	*UserRepoMysql
+}
+
+func NewUserRepoSqlite(db *sql.DB) *UserRepoSqlite {
+	return &UserRepoSqlite{NewUserRepoMysql(db)}
+}
+
+type SessionRepoSqlite struct {
+	*SessionRepoMysql
+}
+
+func NewSessionRepoSqlite(db *sql.DB) *SessionRepoSqlite {
+	return &SessionRepoSqlite{NewSessionRepoMysql(db)}
+}
+
+type FriendshipRepoSqlite struct {
+	*FriendshipRepoMysql
+}
+
+func NewFriendRepoSqlite(db *sql.DB) *FriendshipRepoSqlite {
+	return &FriendshipRepoSqlite{NewFriendRepoMysql(db)}
+}
+
+type GroupRepoSqlite struct {
+	*GroupRepoMysql
+}
+
+func NewGroupRepoSqlite(db *sql.DB) *GroupRepoSqlite {
+	return &GroupRepoSqlite{NewGroupRepoMysql(db)}
+}
+
+type CategoryRepoSqlite struct {
+	*CategoryRepoMysql
+}
+
+func NewCategoryRepoSqlite(db *sql.DB) *CategoryRepoSqlite {
+	return &CategoryRepoSqlite{NewCategoryRepoMysql(db)}
+}
+
+type PaymentRepoSqlite struct {
+	*PaymentRepoMysql
+}
+
+func NewPaymentRepoSqlite(db *sql.DB) *PaymentRepoSqlite {
+	return &PaymentRepoSqlite{NewPaymentRepoMysql(db)}
+}
+
+type RateRepoSqlite struct {
+	*RateRepoMysql
+}
+
+func NewRateRepoSqlite(db *sql.DB) *RateRepoSqlite {
+	return &RateRepoSqlite{NewRateRepoMysql(db)}
+}
+
+type RecurringRepoSqlite struct {
+	*RecurringRepoMysql
+}
+
+func NewRecurringRepoSqlite(db *sql.DB) *RecurringRepoSqlite {
+	return &RecurringRepoSqlite{NewRecurringRepoMysql(db)}
+}
+
+type BudgetRepoSqlite struct {
+	*BudgetRepoMysql
+}
+
+func NewBudgetRepoSqlite(db *sql.DB) *BudgetRepoSqlite {
+	return &BudgetRepoSqlite{NewBudgetRepoMysql(db)}
+}
+
+type ImportRuleRepoSqlite struct {
+	*ImportRuleRepoMysql
+}
+
+func NewImportRuleRepoSqlite(db *sql.DB) *ImportRuleRepoSqlite {
+	return &ImportRuleRepoSqlite{NewImportRuleRepoMysql(db)}
+}
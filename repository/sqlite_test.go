@@ -0,0 +1,808 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/hpmalinova/Money-Manager/contract"
+	"github.com/hpmalinova/Money-Manager/migrations"
+	"github.com/hpmalinova/Money-Manager/model"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// NewSqlite returns a migrated database in a temporary file
+func NewSqlite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := Open(Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening the database", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := migrations.Up(db, migrations.SQLite); err != nil {
+		t.Fatalf("an error '%s' was not expected when migrating the database", err)
+	}
+	return db
+}
+
+// newSqliteUser creates a user with an empty wallet
+func newSqliteUser(t *testing.T, db *sql.DB, username string) int {
+	t.Helper()
+
+	user, err := NewUserRepoSqlite(db).Create(&model.User{Username: username, Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPaymentRepoSqlite(db).CreateWallet(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// acceptProposed accepts the loans and splits proposed to the debtor
+func acceptProposed(t *testing.T, repo contract.PaymentRepo, debtorID int) {
+	t.Helper()
+	acceptProposedOn(t, repo, debtorID, time.Time{})
+}
+
+// acceptProposedOn accepts the proposals to the debtor on the date, from which they accrue interest
+func acceptProposedOn(t *testing.T, repo contract.PaymentRepo, debtorID int, date time.Time) {
+	t.Helper()
+
+	proposals, err := repo.FindProposedDebts(debtorID)
+	assert.NoError(t, err)
+	for _, p := range proposals {
+		consent := &model.Consent{StatusID: p.StatusID, LoanCategoryID: 1, DebtCategoryID: 6, Date: date}
+		assert.NoError(t, repo.AcceptProposal(debtorID, consent))
+	}
+}
+
+func TestUserRepoSqlite(t *testing.T) {
+	db := NewSqlite(t)
+	repo := NewUserRepoSqlite(db)
+
+	id := newSqliteUser(t, db, "Hrisi")
+
+	user, err := repo.FindByUsername("Hrisi")
+	assert.NoError(t, err)
+	assert.Equal(t, id, user.ID)
+
+	_, err = repo.Create(&model.User{Username: "Hrisi", Password: "other"})
+	assert.Error(t, err, "usernames are unique")
+}
+
+func TestFriendshipRepoSqlite(t *testing.T) {
+	db := NewSqlite(t)
+	repo := NewFriendRepoSqlite(db)
+
+	hrisi := newSqliteUser(t, db, "Hrisi")
+	ivan := newSqliteUser(t, db, "Ivan")
+
+	err := repo.Add(&model.Friendship{UserOne: hrisi, UserTwo: ivan, ActionUser: hrisi})
+	assert.NoError(t, err)
+
+	pending, err := repo.FindPending(0, 10, ivan)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{hrisi}, pending)
+
+	assert.NoError(t, repo.AcceptInvite(hrisi, ivan, ivan))
+	friends, err := repo.Find(0, 10, hrisi)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{ivan}, friends)
+}
+
+func TestCategoryRepoSqlite(t *testing.T) {
+	repo := NewCategoryRepoSqlite(NewSqlite(t))
+
+	category, err := repo.FindByName(0, model.LoanCategory)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ExpenseType, category.CType)
+
+	incomes, err := repo.FindIncomes(0)
+	assert.NoError(t, err)
+	assert.Len(t, incomes, 6)
+
+	t.Run("categories of a user", func(t *testing.T) {
+		db := NewSqlite(t)
+		repo := NewCategoryRepoSqlite(db)
+		payment := NewPaymentRepoSqlite(db)
+		budgets := NewBudgetRepoSqlite(db)
+		hrisi := newSqliteUser(t, db, "Hrisi")
+		ivan := newSqliteUser(t, db, "Ivan")
+
+		groceries, err := repo.Create(&model.Category{UserID: hrisi, CType: model.ExpenseType, Name: "groceries", ParentID: 3})
+		assert.NoError(t, err)
+		_, err = repo.Create(&model.Category{UserID: hrisi, CType: model.ExpenseType, Name: "food"})
+		assert.Error(t, err, "the name of a shared category")
+		_, err = repo.Create(&model.Category{UserID: ivan, CType: model.ExpenseType, Name: "groceries"})
+		assert.NoError(t, err, "the categories of other users do not count")
+
+		expenses, err := repo.FindExpenses(hrisi)
+		assert.NoError(t, err)
+		assert.Len(t, expenses, 6)
+		assert.Equal(t, "food", expenses[2].Name)
+		assert.Equal(t, []model.Category{*groceries}, expenses[2].Children)
+
+		// Entries in a subcategory count to its parent
+		assert.NoError(t, payment.Earn(&model.History{UserID: hrisi, Amount: 100, CategoryID: 8}))
+		assert.NoError(t, payment.Pay(&model.History{UserID: hrisi, Amount: 30, CategoryID: 3}))
+		assert.NoError(t, payment.Pay(&model.History{UserID: hrisi, Amount: 10, CategoryID: groceries.ID}))
+		s, err := payment.FindStatistics(hrisi, true, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Ratio{{Percent: "1.00", CategoryName: "food"}}, s.Ratios)
+		assert.NoError(t, budgets.Set(&model.Budget{UserID: hrisi, CategoryID: 3, Amount: 50, Period: model.Monthly}))
+		budget, err := budgets.FindByCategory(hrisi, 3, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(40), budget.Spent)
+
+		assert.Equal(t, sql.ErrNoRows, repo.Rename(ivan, groceries.ID, "shopping"), "the category of another user")
+		assert.Error(t, repo.Rename(hrisi, 3, "meals"), "a shared category")
+		assert.Error(t, repo.Rename(hrisi, groceries.ID, "home"))
+		assert.NoError(t, repo.Rename(hrisi, groceries.ID, "shopping"))
+		assert.NoError(t, repo.Archive(hrisi, groceries.ID, true))
+
+		expenses, err = repo.FindExpenses(hrisi)
+		assert.NoError(t, err)
+		assert.Empty(t, expenses[2].Children)
+		all, err := repo.FindAll(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, "shopping", all[2].Children[0].Name)
+		assert.True(t, all[2].Children[0].Archived)
+		archived, err := repo.FindByName(hrisi, "shopping")
+		assert.NoError(t, err, "archived categories are kept for the history")
+		assert.Equal(t, 3, archived.ParentID)
+	})
+}
+
+func TestPaymentRepoSqlite(t *testing.T) {
+	db := NewSqlite(t)
+	repo := NewPaymentRepoSqlite(db)
+
+	hrisi := newSqliteUser(t, db, "Hrisi")
+	ivan := newSqliteUser(t, db, "Ivan")
+	march := time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	t.Run("earn and pay", func(t *testing.T) {
+		assert.NoError(t, repo.Earn(&model.History{UserID: hrisi, Amount: 100, CategoryID: 8, Date: march}))
+		assert.NoError(t, repo.Pay(&model.History{UserID: hrisi, Amount: 30, CategoryID: 3, Description: "Bread"}))
+
+		balance, err := repo.CheckBalance(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(70), balance.Total.Amount)
+	})
+	t.Run("cannot pay more than the balance", func(t *testing.T) {
+		err := repo.Pay(&model.History{UserID: hrisi, Amount: 1000, CategoryID: 3})
+		assert.Error(t, err)
+
+		balance, err := repo.CheckBalance(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(70), balance.Total.Amount)
+	})
+	t.Run("history within period", func(t *testing.T) {
+		h, err := repo.FindHistory(hrisi, model.Period{From: march, To: march.AddDate(0, 0, 1)})
+		assert.NoError(t, err)
+		assert.Len(t, h.HistoryShowAll, 1)
+		assert.Equal(t, march, h.HistoryShowAll[0].Date.UTC())
+		assert.Equal(t, "salary", h.HistoryShowAll[0].CategoryName)
+
+		s, err := repo.FindStatistics(hrisi, true, model.Period{})
+		assert.NoError(t, err)
+		assert.Len(t, s.Ratios, 1)
+		assert.Equal(t, "food", s.Ratios[0].CategoryName)
+	})
+	t.Run("split an odd amount", func(t *testing.T) {
+		split := &model.TransferSplit{
+			Expense:          model.Category{ID: 3, Name: "food"},
+			DebtCategoryName: "food",
+			Transfer: model.Transfer{
+				CreditorID:     ivan,
+				LoanCategoryID: 1,
+				Loan:           model.Loan{DebtorID: hrisi, Amount: 5},
+			},
+		}
+		assert.NoError(t, repo.Earn(&model.History{UserID: ivan, Amount: 5, CategoryID: 8}))
+		assert.NoError(t, repo.Split(split))
+		acceptProposed(t, repo, hrisi)
+
+		// The shares add up to the amount, the payer pays the odd minor unit
+		debts, err := repo.FindActiveDebts(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(2), debts[0].Amount)
+		s, err := repo.FindStatistics(ivan, true, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Ratio{{Percent: "0.60", CategoryName: "food"}, {Percent: "0.40", CategoryName: "loan"}}, s.Ratios)
+	})
+	t.Run("loan and repay", func(t *testing.T) {
+		loan := &model.TransferLoan{
+			DebtCategoryID:    6,
+			RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{
+				CreditorID:     hrisi,
+				LoanCategoryID: 1,
+				Loan:           model.Loan{DebtorID: ivan, Amount: 50, Description: "Lunch"},
+			},
+		}
+		assert.NoError(t, repo.GiveLoan(loan))
+		acceptProposed(t, repo, ivan)
+
+		debts, err := repo.FindActiveDebts(ivan)
+		assert.NoError(t, err)
+		assert.Len(t, debts, 1)
+		assert.Equal(t, model.Amount(50), debts[0].Amount)
+
+		accept := &model.Accept{StatusID: debts[0].StatusID, RepayC: model.Category{ID: 7}, ExpenseC: model.Category{ID: 2}}
+		assert.Equal(t, ErrNotParty, repo.RequestRepay(hrisi, debts[0].StatusID, 20, ""), "only the debtor repays")
+		assert.Error(t, repo.AcceptPayment(hrisi, accept), "no repayment is pending")
+		assert.Equal(t, sql.ErrNoRows, repo.RequestRepay(ivan, debts[0].StatusID+1, 20, ""))
+
+		assert.NoError(t, repo.RequestRepay(ivan, debts[0].StatusID, 20, ""))
+		assert.Equal(t, ErrNotParty, repo.AcceptPayment(ivan, accept), "only the creditor accepts")
+		_, err = repo.FindCategoryName(ivan, debts[0].StatusID)
+		assert.Equal(t, ErrNotParty, err)
+		accept.Account = "bank"
+		assert.EqualError(t, repo.AcceptPayment(hrisi, accept), "there is no account bank")
+		accept.Account = ""
+		assert.NoError(t, repo.AcceptPayment(hrisi, accept))
+
+		debts, err = repo.FindActiveDebts(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(30), debts[0].Amount)
+
+		balance, err := repo.CheckBalance(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(30), balance.Total.Amount)
+	})
+	t.Run("loan in another currency", func(t *testing.T) {
+		assert.NoError(t, repo.Earn(&model.History{UserID: hrisi, Amount: 1000, Currency: "EUR", CategoryID: 8}))
+		loan := &model.TransferLoan{
+			DebtCategoryID:    6,
+			RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{
+				CreditorID:     hrisi,
+				LoanCategoryID: 1,
+				Loan:           model.Loan{DebtorID: ivan, Amount: 400, Currency: "EUR"},
+			},
+		}
+		assert.NoError(t, repo.GiveLoan(loan))
+		acceptProposed(t, repo, ivan)
+
+		debts, err := repo.FindActiveDebts(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, "EUR", debts[1].Currency)
+
+		// Ivan's base currency is the euro
+		assert.NoError(t, NewUserRepoSqlite(db).UpdateCurrency(ivan, "EUR"))
+		balance, err := repo.CheckBalance(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Money{{Amount: 30, Currency: "BGN"}, {Amount: 400, Currency: "EUR"}}, balance.Wallets)
+		assert.Equal(t, model.Money{Amount: 415, Currency: "EUR"}, balance.Total)
+	})
+	t.Run("accounts", func(t *testing.T) {
+		// The wallet of the new account is in the base currency of Ivan
+		assert.NoError(t, repo.CreateAccount(ivan, "savings"))
+		assert.Error(t, repo.CreateAccount(ivan, "savings"))
+
+		assert.NoError(t, repo.Transfer(&model.AccountTransfer{UserID: ivan, From: "cash", To: "savings", Amount: 100,
+			Currency: "EUR"}))
+		assert.Error(t, repo.Transfer(&model.AccountTransfer{UserID: ivan, From: "cash", To: "savings", Amount: 1000,
+			Currency: "EUR"}))
+		assert.NoError(t, repo.Earn(&model.History{UserID: ivan, Amount: 10, Account: "savings", CategoryID: 9}))
+
+		balance, err := repo.CheckBalance(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Account{Name: "savings", Wallets: []model.Money{{Amount: 10, Currency: "BGN"},
+			{Amount: 100, Currency: "EUR"}}, Total: model.Money{Amount: 105, Currency: "EUR"}}, balance.Accounts[1])
+		assert.Equal(t, model.Money{Amount: 420, Currency: "EUR"}, balance.Total)
+
+		// A transfer is neither an expense nor an income
+		h, err := repo.FindHistory(ivan, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, "savings", h.HistoryShowAll[0].Account)
+		assert.Equal(t, "savings", h.HistoryShowAll[0].CategoryName)
+	})
+	t.Run("split between several", func(t *testing.T) {
+		lily := newSqliteUser(t, db, "Lily")
+		assert.NoError(t, repo.Earn(&model.History{UserID: lily, Amount: 100, CategoryID: 8}))
+		expense := &model.SplitExpense{PayerID: lily, LoanCategoryID: 1,
+			Expense: model.Category{ID: 3, Name: "food"}, DebtCategoryName: "food",
+			Amount: 100, Own: 20, Shares: []model.Share{{DebtorID: hrisi, Amount: 50}, {DebtorID: ivan, Amount: 30}}}
+		assert.Error(t, repo.SplitExpense(&model.SplitExpense{PayerID: lily, Amount: 100, Own: 20}), "the shares do not add up")
+
+		// Nothing is recorded without enough money
+		expense.Amount, expense.Own = 200, 120
+		assert.Error(t, repo.SplitExpense(expense))
+		loans, err := repo.FindActiveLoans(lily)
+		assert.NoError(t, err)
+		assert.Empty(t, loans)
+
+		// Lily pays her own share at once, and every debtor accepts or declines theirs
+		expense.Amount, expense.Own = 100, 20
+		assert.NoError(t, repo.SplitExpense(expense))
+		loans, err = repo.FindActiveLoans(lily)
+		assert.NoError(t, err)
+		assert.Empty(t, loans)
+		proposals, err := repo.FindProposedLoans(lily)
+		assert.NoError(t, err)
+		assert.Len(t, proposals, 2)
+		assert.Equal(t, model.Proposal{StatusID: 4, CreditorID: lily, DebtorID: hrisi, Amount: 50, Total: 50, Currency: "BGN",
+			Split: true, Date: proposals[0].Date}, proposals[0])
+		balance, err := repo.CheckBalance(lily)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(80), balance.Total.Amount)
+
+		assert.NoError(t, repo.RejectProposal(ivan, proposals[1].StatusID))
+		assert.NoError(t, repo.AcceptProposal(hrisi, &model.Consent{StatusID: proposals[0].StatusID, LoanCategoryID: 1,
+			DebtCategoryID: 6}))
+		loans, err = repo.FindActiveLoans(lily)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.LoanExt{{StatusID: 4, Loan: model.Loan{DebtorID: hrisi, Amount: 50, Currency: "BGN"}}}, loans)
+		balance, err = repo.CheckBalance(lily)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(30), balance.Total.Amount)
+
+		s, err := repo.FindStatistics(lily, true, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Ratio{{Percent: "0.29", CategoryName: "food"}, {Percent: "0.71", CategoryName: "loan"}}, s.Ratios)
+	})
+	t.Run("loans with terms", func(t *testing.T) {
+		maria := newSqliteUser(t, db, "Maria")
+		assert.NoError(t, repo.Earn(&model.History{UserID: maria, Amount: 100000, CategoryID: 8}))
+		lent := time.Now().Add(-100 * 24 * time.Hour)
+		due := time.Now().AddDate(0, 0, -1)
+		for _, l := range []model.Loan{
+			{DebtorID: ivan, Amount: 100},
+			{DebtorID: ivan, Amount: 36500, Terms: model.Terms{DueDate: due.AddDate(0, 0, 30), InterestRate: 10}},
+			{DebtorID: hrisi, Amount: 200, Terms: model.Terms{DueDate: due}},
+		} {
+			loan := &model.TransferLoan{DebtCategoryID: 6, RepayCategoryName: model.RepayCategory,
+				Transfer: model.Transfer{CreditorID: maria, LoanCategoryID: 1, Date: lent, Loan: l}}
+			assert.NoError(t, repo.GiveLoan(loan))
+		}
+		acceptProposedOn(t, repo, ivan, lent)
+		acceptProposedOn(t, repo, hrisi, lent)
+
+		// By their due date
+		loans, err := repo.FindActiveLoans(maria)
+		assert.NoError(t, err)
+		assert.Len(t, loans, 3)
+		assert.Equal(t, model.Amount(200), loans[0].Amount)
+		assert.Equal(t, due.Format(model.DefaultDateLayout), loans[0].DueDate.Format(model.DefaultDateLayout))
+		assert.Equal(t, model.Accrued{Overdue: true}, loans[0].Accrued)
+		assert.Equal(t, model.Terms{InterestRate: 10, DueDate: loans[1].DueDate}, loans[1].Terms)
+		assert.Equal(t, model.Accrued{Interest: 1000}, loans[1].Accrued, "10% of 365.00 for 100 days")
+		assert.Equal(t, model.Amount(100), loans[2].Amount)
+		assert.True(t, loans[2].DueDate.IsZero())
+
+		// The interest is repaid with the loan and the loan is not settled
+		open, err := repo.FindOpenDebts(model.DebtScope{UserIDs: []int{maria, ivan}})
+		assert.NoError(t, err)
+		assert.Len(t, open, 1)
+		debts, err := repo.FindActiveDebts(ivan)
+		assert.NoError(t, err)
+		statusID := debts[0].StatusID
+		assert.NoError(t, repo.RequestRepay(ivan, statusID, 100000, ""))
+		pending, err := repo.FindPendingRequests(maria)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(37500), pending[0].Amount, "capped at the debt with its interest")
+		assert.NoError(t, repo.DeclinePayment(maria, statusID))
+
+		// The repayments pay the interest first, and the interest never earns interest
+		assert.NoError(t, repo.RequestRepay(ivan, statusID, 400, ""))
+		accept := &model.Accept{StatusID: statusID, RepayC: model.Category{ID: 7}, ExpenseC: model.Category{ID: 2}}
+		assert.NoError(t, repo.AcceptPayment(maria, accept))
+		debts, err = repo.FindActiveDebts(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(36500), debts[0].Amount)
+		assert.Equal(t, model.Amount(600), debts[0].Interest)
+
+		assert.NoError(t, repo.RequestRepay(ivan, statusID, 1100, ""))
+		assert.NoError(t, repo.AcceptPayment(maria, accept))
+		debts, err = repo.FindActiveDebts(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(36000), debts[0].Amount)
+		assert.Equal(t, model.Amount(0), debts[0].Interest, "the interest accrues anew from the repayment")
+	})
+	t.Run("proposals", func(t *testing.T) {
+		nina := newSqliteUser(t, db, "Nina")
+		assert.NoError(t, repo.Earn(&model.History{UserID: nina, Amount: 100, CategoryID: 8}))
+		loan := &model.TransferLoan{DebtCategoryID: 6, RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{CreditorID: nina, LoanCategoryID: 1,
+				Loan: model.Loan{DebtorID: ivan, Amount: 101, Description: "Rent"}}}
+		assert.Error(t, repo.GiveLoan(loan), "not enough money")
+		loan.Amount = 30
+		assert.NoError(t, repo.GiveLoan(loan))
+		assert.NoError(t, repo.Split(&model.TransferSplit{Expense: model.Category{ID: 3, Name: "food"}, DebtCategoryName: "food",
+			Transfer: model.Transfer{CreditorID: nina, LoanCategoryID: 1, Loan: model.Loan{DebtorID: hrisi, Amount: 40}}}))
+
+		// Nothing moves before the debtors accept
+		proposals, err := repo.FindProposedLoans(nina)
+		assert.NoError(t, err)
+		assert.Len(t, proposals, 2)
+		assert.Equal(t, model.Proposal{StatusID: proposals[0].StatusID, CreditorID: nina, DebtorID: ivan, Amount: 30, Total: 30,
+			Currency: "BGN", Description: "Rent", Date: proposals[0].Date}, proposals[0])
+		assert.True(t, proposals[1].Split)
+		assert.Equal(t, model.Amount(20), proposals[1].Amount)
+		assert.Equal(t, model.Amount(20), proposals[1].Total, "Nina has paid her own share")
+		debts, err := repo.FindProposedDebts(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, proposals[1:], debts)
+		loans, err := repo.FindActiveLoans(nina)
+		assert.NoError(t, err)
+		assert.Empty(t, loans)
+		open, err := repo.FindOpenDebts(model.DebtScope{UserIDs: []int{nina, ivan}})
+		assert.NoError(t, err)
+		assert.Empty(t, open, "proposals are not settled")
+
+		loanID, splitID := proposals[0].StatusID, proposals[1].StatusID
+		consent := &model.Consent{StatusID: loanID, LoanCategoryID: 1, DebtCategoryID: 6}
+		assert.Equal(t, ErrNotParty, repo.AcceptProposal(nina, consent), "only the debtor accepts")
+		assert.Equal(t, errProposed, repo.RequestRepay(ivan, loanID, 10, ""))
+		assert.NoError(t, repo.AcceptProposal(ivan, consent))
+		assert.Equal(t, errNotProposed, repo.AcceptProposal(ivan, consent), "the loan is accepted once")
+		assert.Equal(t, errNotProposed, repo.RejectProposal(ivan, loanID))
+
+		// The creditor withdraws the split
+		assert.Equal(t, ErrNotParty, repo.RejectProposal(ivan, splitID))
+		assert.NoError(t, repo.RejectProposal(nina, splitID))
+		assert.Equal(t, sql.ErrNoRows, repo.RejectProposal(hrisi, splitID))
+
+		loans, err = repo.FindActiveLoans(nina)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.LoanExt{{StatusID: 9, Loan: model.Loan{DebtorID: ivan, Amount: 30, Currency: "BGN", Description: "Rent"}}}, loans)
+		balance, err := repo.CheckBalance(nina)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(50), balance.Total.Amount, "the own share of the withdrawn split stays paid")
+
+		// A loan accrues interest from its acceptance, not from its proposal
+		loan = &model.TransferLoan{DebtCategoryID: 6, RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{CreditorID: nina, LoanCategoryID: 1, Date: time.Now().AddDate(0, 0, -100),
+				Loan: model.Loan{DebtorID: ivan, Amount: 20, Terms: model.Terms{InterestRate: 10}}}}
+		assert.NoError(t, repo.GiveLoan(loan))
+		acceptProposed(t, repo, ivan)
+		loans, err = repo.FindActiveLoans(nina)
+		assert.NoError(t, err)
+		assert.Len(t, loans, 2)
+		assert.Equal(t, model.Amount(0), loans[1].Interest)
+	})
+	t.Run("forgive", func(t *testing.T) {
+		vera := newSqliteUser(t, db, "Vera")
+		assert.NoError(t, repo.Earn(&model.History{UserID: vera, Amount: 50, CategoryID: 8}))
+		assert.NoError(t, repo.GiveLoan(&model.TransferLoan{DebtCategoryID: 6, RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{CreditorID: vera, LoanCategoryID: 1,
+				Loan: model.Loan{DebtorID: hrisi, Amount: 40, Description: "Books"}}}))
+		acceptProposed(t, repo, hrisi)
+		loans, err := repo.FindActiveLoans(vera)
+		assert.NoError(t, err)
+		statusID := loans[0].StatusID
+
+		forgive := &model.Forgive{StatusID: statusID, Amount: 15, ForgiveC: model.Category{ID: 11},
+			ForgivenC: model.Category{ID: 12}}
+		assert.Equal(t, ErrNotParty, repo.Forgive(hrisi, forgive), "only the creditor forgives")
+		assert.NoError(t, repo.Forgive(vera, forgive))
+		loans, err = repo.FindActiveLoans(vera)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(25), loans[0].Amount)
+
+		assert.NoError(t, repo.RequestRepay(hrisi, statusID, 5, ""))
+		assert.Equal(t, errPending, repo.Forgive(vera, forgive))
+		assert.NoError(t, repo.DeclinePayment(vera, statusID))
+
+		forgive.Amount = 26
+		assert.Equal(t, errForgiveAmount, repo.Forgive(vera, forgive), "no more than the debt is forgiven")
+		forgive.Amount = -1
+		assert.Equal(t, errForgiveAmount, repo.Forgive(vera, forgive))
+
+		// The rest of the debt
+		forgive.Amount = 0
+		assert.NoError(t, repo.Forgive(vera, forgive))
+		loans, err = repo.FindActiveLoans(vera)
+		assert.NoError(t, err)
+		assert.Empty(t, loans)
+		assert.Equal(t, sql.ErrNoRows, repo.Forgive(vera, forgive))
+
+		// No money moves
+		balance, err := repo.CheckBalance(vera)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(10), balance.Total.Amount)
+		h, err := repo.FindHistory(hrisi, model.Period{})
+		assert.NoError(t, err)
+		assert.Equal(t, model.ForgivenCategory, h.HistoryShowAll[0].CategoryName)
+
+		notices, err := repo.FindForgiven(hrisi)
+		assert.NoError(t, err)
+		assert.Len(t, notices, 2)
+		assert.Equal(t, model.Forgiveness{ID: notices[0].ID, CreditorID: vera, DebtorID: hrisi, Amount: 15, Currency: "BGN",
+			Description: "Books", Date: notices[0].Date}, notices[0])
+		assert.Equal(t, model.Amount(25), notices[1].Amount)
+		assert.True(t, notices[1].Closed)
+
+		assert.Equal(t, sql.ErrNoRows, repo.DismissForgiven(vera, notices[0].ID), "only the debtor dismisses")
+		assert.NoError(t, repo.DismissForgiven(hrisi, notices[0].ID))
+		notices, err = repo.FindForgiven(hrisi)
+		assert.NoError(t, err)
+		assert.Len(t, notices, 1)
+	})
+}
+
+func TestPaymentRepoSqlite_Settle(t *testing.T) {
+	db := NewSqlite(t)
+	repo := NewPaymentRepoSqlite(db)
+
+	peter := newSqliteUser(t, db, "Peter")
+	george := newSqliteUser(t, db, "George")
+	lily := newSqliteUser(t, db, "Lily")
+	lend := func(creditor, debtor int, amount model.Amount) {
+		assert.NoError(t, repo.Earn(&model.History{UserID: creditor, Amount: amount, CategoryID: 8}))
+		assert.NoError(t, repo.GiveLoan(&model.TransferLoan{DebtCategoryID: 6, RepayCategoryName: model.RepayCategory,
+			Transfer: model.Transfer{CreditorID: creditor, LoanCategoryID: 1,
+				Loan: model.Loan{DebtorID: debtor, Amount: amount}}}))
+		acceptProposed(t, repo, debtor)
+	}
+	lend(george, peter, 30)
+	lend(lily, george, 20)
+	lend(peter, lily, 10)
+
+	circle := model.DebtScope{UserIDs: []int{peter, george, lily}}
+	debts, err := repo.FindOpenDebts(circle)
+	assert.NoError(t, err)
+	assert.Len(t, debts, 3)
+	debts, err = repo.FindOpenDebts(model.DebtScope{UserIDs: []int{peter, lily}})
+	assert.NoError(t, err)
+	assert.Len(t, debts, 1, "only the debts between the users")
+
+	t.Run("pending repayment", func(t *testing.T) {
+		assert.NoError(t, repo.RequestRepay(lily, debts[0].StatusID, 5, ""))
+		assert.Error(t, repo.Settle(circle))
+		assert.NoError(t, repo.DeclinePayment(peter, debts[0].StatusID))
+	})
+	t.Run("settle", func(t *testing.T) {
+		assert.NoError(t, repo.Settle(circle))
+
+		debts, err := repo.FindOpenDebts(circle)
+		assert.NoError(t, err)
+		assert.Len(t, debts, 2)
+		loans, err := repo.FindActiveLoans(george)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.LoanExt{{StatusID: 4, Loan: model.Loan{DebtorID: peter, Amount: 10, Currency: "BGN", Description: "Settlement"}}}, loans)
+		loans, err = repo.FindActiveLoans(lily)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.LoanExt{{StatusID: 5, Loan: model.Loan{DebtorID: peter, Amount: 10, Currency: "BGN", Description: "Settlement"}}}, loans)
+
+		assert.Error(t, repo.Settle(model.DebtScope{GroupID: 1}), "there are no debts")
+	})
+	t.Run("circle of a user", func(t *testing.T) {
+		lend(lily, george, 5)
+		lend(george, lily, 2)
+		assert.NoError(t, repo.Settle(model.DebtScope{UserIDs: []int{peter, george, lily}, PartyID: lily}))
+
+		loans, err := repo.FindActiveLoans(george)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.LoanExt{{StatusID: 4, Loan: model.Loan{DebtorID: peter, Amount: 10, Currency: "BGN",
+			Description: "Settlement"}}}, loans, "the debt of Peter to George is not Lily's to settle")
+		loans, err = repo.FindActiveLoans(lily)
+		assert.NoError(t, err)
+		assert.Len(t, loans, 2)
+		assert.Equal(t, model.Loan{DebtorID: george, Amount: 3, Currency: "BGN", Description: "Settlement"}, loans[1].Loan)
+	})
+}
+
+func TestGroupRepoSqlite(t *testing.T) {
+	db := NewSqlite(t)
+	repo := NewGroupRepoSqlite(db)
+	payment := NewPaymentRepoSqlite(db)
+
+	hrisi := newSqliteUser(t, db, "Hrisi")
+	ivan := newSqliteUser(t, db, "Ivan")
+	lily := newSqliteUser(t, db, "Lily")
+
+	group, err := repo.Create("Trip", hrisi, []int{ivan, lily})
+	assert.NoError(t, err)
+	_, err = repo.Create("Trip", hrisi, []int{ivan, ivan})
+	assert.Error(t, err, "a user is invited twice")
+
+	t.Run("invitations", func(t *testing.T) {
+		invites, err := repo.FindInvites(ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Group{{ID: group.ID, Name: "Trip"}}, invites)
+
+		assert.NoError(t, repo.Join(group.ID, ivan))
+		assert.Equal(t, sql.ErrNoRows, repo.Join(group.ID, ivan), "the invitation is accepted")
+		assert.Error(t, repo.Invite(group.ID, ivan), "ivan is a member")
+
+		joined, err := repo.Find(0, 10, ivan)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Group{{ID: group.ID, Name: "Trip"}}, joined)
+	})
+	t.Run("shared expense", func(t *testing.T) {
+		assert.NoError(t, payment.Earn(&model.History{UserID: hrisi, Amount: 100, CategoryID: 8}))
+		expense := &model.SplitExpense{GroupID: group.ID, PayerID: hrisi, LoanCategoryID: 1,
+			Expense: model.Category{ID: 3, Name: "food"}, DebtCategoryName: "food", Amount: 61, Own: 31, Shares: []model.Share{{DebtorID: ivan, Amount: 30}}}
+		assert.NoError(t, payment.SplitExpense(expense))
+		acceptProposed(t, payment, ivan)
+
+		g, err := repo.FindByID(group.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Trip", g.Name)
+		assert.Equal(t, []model.GroupMember{
+			{UserID: hrisi, Username: "Hrisi", Status: model.MemberStatus, Balance: []model.Money{{Amount: 30, Currency: "BGN"}}},
+			{UserID: ivan, Username: "Ivan", Status: model.MemberStatus, Balance: []model.Money{{Amount: -30, Currency: "BGN"}}},
+			{UserID: lily, Username: "Lily", Status: model.InvitedStatus, Balance: []model.Money{}},
+		}, g.Members)
+
+		balance, err := payment.CheckBalance(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(39), balance.Total.Amount)
+	})
+	t.Run("leave", func(t *testing.T) {
+		assert.Error(t, repo.Leave(group.ID, ivan), "ivan owes hrisi")
+		assert.NoError(t, repo.Leave(group.ID, lily))
+
+		debts, err := payment.FindActiveDebts(ivan)
+		assert.NoError(t, err)
+		assert.NoError(t, payment.Earn(&model.History{UserID: ivan, Amount: 30, CategoryID: 8}))
+		assert.NoError(t, payment.RequestRepay(ivan, debts[0].StatusID, 30, ""))
+		assert.NoError(t, payment.AcceptPayment(hrisi, &model.Accept{StatusID: debts[0].StatusID,
+			RepayC: model.Category{ID: 7}, ExpenseC: model.Category{ID: 3}}))
+
+		assert.NoError(t, repo.Leave(group.ID, ivan))
+		assert.NoError(t, repo.Leave(group.ID, hrisi))
+		_, err = repo.FindByID(group.ID)
+		assert.Equal(t, sql.ErrNoRows, err, "the last member deletes the group")
+	})
+}
+
+func TestRecurringRepoSqlite(t *testing.T) {
+	db := NewSqlite(t)
+	repo := NewRecurringRepoSqlite(db)
+	payment := NewPaymentRepoSqlite(db)
+
+	hrisi := newSqliteUser(t, db, "Hrisi")
+	ivan := newSqliteUser(t, db, "Ivan")
+	march := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	rule, err := repo.Create(&model.Recurring{UserID: hrisi, Amount: 1000, CategoryID: 8, Description: "Job",
+		Frequency: model.Monthly, StartsAt: march, Count: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, "BGN", rule.Currency)
+	assert.Equal(t, model.DefaultAccount, rule.Account)
+
+	t.Run("find", func(t *testing.T) {
+		rules, err := repo.FindByUser(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.Recurring{{ID: rule.ID, UserID: hrisi, Amount: 1000, Currency: "BGN",
+			Account: model.DefaultAccount, CategoryID: 8, CategoryName: "salary", CategoryType: model.IncomeType,
+			Description: "Job", Frequency: model.Monthly, StartsAt: march, Count: 12}}, rules)
+
+		_, err = repo.FindByID(ivan, rule.ID)
+		assert.Equal(t, sql.ErrNoRows, err, "the rule of another user")
+	})
+	t.Run("an occurrence is recorded once", func(t *testing.T) {
+		h := &model.History{UserID: hrisi, Amount: 1000, CategoryID: 8, Date: march, RecurringID: rule.ID, Occurrence: 0}
+		assert.NoError(t, payment.Earn(h))
+		assert.Equal(t, ErrRecorded, payment.Earn(h))
+		assert.Equal(t, ErrRecorded, payment.Pay(&model.History{UserID: hrisi, Amount: 10, CategoryID: 3, RecurringID: rule.ID}))
+
+		balance, err := payment.CheckBalance(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(1000), balance.Total.Amount)
+	})
+	t.Run("pause, resume and advance", func(t *testing.T) {
+		assert.NoError(t, repo.Advance(rule.ID, 3))
+		assert.NoError(t, repo.Advance(rule.ID, 1), "the counter does not go back")
+		assert.NoError(t, repo.Pause(hrisi, rule.ID))
+
+		active, err := repo.FindActive()
+		assert.NoError(t, err)
+		assert.Empty(t, active)
+
+		assert.NoError(t, repo.Resume(hrisi, rule.ID, 5))
+		active, err = repo.FindActive()
+		assert.NoError(t, err)
+		if assert.Len(t, active, 1) {
+			assert.Equal(t, 5, active[0].Done)
+			assert.False(t, active[0].Paused)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, sql.ErrNoRows, repo.Delete(ivan, rule.ID))
+		assert.NoError(t, repo.Delete(hrisi, rule.ID))
+
+		rules, err := repo.FindByUser(hrisi)
+		assert.NoError(t, err)
+		assert.Empty(t, rules)
+	})
+}
+
+func TestBudgetRepoSqlite(t *testing.T) {
+	db := NewSqlite(t)
+	repo := NewBudgetRepoSqlite(db)
+	payment := NewPaymentRepoSqlite(db)
+
+	hrisi := newSqliteUser(t, db, "Hrisi")
+	march := time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, payment.Earn(&model.History{UserID: hrisi, Amount: 1000, CategoryID: 8, Date: march}))
+	assert.NoError(t, payment.Earn(&model.History{UserID: hrisi, Amount: 100, Currency: "EUR", CategoryID: 8, Date: march}))
+	for _, h := range []model.History{
+		{Amount: 100, Date: march},
+		{Amount: 50, Currency: "EUR", Date: march.AddDate(0, 0, 1)},
+		{Amount: 300, Date: march.AddDate(0, -1, 0)},
+	} {
+		h.UserID, h.CategoryID = hrisi, 3
+		assert.NoError(t, payment.Pay(&h))
+	}
+
+	assert.NoError(t, repo.Set(&model.Budget{UserID: hrisi, CategoryID: 3, Amount: 200, Period: model.Weekly}))
+	assert.NoError(t, repo.Set(&model.Budget{UserID: hrisi, CategoryID: 3, Amount: 150, Period: model.Monthly, Block: true}))
+
+	budgets, err := repo.Find(hrisi, march)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Budget{{UserID: hrisi, CategoryID: 3, CategoryName: "food", Amount: 150, Currency: "BGN",
+		Period: model.Monthly, Block: true, Spent: 198,
+		Current: model.Period{From: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)}}},
+		budgets, "the entries in EUR are converted, the ones of February are not counted")
+
+	_, err = repo.FindByCategory(hrisi, 4, march)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(hrisi, 4))
+	assert.NoError(t, repo.Delete(hrisi, 3))
+	budgets, err = repo.Find(hrisi, march)
+	assert.NoError(t, err)
+	assert.Empty(t, budgets)
+}
+
+func TestImportSqlite(t *testing.T) {
+	db := NewSqlite(t)
+	payment := NewPaymentRepoSqlite(db)
+	rules := NewImportRuleRepoSqlite(db)
+	hrisi := newSqliteUser(t, db, "Hrisi")
+
+	rule, err := rules.Create(&model.ImportRule{UserID: hrisi, Pattern: "LIDL", CategoryID: 3})
+	assert.NoError(t, err)
+	found, err := rules.Find(hrisi)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ImportRule{{ID: rule.ID, UserID: hrisi, Pattern: "LIDL", CategoryID: 3, Category: "food",
+		CType: model.ExpenseType}}, found)
+
+	t.Run("the salary pays the groceries", func(t *testing.T) {
+		assert.NoError(t, payment.Import([]model.History{
+			{UserID: hrisi, Amount: 1000, CategoryID: 8, Description: "Salary"},
+			{UserID: hrisi, Amount: 250, CategoryID: 3, Description: "LIDL"},
+		}))
+		balance, err := payment.CheckBalance(hrisi)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Amount(750), balance.Total.Amount)
+	})
+	t.Run("nothing is imported if one entry fails", func(t *testing.T) {
+		assert.Error(t, payment.Import([]model.History{
+			{UserID: hrisi, Amount: 100, CategoryID: 3},
+			{UserID: hrisi, Amount: 1000, CategoryID: 4},
+		}))
+		balance, _ := payment.CheckBalance(hrisi)
+		assert.Equal(t, model.Amount(750), balance.Total.Amount)
+		h, _ := payment.FindHistory(hrisi, model.Period{})
+		assert.Len(t, h.HistoryShowAll, 2)
+	})
+
+	assert.Equal(t, sql.ErrNoRows, rules.Delete(hrisi+1, rule.ID))
+	assert.NoError(t, rules.Delete(hrisi, rule.ID))
+	found, err = rules.Find(hrisi)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestSessionRepoSqlite(t *testing.T) {
+	repo := NewSessionRepoSqlite(NewSqlite(t))
+
+	session := &model.Session{ID: "s1", UserID: 1, RefreshHash: "old", ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, repo.Create(session))
+
+	assert.NoError(t, repo.Refresh("s1", "old", "new", time.Now().Add(2*time.Hour)))
+	assert.Error(t, repo.Refresh("s1", "old", "newer", time.Now().Add(2*time.Hour)), "the old token is used")
+
+	assert.NoError(t, repo.RevokeAll(1))
+	found, err := repo.FindByID("s1")
+	assert.NoError(t, err)
+	assert.False(t, found.Active(time.Now()))
+}
@@ -5,26 +5,18 @@ import (
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/hpmalinova/Money-Manager/model"
-	"log"
 )
 
 type UserRepoMysql struct {
 	db *sql.DB
 }
 
-func NewUserRepoMysql(user, password, dbname string) *UserRepoMysql {
-	connectionString := fmt.Sprintf("%s:%s@/%s", user, password, dbname)
-	repo := &UserRepoMysql{}
-	var err error
-	repo.db, err = sql.Open("mysql", connectionString)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return repo
+func NewUserRepoMysql(db *sql.DB) *UserRepoMysql {
+	return &UserRepoMysql{db: db}
 }
 
 func (u *UserRepoMysql) Find(start, count int) ([]model.User, error) {
-	statement := "SELECT id, username, password FROM users LIMIT ? OFFSET ?"
+	statement := "SELECT id, username, password, currency FROM users LIMIT ? OFFSET ?"
 	rows, err := u.db.Query(statement, count, start)
 	if err != nil {
 		return nil, err
@@ -34,7 +26,7 @@ func (u *UserRepoMysql) Find(start, count int) ([]model.User, error) {
 	users := []model.User{}
 	for rows.Next() {
 		var user model.User
-		err := rows.Scan(&user.ID, &user.Username, &user.Password)
+		err := rows.Scan(&user.ID, &user.Username, &user.Password, &user.Currency)
 		if err != nil {
 			return nil, err
 		}
@@ -50,8 +42,8 @@ func (u *UserRepoMysql) Find(start, count int) ([]model.User, error) {
 //FindById return users by user ID or error otherwise
 func (u *UserRepoMysql) FindByID(id int) (*model.User, error) {
 	user := &model.User{}
-	statement := "SELECT id, username, password FROM users WHERE id= ?"
-	err := u.db.QueryRow(statement, id).Scan(&user.ID, &user.Username, &user.Password)
+	statement := "SELECT id, username, password, currency FROM users WHERE id= ?"
+	err := u.db.QueryRow(statement, id).Scan(&user.ID, &user.Username, &user.Password, &user.Currency)
 	if err != nil {
 		return nil, err
 	}
@@ -76,9 +68,9 @@ func (u *UserRepoMysql) FindNamesByIDs(ids []int) ([]string, error) {
 
 func (u *UserRepoMysql) FindByUsername(username string) (*model.User, error) {
 	user := &model.User{}
-	statement := "SELECT id, username, password FROM users WHERE username= ?"
+	statement := "SELECT id, username, password, currency FROM users WHERE username= ?"
 	row := u.db.QueryRow(statement, username)
-	err := row.Scan(&user.ID, &user.Username, &user.Password)
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Currency)
 	if err != nil || err == sql.ErrNoRows {
 		fmt.Println("IN ERROR")
 		return nil, err
@@ -88,8 +80,11 @@ func (u *UserRepoMysql) FindByUsername(username string) (*model.User, error) {
 
 //Create creates and returns new user with autogenerated ID
 func (u *UserRepoMysql) Create(user *model.User) (*model.User, error) {
-	statement := "INSERT INTO users(username, password) VALUES(?, ?)"
-	result, err := u.db.Exec(statement, user.Username, user.Password)
+	if user.Currency == "" {
+		user.Currency = model.DefaultCurrency
+	}
+	statement := "INSERT INTO users(username, password, currency) VALUES(?, ?, ?)"
+	result, err := u.db.Exec(statement, user.Username, user.Password, user.Currency)
 	if err != nil {
 		return nil, err
 	}
@@ -101,3 +96,10 @@ func (u *UserRepoMysql) Create(user *model.User) (*model.User, error) {
 	}
 	return user, nil
 }
+
+// UpdateCurrency changes the base currency of the user
+func (u *UserRepoMysql) UpdateCurrency(userID int, currency string) error {
+	statement := "UPDATE users SET currency = ? WHERE id = ?"
+	_, err := u.db.Exec(statement, currency, userID)
+	return err
+}
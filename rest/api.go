@@ -0,0 +1,1171 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/hpmalinova/Money-Manager/model"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	apiV1      = "/api/v1"
+	balance    = "balance"
+	categories = "categories"
+	refresh    = "refresh"
+	rates      = "rates"
+	currency   = "currency"
+)
+
+// JSON API
+// Every endpoint receives and returns JSON. Amounts are integers in the minor units of their ISO 4217 currency,
+// which must have an exchange rate, such as 1249 for 12.49 BGN or 500 for 500 JPY. Dates are RFC 3339.
+
+func (a *App) initializeAPIRoutes() {
+	api := a.Router.PathPrefix(apiV1).Subrouter()
+	api.HandleFunc("/"+login, a.apiLogin).Methods(http.MethodPost)
+	api.HandleFunc("/"+refresh, a.apiRefresh).Methods(http.MethodPost)
+
+	// Auth route
+	s := api.NewRoute().Subrouter()
+	s.Use(a.BearerVerify, a.JwtVerify) // Middleware
+	s.HandleFunc("/"+logout, a.apiLogout).Methods(http.MethodPost)
+	s.HandleFunc("/"+logout+"/"+all, a.apiLogoutEverywhere).Methods(http.MethodPost)
+	s.HandleFunc("/"+users+"/{id:[0-9]+}", a.getUser).Methods(http.MethodGet)
+	s.HandleFunc("/"+categories, a.getCategories).Methods(http.MethodGet)
+	s.HandleFunc("/"+categories, a.apiCreateCategory).Methods(http.MethodPost)
+	s.HandleFunc("/"+categories+"/{id:[0-9]+}", a.apiRenameCategory).Methods(http.MethodPut)
+	s.HandleFunc("/"+categories+"/{id:[0-9]+}/"+archive, a.apiArchiveCategory).Methods(http.MethodPost)
+	s.HandleFunc("/"+categories+"/{id:[0-9]+}/"+restore, a.apiRestoreCategory).Methods(http.MethodPost)
+	s.HandleFunc("/"+balance, a.apiBalance).Methods(http.MethodGet)
+	s.HandleFunc("/"+accounts, a.apiCreateAccount).Methods(http.MethodPost)
+	s.HandleFunc("/"+accounts+"/"+transfer, a.apiTransfer).Methods(http.MethodPost)
+	s.HandleFunc("/"+budgets, a.apiBudgets).Methods(http.MethodGet)
+	s.HandleFunc("/"+budgets+"/{category}", a.apiSetBudget).Methods(http.MethodPut)
+	s.HandleFunc("/"+budgets+"/{category}", a.apiDeleteBudget).Methods(http.MethodDelete)
+	s.HandleFunc("/"+currency, a.apiSetCurrency).Methods(http.MethodPut)
+	s.HandleFunc("/"+rates, a.apiRates).Methods(http.MethodGet)
+	s.HandleFunc("/"+rates+"/{currency:[A-Z]{3}}", a.apiSetRate).Methods(http.MethodPut)
+
+	s.HandleFunc("/"+friends, a.apiFriends).Methods(http.MethodGet)
+	s.HandleFunc("/"+friends, a.apiAddFriend).Methods(http.MethodPost)
+	s.HandleFunc("/"+friends+"/{username}/"+accept, a.apiAcceptInvite).Methods(http.MethodPost)
+	s.HandleFunc("/"+friends+"/{username}/"+decline, a.apiDeclineInvite).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+groups, a.apiGroups).Methods(http.MethodGet)
+	s.HandleFunc("/"+groups, a.apiCreateGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}", a.apiGroup).Methods(http.MethodGet)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}", a.apiRenameGroup).Methods(http.MethodPut)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+invite, a.apiInviteToGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+accept, a.apiJoinGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+leave, a.apiLeaveGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+expenses, a.apiGroupExpense).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+settle, a.apiGroupSettlement).Methods(http.MethodGet)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+settle, a.apiSettleGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+settle, a.apiSettlement).Methods(http.MethodGet)
+	s.HandleFunc("/"+settle, a.apiSettleCircle).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+pay, a.apiPay).Methods(http.MethodPost)
+	s.HandleFunc("/"+earn, a.apiEarn).Methods(http.MethodPost)
+	s.HandleFunc("/"+split, a.apiSplit).Methods(http.MethodPost)
+	s.HandleFunc("/"+expenses, a.apiSplitExpense).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+recurring, a.apiRecurring).Methods(http.MethodGet)
+	s.HandleFunc("/"+recurring, a.apiCreateRecurring).Methods(http.MethodPost)
+	s.HandleFunc("/"+recurring+"/{id:[0-9]+}/"+pause, a.apiPauseRecurring).Methods(http.MethodPost)
+	s.HandleFunc("/"+recurring+"/{id:[0-9]+}/"+resume, a.apiResumeRecurring).Methods(http.MethodPost)
+	s.HandleFunc("/"+recurring+"/{id:[0-9]+}", a.apiDeleteRecurring).Methods(http.MethodDelete)
+
+	s.HandleFunc("/"+debts, a.apiDebts).Methods(http.MethodGet)
+	s.HandleFunc("/"+debts+"/{id:[0-9]+}/"+repay, a.apiRequestRepay).Methods(http.MethodPost)
+	s.HandleFunc("/"+debts+"/{id:[0-9]+}/"+accept, a.apiAcceptProposal).Methods(http.MethodPost)
+	s.HandleFunc("/"+debts+"/{id:[0-9]+}/"+decline, a.apiRejectProposal).Methods(http.MethodPost)
+	s.HandleFunc("/"+debts+"/"+forgiven+"/{id:[0-9]+}", a.apiDismissForgiven).Methods(http.MethodDelete)
+
+	s.HandleFunc("/"+loans, a.apiLoans).Methods(http.MethodGet)
+	s.HandleFunc("/"+loans, a.apiGiveLoan).Methods(http.MethodPost)
+	s.HandleFunc("/"+loans+"/{id:[0-9]+}/"+accept, a.apiAcceptPayment).Methods(http.MethodPost)
+	s.HandleFunc("/"+loans+"/{id:[0-9]+}/"+decline, a.apiDeclinePayment).Methods(http.MethodPost)
+	s.HandleFunc("/"+loans+"/{id:[0-9]+}/"+withdraw, a.apiRejectProposal).Methods(http.MethodPost)
+	s.HandleFunc("/"+loans+"/{id:[0-9]+}/"+forgive, a.apiForgiveLoan).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+history, a.apiHistory).Methods(http.MethodGet)
+	s.HandleFunc("/"+history+"/{id:[0-9]+}", a.apiEditEntry).Methods(http.MethodPut)
+	s.HandleFunc("/"+history+"/{id:[0-9]+}", a.apiDeleteEntry).Methods(http.MethodDelete)
+
+	a.initializeExportRoutes(s)
+	a.initializeImportAPIRoutes(s)
+}
+
+// isJSON responds with Unsupported Media Type and returns false if the body is not JSON.
+// Other sites may post forms and plain text, but not JSON, to the API without asking the browser first.
+func isJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "The body must be application/json")
+		return false
+	}
+	return true
+}
+
+// decodeAndValidate reads the JSON body into v and validates it.
+// It responds to the client and returns false if the body is invalid.
+func (a *App) decodeAndValidate(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if !isJSON(w, r) {
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return false
+	}
+	if err := a.Validator.Struct(v); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return false
+	}
+	return true
+}
+
+// decodeOptional decodes and validates the body of the request as decodeAndValidate does, if there is one
+func (a *App) decodeOptional(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	return a.decodeAndValidate(w, r, v)
+}
+
+func currentUserID(r *http.Request) int {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	return userID
+}
+
+// isAdmin reports whether the user maintains the data shared by all users
+func (a *App) isAdmin(userID int) bool {
+	user, err := a.Users.FindByID(userID)
+	if err != nil {
+		return false
+	}
+	for _, admin := range a.Admins {
+		if user.Username == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// findCategory returns the category of the user with the given name if it has the given type,
+// is not archived and is not reserved for loans
+func (a *App) findCategory(userID int, name, cType string) (*model.Category, error) {
+	category, err := a.Categories.FindByName(userID, name)
+	if err != nil || category.CType != cType || category.Archived || model.IsSystemCategory(category.Name) {
+		return nil, fmt.Errorf("there is no %s category: %v", cType, name)
+	}
+	return category, nil
+}
+
+// findFriend returns the user with the given username, who must not be the current user
+func (a *App) findFriend(userID int, username string) (*model.User, error) {
+	friend, err := a.Users.FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("there is no user: %v", username)
+	}
+	if friend.ID == userID {
+		return nil, fmt.Errorf("you cannot choose yourself")
+	}
+	return friend, nil
+}
+
+// orderedPair returns the IDs in the order in which they are stored in friendship
+func orderedPair(userID, friendID int) (int, int) {
+	// userOne is the user with the lowest ID
+	if userID > friendID {
+		return friendID, userID
+	}
+	return userID, friendID
+}
+
+func (a *App) apiLogin(w http.ResponseWriter, r *http.Request) {
+	user := &model.UserLogin{}
+	if !a.decodeAndValidate(w, r, user) {
+		return
+	}
+
+	tokens, err := a.checkCredentials(w, user.Username, user.Password)
+	if err != nil {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+func (a *App) apiBalance(w http.ResponseWriter, r *http.Request) {
+	b, err := a.Payment.CheckBalance(currentUserID(r))
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, b)
+}
+
+// ACCOUNTS
+
+func (a *App) apiCreateAccount(w http.ResponseWriter, r *http.Request) {
+	account := &model.NewAccount{}
+	if !a.decodeAndValidate(w, r, account) {
+		return
+	}
+
+	if err := a.Payment.CreateAccount(currentUserID(r), account.Name); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// apiTransfer moves money between two accounts of the user
+func (a *App) apiTransfer(w http.ResponseWriter, r *http.Request) {
+	t := &model.AccountTransfer{}
+	if !a.decodeAndValidate(w, r, t) {
+		return
+	}
+
+	t.UserID = currentUserID(r)
+	currency, err := a.findCurrency(t.UserID, t.Currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	t.Currency = currency
+
+	if err := a.Payment.Transfer(t); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BUDGETS
+
+func (a *App) apiBudgets(w http.ResponseWriter, r *http.Request) {
+	userBudgets, err := a.Budgets.Find(currentUserID(r), time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userBudgets)
+}
+
+// apiSetBudget creates or replaces the budget of the expense category
+func (a *App) apiSetBudget(w http.ResponseWriter, r *http.Request) {
+	req := &model.BudgetRequest{}
+	if !a.decodeAndValidate(w, r, req) {
+		return
+	}
+
+	if err := a.setBudget(currentUserID(r), mux.Vars(r)["category"], req); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiDeleteBudget(w http.ResponseWriter, r *http.Request) {
+	category, err := a.findCategory(currentUserID(r), mux.Vars(r)["category"], model.ExpenseType)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := a.Budgets.Delete(currentUserID(r), category.ID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CATEGORIES
+
+// apiCreateCategory creates a category of the user, nested under the parent of the request if it names one
+func (a *App) apiCreateCategory(w http.ResponseWriter, r *http.Request) {
+	req := &model.CategoryRequest{}
+	if !a.decodeAndValidate(w, r, req) {
+		return
+	}
+
+	category, err := a.createCategory(currentUserID(r), req)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, category)
+}
+
+func (a *App) apiRenameCategory(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	body := &struct {
+		Name string `json:"name" validate:"required,min=3,max=32"`
+	}{}
+	if !a.decodeAndValidate(w, r, body) {
+		return
+	}
+
+	if err := a.Categories.Rename(currentUserID(r), id, body.Name); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiArchiveCategory(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := a.Categories.Archive(currentUserID(r), id, true); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiRestoreCategory(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := a.Categories.Archive(currentUserID(r), id, false); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CURRENCIES
+
+// apiSetCurrency changes the base currency of the balance and the statistics of the user
+func (a *App) apiSetCurrency(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	body := &struct {
+		Currency string `json:"currency" validate:"len=3,uppercase"`
+	}{}
+	if !a.decodeAndValidate(w, r, body) {
+		return
+	}
+
+	currency, err := a.findCurrency(userID, body.Currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.Users.UpdateCurrency(userID, currency); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiRates(w http.ResponseWriter, r *http.Request) {
+	rs, err := a.Rates.FindAll()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, rs)
+}
+
+// apiSetRate sets the value of one unit of the currency in leva, adding the currency if it is new.
+// The rates are shared by all users, so only the admins set them.
+func (a *App) apiSetRate(w http.ResponseWriter, r *http.Request) {
+	if !a.isAdmin(currentUserID(r)) {
+		respondWithError(w, http.StatusForbidden, "Only an admin can set the exchange rates")
+		return
+	}
+
+	if !isJSON(w, r) {
+		return
+	}
+	rate := &model.Rate{}
+	if err := json.NewDecoder(r.Body).Decode(rate); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	rate.Currency = mux.Vars(r)["currency"]
+	if err := a.Validator.Struct(rate); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+	if rate.Currency == model.DefaultCurrency && rate.Rate != 1 {
+		respondWithError(w, http.StatusBadRequest, "The rate of "+model.DefaultCurrency+" is always 1")
+		return
+	}
+
+	if err := a.Rates.Update(rate); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FRIENDS
+
+func (a *App) apiFriends(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	start, count := 0, 100
+
+	friendsData, err := a.getFriendsData(start, count, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pending, err := a.getPendingFriendsData(start, count, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, model.GetFriends{Friends: *friendsData, PendingFriends: *pending})
+}
+
+func (a *App) apiAddFriend(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	body := &struct {
+		Username string `json:"username" validate:"required,min=3,max=32"`
+	}{}
+	if !a.decodeAndValidate(w, r, body) {
+		return
+	}
+
+	friend, err := a.findFriend(userID, body.Username)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userOne, userTwo := orderedPair(userID, friend.ID)
+	friendship := &model.Friendship{
+		UserOne:    userOne,
+		UserTwo:    userTwo,
+		ActionUser: userID,
+	}
+	if err := a.Friendship.Add(friendship); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *App) apiAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	friend, err := a.Users.FindByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	userOne, userTwo := orderedPair(userID, friend.ID)
+	if err := a.Friendship.AcceptInvite(userOne, userTwo, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiDeclineInvite(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	friend, err := a.Users.FindByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	userOne, userTwo := orderedPair(userID, friend.ID)
+	if err := a.Friendship.DeclineInvite(userOne, userTwo); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GROUPS
+
+func (a *App) apiGroups(w http.ResponseWriter, r *http.Request) {
+	g, err := a.getGroupsData(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, g)
+}
+
+// apiCreateGroup creates a group of the user and invites the given friends to it
+func (a *App) apiCreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	cg := &model.CreateGroup{}
+	if !a.decodeAndValidate(w, r, cg) {
+		return
+	}
+
+	invited, err := a.findFriends(userID, cg.Participants)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	group, err := a.Groups.Create(cg.Name, userID, invited)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, group)
+}
+
+// apiGroup returns the members of the group and their balances
+func (a *App) apiGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	group, err := a.findGroup(currentUserID(r), groupID)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, group)
+}
+
+func (a *App) apiRenameGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	body := &struct {
+		Name string `json:"name" validate:"required,min=1,max=32"`
+	}{}
+	if !a.decodeAndValidate(w, r, body) {
+		return
+	}
+
+	if _, err := a.findGroup(currentUserID(r), groupID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	if err := a.Groups.Rename(groupID, body.Name); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiInviteToGroup invites a friend of the user to the group
+func (a *App) apiInviteToGroup(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	gi := &model.GroupInvite{}
+	if !a.decodeAndValidate(w, r, gi) {
+		return
+	}
+
+	if _, err := a.findGroup(userID, groupID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	invited, err := a.findFriends(userID, []string{gi.Username})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.Groups.Invite(groupID, invited[0]); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiJoinGroup accepts an invitation to the group
+func (a *App) apiJoinGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Groups.Join(groupID, currentUserID(r)); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiLeaveGroup leaves the group or declines an invitation to it
+func (a *App) apiLeaveGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Groups.Leave(groupID, currentUserID(r)); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiGroupExpense records an expense which the user paid for the group.
+// It is shared equally by all members unless the participants are given.
+func (a *App) apiGroupExpense(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	e := &model.SplitRequest{}
+	if !a.decodeAndValidate(w, r, e) {
+		return
+	}
+
+	group, err := a.findGroup(userID, groupID)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	if err := a.recordSplit(userID, group, e); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// SETTLEMENT
+
+// apiGroupSettlement returns the payments which settle the debts of the group
+func (a *App) apiGroupSettlement(w http.ResponseWriter, r *http.Request) {
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	group, err := a.findGroup(currentUserID(r), groupID)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	plan, err := a.getSettlementPlan(group.Name, model.DebtScope{GroupID: groupID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, plan)
+}
+
+// apiSettleGroup replaces the debts of the group with the payments of its settlement plan
+func (a *App) apiSettleGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if _, err := a.findGroup(currentUserID(r), groupID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	if err := a.Payment.Settle(model.DebtScope{GroupID: groupID}); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSettlement returns the payments which settle the debts outside of groups
+// between the user and the friends of the user
+func (a *App) apiSettlement(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*model.UserToken)
+
+	scope, err := a.circleScope(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	plan, err := a.getSettlementPlan(user.Username, scope)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, plan)
+}
+
+// apiSettleCircle replaces the debts between the user and the friends of the user
+// with the payments of their settlement plan
+func (a *App) apiSettleCircle(w http.ResponseWriter, r *http.Request) {
+	scope, err := a.circleScope(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := a.Payment.Settle(scope); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PAYMENT
+
+func (a *App) apiPay(w http.ResponseWriter, r *http.Request) {
+	p := &model.Pay{}
+	if !a.decodeAndValidate(w, r, p) {
+		return
+	}
+
+	userID := currentUserID(r)
+	category, err := a.findCategory(userID, p.CategoryName, model.ExpenseType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currency, err := a.findCurrency(userID, p.Currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h := &model.History{
+		UserID:      userID,
+		Amount:      p.Amount,
+		Currency:    currency,
+		Account:     p.Account,
+		CategoryID:  category.ID,
+		Description: p.Description,
+		Date:        p.Date,
+	}
+	warning, err := a.checkBudget(h)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	if err := a.Payment.Pay(h); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if warning != "" {
+		respondWithJSON(w, http.StatusCreated, map[string]string{"warning": warning})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *App) apiEarn(w http.ResponseWriter, r *http.Request) {
+	p := &model.Pay{}
+	if !a.decodeAndValidate(w, r, p) {
+		return
+	}
+
+	userID := currentUserID(r)
+	category, err := a.findCategory(userID, p.CategoryName, model.IncomeType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currency, err := a.findCurrency(userID, p.Currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h := &model.History{
+		UserID:      userID,
+		Amount:      p.Amount,
+		Currency:    currency,
+		Account:     p.Account,
+		CategoryID:  category.ID,
+		Description: p.Description,
+		Date:        p.Date,
+	}
+	if err := a.Payment.Earn(h); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *App) apiGiveLoan(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	l := &model.LoanRequest{}
+	if !a.decodeAndValidate(w, r, l) {
+		return
+	}
+
+	friend, err := a.findFriend(userID, l.Friend)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currency, err := a.findCurrency(userID, l.Currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	loanC := a.getCategoryByName(model.LoanCategory)
+	debtC := a.getCategoryByName(model.DebtCategory)
+	repayC := a.getCategoryByName(model.RepayCategory)
+	if loanC == nil || debtC == nil || repayC == nil {
+		respondWithError(w, http.StatusInternalServerError, "Loan categories are missing")
+		return
+	}
+
+	t := &model.TransferLoan{
+		DebtCategoryID:    debtC.ID,
+		RepayCategoryName: repayC.Name,
+		Transfer: model.Transfer{
+			CreditorID:     userID,
+			Account:        l.Account,
+			LoanCategoryID: loanC.ID,
+			Date:           l.Date,
+			Loan: model.Loan{
+				DebtorID:    friend.ID,
+				Amount:      l.Amount,
+				Currency:    currency,
+				Description: l.Description,
+				Terms:       l.Terms,
+			},
+		},
+	}
+	if err := a.Payment.GiveLoan(t); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *App) apiSplit(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	l := &model.LoanRequest{}
+	if !a.decodeAndValidate(w, r, l) {
+		return
+	}
+
+	friend, err := a.findFriend(userID, l.Friend)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currency, err := a.findCurrency(userID, l.Currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	expenseC, err := a.findCategory(userID, l.CategoryName, model.ExpenseType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	loanC := a.getCategoryByName(model.LoanCategory)
+	if loanC == nil {
+		respondWithError(w, http.StatusInternalServerError, "Loan categories are missing")
+		return
+	}
+
+	t := &model.TransferSplit{
+		Expense:          *expenseC,
+		DebtCategoryName: a.debtCategory(userID, expenseC),
+		Transfer: model.Transfer{
+			CreditorID:     userID,
+			Account:        l.Account,
+			LoanCategoryID: loanC.ID,
+			Date:           l.Date,
+			Loan: model.Loan{
+				DebtorID:    friend.ID,
+				Amount:      l.Amount,
+				Currency:    currency,
+				Description: l.Description,
+			},
+		},
+	}
+	if err := a.Payment.Split(t); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// apiSplitExpense records an expense which the user paid for several friends,
+// divided equally, by exact amounts, by percents or by shares
+func (a *App) apiSplitExpense(w http.ResponseWriter, r *http.Request) {
+	e := &model.SplitRequest{}
+	if !a.decodeAndValidate(w, r, e) {
+		return
+	}
+
+	if err := a.recordSplit(currentUserID(r), nil, e); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// RECURRING
+
+func (a *App) apiRecurring(w http.ResponseWriter, r *http.Request) {
+	rules, err := a.getRecurringRules(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, rules)
+}
+
+// apiCreateRecurring stores a rule and records its occurrences which are already due
+func (a *App) apiCreateRecurring(w http.ResponseWriter, r *http.Request) {
+	req := &model.RecurringRequest{}
+	if !a.decodeAndValidate(w, r, req) {
+		return
+	}
+
+	rule, err := a.createRecurring(currentUserID(r), req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, rule)
+}
+
+func (a *App) apiPauseRecurring(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := a.pauseRecurring(currentUserID(r), id, true); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiResumeRecurring resumes a rule from its first occurrence after now
+func (a *App) apiResumeRecurring(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := a.pauseRecurring(currentUserID(r), id, false); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiDeleteRecurring(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := a.Recurring.Delete(currentUserID(r), id); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DEBTS AND LOANS
+
+func (a *App) apiDebts(w http.ResponseWriter, r *http.Request) {
+	d, err := a.getDebtsData(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, d)
+}
+
+func (a *App) apiRequestRepay(w http.ResponseWriter, r *http.Request) {
+	debtID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	rr := &model.RepayRequest{}
+	if !a.decodeAndValidate(w, r, rr) {
+		return
+	}
+	if rr.Amount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Amount must be positive")
+		return
+	}
+
+	if err := a.Payment.RequestRepay(currentUserID(r), debtID, rr.Amount, rr.Account); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiAcceptProposal accepts a loan or a split proposed to the user, which moves the money
+func (a *App) apiAcceptProposal(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	ar := &model.AcceptRequest{}
+	if !a.decodeOptional(w, r, ar) {
+		return
+	}
+
+	if err := a.acceptProposal(currentUserID(r), statusID, ar.Account); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiRejectProposal deletes a proposed loan or split. The debtor declines it, or the creditor withdraws it.
+func (a *App) apiRejectProposal(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Payment.RejectProposal(currentUserID(r), statusID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiDismissForgiven deletes the notice of a debt which a creditor forgave the user
+func (a *App) apiDismissForgiven(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Payment.DismissForgiven(currentUserID(r), id); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiLoans(w http.ResponseWriter, r *http.Request) {
+	l, err := a.getLoansData(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, l)
+}
+
+// apiForgiveLoan forgives the debtor the amount of a loan of the user, or the whole loan if no amount is set
+func (a *App) apiForgiveLoan(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	fr := &model.ForgiveRequest{}
+	if !a.decodeAndValidate(w, r, fr) {
+		return
+	}
+
+	if err := a.forgiveDebt(currentUserID(r), statusID, fr.Amount); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiAcceptPayment(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	ar := &model.AcceptRequest{}
+	if !a.decodeOptional(w, r, ar) {
+		return
+	}
+
+	if err := a.acceptRepayment(currentUserID(r), statusID, ar.Account); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiDeclinePayment(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Payment.DeclinePayment(currentUserID(r), statusID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HISTORY
+
+func (a *App) apiHistory(w http.ResponseWriter, r *http.Request) {
+	period, err := parsePeriod(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hs, err := a.getHistoryData(currentUserID(r), period)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, hs)
+}
+
+func (a *App) apiEditEntry(w http.ResponseWriter, r *http.Request) {
+	entryID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	h := &model.History{}
+	if !a.decodeAndValidate(w, r, h) {
+		return
+	}
+	if h.Amount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Amount must be positive")
+		return
+	}
+	h.ID = entryID
+	h.UserID = currentUserID(r)
+
+	if err := a.Payment.UpdateEntry(h); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiDeleteEntry(w http.ResponseWriter, r *http.Request) {
+	entryID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Payment.DeleteEntry(currentUserID(r), entryID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,6 +1,9 @@
 package rest
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
 	"fmt"
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
@@ -14,6 +17,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -21,26 +25,75 @@ import (
 type App struct {
 	Router *mux.Router
 
-	Users      contract.UserRepo
-	Friendship contract.FriendshipRepo
-	Groups     contract.GroupRepo
-	Categories contract.CategoryRepo
-	Payment    contract.PaymentRepo
+	Users       contract.UserRepo
+	Sessions    contract.SessionRepo
+	Friendship  contract.FriendshipRepo
+	Groups      contract.GroupRepo
+	Recurring   contract.RecurringRepo
+	Budgets     contract.BudgetRepo
+	Categories  contract.CategoryRepo
+	ImportRules contract.ImportRuleRepo
+	Payment     contract.PaymentRepo
+	Rates       contract.RateRepo
 
 	Validator  *validator.Validate
 	Translator ut.Translator
 	Template   *template.Template
+	Templates  string // The glob of the template files, templates/* by default
+
+	Keys    *KeySet
+	Cookies CookieConfig
+	CSRFKey []byte   // The key of the CSRF tokens, random by default
+	Admins  []string // The usernames of the users who maintain the exchange rates
+}
+
+// Init creates the repositories of the driver, which share the db connection pool
+func (a *App) Init(db *sql.DB, driver string) {
+	switch driver {
+	case repository.SQLite:
+		a.Users = repository.NewUserRepoSqlite(db)
+		a.Sessions = repository.NewSessionRepoSqlite(db)
+		a.Friendship = repository.NewFriendRepoSqlite(db)
+		a.Groups = repository.NewGroupRepoSqlite(db)
+		a.Recurring = repository.NewRecurringRepoSqlite(db)
+		a.Budgets = repository.NewBudgetRepoSqlite(db)
+		a.Categories = repository.NewCategoryRepoSqlite(db)
+		a.ImportRules = repository.NewImportRuleRepoSqlite(db)
+		a.Payment = repository.NewPaymentRepoSqlite(db)
+		a.Rates = repository.NewRateRepoSqlite(db)
+	default:
+		a.Users = repository.NewUserRepoMysql(db)
+		a.Sessions = repository.NewSessionRepoMysql(db)
+		a.Friendship = repository.NewFriendRepoMysql(db)
+		a.Groups = repository.NewGroupRepoMysql(db)
+		a.Recurring = repository.NewRecurringRepoMysql(db)
+		a.Budgets = repository.NewBudgetRepoMysql(db)
+		a.Categories = repository.NewCategoryRepoMysql(db)
+		a.ImportRules = repository.NewImportRuleRepoMysql(db)
+		a.Payment = repository.NewPaymentRepoMysql(db)
+		a.Rates = repository.NewRateRepoMysql(db)
+	}
+	a.initialize()
 }
 
-func (a *App) Init(user, password, dbname string) {
-	// db=sqlopen
-	// newrepo(&db) --> repo.db = db
-	a.Users = repository.NewUserRepoMysql(user, password, dbname) // TODO one db connection?
-	a.Friendship = repository.NewFriendRepoMysql(user, password, dbname)
-	a.Groups = repository.NewGroupRepoMysql(user, password, dbname)
-	a.Categories = repository.NewCategoryRepoMysql(user, password, dbname)
-	a.Payment = repository.NewPaymentRepoMysql(user, password, dbname)
+// InitMemory keeps all data in memory, so that the service runs without a database
+func (a *App) InitMemory() {
+	s := repository.NewMemoryStore()
+	a.Users = repository.NewUserRepoMemory(s)
+	a.Sessions = repository.NewSessionRepoMemory(s)
+	a.Friendship = repository.NewFriendRepoMemory(s)
+	a.Groups = repository.NewGroupRepoMemory(s)
+	a.Recurring = repository.NewRecurringRepoMemory(s)
+	a.Budgets = repository.NewBudgetRepoMemory(s)
+	a.Categories = repository.NewCategoryRepoMemory(s)
+	a.ImportRules = repository.NewImportRuleRepoMemory(s)
+	a.Payment = repository.NewPaymentRepoMemory(s)
+	a.Rates = repository.NewRateRepoMemory(s)
+	a.initialize()
+}
 
+// initialize sets up the validator, the templates and the routes, and adds the demo data
+func (a *App) initialize() {
 	a.Validator = validator.New()
 	eng := en.New()
 	var uni *ut.UniversalTranslator
@@ -56,13 +109,28 @@ func (a *App) Init(user, password, dbname string) {
 	}
 
 	a.Router = mux.NewRouter()
-	a.Template = template.Must(template.ParseGlob("templates/*"))
+	if a.Templates == "" {
+		a.Templates = "templates/*"
+	}
+	// csrfField is bound to the token of the session when a template is rendered
+	a.Template = template.Must(template.New("").Funcs(template.FuncMap{
+		"csrfField": func() template.HTML { return "" },
+	}).ParseGlob(a.Templates))
+	if len(a.CSRFKey) == 0 {
+		a.CSRFKey = make([]byte, 32)
+		if _, err := rand.Read(a.CSRFKey); err != nil {
+			log.Fatal(err)
+		}
+	}
 	a.initializeRoutes()
+	a.initializeAPIRoutes()
 
 	a.AddData()
 }
 
+// Run starts the scheduler of the recurring rules and serves the routes on the port
 func (a *App) Run(port string) {
+	go a.RunScheduler(context.Background(), schedulerInterval)
 	log.Fatal(http.ListenAndServe(":"+port, a.Router))
 }
 
@@ -83,19 +151,51 @@ const (
 	loans    = "loans"
 	accept   = "accept"
 	decline  = "decline"
+	withdraw = "withdraw"
+	forgive  = "forgive"
+	forgiven = "forgiven"
+	dismiss  = "dismiss"
 	history = "history"
+	all      = "all"
+	edit     = "edit"
+	remove   = "delete"
+	accounts = "accounts"
+	transfer = "transfer"
+	groups   = "groups"
+	invite   = "invite"
+	leave    = "leave"
+	rename   = "rename"
+	expenses = "expenses"
+	settle   = "settlement"
+	recurring = "recurring"
+	pause    = "pause"
+	resume   = "resume"
+	budgets  = "budgets"
+	archive  = "archive"
+	restore  = "restore"
 )
 
 func (a *App) initializeRoutes() {
+	a.Router.Use(a.LimitBody) // Middleware
 	a.Router.HandleFunc("/", a.welcome).Methods(http.MethodGet)
 	a.Router.HandleFunc("/"+register, a.register).Methods(http.MethodGet, http.MethodPost)
 	a.Router.HandleFunc("/"+login, a.login).Methods(http.MethodGet, http.MethodPost)
 
 	// Auth route
 	s := a.Router.PathPrefix("/" + index).Subrouter()
-	s.Use(JwtVerify) // Middleware
+	s.Use(a.JwtVerify, a.CSRFVerify) // Middleware
 	s.HandleFunc("", a.index).Methods(http.MethodGet)
 	s.HandleFunc("/"+logout, a.logout).Methods(http.MethodPost)
+	s.HandleFunc("/"+logout+"/"+all, a.logoutEverywhere).Methods(http.MethodPost)
+	s.HandleFunc("/"+accounts, a.createAccount).Methods(http.MethodPost)
+	s.HandleFunc("/"+accounts+"/"+transfer, a.transfer).Methods(http.MethodPost)
+	s.HandleFunc("/"+budgets, a.setBudgetForm).Methods(http.MethodPost)
+	s.HandleFunc("/"+budgets+"/{category}/"+remove, a.deleteBudget).Methods(http.MethodPost)
+	s.HandleFunc("/"+categories, a.getCategoryTree).Methods(http.MethodGet)
+	s.HandleFunc("/"+categories, a.createCategoryForm).Methods(http.MethodPost)
+	s.HandleFunc("/"+categories+"/{id:[0-9]+}/"+rename, a.renameCategory).Methods(http.MethodPost)
+	s.HandleFunc("/"+categories+"/{id:[0-9]+}/"+archive, a.archiveCategory).Methods(http.MethodPost)
+	s.HandleFunc("/"+categories+"/{id:[0-9]+}/"+restore, a.restoreCategory).Methods(http.MethodPost)
 	s.HandleFunc("/"+users, a.getUsers).Methods(http.MethodGet)
 	s.HandleFunc("/"+friends, a.getFriends).Methods(http.MethodGet, http.MethodPost)
 	s.HandleFunc("/"+friends+"/"+accept+"/{username}", a.acceptInvite).Methods(http.MethodPost)
@@ -106,21 +206,52 @@ func (a *App) initializeRoutes() {
 	s.HandleFunc("/"+pay, a.pay).Methods(http.MethodGet, http.MethodPost)
 	s.HandleFunc("/"+giveLoan, a.giveLoan).Methods(http.MethodPost)
 	s.HandleFunc("/"+split, a.split).Methods(http.MethodPost)
+	s.HandleFunc("/"+expenses, a.splitExpense).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+recurring, a.getRecurring).Methods(http.MethodGet)
+	s.HandleFunc("/"+recurring, a.createRecurringRule).Methods(http.MethodPost)
+	s.HandleFunc("/"+recurring+"/{id:[0-9]+}/"+pause, a.pauseRecurringRule).Methods(http.MethodPost)
+	s.HandleFunc("/"+recurring+"/{id:[0-9]+}/"+resume, a.resumeRecurringRule).Methods(http.MethodPost)
+	s.HandleFunc("/"+recurring+"/{id:[0-9]+}/"+remove, a.deleteRecurringRule).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+groups, a.getGroups).Methods(http.MethodGet)
+	s.HandleFunc("/"+groups, a.createGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}", a.getGroup).Methods(http.MethodGet)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+rename, a.renameGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+invite, a.inviteToGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+accept, a.joinGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+leave, a.leaveGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+expenses, a.groupExpense).Methods(http.MethodPost)
+
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+settle, a.getGroupSettlement).Methods(http.MethodGet)
+	s.HandleFunc("/"+groups+"/{id:[0-9]+}/"+settle, a.settleGroup).Methods(http.MethodPost)
+	s.HandleFunc("/"+settle, a.getSettlement).Methods(http.MethodGet)
+	s.HandleFunc("/"+settle, a.settleCircle).Methods(http.MethodPost)
 
 	s.HandleFunc("/"+debts, a.getDebts).Methods(http.MethodGet)
 	s.HandleFunc("/"+debts+"/"+repay+"/{id:[0-9]+}", a.requestRepay).Methods(http.MethodPost)
+	s.HandleFunc("/"+debts+"/"+accept+"/{id:[0-9]+}", a.acceptLoan).Methods(http.MethodPost)
+	s.HandleFunc("/"+debts+"/"+decline+"/{id:[0-9]+}", a.rejectLoan).Methods(http.MethodPost)
+	s.HandleFunc("/"+debts+"/"+dismiss+"/{id:[0-9]+}", a.dismissForgiven).Methods(http.MethodPost)
 
 	s.HandleFunc("/"+loans, a.getLoans).Methods(http.MethodGet)
 	s.HandleFunc("/"+loans+"/"+accept+"/{id:[0-9]+}", a.acceptPayment).Methods(http.MethodPost)
 	s.HandleFunc("/"+loans+"/"+decline+"/{id:[0-9]+}", a.declinePayment).Methods(http.MethodPost)
+	s.HandleFunc("/"+loans+"/"+withdraw+"/{id:[0-9]+}", a.withdrawLoan).Methods(http.MethodPost)
+	s.HandleFunc("/"+loans+"/"+forgive+"/{id:[0-9]+}", a.forgiveLoan).Methods(http.MethodPost)
 
 	s.HandleFunc("/"+history, a.getHistory).Methods(http.MethodGet)
+	s.HandleFunc("/"+history+"/"+edit+"/{id:[0-9]+}", a.editEntry).Methods(http.MethodPost)
+	s.HandleFunc("/"+history+"/"+remove+"/{id:[0-9]+}", a.deleteEntry).Methods(http.MethodPost)
+
+	a.initializeExportRoutes(s)
+	a.initializeImportRoutes(s)
 }
 
 // Handlers
 
 func (a *App) welcome(w http.ResponseWriter, r *http.Request) {
-	_ = a.Template.ExecuteTemplate(w, welcome, nil)
+	_ = a.render(w, r, welcome, nil)
 }
 
 func (a *App) register(w http.ResponseWriter, r *http.Request) {
@@ -131,7 +262,7 @@ func (a *App) register(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		_ = a.Template.ExecuteTemplate(w, register, nil)
+		_ = a.render(w, r, register, nil)
 	case "POST":
 		if err := r.ParseForm(); err != nil {
 			_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
@@ -183,7 +314,7 @@ func (a *App) login(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		a.Template.ExecuteTemplate(w, login, nil)
+		a.render(w, r, login, nil)
 	case "POST":
 		if err := r.ParseForm(); err != nil {
 			fmt.Fprintf(w, "ParseForm() err: %v", err)
@@ -200,17 +331,11 @@ func (a *App) login(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		resp, err := a.checkCredentials(w, user.Username, user.Password)
-		if err == nil {
-			tokenString := resp["token"]
-			http.SetCookie(w, &http.Cookie{
-				Name:     "token",
-				Value:    tokenString,
-				Expires:  time.Now().Add(30 * time.Minute),
-				HttpOnly: true,
-				//MaxAge: 60*60,
-			})
+		tokens, err := a.checkCredentials(w, user.Username, user.Password)
+		if err != nil {
+			return
 		}
+		a.setAuthCookies(w, tokens)
 
 		http.Redirect(w, r, "/"+index, http.StatusFound)
 	default:
@@ -223,24 +348,148 @@ func (a *App) index(w http.ResponseWriter, r *http.Request) {
 	user := ctx.Value("user").(*model.UserToken)
 	userID, _ := strconv.Atoi(user.UserID)
 	// Show balance
-	balance, _ := a.Payment.CheckBalance(userID)
-
-	_ = a.Template.ExecuteTemplate(w, index, model.UserWallet{
-		Username: user.Username,
-		Balance:  balance,
+	balance := a.getBalance(userID)
+
+	// Show budgets
+	userBudgets, _ := a.Budgets.Find(userID, time.Now())
+	categories, _ := a.Categories.FindExpenses(userID)
+
+	_ = a.render(w, r, index, model.UserWallet{
+		Username:   user.Username,
+		Balance:    balance,
+		Budgets:    userBudgets,
+		Categories: userCategories(categories),
+		Currencies: a.getCurrencies(),
 	})
 }
 
-// TODO
+// I open a savings account
+// Receive --> name
+func (a *App) createAccount(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	account := &model.NewAccount{Name: r.FormValue("name")}
+	if err := a.Validator.Struct(account); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if err := a.Payment.CreateAccount(userID, account.Name); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index, http.StatusFound)
+}
+
+// I move 100lv from the bank to cash
+// Receive --> from, to, amount, currency
+func (a *App) transfer(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	currency, err := a.findCurrency(userID, r.FormValue("currency"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	amount, err := parseAmount(r.FormValue("amount"), currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	t := &model.AccountTransfer{
+		UserID:   userID,
+		From:     r.FormValue("from"),
+		To:       r.FormValue("to"),
+		Amount:   amount,
+		Currency: currency,
+	}
+	if err := a.Validator.Struct(t); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if err := a.Payment.Transfer(t); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/"+index, http.StatusFound)
+}
+
+// Food costs me at most 300lv per month
+// Receive --> category, amount, currency, period, block
+func (a *App) setBudgetForm(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	currency, err := a.findCurrency(userID, r.FormValue("currency"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	amount, err := parseAmount(r.FormValue("amount"), currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+	req := &model.BudgetRequest{
+		Amount:   amount,
+		Currency: currency,
+		Period:   r.FormValue("period"),
+		Block:    r.FormValue("block") != "",
+	}
+	if err := a.Validator.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if err := a.setBudget(userID, r.FormValue("category"), req); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/"+index, http.StatusFound)
+}
+
+func (a *App) deleteBudget(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	category, err := a.findCategory(userID, mux.Vars(r)["category"], model.ExpenseType)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := a.Budgets.Delete(userID, category.ID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index, http.StatusFound)
+}
+
 func (a *App) logout(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("logout")
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		//MaxAge: 0,
-	})
+	claims := r.Context().Value("user").(*model.UserToken)
+	if err := a.Sessions.Revoke(claims.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.clearAuthCookies(w)
 
 	http.Redirect(w, r, "/", http.StatusFound)
 }
@@ -263,7 +512,107 @@ func (a *App) getUsers(w http.ResponseWriter, r *http.Request) {
 		users[i].Password = ""
 	}
 
-	a.Template.ExecuteTemplate(w, "showUsers", model.Users{Users: users})
+	a.render(w, r, "showUsers", model.Users{Users: users})
+}
+
+// CATEGORIES
+
+// Return --> the shared categories and mine, with their subcategories
+func (a *App) getCategoryTree(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	tree, err := a.Categories.FindAll(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	parents, err := a.parentCategories(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	_ = a.render(w, r, categories, model.CategoriesTemplate{
+		Categories: userCategories(tree),
+		Parents:    parents,
+	})
+}
+
+// I split FOOD into GROCERIES and RESTAURANTS
+// Receive --> name, type, parent
+func (a *App) createCategoryForm(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	req := &model.CategoryRequest{
+		Name:   r.FormValue("name"),
+		CType:  r.FormValue("type"),
+		Parent: r.FormValue("parent"),
+	}
+	if err := a.Validator.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if _, err := a.createCategory(userID, req); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+categories, http.StatusFound)
+}
+
+// Receive --> name
+func (a *App) renameCategory(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	category := &model.Category{ID: id, Name: r.FormValue("name")}
+	if err := a.Validator.Struct(category); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if err := a.Categories.Rename(userID, id, category.Name); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+categories, http.StatusFound)
+}
+
+// I no longer go to RESTAURANTS. The category disappears, but my history keeps it.
+func (a *App) archiveCategory(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Categories.Archive(userID, id, true); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+categories, http.StatusFound)
+}
+
+func (a *App) restoreCategory(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Categories.Archive(userID, id, false); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+categories, http.StatusFound)
 }
 
 // FRIENDS
@@ -286,7 +635,7 @@ func (a *App) getFriends(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Template.ExecuteTemplate(w, friends, model.GetFriends{Friends: *friendsData, PendingFriends: *pending})
+	a.render(w, r, friends, model.GetFriends{Friends: *friendsData, PendingFriends: *pending})
 }
 
 func (a *App) acceptInvite(w http.ResponseWriter, r *http.Request) {
@@ -377,142 +726,586 @@ func (a *App) addFriend(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+index+"/"+friends, http.StatusFound)
 }
 
-// PAYMENT
+// GROUPS
 
-// I want to pay 20lv for FOOD "Happy"
-// Receive --> user_id, amount, categoryName, description
-func (a *App) pay(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/"+index+"/"+pay {
-		fmt.Println(r.URL.Path)
-		http.Error(w, "404 not found.", http.StatusNotFound)
+func (a *App) getGroups(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	g, err := a.getGroupsData(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	switch r.Method {
-	case "GET":
-		user := r.Context().Value("user").(*model.UserToken)
-		userID, _ := strconv.Atoi(user.UserID)
-		// Show balance
-		balance, _ := a.Payment.CheckBalance(userID)
+	friendIDs, _ := a.Friendship.Find(0, 100, userID)
+	g.Friends, _ = a.convertToUsername(friendIDs)
 
-		// Show Expense Categories
-		categories, _ := a.Categories.FindExpenses()
+	_ = a.render(w, r, groups, g)
+}
 
-		// Show Friends
-		friendIDs, _ := a.Friendship.Find(0, 100, userID) // TODO fix range
-		friendUsernames, _ := a.convertToUsername(friendIDs)
+// I create the group "Trip" with George and Lily
+// Receive --> name, participants
+func (a *App) createGroup(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
 
-		_ = a.Template.ExecuteTemplate(w, pay, model.PayTemplate{
-			Balance:    balance,
-			Categories: categories,
-			Friends:    friendUsernames,
-		})
-	case "POST":
-		userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	cg := &model.CreateGroup{Name: r.FormValue("name"), Participants: r.Form["participants"]}
+	if err := a.Validator.Struct(cg); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
 
-		if err := r.ParseForm(); err != nil {
-			_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
-			return
-		}
-		amountS := r.FormValue("amount")
-		amount, _ := strconv.Atoi(amountS)
-		categoryName := r.FormValue("category")
-		category, _ := a.Categories.FindByName(categoryName)
-		description := r.FormValue("description")
+	invited, err := a.findFriends(userID, cg.Participants)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-		h := &model.History{
-			UserID:      userID,
-			Amount:      amount,
-			CategoryID:  category.ID,
-			Description: description,
-		}
+	group, err := a.Groups.Create(cg.Name, userID, invited)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
 
-		err := a.Payment.Pay(h)
-		if err != nil {
-			respondWithError(w, http.StatusBadRequest, err.Error())
+	http.Redirect(w, r, fmt.Sprintf("/%s/%s/%d", index, groups, group.ID), http.StatusFound)
+}
+
+// Return --> members and their balances, the friends to invite
+func (a *App) getGroup(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	group, err := a.findGroup(userID, groupID)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	balance := a.getBalance(userID)
+	categories, _ := a.Categories.FindExpenses(userID)
+
+	// Show the friends who are not in the group
+	friendIDs, _ := a.Friendship.Find(0, 100, userID)
+	outside := []int{}
+	for _, id := range friendIDs {
+		if group.Member(id) == nil {
+			outside = append(outside, id)
 		}
-		http.Redirect(w, r, "/"+index+"/"+pay, http.StatusFound)
-	default:
-		_, _ = fmt.Fprintf(w, "Sorry, only GET and POST methods are supported.")
 	}
+	friendUsernames, _ := a.convertToUsername(outside)
+
+	_ = a.render(w, r, "group", model.GroupTemplate{
+		Group:      *group,
+		UserID:     userID,
+		Balance:    balance,
+		Categories: categories,
+		Friends:    friendUsernames,
+		Currencies: a.getCurrencies(),
+		Currency:   balance.Total.Currency,
+		Account:    model.DefaultAccount,
+	})
 }
 
-// I giveMoneyTo George for "Bills"
-// Receive --> <CreditorID> // DebtorID, Amount, Description
-func (a *App) giveLoan(w http.ResponseWriter, r *http.Request) {
+// Receive --> name
+func (a *App) renameGroup(w http.ResponseWriter, r *http.Request) {
 	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
 
 	if err := r.ParseForm(); err != nil {
 		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
 		return
 	}
-	friendName := r.FormValue("to")
-	friend, _ := a.Users.FindByUsername(friendName)
-	amountS := r.FormValue("amount")
-	amount, _ := strconv.Atoi(amountS)
-	description := r.FormValue("description")
+	group := &model.Group{ID: groupID, Name: r.FormValue("name")}
+	if err := a.Validator.Struct(group); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
 
-	var loan = "loan"
-	loanC, _ := a.Categories.FindByName(loan)
+	if _, err := a.findGroup(userID, groupID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	if err := a.Groups.Rename(groupID, group.Name); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
 
-	var debt = "debt"
-	debtC, _ := a.Categories.FindByName(debt)
+	http.Redirect(w, r, fmt.Sprintf("/%s/%s/%d", index, groups, groupID), http.StatusFound)
+}
 
-	var repay = "repay"
-	repayC, _ := a.Categories.FindByName(repay)
+// I invite my friend Lily to the group
+// Receive --> username
+func (a *App) inviteToGroup(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	t := &model.TransferLoan{
-		DebtCategoryID:    debtC.ID,
-		RepayCategoryName: repayC.Name,
-		Transfer: model.Transfer{
-			CreditorID:     userID,
-			LoanCategoryID: loanC.ID,
-			Loan: model.Loan{
-				DebtorID:    friend.ID,
-				Amount:      amount,
-				Description: description,
-			},
-		},
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
 	}
 
-	if err := a.Payment.GiveLoan(t); err != nil {
-		msg := fmt.Sprintf("Error in giving money: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, msg)
+	if _, err := a.findGroup(userID, groupID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	invited, err := a.findFriends(userID, []string{r.FormValue("username")})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.Groups.Invite(groupID, invited[0]); err != nil {
+		respondWithRepoError(w, err)
 		return
 	}
 
-	http.Redirect(w, r, "/index/pay", http.StatusFound)
+	http.Redirect(w, r, fmt.Sprintf("/%s/%s/%d", index, groups, groupID), http.StatusFound)
 }
 
-// I want to split money with George for FOOD "Happy"
-// Receive --> creditor_id, debtor_id, amount, categoryName, description
-func (a *App) split(w http.ResponseWriter, r *http.Request) {
+// I accept the invitation to the group
+func (a *App) joinGroup(w http.ResponseWriter, r *http.Request) {
 	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	if err := r.ParseForm(); err != nil {
-		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+	if err := a.Groups.Join(groupID, userID); err != nil {
+		respondWithRepoError(w, err)
 		return
 	}
-	friendName := r.FormValue("to")
-	friend, _ := a.Users.FindByUsername(friendName)
-	amountS := r.FormValue("amount")
-	amount, _ := strconv.Atoi(amountS)
-	categoryName := r.FormValue("category")
-	description := r.FormValue("description")
 
-	var loan = "loan"
-	loanC, _ := a.Categories.FindByName(loan)
+	http.Redirect(w, r, fmt.Sprintf("/%s/%s/%d", index, groups, groupID), http.StatusFound)
+}
 
-	expenseC, _ := a.Categories.FindByName(categoryName)
+// I leave the group or decline the invitation to it
+func (a *App) leaveGroup(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Groups.Leave(groupID, userID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+groups, http.StatusFound)
+}
+
+// I paid 60lv for FOOD for the group. Every participant owes me their share.
+// Receive --> amount, currency, account, category, description, date, method, participant[], part_<participant>
+func (a *App) groupExpense(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	e, err := a.parseSplitForm(userID, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.Validator.Struct(e); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	group, err := a.findGroup(userID, groupID)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	if err := a.recordSplit(userID, group, e); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%s/%s/%d", index, groups, groupID), http.StatusFound)
+}
+
+// SETTLEMENT
+
+// Peter owes George 10lv, George owes Lily 10lv. Peter can pay Lily instead.
+// Return --> the payments which settle the debts of the group
+func (a *App) getGroupSettlement(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	group, err := a.findGroup(userID, groupID)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	plan, err := a.getSettlementPlan(group.Name, model.DebtScope{GroupID: groupID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	plan.Action = fmt.Sprintf("/%s/%s/%d/%s", index, groups, groupID, settle)
+
+	_ = a.render(w, r, settle, plan)
+}
+
+func (a *App) settleGroup(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	groupID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if _, err := a.findGroup(userID, groupID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	if err := a.Payment.Settle(model.DebtScope{GroupID: groupID}); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%s/%s/%d", index, groups, groupID), http.StatusFound)
+}
+
+// Return --> the payments which settle the debts between me and my friends
+func (a *App) getSettlement(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*model.UserToken)
+	userID, _ := strconv.Atoi(user.UserID)
+
+	scope, err := a.circleScope(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	plan, err := a.getSettlementPlan(user.Username, scope)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	plan.Action = "/" + index + "/" + settle
+
+	_ = a.render(w, r, settle, plan)
+}
+
+func (a *App) settleCircle(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	scope, err := a.circleScope(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := a.Payment.Settle(scope); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+debts, http.StatusFound)
+}
+
+// RECURRING
+
+func (a *App) getRecurring(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	rules, err := a.getRecurringRules(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	balance := a.getBalance(userID)
+
+	// Show the categories which a rule can record
+	expenses, _ := a.Categories.FindExpenses(userID)
+	incomes, _ := a.Categories.FindIncomes(userID)
+
+	_ = a.render(w, r, recurring, model.RecurringTemplate{
+		Rules:      rules,
+		Balance:    balance,
+		Categories: userCategories(append(expenses, incomes...)),
+		Currencies: a.getCurrencies(),
+		Currency:   balance.Total.Currency,
+		Account:    model.DefaultAccount,
+	})
+}
+
+// I pay 600lv for HOME "Rent" on the first of every month
+// Receive --> amount, currency, account, category, description, frequency, starts, ends, count
+func (a *App) createRecurringRule(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	req, err := a.parseRecurringForm(userID, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.Validator.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if _, err := a.createRecurring(userID, req); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+recurring, http.StatusFound)
+}
+
+func (a *App) pauseRecurringRule(w http.ResponseWriter, r *http.Request) {
+	a.setRecurringPaused(w, r, true)
+}
+
+func (a *App) resumeRecurringRule(w http.ResponseWriter, r *http.Request) {
+	a.setRecurringPaused(w, r, false)
+}
+
+func (a *App) setRecurringPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.pauseRecurring(userID, id, paused); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+recurring, http.StatusFound)
+}
+
+func (a *App) deleteRecurringRule(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Recurring.Delete(userID, id); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+recurring, http.StatusFound)
+}
+
+// PAYMENT
+
+// I want to pay 20lv for FOOD "Happy"
+// Receive --> user_id, amount, categoryName, description
+func (a *App) pay(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/"+index+"/"+pay {
+		fmt.Println(r.URL.Path)
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		user := r.Context().Value("user").(*model.UserToken)
+		userID, _ := strconv.Atoi(user.UserID)
+		// Show balance
+		balance := a.getBalance(userID)
+
+		// Show Expense Categories
+		categories, _ := a.Categories.FindExpenses(userID)
+
+		// Show Friends
+		friendIDs, _ := a.Friendship.Find(0, 100, userID) // TODO fix range
+		friendUsernames, _ := a.convertToUsername(friendIDs)
+
+		_ = a.render(w, r, pay, model.PayTemplate{
+			Username:   user.Username,
+			Warning:    r.FormValue("warning"),
+			Balance:    balance,
+			Categories: categories,
+			Friends:    friendUsernames,
+			Currencies: a.getCurrencies(),
+			Currency:   balance.Total.Currency,
+			Account:    model.DefaultAccount,
+		})
+	case "POST":
+		userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+		if err := r.ParseForm(); err != nil {
+			_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+			return
+		}
+		currency, err := a.findCurrency(userID, r.FormValue("currency"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		amount, err := parseAmount(r.FormValue("amount"), currency)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+		category, err := a.findCategory(userID, r.FormValue("category"), model.ExpenseType)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		description := r.FormValue("description")
+		date, err := parseDate(r.FormValue("date"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid date")
+			return
+		}
+
+		h := &model.History{
+			UserID:      userID,
+			Amount:      amount,
+			Currency:    currency,
+			Account:     r.FormValue("account"),
+			CategoryID:  category.ID,
+			Description: description,
+			Date:        date,
+		}
+
+		warning, err := a.checkBudget(h)
+		if err != nil {
+			respondWithRepoError(w, err)
+			return
+		}
+
+		err = a.Payment.Pay(h)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if warning != "" {
+			http.Redirect(w, r, "/"+index+"/"+pay+"?warning="+url.QueryEscape(warning), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/"+index+"/"+pay, http.StatusFound)
+	default:
+		_, _ = fmt.Fprintf(w, "Sorry, only GET and POST methods are supported.")
+	}
+}
+
+// I giveMoneyTo George for "Bills"
+// Receive --> <CreditorID> // DebtorID, Amount, Description
+func (a *App) giveLoan(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	friend, err := a.findFriend(userID, r.FormValue("to"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	currency, err := a.findCurrency(userID, r.FormValue("currency"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	amount, err := parseAmount(r.FormValue("amount"), currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+	description := r.FormValue("description")
+	date, err := parseDate(r.FormValue("date"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid date")
+		return
+	}
+	terms, err := parseTerms(r.FormValue("dueDate"), r.FormValue("interestRate"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var loan = "loan"
+	loanC, _ := a.Categories.FindByName(0, loan)
+
+	var debt = "debt"
+	debtC, _ := a.Categories.FindByName(0, debt)
+
+	var repay = "repay"
+	repayC, _ := a.Categories.FindByName(0, repay)
+
+	t := &model.TransferLoan{
+		DebtCategoryID:    debtC.ID,
+		RepayCategoryName: repayC.Name,
+		Transfer: model.Transfer{
+			CreditorID:     userID,
+			Account:        r.FormValue("account"),
+			LoanCategoryID: loanC.ID,
+			Date:           date,
+			Loan: model.Loan{
+				DebtorID:    friend.ID,
+				Amount:      amount,
+				Currency:    currency,
+				Description: description,
+				Terms:       terms,
+			},
+		},
+	}
+
+	if err := a.Payment.GiveLoan(t); err != nil {
+		msg := fmt.Sprintf("Error in giving money: %v", err.Error())
+		respondWithError(w, http.StatusInternalServerError, msg)
+		return
+	}
+
+	http.Redirect(w, r, "/index/pay", http.StatusFound)
+}
+
+// I want to split money with George for FOOD "Happy"
+// Receive --> creditor_id, debtor_id, amount, categoryName, description
+func (a *App) split(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	friend, err := a.findFriend(userID, r.FormValue("to"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	currency, err := a.findCurrency(userID, r.FormValue("currency"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	amount, err := parseAmount(r.FormValue("amount"), currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+	expenseC, err := a.findCategory(userID, r.FormValue("category"), model.ExpenseType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	description := r.FormValue("description")
+	date, err := parseDate(r.FormValue("date"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid date")
+		return
+	}
+
+	var loan = "loan"
+	loanC, _ := a.Categories.FindByName(0, loan)
 
 	t := &model.TransferSplit{
-		Expense: *expenseC,
+		Expense:          *expenseC,
+		DebtCategoryName: a.debtCategory(userID, expenseC),
 		Transfer: model.Transfer{
 			CreditorID:     userID,
+			Account:        r.FormValue("account"),
 			LoanCategoryID: loanC.ID,
+			Date:           date,
 			Loan: model.Loan{
 				DebtorID:    friend.ID,
 				Amount:      amount,
+				Currency:    currency,
 				Description: description,
 			},
 		},
@@ -527,6 +1320,34 @@ func (a *App) split(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+index+"/"+pay, http.StatusFound)
 }
 
+// I paid 100lv for FOOD at a dinner with four friends. Lily had 40lv, the rest of us 15lv each.
+// Receive --> amount, currency, account, category, description, date, method, participant[], part_<participant>
+func (a *App) splitExpense(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	e, err := a.parseSplitForm(userID, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.Validator.Struct(e); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if err := a.recordSplit(userID, nil, e); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+pay, http.StatusFound)
+}
+
 // I earn 1000lv from SALARY "Job"
 // Receive --> user_id, amount, categoryName, description
 func (a *App) earn(w http.ResponseWriter, r *http.Request) {
@@ -541,19 +1362,22 @@ func (a *App) earn(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value("user").(*model.UserToken)
 		userID, _ := strconv.Atoi(user.UserID)
 		// Show balance
-		balance, _ := a.Payment.CheckBalance(userID)
+		balance := a.getBalance(userID)
 
 		// Show Income Categories
-		categories, _ := a.Categories.FindIncomes()
+		categories, _ := a.Categories.FindIncomes(userID)
 
 		// Show Friends
 		friendIDs, _ := a.Friendship.Find(0, 100, userID) // TODO fix range
 		friendUsernames, _ := a.convertToUsername(friendIDs)
 
-		_ = a.Template.ExecuteTemplate(w, earn, model.PayTemplate{
+		_ = a.render(w, r, earn, model.PayTemplate{
 			Balance:    balance,
 			Categories: categories,
 			Friends:    friendUsernames,
+			Currencies: a.getCurrencies(),
+			Currency:   balance.Total.Currency,
+			Account:    model.DefaultAccount,
 		})
 	case "POST":
 		userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
@@ -562,22 +1386,42 @@ func (a *App) earn(w http.ResponseWriter, r *http.Request) {
 			_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
 			return
 		}
-		amountS := r.FormValue("amount")
-		amount, _ := strconv.Atoi(amountS)
-		categoryName := r.FormValue("category")
-		category, _ := a.Categories.FindByName(categoryName)
+		currency, err := a.findCurrency(userID, r.FormValue("currency"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		amount, err := parseAmount(r.FormValue("amount"), currency)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+		category, err := a.findCategory(userID, r.FormValue("category"), model.IncomeType)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		description := r.FormValue("description")
+		date, err := parseDate(r.FormValue("date"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid date")
+			return
+		}
 
 		h := &model.History{
 			UserID:      userID,
 			Amount:      amount,
+			Currency:    currency,
+			Account:     r.FormValue("account"),
 			CategoryID:  category.ID,
 			Description: description,
+			Date:        date,
 		}
 
-		err := a.Payment.Earn(h)
+		err = a.Payment.Earn(h)
 		if err != nil {
 			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 		http.Redirect(w, r, "/"+index+"/"+earn, http.StatusFound)
 	default:
@@ -599,49 +1443,13 @@ func (a *App) getDebts(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value("user").(*model.UserToken)
 		userID, _ := strconv.Atoi(user.UserID)
 
-		// Show balance
-		balance, _ := a.Payment.CheckBalance(userID)
-
-		// Show debts:
-		activeDebts, err := a.Payment.FindActiveDebts(userID)
+		d, err := a.getDebtsData(userID)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		ds := make([]model.DebtTemplate, 0, len(activeDebts))
-		for _, d := range activeDebts {
-			creditor, _ := a.Users.FindByID(d.CreditorID)
-			ds = append(ds, model.DebtTemplate{
-				Creditor: creditor.Username,
-				DLTemplate: model.DLTemplate{
-					StatusID:    d.StatusID,
-					Amount:      d.Amount,
-					Description: d.Description,
-				},
-			})
-		}
-
-		// Show pending debts:
-		pendingDebts, err := a.Payment.FindPendingDebts(userID)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		pds := make([]model.DebtTemplate, 0, len(pendingDebts))
-		for _, pd := range pendingDebts {
-			creditor, _ := a.Users.FindByID(pd.CreditorID)
-			pds = append(pds, model.DebtTemplate{
-				Creditor: creditor.Username,
-				DLTemplate: model.DLTemplate{
-					Amount:      pd.Amount,
-					Description: pd.Description,
-				},
-			})
-		}
-
-		_ = a.Template.ExecuteTemplate(w, debts, model.DebtsTemplate{Active: ds, Pending: pds, Balance: balance})
+		_ = a.render(w, r, debts, d)
 		//case "POST":
 	}
 }
@@ -657,16 +1465,60 @@ func (a *App) requestRepay(w http.ResponseWriter, r *http.Request) {
 		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
 		return
 	}
-	amountS := r.FormValue("amount")
-	amount, _ := strconv.Atoi(amountS)
+	currency, err := a.debtCurrency(currentUserID(r), debtID)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	amount, err := parseAmount(r.FormValue("amount"), currency)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
 
-	err := a.Payment.RequestRepay(debtID, amount)
+	err = a.Payment.RequestRepay(currentUserID(r), debtID, amount, r.FormValue("account"))
 	if err != nil {
 		fmt.Printf("Error requesting repay: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Invalid transfer")
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+debts, http.StatusFound)
+}
+
+// Peter has proposed to lend you money or to split a bill with you. You acceptLoan.
+// Receive --> statusID
+func (a *App) acceptLoan(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.acceptProposal(currentUserID(r), statusID, r.FormValue("account")); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/"+index+"/"+debts, http.StatusFound)
+}
+
+// Peter has proposed to lend you money or to split a bill with you. You rejectLoan.
+// Receive --> statusID
+func (a *App) rejectLoan(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Payment.RejectProposal(currentUserID(r), statusID); err != nil {
+		respondWithRepoError(w, err)
 		return
 	}
+	http.Redirect(w, r, "/"+index+"/"+debts, http.StatusFound)
+}
+
+// Peter has forgiven you a debt. You read the notice and dismissForgiven.
+// Receive --> notice ID
+func (a *App) dismissForgiven(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
 
+	if err := a.Payment.DismissForgiven(currentUserID(r), id); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
 	http.Redirect(w, r, "/"+index+"/"+debts, http.StatusFound)
 }
 
@@ -684,49 +1536,13 @@ func (a *App) getLoans(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value("user").(*model.UserToken)
 		userID, _ := strconv.Atoi(user.UserID)
 
-		// Show balance
-		balance, _ := a.Payment.CheckBalance(userID)
-
-		// Show loans:
-		activeLoans, err := a.Payment.FindActiveLoans(userID)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		als := make([]model.LoanTemplate, 0, len(activeLoans))
-		for _, al := range activeLoans {
-			debtor, _ := a.Users.FindByID(al.DebtorID)
-			als = append(als, model.LoanTemplate{
-				Debtor: debtor.Username,
-				DLTemplate: model.DLTemplate{
-					Amount:      al.Amount,
-					Description: al.Description,
-				},
-			})
-		}
-
-		// Show pending requests:
-		pendingRequests, err := a.Payment.FindPendingRequests(userID)
+		l, err := a.getLoansData(userID)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		prs := make([]model.LoanTemplate, 0, len(pendingRequests))
-		for _, pr := range pendingRequests {
-			debtor, _ := a.Users.FindByID(pr.DebtorID)
-			prs = append(prs, model.LoanTemplate{
-				Debtor: debtor.Username,
-				DLTemplate: model.DLTemplate{
-					StatusID:    pr.StatusID,
-					Amount:      pr.Amount,
-					Description: pr.Description,
-				},
-			})
-		}
-
-		_ = a.Template.ExecuteTemplate(w, loans, model.LoansTemplate{Active: als, Pending: prs, Balance: balance})
+		_ = a.render(w, r, loans, l)
 		//case "POST":
 	}
 }
@@ -738,14 +1554,8 @@ func (a *App) acceptPayment(w http.ResponseWriter, r *http.Request) {
 	status := vars["id"]
 	statusID, _ := strconv.Atoi(status)
 
-	expenseC := a.getCategoryByName(a.getCategoryByStatus(statusID))
-	repayC := a.getCategoryByName("receive")
-	am := &model.Accept{StatusID: statusID, RepayC: *repayC, ExpenseC: *expenseC}
-	fmt.Println("EXPENSEC AFTER", expenseC, repayC, statusID)
-
-	if err := a.Payment.AcceptPayment(am); err != nil {
-		msg := fmt.Sprintf("Error accepting payment: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, msg)
+	if err := a.acceptRepayment(currentUserID(r), statusID, r.FormValue("account")); err != nil {
+		respondWithRepoError(w, err)
 		return
 	}
 	http.Redirect(w, r, "/"+index+"/"+loans, http.StatusFound)
@@ -758,9 +1568,50 @@ func (a *App) declinePayment(w http.ResponseWriter, r *http.Request) {
 	status := vars["id"]
 	statusID, _ := strconv.Atoi(status)
 
-	if err := a.Payment.DeclinePayment(statusID); err != nil {
+	if err := a.Payment.DeclinePayment(currentUserID(r), statusID); err != nil {
 		fmt.Printf("Error declining request: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Invalid request payload")
+		respondWithRepoError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/"+index+"/"+loans, http.StatusFound)
+}
+
+// Peter has not accepted your loan yet. You withdrawLoan.
+// Receive --> statusID
+func (a *App) withdrawLoan(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := a.Payment.RejectProposal(currentUserID(r), statusID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/"+index+"/"+loans, http.StatusFound)
+}
+
+// You have lent Peter money and forgiveLoan, or a part of it. An empty amount forgives all of it.
+// Receive --> statusID, amount
+func (a *App) forgiveLoan(w http.ResponseWriter, r *http.Request) {
+	statusID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	var amount model.Amount
+	if value := r.FormValue("amount"); value != "" {
+		currency, err := a.loanCurrency(currentUserID(r), statusID)
+		if err != nil {
+			respondWithRepoError(w, err)
+			return
+		}
+		if amount, err = parseAmount(value, currency); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+
+	if err := a.forgiveDebt(currentUserID(r), statusID, amount); err != nil {
+		respondWithRepoError(w, err)
 		return
 	}
 	http.Redirect(w, r, "/"+index+"/"+loans, http.StatusFound)
@@ -769,41 +1620,86 @@ func (a *App) declinePayment(w http.ResponseWriter, r *http.Request) {
 func (a *App) getHistory(w http.ResponseWriter, r *http.Request){
 	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
 
-	h, err := a.Payment.FindHistory(userID)
+	period, err := parsePeriod(r)
 	if err != nil {
-		msg := fmt.Sprintf("Error getting history: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, msg)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hs, err := a.getHistoryData(userID, period)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	hs.From = r.FormValue("from")
+	hs.To = r.FormValue("to")
 
-	for i, hs := range h.HistoryShowAll{
-		if hs.CategoryType == "expense" {
-			h.HistoryShowAll[i].CategoryType = "-"
+	for i, h := range hs.HistoryShowAll.HistoryShowAll {
+		if h.CategoryType == "expense" {
+			hs.HistoryShowAll.HistoryShowAll[i].CategoryType = "-"
 		} else {
-			h.HistoryShowAll[i].CategoryType = "+"
+			hs.HistoryShowAll.HistoryShowAll[i].CategoryType = "+"
 		}
 	}
 
-	// Statistics:
-	exp, err :=	a.Payment.FindStatistics(userID, true)
+	a.render(w, r, history, hs)
+}
+
+
+// I paid 25lv for FOOD, not 52lv. I edit the entry.
+// Receive --> entryID, amount, description, date
+func (a *App) editEntry(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	vars := mux.Vars(r)
+	entryID, _ := strconv.Atoi(vars["id"])
+
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	currency, err := a.entryCurrency(userID, entryID)
 	if err != nil {
-		msg := fmt.Sprintf("Error getting expense statistics: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, msg)
+		respondWithRepoError(w, err)
 		return
 	}
-	inc, err :=	a.Payment.FindStatistics(userID, false)
+	amount, err := parseAmount(r.FormValue("amount"), currency)
 	if err != nil {
-		msg := fmt.Sprintf("Error getting income statistics: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, msg)
+		respondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+	date, err := parseDate(r.FormValue("date"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid date")
 		return
 	}
 
-	hs := model.HistoryAndStatistics{
-		HistoryShowAll: *h,
-		Expense:     *exp,
-		Income: *inc,
+	h := &model.History{
+		ID:          entryID,
+		UserID:      userID,
+		Amount:      amount,
+		Description: r.FormValue("description"),
+		Date:        date,
 	}
 
-	a.Template.ExecuteTemplate(w, history, hs)
+	if err := a.Payment.UpdateEntry(h); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/"+index+"/"+history, http.StatusFound)
 }
 
+// I paid for FOOD by mistake. I delete the entry and get my money back.
+// Receive --> entryID
+func (a *App) deleteEntry(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Context().Value("user").(*model.UserToken).UserID)
+
+	vars := mux.Vars(r)
+	entryID, _ := strconv.Atoi(vars["id"])
+
+	if err := a.Payment.DeleteEntry(userID, entryID); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/"+index+"/"+history, http.StatusFound)
+}
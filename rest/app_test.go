@@ -0,0 +1,1550 @@
+package rest
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hpmalinova/Money-Manager/model"
+	"github.com/hpmalinova/Money-Manager/repository"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestApp returns an app with the demo data of data.go in memory.
+// Hrisi (love) has 40, Peter (1234) has 90, George (1234) has 20 and Lily (1234) has 40.
+// Lily owes Hrisi 30 and Peter owes George 30.
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+
+	keys, err := NewKeySet(KeyConfig{Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{Keys: keys, Templates: "../templates/*"}
+	a.InitMemory()
+	return a
+}
+
+func (a *App) serve(req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+// call sends a JSON API request with the access token and decodes the response into out, if any
+func (a *App) call(t *testing.T, method, path, token string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, apiV1+path, &payload)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := a.serve(req)
+	if out != nil && rr.Code < 300 {
+		if err := json.Unmarshal(rr.Body.Bytes(), out); err != nil {
+			t.Fatalf("invalid response %q: %v", rr.Body.String(), err)
+		}
+	}
+	return rr.Code
+}
+
+func (a *App) apiToken(t *testing.T, username, password string) string {
+	t.Helper()
+
+	tokens := &model.Tokens{}
+	code := a.call(t, http.MethodPost, "/"+login, "", model.UserLogin{Username: username, Password: password}, tokens)
+	if code != http.StatusOK {
+		t.Fatalf("login of %v failed with %d", username, code)
+	}
+	return tokens.Token
+}
+
+func (a *App) balanceOf(t *testing.T, token string) model.Amount {
+	t.Helper()
+
+	b := model.Balance{}
+	if code := a.call(t, http.MethodGet, "/"+balance, token, nil, &b); code != http.StatusOK {
+		t.Fatalf("balance failed with %d", code)
+	}
+	return b.Total.Amount
+}
+
+// acceptLoans accepts the loans and splits proposed to the user of the token
+func (a *App) acceptLoans(t *testing.T, token string) {
+	t.Helper()
+
+	d := &model.DebtsTemplate{}
+	if code := a.call(t, http.MethodGet, "/"+debts, token, nil, d); code != http.StatusOK {
+		t.Fatalf("debts failed with %d", code)
+	}
+	for _, p := range d.Proposed {
+		path := "/" + debts + "/" + strconv.Itoa(p.StatusID) + "/" + accept
+		if code := a.call(t, http.MethodPost, path, token, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("accepting %d failed with %d", p.StatusID, code)
+		}
+	}
+}
+
+// browserLogin logs the user in with the login form and returns the auth cookies
+// and the CSRF token of the session, which the forms of the index page carry
+func (a *App) browserLogin(t *testing.T, username, password string) ([]*http.Cookie, string) {
+	t.Helper()
+
+	form := url.Values{"username": {username}, "password": {password}}
+	req := httptest.NewRequest(http.MethodPost, "/"+login, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := a.serve(req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("login of %v failed with %d", username, rr.Code)
+	}
+	cookies := rr.Result().Cookies()
+
+	req = httptest.NewRequest(http.MethodGet, "/"+index, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	match := csrfInput.FindStringSubmatch(a.serve(req).Body.String())
+	if match == nil {
+		t.Fatal("the index page has no CSRF token")
+	}
+	return cookies, match[1]
+}
+
+var csrfInput = regexp.MustCompile(`<input name="` + csrfParam + `" type="hidden" value="([^"]+)"/>`)
+
+func TestAPI_Login(t *testing.T) {
+	a := newTestApp(t)
+
+	t.Run("wrong password", func(t *testing.T) {
+		code := a.call(t, http.MethodPost, "/"+login, "", model.UserLogin{Username: "Hrisi", Password: "hate"}, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+	t.Run("missing token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, a.call(t, http.MethodGet, "/"+balance, "", nil, nil))
+	})
+	t.Run("logout revokes the token", func(t *testing.T) {
+		token := a.apiToken(t, "Hrisi", "love")
+		assert.Equal(t, 40*model.Unit, a.balanceOf(t, token))
+
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+logout, token, nil, nil))
+		assert.Equal(t, http.StatusUnauthorized, a.call(t, http.MethodGet, "/"+balance, token, nil, nil))
+	})
+}
+
+func TestAPI_PayAndEarn(t *testing.T) {
+	a := newTestApp(t)
+	token := a.apiToken(t, "Hrisi", "love")
+
+	code := a.call(t, http.MethodPost, "/"+pay, token, model.Pay{Amount: 15 * model.Unit, CategoryName: "food"}, nil)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, 25*model.Unit, a.balanceOf(t, token))
+
+	t.Run("not enough money", func(t *testing.T) {
+		code := a.call(t, http.MethodPost, "/"+pay, token, model.Pay{Amount: 26 * model.Unit, CategoryName: "food"}, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, 25*model.Unit, a.balanceOf(t, token))
+	})
+	t.Run("loan categories are reserved", func(t *testing.T) {
+		code := a.call(t, http.MethodPost, "/"+pay, token, model.Pay{Amount: model.Unit, CategoryName: model.LoanCategory}, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+	t.Run("amounts in minor units", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, apiV1+"/"+pay, strings.NewReader(`{"amount": 1249, "categoryName": "food"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		assert.Equal(t, http.StatusCreated, a.serve(req).Code)
+		assert.Equal(t, model.Amount(1251), a.balanceOf(t, token))
+
+		code := a.call(t, http.MethodPost, "/"+earn, token, map[string]interface{}{"amount": 12.49, "categoryName": "salary"}, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code = a.call(t, http.MethodPost, "/"+earn, token, model.Pay{Amount: 1249, CategoryName: "salary"}, nil)
+		assert.Equal(t, http.StatusCreated, code)
+	})
+	t.Run("earn", func(t *testing.T) {
+		code := a.call(t, http.MethodPost, "/"+earn, token, model.Pay{Amount: 100 * model.Unit, CategoryName: "salary"}, nil)
+		assert.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, 125*model.Unit, a.balanceOf(t, token))
+	})
+}
+
+func TestAPI_Repay(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+
+	d := &model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+	assert.Len(t, d.Active, 1)
+	debtID := d.Active[0].StatusID
+
+	peter := a.apiToken(t, "Peter", "1234")
+	repayPath := "/" + debts + "/" + strconv.Itoa(debtID) + "/" + repay
+	acceptPath := "/" + loans + "/" + strconv.Itoa(debtID) + "/" + accept
+	declinePath := "/" + loans + "/" + strconv.Itoa(debtID) + "/" + decline
+
+	t.Run("only the debtor repays", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, repayPath, peter, model.RepayRequest{Amount: 10 * model.Unit}, nil))
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, repayPath, hrisi, model.RepayRequest{Amount: 10 * model.Unit}, nil))
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, acceptPath, hrisi, nil, nil), "no repayment is pending")
+	})
+
+	code := a.call(t, http.MethodPost, repayPath, lily, model.RepayRequest{Amount: 10 * model.Unit}, nil)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	t.Run("only the creditor accepts or declines", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, acceptPath, lily, nil, nil))
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, acceptPath, peter, nil, nil))
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, declinePath, peter, nil, nil))
+		assert.Equal(t, 40*model.Unit, a.balanceOf(t, lily))
+	})
+
+	l := &model.LoansTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+loans, hrisi, nil, l))
+	assert.Len(t, l.Pending, 1)
+
+	code = a.call(t, http.MethodPost, acceptPath, hrisi, nil, nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, 50*model.Unit, a.balanceOf(t, hrisi))
+	assert.Equal(t, 30*model.Unit, a.balanceOf(t, lily))
+
+	t.Run("unknown debt", func(t *testing.T) {
+		code := a.call(t, http.MethodPost, "/"+debts+"/999/"+repay, lily, model.RepayRequest{Amount: 10 * model.Unit}, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, "/"+loans+"/999/"+accept, hrisi, nil, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, "/"+loans+"/999/"+decline, hrisi, nil, nil))
+	})
+	t.Run("browser", func(t *testing.T) {
+		cookies, csrf := a.browserLogin(t, "Peter", "1234")
+
+		for path, status := range map[string]int{
+			"/" + index + "/" + loans + "/" + accept + "/999":                    http.StatusNotFound,
+			"/" + index + "/" + debts + "/" + repay + "/" + strconv.Itoa(debtID): http.StatusForbidden,
+		} {
+			form := url.Values{"amount": {"1"}, csrfParam: {csrf}}
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			assert.Equal(t, status, a.serve(req).Code, path)
+		}
+	})
+}
+
+func TestAPI_LoanTerms(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+
+	loan := model.LoanRequest{Friend: "Lily", Amount: 10 * model.Unit, Date: time.Now().Add(-100 * 24 * time.Hour),
+		Terms: model.Terms{DueDate: time.Now().AddDate(0, 0, -1), InterestRate: 12}}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, hrisi, loan, nil))
+	loan.InterestRate = 150
+	assert.Equal(t, http.StatusUnprocessableEntity, a.call(t, http.MethodPost, "/"+loans, hrisi, loan, nil))
+	a.acceptLoans(t, lily)
+
+	// The overdue loan comes before the debt without a due date
+	d := &model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+	assert.Len(t, d.Active, 2)
+	assert.Equal(t, model.Amount(0), d.Active[0].Interest, "the interest accrues from the acceptance")
+	assert.True(t, d.Active[0].Overdue)
+	assert.Equal(t, 12.0, d.Active[0].InterestRate)
+	assert.Nil(t, d.Active[1].DueDate)
+
+	t.Run("browser", func(t *testing.T) {
+		cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+		browse := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set(csrfHeader, csrf)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			return a.serve(req)
+		}
+
+		form := url.Values{"to": {"Lily"}, "amount": {"5"}, "dueDate": {"2021-01-31"}, "interestRate": {"abc"}}
+		assert.Equal(t, http.StatusBadRequest, browse(http.MethodPost, "/"+index+"/"+giveLoan, form).Code)
+		form.Set("interestRate", "")
+		assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+giveLoan, form).Code)
+		a.acceptLoans(t, lily)
+
+		rr := browse(http.MethodGet, "/"+index+"/"+loans, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "interest at 12% per year")
+		assert.Contains(t, rr.Body.String(), "due on 2021-01-31 <strong>(overdue)</strong>")
+	})
+}
+
+func TestAPI_Split(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+
+	// The odd stotinka is paid by Hrisi
+	l := model.LoanRequest{Friend: "Lily", Amount: 5, CategoryName: "food"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+split, hrisi, l, nil))
+	a.acceptLoans(t, lily)
+	assert.Equal(t, 40*model.Unit-5, a.balanceOf(t, hrisi))
+
+	d := &model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+	assert.Len(t, d.Active, 2)
+	assert.Equal(t, model.Amount(2), d.Active[1].Amount)
+}
+
+func TestAPI_Proposals(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+	peter := a.apiToken(t, "Peter", "1234")
+	path := func(list string, statusID int, action string) string {
+		return "/" + list + "/" + strconv.Itoa(statusID) + "/" + action
+	}
+
+	// No money moves before Lily accepts
+	l := model.LoanRequest{Friend: "Lily", Amount: 10 * model.Unit, Description: "Taxi"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, hrisi, l, nil))
+	assert.Equal(t, 40*model.Unit, a.balanceOf(t, hrisi))
+	assert.Equal(t, 40*model.Unit, a.balanceOf(t, lily))
+
+	loansOf := &model.LoansTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+loans, hrisi, nil, loansOf))
+	assert.Len(t, loansOf.Proposed, 1)
+	assert.Len(t, loansOf.Active, 1)
+	d := &model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+	assert.Equal(t, []model.DebtTemplate{{Creditor: "Hrisi", DLTemplate: model.DLTemplate{StatusID: loansOf.Proposed[0].StatusID,
+		Amount: 10 * model.Unit, Currency: "BGN", Description: "Taxi"}}}, d.Proposed)
+	statusID := d.Proposed[0].StatusID
+
+	t.Run("only the debtor accepts", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, path(debts, statusID, accept), hrisi, nil, nil))
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, path(debts, statusID, accept), peter, nil, nil))
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, path(loans, statusID, withdraw), peter, nil, nil))
+		code := a.call(t, http.MethodPost, path(debts, statusID, repay), lily, model.RepayRequest{Amount: 5 * model.Unit}, nil)
+		assert.Equal(t, http.StatusBadRequest, code, "the loan is not accepted yet")
+	})
+
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path(debts, statusID, accept), lily, nil, nil))
+	assert.Equal(t, 30*model.Unit, a.balanceOf(t, hrisi))
+	assert.Equal(t, 50*model.Unit, a.balanceOf(t, lily))
+	assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, path(debts, statusID, accept), lily, nil, nil))
+
+	t.Run("decline and withdraw", func(t *testing.T) {
+		l := model.LoanRequest{Friend: "Lily", Amount: 20 * model.Unit, CategoryName: "food"}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+split, hrisi, l, nil))
+		d := &model.DebtsTemplate{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		assert.Equal(t, 10*model.Unit, d.Proposed[0].Total)
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path(debts, d.Proposed[0].StatusID, decline), lily, nil, nil))
+		assert.Equal(t, 20*model.Unit, a.balanceOf(t, hrisi), "Hrisi has paid her own share")
+
+		l = model.LoanRequest{Friend: "Lily", Amount: 5 * model.Unit}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, hrisi, l, nil))
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		statusID := d.Proposed[0].StatusID
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path(loans, statusID, withdraw), hrisi, nil, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, path(debts, statusID, decline), lily, nil, nil))
+
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		assert.Empty(t, d.Proposed)
+		assert.Equal(t, 20*model.Unit, a.balanceOf(t, hrisi))
+	})
+	t.Run("browser", func(t *testing.T) {
+		browser := func(username, password string) func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			cookies, csrf := a.browserLogin(t, username, password)
+			return func(method, path string, form url.Values) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set(csrfHeader, csrf)
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+				return a.serve(req)
+			}
+		}
+		asHrisi, asLily := browser("Hrisi", "love"), browser("Lily", "1234")
+
+		form := url.Values{"to": {"Lily"}, "amount": {"4"}, "category": {"food"}, "description": {"Pizza"}}
+		assert.Equal(t, http.StatusFound, asHrisi(http.MethodPost, "/"+index+"/"+split, form).Code)
+
+		rr := asHrisi(http.MethodGet, "/"+index+"/"+loans, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "their share of 2.00 BGN")
+		rr = asLily(http.MethodGet, "/"+index+"/"+debts, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "has paid your share of 2.00 BGN and asks you to owe it")
+
+		d := &model.DebtsTemplate{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		acceptPath := "/" + index + "/" + debts + "/" + accept + "/" + strconv.Itoa(d.Proposed[0].StatusID)
+		assert.Equal(t, http.StatusForbidden, asHrisi(http.MethodPost, acceptPath, nil).Code)
+		assert.Equal(t, http.StatusFound, asLily(http.MethodPost, acceptPath, nil).Code)
+		assert.Equal(t, 16*model.Unit, a.balanceOf(t, hrisi))
+	})
+}
+
+func TestAPI_Forgive(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+	peter := a.apiToken(t, "Peter", "1234")
+
+	d := &model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+	assert.Len(t, d.Active, 1)
+	debt := d.Active[0].Amount
+	forgivePath := "/" + loans + "/" + strconv.Itoa(d.Active[0].StatusID) + "/" + forgive
+
+	t.Run("only the creditor forgives", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, forgivePath, peter, model.ForgiveRequest{}, nil))
+		assert.Equal(t, http.StatusForbidden, a.call(t, http.MethodPost, forgivePath, lily, model.ForgiveRequest{}, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, "/"+loans+"/999/"+forgive, hrisi, model.ForgiveRequest{}, nil))
+	})
+
+	code := a.call(t, http.MethodPost, forgivePath, hrisi, model.ForgiveRequest{Amount: debt + 1}, nil)
+	assert.Equal(t, http.StatusBadRequest, code, "no more than the debt is forgiven")
+
+	// No money moves
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, forgivePath, hrisi, model.ForgiveRequest{Amount: model.Unit}, nil))
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+	assert.Equal(t, debt-model.Unit, d.Active[0].Amount)
+	assert.Equal(t, 40*model.Unit, a.balanceOf(t, hrisi))
+	assert.Equal(t, 40*model.Unit, a.balanceOf(t, lily))
+
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, forgivePath, hrisi, model.ForgiveRequest{}, nil))
+	assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, forgivePath, hrisi, model.ForgiveRequest{}, nil))
+	d = &model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+	assert.Empty(t, d.Active)
+	assert.Len(t, d.Forgiven, 2)
+	assert.Equal(t, "Hrisi", d.Forgiven[0].Creditor)
+	assert.Equal(t, model.Unit, d.Forgiven[0].Amount)
+	assert.Equal(t, debt-model.Unit, d.Forgiven[1].Amount)
+	assert.True(t, d.Forgiven[1].Closed)
+
+	h := &model.HistoryAndStatistics{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+history, lily, nil, h))
+	assert.Equal(t, model.ForgivenCategory, h.HistoryShowAll.HistoryShowAll[0].CategoryName)
+	assert.False(t, h.HistoryShowAll.HistoryShowAll[0].Editable)
+
+	t.Run("only the debtor dismisses", func(t *testing.T) {
+		dismissPath := "/" + debts + "/" + forgiven + "/" + strconv.Itoa(d.Forgiven[0].ID)
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodDelete, dismissPath, hrisi, nil, nil))
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodDelete, dismissPath, lily, nil, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodDelete, dismissPath, lily, nil, nil))
+	})
+	t.Run("browser", func(t *testing.T) {
+		browser := func(username, password string) func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			cookies, csrf := a.browserLogin(t, username, password)
+			return func(method, path string, form url.Values) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set(csrfHeader, csrf)
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+				return a.serve(req)
+			}
+		}
+		asHrisi, asLily := browser("Hrisi", "love"), browser("Lily", "1234")
+
+		l := model.LoanRequest{Friend: "Lily", Amount: 5 * model.Unit, Description: "Taxi"}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, hrisi, l, nil))
+		a.acceptLoans(t, lily)
+		d := &model.DebtsTemplate{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		path := "/" + index + "/" + loans + "/" + forgive + "/" + strconv.Itoa(d.Active[0].StatusID)
+
+		rr := asHrisi(http.MethodGet, "/"+index+"/"+loans, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `action="`+path+`"`)
+		assert.Equal(t, http.StatusBadRequest, asHrisi(http.MethodPost, path, url.Values{"amount": {"abc"}}).Code)
+		assert.Equal(t, http.StatusFound, asHrisi(http.MethodPost, path, url.Values{"amount": {""}}).Code)
+
+		rr = asLily(http.MethodGet, "/"+index+"/"+debts, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "your debt of 5.00 BGN")
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		dismissPath := "/" + index + "/" + debts + "/" + dismiss + "/" + strconv.Itoa(d.Forgiven[len(d.Forgiven)-1].ID)
+		assert.Equal(t, http.StatusFound, asLily(http.MethodPost, dismissPath, nil).Code)
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		assert.Len(t, d.Forgiven, 1)
+	})
+}
+
+func TestAPI_History(t *testing.T) {
+	a := newTestApp(t)
+	token := a.apiToken(t, "Peter", "1234")
+
+	h := &model.HistoryAndStatistics{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+history, token, nil, h))
+	assert.Len(t, h.HistoryShowAll.HistoryShowAll, 2)
+
+	// Peter paid 10 for home
+	var entryID int
+	for _, e := range h.HistoryShowAll.HistoryShowAll {
+		if e.CategoryName == "home" {
+			entryID = e.ID
+		}
+	}
+	assert.NotZero(t, entryID)
+
+	code := a.call(t, http.MethodPut, "/"+history+"/"+strconv.Itoa(entryID), token, model.History{Amount: 4 * model.Unit}, nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, 96*model.Unit, a.balanceOf(t, token))
+
+	code = a.call(t, http.MethodDelete, "/"+history+"/"+strconv.Itoa(entryID), token, nil, nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, 100*model.Unit, a.balanceOf(t, token))
+
+	t.Run("entries of other users", func(t *testing.T) {
+		other := a.apiToken(t, "George", "1234")
+		code := a.call(t, http.MethodDelete, "/"+history+"/1", other, nil, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestBrowser_LoginAndHistory(t *testing.T) {
+	a := newTestApp(t)
+
+	form := url.Values{"username": {"Hrisi"}, "password": {"love"}}
+	req := httptest.NewRequest(http.MethodPost, "/"+login, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := a.serve(req)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+index+"/"+history, nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rr = a.serve(req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Bread")
+
+	exportReq := httptest.NewRequest(http.MethodGet, "/"+index+"/"+export+"/"+history, nil)
+	for _, c := range req.Cookies() {
+		exportReq.AddCookie(c)
+	}
+	rr = a.serve(exportReq)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `attachment; filename="history.csv"`, rr.Header().Get("Content-Disposition"))
+	assert.Contains(t, rr.Body.String(), "Bread")
+
+	t.Run("without cookies", func(t *testing.T) {
+		rr := a.serve(httptest.NewRequest(http.MethodGet, "/"+index+"/"+history, nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestBrowser_CSRF(t *testing.T) {
+	a := newTestApp(t)
+	token := a.apiToken(t, "Hrisi", "love")
+	cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+	for _, c := range cookies {
+		assert.True(t, c.Secure, c.Name)
+		assert.True(t, c.HttpOnly, c.Name)
+		assert.Equal(t, http.SameSiteLaxMode, c.SameSite, c.Name)
+	}
+
+	payment := func(form url.Values, header string) int {
+		req := httptest.NewRequest(http.MethodPost, "/"+index+"/"+pay, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			req.Header.Set(csrfHeader, header)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return a.serve(req).Code
+	}
+
+	form := url.Values{"amount": {"1"}, "category": {"food"}}
+	assert.Equal(t, http.StatusForbidden, payment(form, ""), "without a token")
+	assert.Equal(t, http.StatusForbidden, payment(form, "forged"))
+	_, other := a.browserLogin(t, "Peter", "1234")
+	assert.Equal(t, http.StatusForbidden, payment(form, other), "the token of another session")
+	assert.Equal(t, 40*model.Unit, a.balanceOf(t, token))
+
+	assert.Equal(t, http.StatusFound, payment(form, csrf))
+	form.Set(csrfParam, csrf)
+	assert.Equal(t, http.StatusFound, payment(form, ""))
+	assert.Equal(t, 38*model.Unit, a.balanceOf(t, token))
+
+	t.Run("bearer token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/"+index+"/"+pay, strings.NewReader("amount=1&category=food"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		assert.Equal(t, http.StatusFound, a.serve(req).Code)
+	})
+	t.Run("the API takes no cookies", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, apiV1+"/"+pay, strings.NewReader(`{"amount": 1, "categoryName": "food"}`))
+		req.Header.Set("Content-Type", "text/plain")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		assert.Equal(t, http.StatusUnauthorized, a.serve(req).Code)
+
+		req = httptest.NewRequest(http.MethodPost, apiV1+"/"+pay, strings.NewReader(`{"amount": 1, "categoryName": "food"}`))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("Authorization", "Bearer "+token)
+		assert.Equal(t, http.StatusUnsupportedMediaType, a.serve(req).Code)
+		assert.Equal(t, 37*model.Unit, a.balanceOf(t, token))
+	})
+	t.Run("cookie config", func(t *testing.T) {
+		c, err := NewCookieConfig("false", "Strict")
+		assert.NoError(t, err)
+		assert.Equal(t, CookieConfig{Insecure: true, SameSite: http.SameSiteStrictMode}, c)
+		_, err = NewCookieConfig("", "sometimes")
+		assert.Error(t, err)
+
+		a.Cookies = c
+		cookies, _ := a.browserLogin(t, "Hrisi", "love")
+		assert.False(t, cookies[0].Secure)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+	})
+}
+
+func TestAPI_Export(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+	download := func(path, token string) (int, [][]string) {
+		req := httptest.NewRequest(http.MethodGet, apiV1+"/"+export+"/"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := a.serve(req)
+		if rr.Code != http.StatusOK {
+			return rr.Code, nil
+		}
+		assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		assert.NoError(t, err)
+		return rr.Code, records
+	}
+
+	h := &model.HistoryAndStatistics{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+history, hrisi, nil, h))
+	code, records := download(history, hrisi)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"id", "date", "type", "category", "amount", "currency", "account", "description"}, records[0])
+	assert.Len(t, records, len(h.HistoryShowAll.HistoryShowAll)+1)
+	for _, e := range h.HistoryShowAll.HistoryShowAll {
+		if e.Description == "Bread" {
+			assert.Contains(t, records, []string{strconv.Itoa(e.ID), e.Date.UTC().Format(time.RFC3339),
+				model.ExpenseType, "food", "5.00", e.Currency, e.Account, "Bread"})
+		}
+	}
+
+	code, records = download(history+"?from=2020-01-01&to=2020-12-31", hrisi)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, records, 1, "only the header")
+	code, _ = download(history+"?from=2021-02-01&to=2021-01-01", hrisi)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Lily owes Hrisi 30 for the bills
+	code, records = download(debts, lily)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, [][]string{{"status", "creditor", "amount", "currency", "description"}, {"active", "Hrisi", "30.00", "BGN", "Bills"}}, records)
+	code, records = download(loans, hrisi)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"active", "Lily", "30.00", "BGN", "Bills"}, records[1])
+
+	t.Run("formulas", func(t *testing.T) {
+		e := model.Pay{Amount: model.Unit, CategoryName: "food", Description: "=HYPERLINK(\"http://example.com\")"}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+pay, hrisi, e, nil))
+		_, records := download(history, hrisi)
+		descriptions := []string{}
+		for _, r := range records {
+			descriptions = append(descriptions, r[7])
+		}
+		assert.Contains(t, descriptions, "'=HYPERLINK(\"http://example.com\")")
+	})
+
+	t.Run("without a token", func(t *testing.T) {
+		rr := a.serve(httptest.NewRequest(http.MethodGet, apiV1+"/"+export+"/"+history, nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestCSVText(t *testing.T) {
+	for _, s := range []string{"=1+2", "+1", "-1", "@SUM(A1)", "\t=1", "\r=1"} {
+		assert.Equal(t, "'"+s, csvText(s))
+	}
+	for _, s := range []string{"", "Bread", "1+2", "a=b", "'quoted"} {
+		assert.Equal(t, s, csvText(s))
+	}
+}
+
+func TestRespondWithRepoError(t *testing.T) {
+	for err, code := range map[error]int{
+		sql.ErrNoRows:                           http.StatusNotFound,
+		fmt.Errorf("debt 1: %w", sql.ErrNoRows): http.StatusNotFound,
+		repository.ErrNotParty:                  http.StatusForbidden,
+		&repository.BadRequestError{Message: "the debt is not accepted yet"}: http.StatusBadRequest,
+		fmt.Errorf("row 1: %w", &repository.BadRequestError{Message: "no"}):  http.StatusBadRequest,
+		errors.New("Bad Request: not from the repository"):                   http.StatusInternalServerError,
+	} {
+		rr := httptest.NewRecorder()
+		respondWithRepoError(rr, err)
+		assert.Equal(t, code, rr.Code, err.Error())
+	}
+
+	rr := httptest.NewRecorder()
+	respondWithRepoError(rr, &repository.BadRequestError{Message: "the debt is not accepted yet"})
+	assert.JSONEq(t, `{"error": "the debt is not accepted yet"}`, rr.Body.String())
+}
+
+func TestAPI_Currencies(t *testing.T) {
+	a := newTestApp(t)
+	a.Admins = []string{"Hrisi"}
+	token := a.apiToken(t, "Hrisi", "love")
+
+	t.Run("unknown currency", func(t *testing.T) {
+		e := model.Pay{Amount: 10 * model.Unit, Currency: "USD", CategoryName: "salary"}
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+earn, token, e, nil))
+	})
+
+	rate := model.Rate{Rate: 2}
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPut, "/"+rates+"/USD", token, rate, nil))
+	rs := []model.Rate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+rates, token, nil, &rs))
+	assert.Contains(t, rs, model.Rate{Currency: "USD", Rate: 2})
+
+	// A wallet in dollars is opened
+	e := model.Pay{Amount: 10 * model.Unit, Currency: "USD", CategoryName: "salary"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+earn, token, e, nil))
+	assert.Equal(t, 60*model.Unit, a.balanceOf(t, token))
+
+	body := map[string]string{"currency": "USD"}
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPut, "/"+currency, token, body, nil))
+	b := model.Balance{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+balance, token, nil, &b))
+	assert.Len(t, b.Wallets, 2)
+	assert.Equal(t, model.Money{Amount: 30 * model.Unit, Currency: "USD"}, b.Total)
+
+	t.Run("the rate of the default currency", func(t *testing.T) {
+		code := a.call(t, http.MethodPut, "/"+rates+"/BGN", token, model.Rate{Rate: 2}, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		peter := a.apiToken(t, "Peter", "1234")
+		code := a.call(t, http.MethodPut, "/"+rates+"/USD", peter, model.Rate{Rate: 3}, nil)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+rates, peter, nil, &rs))
+		assert.Contains(t, rs, model.Rate{Currency: "USD", Rate: 2})
+	})
+
+	t.Run("the digits of the currency", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPut, "/"+rates+"/JPY", token, model.Rate{Rate: 0.01}, nil))
+		cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+		post := func(amount string) int {
+			form := url.Values{"amount": {amount}, "currency": {"JPY"}, "category": {"salary"}}
+			req := httptest.NewRequest(http.MethodPost, "/"+index+"/"+earn, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set(csrfHeader, csrf)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			return a.serve(req).Code
+		}
+		assert.Equal(t, http.StatusBadRequest, post("12.5"))
+		assert.Equal(t, http.StatusFound, post("500"))
+
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+balance, token, nil, &b))
+		assert.Contains(t, b.Wallets, model.Money{Amount: 500, Currency: "JPY"})
+	})
+}
+
+func TestAPI_Accounts(t *testing.T) {
+	a := newTestApp(t)
+	token := a.apiToken(t, "Hrisi", "love")
+
+	code := a.call(t, http.MethodPost, "/"+accounts, token, model.NewAccount{Name: "bank"}, nil)
+	assert.Equal(t, http.StatusCreated, code)
+	code = a.call(t, http.MethodPost, "/"+accounts, token, model.NewAccount{Name: "bank"}, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	tr := model.AccountTransfer{From: "cash", To: "bank", Amount: 25 * model.Unit}
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+accounts+"/"+transfer, token, tr, nil))
+	p := model.Pay{Amount: 5 * model.Unit, Account: "bank", CategoryName: "food"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+pay, token, p, nil))
+
+	b := model.Balance{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+balance, token, nil, &b))
+	assert.Equal(t, []model.Account{
+		{Name: "bank", Wallets: []model.Money{{Amount: 20 * model.Unit, Currency: "BGN"}},
+			Total: model.Money{Amount: 20 * model.Unit, Currency: "BGN"}},
+		{Name: "cash", Wallets: []model.Money{{Amount: 15 * model.Unit, Currency: "BGN"}},
+			Total: model.Money{Amount: 15 * model.Unit, Currency: "BGN"}},
+	}, b.Accounts)
+	assert.Equal(t, 35*model.Unit, b.Total.Amount)
+
+	t.Run("invalid transfers", func(t *testing.T) {
+		tr := model.AccountTransfer{From: "cash", To: "cash", Amount: 5 * model.Unit}
+		assert.Equal(t, http.StatusUnprocessableEntity, a.call(t, http.MethodPost, "/"+accounts+"/"+transfer, token, tr, nil))
+		tr = model.AccountTransfer{From: "cash", To: "card", Amount: 5 * model.Unit}
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+accounts+"/"+transfer, token, tr, nil))
+		tr = model.AccountTransfer{From: "cash", To: "bank", Amount: 100 * model.Unit}
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+accounts+"/"+transfer, token, tr, nil))
+	})
+	t.Run("loans and repayments", func(t *testing.T) {
+		lily := a.apiToken(t, "Lily", "1234")
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+accounts, lily, model.NewAccount{Name: "card"}, nil))
+
+		l := model.LoanRequest{Friend: "Lily", Amount: 10 * model.Unit, Account: "bank"}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, token, l, nil))
+		d := &model.DebtsTemplate{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		id := "/" + strconv.Itoa(d.Proposed[0].StatusID) + "/"
+		card := model.AcceptRequest{Account: "card"}
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+debts+id+accept, lily, card, nil))
+
+		rr := model.RepayRequest{Amount: 4 * model.Unit, Account: "card"}
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+debts+id+repay, lily, rr, nil))
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+loans+id+accept, token, nil, nil))
+
+		b := model.Balance{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+balance, lily, nil, &b))
+		assert.Equal(t, "card", b.Accounts[0].Name)
+		assert.Equal(t, 6*model.Unit, b.Accounts[0].Total.Amount, "Lily received the loan and repaid a part on the card")
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+balance, token, nil, &b))
+		assert.Equal(t, 10*model.Unit, b.Accounts[0].Total.Amount, "the loan is paid from the bank")
+		assert.Equal(t, 19*model.Unit, b.Accounts[1].Total.Amount, "the repayment is received in cash")
+	})
+}
+
+func TestAPI_Groups(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+	before := a.balanceOf(t, hrisi)
+
+	cg := model.CreateGroup{Name: "Trip", Participants: []string{"George"}}
+	assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+groups, hrisi, cg, nil), "George is not a friend")
+
+	group := model.Group{}
+	cg = model.CreateGroup{Name: "Trip", Participants: []string{"Lily"}}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+groups, hrisi, cg, &group))
+	path := "/" + groups + "/" + strconv.Itoa(group.ID)
+
+	g := model.GroupsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+groups, lily, nil, &g))
+	assert.Equal(t, []model.Group{{ID: group.ID, Name: "Trip"}}, g.Invites)
+	assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodGet, path, lily, nil, nil), "Lily has not joined yet")
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path+"/"+accept, lily, nil, nil))
+
+	e := model.SplitRequest{Amount: 20 * model.Unit, CategoryName: "food", Description: "Pizza"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, path+"/"+expenses, hrisi, e, nil))
+	assert.Equal(t, before-10*model.Unit, a.balanceOf(t, hrisi), "Lily has not accepted her share yet")
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, path, lily, nil, &group))
+	assert.Empty(t, group.Members[1].Balance)
+
+	a.acceptLoans(t, lily)
+	assert.Equal(t, before-20*model.Unit, a.balanceOf(t, hrisi))
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, path, lily, nil, &group))
+	assert.Equal(t, "Lily", group.Members[1].Username)
+	assert.Equal(t, []model.Money{{Amount: -10 * model.Unit, Currency: "BGN"}}, group.Members[1].Balance)
+	assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, path+"/"+leave, lily, nil, nil), "Lily owes Hrisi")
+
+	t.Run("outsiders", func(t *testing.T) {
+		peter := a.apiToken(t, "Peter", "1234")
+		rename := model.Group{Name: "Mine"}
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodGet, path, peter, nil, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPut, path, peter, rename, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, path+"/"+expenses, peter, e, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, path+"/"+accept, peter, nil, nil))
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, path+"/"+invite, hrisi,
+			model.GroupInvite{Username: "Peter"}, nil), "Peter is not a friend")
+	})
+	t.Run("rename", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPut, path, lily, model.Group{Name: "Summer"}, nil))
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, path, hrisi, nil, &group))
+		assert.Equal(t, "Summer", group.Name)
+	})
+}
+
+func TestBrowser_Groups(t *testing.T) {
+	a := newTestApp(t)
+
+	cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+	browse := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrf)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return a.serve(req)
+	}
+
+	rr := browse(http.MethodPost, "/"+index+"/"+groups, url.Values{"name": {"Trip"}, "participants": {"Lily"}})
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location := rr.Header().Get("Location")
+
+	rr = browse(http.MethodGet, location, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Lily (invited)")
+
+	rr = browse(http.MethodGet, "/"+index+"/"+groups, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Trip")
+
+	t.Run("split between friends", func(t *testing.T) {
+		rr := browse(http.MethodGet, "/"+index+"/"+pay, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "part_Lily")
+
+		form := url.Values{"amount": {"12"}, "category": {"food"}, "method": {"percent"},
+			"participant": {"Hrisi", "Lily"}, "part_Hrisi": {"25"}, "part_Lily": {"75"}}
+		assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+expenses, form).Code)
+		form.Set("part_Lily", "70")
+		assert.Equal(t, http.StatusBadRequest, browse(http.MethodPost, "/"+index+"/"+expenses, form).Code)
+	})
+	t.Run("settlement", func(t *testing.T) {
+		rr := browse(http.MethodGet, "/"+index+"/"+settle, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Lily pays Hrisi")
+
+		assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+settle, nil).Code)
+		rr = browse(http.MethodGet, location+"/"+settle, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "There are no debts to settle")
+	})
+}
+
+func TestAPI_SplitExpense(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+
+	e := model.SplitRequest{Amount: 30 * model.Unit, CategoryName: "food", Description: "Dinner", Method: model.ExactSplit,
+		Participants: []model.SplitParticipant{{Username: "Lily", Amount: 20 * model.Unit}, {Username: "Hrisi", Amount: 10 * model.Unit}}}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+expenses, hrisi, e, nil))
+	assert.Equal(t, 30*model.Unit, a.balanceOf(t, hrisi), "Hrisi pays her own share at once")
+
+	// Hrisi pays for Lily only
+	e = model.SplitRequest{Amount: 10 * model.Unit, CategoryName: "food", Description: "Cake", Method: model.SharesSplit,
+		Participants: []model.SplitParticipant{{Username: "Lily", Shares: 1}}}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+expenses, hrisi, e, nil))
+	assert.Equal(t, 30*model.Unit, a.balanceOf(t, hrisi))
+
+	// Lily owes nothing before she accepts her shares
+	d := model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, &d))
+	assert.Len(t, d.Active, 1)
+	assert.Len(t, d.Proposed, 2)
+	assert.Equal(t, model.DebtTemplate{Creditor: "Hrisi", DLTemplate: model.DLTemplate{StatusID: d.Proposed[0].StatusID,
+		Amount: 20 * model.Unit, Total: 20 * model.Unit, Currency: "BGN", Description: "Dinner"}}, d.Proposed[0])
+	dinner, cake := d.Proposed[0].StatusID, d.Proposed[1].StatusID
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+debts+"/"+strconv.Itoa(cake)+"/"+decline, lily, nil, nil))
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+debts+"/"+strconv.Itoa(dinner)+"/"+accept, lily, nil, nil))
+	assert.Equal(t, 10*model.Unit, a.balanceOf(t, hrisi))
+
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, &d))
+	assert.Len(t, d.Active, 2)
+	assert.Empty(t, d.Proposed)
+	assert.Equal(t, model.DebtTemplate{Creditor: "Hrisi", DLTemplate: model.DLTemplate{StatusID: dinner,
+		Amount: 20 * model.Unit, Currency: "BGN", Description: "Dinner"}}, d.Active[1])
+
+	t.Run("invalid splits", func(t *testing.T) {
+		peter := a.apiToken(t, "Peter", "1234")
+		e := model.SplitRequest{Amount: 10 * model.Unit, CategoryName: "food", Method: model.PercentSplit,
+			Participants: []model.SplitParticipant{{Username: "Peter", Percent: 50}, {Username: "George", Percent: 40}}}
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+expenses, peter, e, nil), "not 100 percent")
+		e.Participants[1].Percent = 50
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+expenses, peter, e, nil))
+
+		e.Participants[1].Username = "Hrisi"
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+expenses, peter, e, nil), "not a friend")
+		e.Participants = []model.SplitParticipant{{Username: "George"}, {Username: "George"}}
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+expenses, peter, e, nil), "twice")
+		e.Method = "half"
+		assert.Equal(t, http.StatusUnprocessableEntity, a.call(t, http.MethodPost, "/"+expenses, peter, e, nil))
+	})
+}
+
+func TestAPI_Settlement(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+
+	// Lily owes Hrisi 30 and lends Hrisi 10
+	l := model.LoanRequest{Friend: "Hrisi", Amount: 10 * model.Unit}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, lily, l, nil))
+	a.acceptLoans(t, hrisi)
+
+	// Peter, another friend of Hrisi, lends Lily 5. The debt is theirs, and Hrisi does not settle it.
+	peter := a.apiToken(t, "Peter", "1234")
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+friends+"/Peter/"+accept, hrisi, nil, nil))
+	l = model.LoanRequest{Friend: "Lily", Amount: 5 * model.Unit, Description: "Cinema"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, peter, l, nil))
+	a.acceptLoans(t, lily)
+
+	plan := model.SettlementPlan{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+settle, hrisi, nil, &plan))
+	assert.Equal(t, model.SettlementPlan{Name: "Hrisi", Debts: 2, Settlements: []model.Settlement{
+		{From: "Lily", To: "Hrisi", Amount: 20 * model.Unit, Currency: "BGN"}}}, plan)
+
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+settle, hrisi, nil, nil))
+	d := model.DebtsTemplate{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, hrisi, nil, &d))
+	assert.Empty(t, d.Active)
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, &d))
+	assert.Len(t, d.Active, 2)
+	assert.Equal(t, model.DLTemplate{StatusID: d.Active[0].StatusID, Amount: 5 * model.Unit, Currency: "BGN",
+		Description: "Cinema"}, d.Active[0].DLTemplate, "the debt to Peter is unchanged")
+	assert.Equal(t, "Hrisi", d.Active[1].Creditor)
+	assert.Equal(t, 20*model.Unit, d.Active[1].Amount)
+
+	t.Run("around the circle", func(t *testing.T) {
+		// Hrisi owes Peter 20 and Lily owes Hrisi 20, so Lily pays Peter instead
+		l := model.LoanRequest{Friend: "Hrisi", Amount: 20 * model.Unit}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+loans, peter, l, nil))
+		a.acceptLoans(t, hrisi)
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+settle, hrisi, nil, &plan))
+		assert.Equal(t, []model.Settlement{{From: "Lily", To: "Peter", Amount: 20 * model.Unit, Currency: "BGN"}}, plan.Settlements)
+
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, "/"+settle, hrisi, nil, nil))
+		d := model.DebtsTemplate{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, hrisi, nil, &d))
+		assert.Empty(t, d.Active)
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, &d))
+		assert.Len(t, d.Active, 2)
+		assert.Equal(t, "Cinema", d.Active[0].Description)
+		assert.Equal(t, "Peter", d.Active[1].Creditor)
+		assert.Equal(t, 20*model.Unit, d.Active[1].Amount)
+	})
+	t.Run("groups", func(t *testing.T) {
+		group := model.Group{}
+		cg := model.CreateGroup{Name: "Trip"}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+groups, hrisi, cg, &group))
+		path := "/" + groups + "/" + strconv.Itoa(group.ID) + "/" + settle
+
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, path, hrisi, nil, &plan))
+		assert.Empty(t, plan.Settlements, "the debts outside of the group are not settled in it")
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, path, hrisi, nil, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodGet, path, lily, nil, nil))
+	})
+}
+
+func TestAPI_Recurring(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+
+	// The occurrences which are already due are recorded when the rule is created
+	salary := model.RecurringRequest{Amount: 100 * model.Unit, CategoryName: "salary", Frequency: model.Monthly,
+		StartsAt: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), Count: 3}
+	rule := model.Recurring{}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+recurring, hrisi, salary, &rule))
+	assert.Equal(t, 3, rule.Done)
+	assert.Nil(t, rule.Next, "the rule has ended")
+	assert.Equal(t, 340*model.Unit, a.balanceOf(t, hrisi))
+
+	t.Run("no duplicates", func(t *testing.T) {
+		a.recordDue(time.Now().AddDate(1, 0, 0))
+		// A run which has not seen the advanced counter, such as one before a restart
+		stale := rule
+		stale.UserID, stale.CategoryID, stale.CategoryType, stale.Done = 1, 8, model.IncomeType, 0
+		assert.NoError(t, a.recordRule(stale, time.Now()))
+		assert.Equal(t, 340*model.Unit, a.balanceOf(t, hrisi))
+
+		h := model.HistoryShowAll{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+history, hrisi, nil, &h))
+		recorded := 0
+		for _, entry := range h.HistoryShowAll {
+			if entry.Date.Year() == 2021 {
+				recorded++
+			}
+		}
+		assert.Equal(t, 3, recorded)
+	})
+	t.Run("pause and resume", func(t *testing.T) {
+		now := time.Now().UTC()
+		food := model.RecurringRequest{Amount: 5 * model.Unit, CategoryName: "food", Frequency: model.Weekly,
+			StartsAt: now.Add(time.Hour)}
+		rule := model.Recurring{}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+recurring, hrisi, food, &rule))
+		assert.Equal(t, 0, rule.Done)
+		if assert.NotNil(t, rule.Next) {
+			assert.True(t, rule.Next.After(now))
+		}
+
+		a.recordDue(now.AddDate(0, 0, 8))
+		assert.Equal(t, 330*model.Unit, a.balanceOf(t, hrisi))
+
+		path := "/" + recurring + "/" + strconv.Itoa(rule.ID)
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPost, path+"/"+pause, lily, nil, nil))
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path+"/"+pause, hrisi, nil, nil))
+		a.recordDue(now.AddDate(0, 0, 30))
+		assert.Equal(t, 330*model.Unit, a.balanceOf(t, hrisi), "a paused rule is not recorded")
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path+"/"+resume, hrisi, nil, nil))
+
+		rules := []model.Recurring{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+recurring, hrisi, nil, &rules))
+		if assert.Len(t, rules, 2) {
+			assert.Equal(t, 2, rules[1].Done)
+			assert.False(t, rules[1].Paused)
+		}
+
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodDelete, path, lily, nil, nil))
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodDelete, path, hrisi, nil, nil))
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+recurring, hrisi, nil, &rules))
+		assert.Len(t, rules, 1)
+	})
+	t.Run("invalid rules", func(t *testing.T) {
+		hourly := salary
+		hourly.Frequency = "hourly"
+		assert.Equal(t, http.StatusUnprocessableEntity, a.call(t, http.MethodPost, "/"+recurring, hrisi, hourly, nil))
+
+		loan := salary
+		loan.CategoryName = model.LoanCategory
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+recurring, hrisi, loan, nil))
+
+		backwards := salary
+		backwards.EndsAt = salary.StartsAt.AddDate(0, 0, -1)
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+recurring, hrisi, backwards, nil))
+	})
+}
+
+func TestBrowser_Recurring(t *testing.T) {
+	a := newTestApp(t)
+
+	cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+	browse := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrf)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return a.serve(req)
+	}
+
+	rule := url.Values{"amount": {"10"}, "category": {"home"}, "description": {"Rent"}, "frequency": {"monthly"},
+		"starts": {"2021-01-01"}, "ends": {"2021-02-15"}}
+	rr := browse(http.MethodPost, "/"+index+"/"+recurring, rule)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	rr = browse(http.MethodGet, "/"+index+"/"+recurring, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "monthly from 2021-01-01")
+	assert.Contains(t, rr.Body.String(), "recorded 2")
+	assert.Contains(t, rr.Body.String(), "Finished.")
+
+	rule.Set("ends", "")
+	rule.Set("starts", time.Now().AddDate(0, 0, 1).Format(dateLayout))
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+recurring, rule).Code)
+	rr = browse(http.MethodGet, "/"+index+"/"+recurring, nil)
+	assert.Contains(t, rr.Body.String(), "/index/recurring/2/pause")
+
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+recurring+"/2/"+pause, nil).Code)
+	rr = browse(http.MethodGet, "/"+index+"/"+recurring, nil)
+	assert.Contains(t, rr.Body.String(), "Paused.")
+
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+recurring+"/2/"+remove, nil).Code)
+	assert.Equal(t, http.StatusNotFound, browse(http.MethodPost, "/"+index+"/"+recurring+"/2/"+remove, nil).Code)
+}
+
+func TestAPI_Budgets(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+
+	// Hrisi has spent 20 for food
+	budget := model.BudgetRequest{Amount: 50 * model.Unit, Period: model.Monthly}
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPut, "/"+budgets+"/food", hrisi, budget, nil))
+
+	p := model.Pay{Amount: 20 * model.Unit, CategoryName: "food"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+pay, hrisi, p, nil))
+	p.Amount = 15 * model.Unit
+	warning := map[string]string{}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+pay, hrisi, p, &warning))
+	assert.Equal(t, "the payment exceeds the monthly budget of food by 5.00 BGN", warning["warning"])
+
+	found := []model.Budget{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+budgets, hrisi, nil, &found))
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, 55*model.Unit, found[0].Spent)
+		assert.True(t, found[0].Overspent())
+	}
+	h := model.HistoryAndStatistics{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+history, hrisi, nil, &h))
+	assert.Len(t, h.Budgets, 1)
+
+	t.Run("blocking budget", func(t *testing.T) {
+		budget.Block = true
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPut, "/"+budgets+"/food", hrisi, budget, nil))
+		p.Amount = 1 * model.Unit
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+pay, hrisi, p, nil))
+		assert.Equal(t, 5*model.Unit, a.balanceOf(t, hrisi))
+
+		p.CategoryName = "car"
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+pay, hrisi, p, nil), "other categories")
+	})
+	t.Run("invalid budgets", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPut, "/"+budgets+"/salary", hrisi, budget, nil))
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPut, "/"+budgets+"/"+model.LoanCategory, hrisi, budget, nil))
+		daily := budget
+		daily.Period = model.Daily
+		assert.Equal(t, http.StatusUnprocessableEntity, a.call(t, http.MethodPut, "/"+budgets+"/food", hrisi, daily, nil))
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodDelete, "/"+budgets+"/food", hrisi, nil, nil))
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodDelete, "/"+budgets+"/food", hrisi, nil, nil))
+	})
+}
+
+func TestBrowser_Budgets(t *testing.T) {
+	a := newTestApp(t)
+
+	cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+	browse := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrf)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return a.serve(req)
+	}
+
+	budget := url.Values{"category": {"food"}, "amount": {"30"}, "period": {"weekly"}}
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+budgets, budget).Code)
+	rr := browse(http.MethodGet, "/"+index, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "food: 20.00 of 30.00 BGN weekly (66%)")
+
+	rr = browse(http.MethodPost, "/"+index+"/"+pay, url.Values{"amount": {"12"}, "category": {"food"}})
+	assert.Equal(t, http.StatusFound, rr.Code)
+	rr = browse(http.MethodGet, rr.Header().Get("Location"), nil)
+	assert.Contains(t, rr.Body.String(), "Warning: the payment exceeds the weekly budget of food by 2.00 BGN")
+
+	// A failed payment is not redirected with the warning
+	rr = browse(http.MethodPost, "/"+index+"/"+pay, url.Values{"amount": {"1000"}, "category": {"food"}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+
+	rr = browse(http.MethodGet, "/"+index+"/"+history, nil)
+	assert.Contains(t, rr.Body.String(), "overspent by 2.00 BGN")
+
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+budgets+"/food/"+remove, nil).Code)
+	rr = browse(http.MethodGet, "/"+index, nil)
+	assert.NotContains(t, rr.Body.String(), "Budgets:")
+}
+
+func TestBrowser_UnknownNames(t *testing.T) {
+	a := newTestApp(t)
+
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	balance := a.balanceOf(t, hrisi)
+	cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrf)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return a.serve(req)
+	}
+
+	for path, form := range map[string]url.Values{
+		"/" + index + "/" + pay:      {"amount": {"1"}, "category": {"nothing"}},
+		"/" + index + "/" + earn:     {"amount": {"1"}, "category": {"food"}},
+		"/" + index + "/" + split:    {"amount": {"1"}, "category": {"salary"}, "to": {"Lily"}},
+		"/" + index + "/" + giveLoan: {"amount": {"1"}, "to": {"nobody"}},
+	} {
+		assert.Equal(t, http.StatusBadRequest, post(path, form).Code, path)
+	}
+
+	// A failed income is not redirected
+	rr := post("/"+index+"/"+earn, url.Values{"amount": {"1"}, "category": {"salary"}, "account": {"nothing"}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+	assert.Equal(t, balance, a.balanceOf(t, hrisi))
+}
+
+func TestAPI_Categories(t *testing.T) {
+	a := newTestApp(t)
+	hrisi := a.apiToken(t, "Hrisi", "love")
+	lily := a.apiToken(t, "Lily", "1234")
+
+	restaurants := model.Category{}
+	req := model.CategoryRequest{Name: "restaurants", CType: model.ExpenseType, Parent: "food"}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+categories, hrisi, req, &restaurants))
+	assert.Equal(t, 3, restaurants.ParentID)
+
+	tree := []model.Category{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+categories, hrisi, nil, &tree))
+	assert.Equal(t, "food", tree[2].Name)
+	assert.Equal(t, []model.Category{restaurants}, tree[2].Children)
+	lilys := []model.Category{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+categories, lily, nil, &lilys))
+	assert.Empty(t, lilys[2].Children, "the categories of other users are hidden")
+
+	t.Run("statistics count subcategories to their parent", func(t *testing.T) {
+		p := model.Pay{Amount: 10 * model.Unit, CategoryName: "restaurants"}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+pay, hrisi, p, nil))
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+pay, lily, p, nil))
+
+		h := model.HistoryAndStatistics{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+history, hrisi, nil, &h))
+		for _, r := range h.Expense.Ratios {
+			assert.NotEqual(t, "restaurants", r.CategoryName)
+		}
+	})
+	t.Run("friends repay a split in the shared parent", func(t *testing.T) {
+		l := model.LoanRequest{Friend: "Lily", Amount: 10 * model.Unit, CategoryName: "restaurants"}
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+split, hrisi, l, nil))
+		a.acceptLoans(t, lily)
+
+		d := &model.DebtsTemplate{}
+		assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+debts, lily, nil, d))
+		debtID := d.Active[len(d.Active)-1].StatusID
+		code := a.call(t, http.MethodPost, "/"+debts+"/"+strconv.Itoa(debtID)+"/"+repay, lily, model.RepayRequest{Amount: 5 * model.Unit}, nil)
+		assert.Equal(t, http.StatusNoContent, code)
+		code = a.call(t, http.MethodPost, "/"+loans+"/"+strconv.Itoa(debtID)+"/"+accept, hrisi, nil, nil)
+		assert.Equal(t, http.StatusNoContent, code)
+	})
+	t.Run("invalid categories", func(t *testing.T) {
+		for _, req := range []model.CategoryRequest{
+			{Name: "car", CType: model.ExpenseType},
+			{Name: "fees", CType: model.ExpenseType, Parent: model.LoanCategory},
+			{Name: "fees", CType: model.ExpenseType, Parent: "salary"},
+			{Name: "dinners", CType: model.ExpenseType, Parent: "restaurants"},
+		} {
+			assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+categories, hrisi, req, nil), req)
+		}
+		invalid := model.CategoryRequest{Name: "fees", CType: "loan"}
+		assert.Equal(t, http.StatusUnprocessableEntity, a.call(t, http.MethodPost, "/"+categories, hrisi, invalid, nil))
+	})
+	t.Run("rename and archive", func(t *testing.T) {
+		path := "/" + categories + "/" + strconv.Itoa(restaurants.ID)
+		name := map[string]string{"name": "dining"}
+		assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodPut, path, lily, name, nil))
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPut, "/"+categories+"/3", hrisi, name, nil), "a shared category")
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+categories+"/1/"+archive, hrisi, nil, nil), "a system category")
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPut, path, hrisi, name, nil))
+
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path+"/"+archive, hrisi, nil, nil))
+		p := model.Pay{Amount: 1 * model.Unit, CategoryName: "dining"}
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+pay, hrisi, p, nil))
+		assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodPost, path+"/"+restore, hrisi, nil, nil))
+		assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+pay, hrisi, p, nil))
+	})
+}
+
+func TestBrowser_Categories(t *testing.T) {
+	a := newTestApp(t)
+
+	cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+	browse := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrf)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return a.serve(req)
+	}
+
+	category := url.Values{"name": {"groceries"}, "type": {"expense"}, "parent": {"food"}}
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, "/"+index+"/"+categories, category).Code)
+	rr := browse(http.MethodGet, "/"+index+"/"+categories, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "groceries (expense)")
+	assert.NotContains(t, rr.Body.String(), "/index/categories/3/rename", "the shared categories cannot be renamed")
+
+	rr = browse(http.MethodGet, "/"+index+"/"+pay, nil)
+	assert.Contains(t, rr.Body.String(), "&nbsp;&nbsp;groceries")
+
+	path := "/" + index + "/" + categories + "/13/"
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, path+rename, url.Values{"name": {"market"}}).Code)
+	assert.Equal(t, http.StatusFound, browse(http.MethodPost, path+archive, nil).Code)
+	rr = browse(http.MethodGet, "/"+index+"/"+categories, nil)
+	assert.Contains(t, rr.Body.String(), "market (expense) - archived")
+	rr = browse(http.MethodGet, "/"+index+"/"+pay, nil)
+	assert.NotContains(t, rr.Body.String(), "market")
+}
+
+// statement returns a multipart request which uploads the statement with the form values
+func statement(t *testing.T, path, filename, content string, form url.Values) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	file, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.Write([]byte(content))
+	for name, values := range form {
+		for _, value := range values {
+			_ = writer.WriteField(name, value)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestAPI_Import(t *testing.T) {
+	a := newTestApp(t)
+	token := a.apiToken(t, "Hrisi", "love")
+	today := time.Now().Format(dateLayout)
+
+	rule := &model.ImportRule{}
+	code := a.call(t, http.MethodPost, "/"+imports+"/"+rules, token, model.ImportRule{Pattern: "lidl", Category: "food"}, rule)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, model.ExpenseType, rule.CType)
+	code = a.call(t, http.MethodPost, "/"+imports+"/"+rules, token, model.ImportRule{Pattern: "x", Category: "loan"}, nil)
+	assert.Equal(t, http.StatusBadRequest, code, "the categories of loans are reserved")
+
+	// Hrisi paid 5 for bread and earned 100 today
+	csv := "Date;Details;Amount\n" + today + ";Bakery;-5,00\n" + today + ";LIDL Sofia;-12,49\n" + today + ";Salary;250\n"
+	upload := func(content string, form url.Values) (int, *model.Statement) {
+		req := statement(t, apiV1+"/"+imports+"/"+preview, "statement.csv", content, form)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := a.serve(req)
+		s := &model.Statement{}
+		if rr.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), s))
+		}
+		return rr.Code, s
+	}
+	code, s := upload(csv, url.Values{"date": {"date"}, "amount": {"amount"}, "description": {"details"}, "comma": {";"}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, s.Rows, 3)
+	assert.True(t, s.Rows[0].Duplicate)
+	assert.False(t, s.Rows[0].Accept)
+	assert.Equal(t, "food", s.Rows[1].Category)
+	assert.Equal(t, model.Amount(1249), s.Rows[1].Amount)
+	assert.True(t, s.Rows[2].Accept)
+	assert.Equal(t, "", s.Rows[2].Category)
+
+	code = a.call(t, http.MethodPost, "/"+imports, token, s, nil)
+	assert.Equal(t, http.StatusBadRequest, code, "the salary has no category")
+
+	s.Rows[2].Category = "salary"
+	result := map[string]int{}
+	assert.Equal(t, http.StatusCreated, a.call(t, http.MethodPost, "/"+imports, token, s, &result))
+	assert.Equal(t, 2, result["imported"])
+	assert.Equal(t, 277*model.Unit+51, a.balanceOf(t, token))
+
+	t.Run("the rows are duplicates once imported", func(t *testing.T) {
+		_, s := upload(csv, url.Values{"date": {"date"}, "amount": {"amount"}, "description": {"details"}, "comma": {";"}})
+		for _, row := range s.Rows {
+			assert.True(t, row.Duplicate)
+		}
+	})
+	t.Run("nothing is imported without enough money", func(t *testing.T) {
+		s := &model.Statement{Rows: []model.ImportRow{
+			{Date: time.Now(), Amount: 10 * model.Unit, CType: model.ExpenseType, Currency: "BGN", Category: "food", Accept: true},
+			{Date: time.Now(), Amount: 1000 * model.Unit, CType: model.ExpenseType, Currency: "BGN", Category: "home", Accept: true},
+		}}
+		assert.Equal(t, http.StatusBadRequest, a.call(t, http.MethodPost, "/"+imports, token, s, nil))
+		assert.Equal(t, 277*model.Unit+51, a.balanceOf(t, token))
+	})
+	t.Run("invalid statements", func(t *testing.T) {
+		code, _ := upload(csv, url.Values{"date": {"date"}, "amount": {"sum"}, "comma": {";"}})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = upload(csv, url.Values{"format": {"ofx"}})
+		assert.Equal(t, http.StatusBadRequest, code)
+		large := "Date;Details;Amount\n" + today + ";" + strings.Repeat("x", maxStatementSize) + ";-5,00\n"
+		code, _ = upload(large, url.Values{"date": {"date"}, "amount": {"amount"}, "description": {"details"}, "comma": {";"}})
+		assert.Equal(t, http.StatusBadRequest, code, "the statement is too large")
+	})
+	t.Run("OFX", func(t *testing.T) {
+		ofx := "<OFX><BANKTRANLIST><STMTTRN><DTPOSTED>" + strings.ReplaceAll(today, "-", "") +
+			"<TRNAMT>-3.20<NAME>LIDL</STMTTRN></BANKTRANLIST></OFX>"
+		code, s := upload(ofx, url.Values{"format": {"ofx"}})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []model.ImportRow{{Date: s.Rows[0].Date, Amount: 320, CType: model.ExpenseType, Currency: "BGN",
+			Description: "LIDL", Category: "food", Accept: true}}, s.Rows)
+	})
+
+	importRules := []model.ImportRule{}
+	assert.Equal(t, http.StatusOK, a.call(t, http.MethodGet, "/"+imports+"/"+rules, token, nil, &importRules))
+	assert.Len(t, importRules, 1)
+	path := "/" + imports + "/" + rules + "/" + strconv.Itoa(rule.ID)
+	assert.Equal(t, http.StatusNotFound, a.call(t, http.MethodDelete, path, a.apiToken(t, "Lily", "1234"), nil, nil))
+	assert.Equal(t, http.StatusNoContent, a.call(t, http.MethodDelete, path, token, nil, nil))
+}
+
+func TestBrowser_Import(t *testing.T) {
+	a := newTestApp(t)
+	token := a.apiToken(t, "Hrisi", "love")
+
+	cookies, csrf := a.browserLogin(t, "Hrisi", "love")
+	browse := func(req *http.Request) *httptest.ResponseRecorder {
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return a.serve(req)
+	}
+
+	rule := url.Values{"pattern": {"Shell"}, "category": {"car"}, csrfParam: {csrf}}
+	req := httptest.NewRequest(http.MethodPost, "/"+index+"/"+imports+"/"+rules, strings.NewReader(rule.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, http.StatusFound, browse(req).Code)
+
+	csv := "date,amount,description\n" + time.Now().Format(dateLayout) + ",-5.00,Bread\n2024-03-02,-20,Shell\n"
+	req = statement(t, "/"+index+"/"+imports+"/"+preview, "statement.csv", csv,
+		url.Values{"date": {"date"}, "amount": {"amount"}, "description": {"description"}, csrfParam: {csrf}})
+	rr := browse(req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "already in the history")
+	assert.Contains(t, rr.Body.String(), `<option value=car selected>car</option>`)
+
+	rows := url.Values{"account": {""}, "rows": {"2"}, "accept": {"1"},
+		"date_0": {time.Now().Format(dateLayout)}, "amount_0": {"5.00"}, "type_0": {"expense"}, "currency_0": {"BGN"},
+		"description_0": {"Bread"}, "category_0": {"food"},
+		"date_1": {"2024-03-02"}, "amount_1": {"20.00"}, "type_1": {"expense"}, "currency_1": {"BGN"},
+		"description_1": {"Shell"}, "category_1": {"car"}, csrfParam: {csrf}}
+	req = httptest.NewRequest(http.MethodPost, "/"+index+"/"+imports, strings.NewReader(rows.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, http.StatusFound, browse(req).Code)
+	assert.Equal(t, 20*model.Unit, a.balanceOf(t, token), "only the Shell row is imported")
+
+	for _, count := range []string{"-1", "1001", "2000000000"} {
+		rows.Set("rows", count)
+		req = httptest.NewRequest(http.MethodPost, "/"+index+"/"+imports, strings.NewReader(rows.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		assert.Equal(t, http.StatusBadRequest, browse(req).Code, count)
+	}
+
+	// The CSRF token is not read past the limit of the body
+	body := "pattern=Bakery&category=food&description=" + strings.Repeat("x", maxStatementSize) + "&" +
+		url.Values{csrfParam: {csrf}}.Encode()
+	req = httptest.NewRequest(http.MethodPost, "/"+index+"/"+imports+"/"+rules, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, http.StatusForbidden, browse(req).Code)
+}
@@ -5,39 +5,110 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/hpmalinova/Money-Manager/model"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func JwtVerify(next http.Handler) http.Handler {
+// tokenFromRequest returns the token of an "Authorization: Bearer" header
+// or, if there is no such header, the value of the token cookie
+func tokenFromRequest(r *http.Request) (string, int) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		const prefix = "Bearer "
+		if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+			return "", http.StatusBadRequest
+		}
+		return strings.TrimSpace(header[len(prefix):]), 0
+	}
+
+	t, err := r.Cookie(tokenCookie)
+	if err != nil {
+		if err == http.ErrNoCookie {
+			// If the cookie is not set, return an unauthorized status
+			return "", http.StatusUnauthorized
+		}
+		// For any other type of error, return a bad request status
+		return "", http.StatusBadRequest
+	}
+	return t.Value, 0
+}
+
+// BearerVerify accepts only the requests with an "Authorization: Bearer" header.
+// Browsers send the token cookie also with the requests of other sites, so the JSON API does not accept it.
+func (a *App) BearerVerify(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		t, err := r.Cookie("token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				// If the cookie is not set, return an unauthorized status
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			// For any other type of error, return a bad request status
-			w.WriteHeader(http.StatusBadRequest)
+		if r.Header.Get("Authorization") == "" {
+			respondWithError(w, http.StatusUnauthorized, "Missing auth token")
 			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		token := t.Value
-		if token == "" {
+// JwtVerify accepts requests with a valid access token of an active session.
+// Browsers, which send the token as a cookie, get a new access token when theirs is about to expire
+// and are refreshed with the refresh token cookie when it has expired.
+func (a *App) JwtVerify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromCookie := r.Header.Get("Authorization") == ""
+
+		token, status := tokenFromRequest(r)
+		if status != 0 || token == "" {
+			if fromCookie {
+				if claims := a.refreshFromCookie(w, r); claims != nil {
+					serveWithClaims(next, w, r, claims)
+					return
+				}
+			}
+			if status != 0 {
+				w.WriteHeader(status)
+				return
+			}
 			respondWithError(w, http.StatusUnauthorized, "Missing auth token")
 			return
 		}
 		claims := &model.UserToken{}
 
-		_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte("secret"), nil //todo env
-		})
-
+		_, err := a.Keys.Parse(token, claims)
 		if err != nil {
+			if fromCookie && isExpired(err) {
+				if claims := a.refreshFromCookie(w, r); claims != nil {
+					serveWithClaims(next, w, r, claims)
+					return
+				}
+			}
 			respondWithError(w, http.StatusForbidden, err.Error())
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "user", claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		// The session must not be revoked
+		session, err := a.Sessions.FindByID(claims.Id)
+		if err != nil || !session.Active(time.Now()) || strconv.Itoa(session.UserID) != claims.UserID {
+			if fromCookie {
+				a.clearAuthCookies(w)
+			}
+			respondWithError(w, http.StatusUnauthorized, "Session has expired or was revoked")
+			return
+		}
+
+		// Sliding renewal
+		if fromCookie && time.Until(time.Unix(claims.ExpiresAt, 0)) < renewBefore {
+			if token, renewed, err := a.renewAccessToken(claims); err == nil {
+				a.setAuthCookies(w, &model.Tokens{Token: token})
+				claims = renewed
+			}
+		}
+
+		serveWithClaims(next, w, r, claims)
 	})
 }
+
+func serveWithClaims(next http.Handler, w http.ResponseWriter, r *http.Request, claims *model.UserToken) {
+	ctx := context.WithValue(r.Context(), "user", claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func isExpired(err error) bool {
+	ve, ok := err.(*jwt.ValidationError)
+	return ok && ve.Errors&jwt.ValidationErrorExpired != 0
+}
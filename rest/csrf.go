@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/hpmalinova/Money-Manager/model"
+	"html/template"
+	"net/http"
+)
+
+const (
+	csrfParam  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfToken returns the CSRF token of the session. It is derived from the session ID,
+// so that it is the same in every page of the session and needs not be stored.
+func (a *App) csrfToken(sessionID string) string {
+	mac := hmac.New(sha256.New, a.CSRFKey)
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CSRFVerify rejects the state-changing requests of browsers which do not carry the CSRF token
+// of their session in the csrf_token form value or the X-CSRF-Token header.
+// Requests with an "Authorization: Bearer" header are not sent by browsers on their own and are accepted.
+func (a *App) CSRFVerify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims := r.Context().Value("user").(*model.UserToken)
+		token := r.Header.Get(csrfHeader)
+		if token == "" {
+			token = r.FormValue(csrfParam)
+		}
+		if !hmac.Equal([]byte(token), []byte(a.csrfToken(claims.Id))) {
+			respondWithError(w, http.StatusForbidden, "Invalid CSRF token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// render executes the template with the CSRF token of the session of the request,
+// which the forms include with {{csrfField}}
+func (a *App) render(w http.ResponseWriter, r *http.Request, name string, data interface{}) error {
+	field := template.HTML("")
+	if claims, ok := r.Context().Value("user").(*model.UserToken); ok {
+		field = template.HTML(fmt.Sprintf(`<input name="%s" type="hidden" value="%s"/>`,
+			csrfParam, template.HTMLEscapeString(a.csrfToken(claims.Id))))
+	}
+
+	// The parsed templates are never executed, so that they can be cloned
+	t, err := a.Template.Clone()
+	if err != nil {
+		return err
+	}
+	t.Funcs(template.FuncMap{"csrfField": func() template.HTML { return field }})
+	return t.ExecuteTemplate(w, name, data)
+}
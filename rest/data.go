@@ -16,14 +16,14 @@ func (a *App) AddData() {
 	_, _ = a.Users.Create(&model.User{ID: 3, Username: "George", Password: string(pass2)})
 	_, _ = a.Users.Create(&model.User{ID: 4, Username: "Lily", Password: string(pass2)})
 
-	a.addMoneyToWallet(100)
+	a.addMoneyToWallet(100 * model.Unit)
 	a.addFriendships()
 	a.addPayments()
 	a.addLoans()
 	a.addSplit()
 }
 
-func (a *App) addMoneyToWallet(amount int) {
+func (a *App) addMoneyToWallet(amount model.Amount) {
 	for _, id := range userIDs {
 		_ = a.Payment.CreateWallet(id)
 		_ = a.Payment.Earn(&model.History{
@@ -69,7 +69,7 @@ func (a *App) addFriendships() {
 // George: 80
 // Lily: 10
 func (a *App) addPayments() {
-	amount := []int{5, 10, 20, 90}
+	amount := []model.Amount{5 * model.Unit, 10 * model.Unit, 20 * model.Unit, 90 * model.Unit}
 	category := []int{3, 4, 5, 3}
 	description := []string{"Bread", "", "Car Wash", "Bar"}
 
@@ -84,13 +84,13 @@ func (a *App) addPayments() {
 
 	_ = a.Payment.Pay(&model.History{
 		UserID:      1,
-		Amount:      15,
+		Amount:      15 * model.Unit,
 		CategoryID:  3,
 		Description: "",
 	})
 	_ = a.Payment.Pay(&model.History{
 		UserID:      1,
-		Amount:      10,
+		Amount:      10 * model.Unit,
 		CategoryID:  4,
 		Description: "",
 	})
@@ -100,7 +100,7 @@ func (a *App) addPayments() {
 // Peter: 90
 // George: 80
 // Lily: 40
-// Hrisi --> Lily (30lv "Bills")
+// Hrisi --> Lily (30lv "Bills"), accepted by Lily
 func (a *App) addLoans() {
 	_ = a.Payment.GiveLoan(&model.TransferLoan{
 		DebtCategoryID:    6,
@@ -110,32 +110,44 @@ func (a *App) addLoans() {
 			LoanCategoryID: 1,
 			Loan: model.Loan{
 				DebtorID:    4,
-				Amount:      30,
+				Amount:      30 * model.Unit,
 				Description: "Bills",
 			},
 		},
 	})
+	a.acceptProposals(4)
 }
 
 // Hrisi: 40
 // Peter: 90
 // George: 20
 // Lily: 40
-// George --> Peter 60 FOOD "Restaurant"
+// George --> Peter 60 FOOD "Restaurant", accepted by Peter
 func (a *App) addSplit() {
 	_ = a.Payment.Split(&model.TransferSplit{
 		Expense: model.Category{
 			ID:   3,
 			Name: "food",
 		},
+		DebtCategoryName: "food",
 		Transfer: model.Transfer{
 			CreditorID:     3,
 			LoanCategoryID: 1,
 			Loan: model.Loan{
 				DebtorID:    2,
-				Amount:      60,
+				Amount:      60 * model.Unit,
 				Description: "Restaurant",
 			},
 		},
 	})
+	a.acceptProposals(2)
+}
+
+// acceptProposals accepts the loans and splits proposed to the debtor as of their dates
+func (a *App) acceptProposals(debtorID int) {
+	proposals, _ := a.Payment.FindProposedDebts(debtorID)
+	for _, p := range proposals {
+		_ = a.Payment.AcceptProposal(debtorID, &model.Consent{StatusID: p.StatusID, LoanCategoryID: 1, DebtCategoryID: 6,
+			Date: p.Date})
+	}
 }
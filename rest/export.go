@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/hpmalinova/Money-Manager/model"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The exports write the data of the user as CSV for spreadsheets and accounting tools.
+// Amounts have two fractional digits and a dot, such as 12.49, and dates are RFC 3339 in UTC.
+// They are served both by the JSON API, for the Authorization header, and by the browser routes, for the cookie.
+
+const export = "export"
+
+func (a *App) initializeExportRoutes(s *mux.Router) {
+	s.HandleFunc("/"+export+"/"+history, a.exportHistory).Methods(http.MethodGet)
+	s.HandleFunc("/"+export+"/"+debts, a.exportDebts).Methods(http.MethodGet)
+	s.HandleFunc("/"+export+"/"+loans, a.exportLoans).Methods(http.MethodGet)
+}
+
+// exportHistory writes the history entries of the user in the period of the "from" and "to" values
+func (a *App) exportHistory(w http.ResponseWriter, r *http.Request) {
+	period, err := parsePeriod(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h, err := a.Payment.FindHistory(currentUserID(r), period)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cw := startCSV(w, history, []string{"id", "date", "type", "category", "amount", "currency", "account", "description"})
+	for _, e := range h.HistoryShowAll {
+		_ = cw.Write([]string{fmt.Sprint(e.ID), e.Date.UTC().Format(time.RFC3339), e.CategoryType,
+			csvText(e.CategoryName), e.Amount.In(e.Currency), e.Currency, csvText(e.Account), csvText(e.Description)})
+	}
+	cw.Flush()
+}
+
+// exportDebts writes what the user owes. The amount of a pending debt is the repayment which awaits the creditor,
+// and the amount of a proposed one is what the user would owe after accepting it.
+func (a *App) exportDebts(w http.ResponseWriter, r *http.Request) {
+	d, err := a.getDebtsData(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cw := startCSV(w, debts, []string{"status", "creditor", "amount", "currency", "description"})
+	for _, debt := range d.Active {
+		_ = cw.Write(append([]string{"active", csvText(debt.Creditor)}, dlRecord(debt.DLTemplate)...))
+	}
+	for _, debt := range d.Pending {
+		_ = cw.Write(append([]string{"pending", csvText(debt.Creditor)}, dlRecord(debt.DLTemplate)...))
+	}
+	for _, debt := range d.Proposed {
+		_ = cw.Write(append([]string{"proposed", csvText(debt.Creditor)}, dlRecord(debt.DLTemplate)...))
+	}
+	cw.Flush()
+}
+
+// exportLoans writes what the friends of the user owe them.
+// The amount of a pending loan is the repayment which awaits the user, and proposed loans await the debtor.
+func (a *App) exportLoans(w http.ResponseWriter, r *http.Request) {
+	l, err := a.getLoansData(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cw := startCSV(w, loans, []string{"status", "debtor", "amount", "currency", "description"})
+	for _, loan := range l.Active {
+		_ = cw.Write(append([]string{"active", csvText(loan.Debtor)}, dlRecord(loan.DLTemplate)...))
+	}
+	for _, loan := range l.Pending {
+		_ = cw.Write(append([]string{"pending", csvText(loan.Debtor)}, dlRecord(loan.DLTemplate)...))
+	}
+	for _, loan := range l.Proposed {
+		_ = cw.Write(append([]string{"proposed", csvText(loan.Debtor)}, dlRecord(loan.DLTemplate)...))
+	}
+	cw.Flush()
+}
+
+// startCSV responds with the CSV attachment name.csv and writes its header.
+// The records are streamed to the client as they are written.
+func startCSV(w http.ResponseWriter, name string, header []string) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write(header)
+	return cw
+}
+
+func dlRecord(dl model.DLTemplate) []string {
+	return []string{dl.Amount.In(dl.Currency), dl.Currency, csvText(dl.Description)}
+}
+
+// csvText escapes a text written by a user, so that spreadsheets do not run it as a formula:
+// a text starting with =, +, -, @, a tab or a carriage return is prefixed with a single quote
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
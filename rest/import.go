@@ -0,0 +1,408 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/hpmalinova/Money-Manager/model"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The import reads the transactions of a bank statement, CSV or OFX, and previews them:
+// the rules of the user choose their categories and the ones which are already in the history are marked.
+// The accepted transactions are then recorded as payments and incomes in one transaction.
+
+const (
+	imports = "import"
+	preview = "preview"
+	rules   = "rules"
+)
+
+// maxStatementSize limits the body of every request, of which the uploaded statements are the largest
+const maxStatementSize = 5 << 20
+
+// maxImportRows limits the rows of a statement, in the preview and on import
+const maxImportRows = 1000
+
+// LimitBody limits the body of the requests to maxStatementSize before any handler or middleware,
+// such as CSRFVerify, reads it. ParseMultipartForm only limits the part which it keeps in memory.
+func (a *App) LimitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxStatementSize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *App) initializeImportAPIRoutes(s *mux.Router) {
+	s.HandleFunc("/"+imports+"/"+preview, a.apiPreviewImport).Methods(http.MethodPost)
+	s.HandleFunc("/"+imports, a.apiImport).Methods(http.MethodPost)
+	s.HandleFunc("/"+imports+"/"+rules, a.apiImportRules).Methods(http.MethodGet)
+	s.HandleFunc("/"+imports+"/"+rules, a.apiCreateImportRule).Methods(http.MethodPost)
+	s.HandleFunc("/"+imports+"/"+rules+"/{id:[0-9]+}", a.apiDeleteImportRule).Methods(http.MethodDelete)
+}
+
+func (a *App) initializeImportRoutes(s *mux.Router) {
+	s.HandleFunc("/"+imports, a.getImport).Methods(http.MethodGet)
+	s.HandleFunc("/"+imports+"/"+preview, a.previewImport).Methods(http.MethodPost)
+	s.HandleFunc("/"+imports, a.importForm).Methods(http.MethodPost)
+	s.HandleFunc("/"+imports+"/"+rules, a.createImportRuleForm).Methods(http.MethodPost)
+	s.HandleFunc("/"+imports+"/"+rules+"/{id:[0-9]+}/"+remove, a.deleteImportRule).Methods(http.MethodPost)
+}
+
+// JSON API
+
+// apiPreviewImport reads a statement uploaded as multipart/form-data and returns its rows.
+// The client changes their categories and whether they are accepted, and sends them to apiImport.
+func (a *App) apiPreviewImport(w http.ResponseWriter, r *http.Request) {
+	statement, err := a.parseStatement(currentUserID(r), r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, statement)
+}
+
+// apiImport records the accepted rows of a previewed statement
+func (a *App) apiImport(w http.ResponseWriter, r *http.Request) {
+	statement := &model.Statement{}
+	if !a.decodeAndValidate(w, r, statement) {
+		return
+	}
+
+	imported, err := a.importStatement(currentUserID(r), statement)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]int{"imported": imported})
+}
+
+func (a *App) apiImportRules(w http.ResponseWriter, r *http.Request) {
+	importRules, err := a.ImportRules.Find(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, importRules)
+}
+
+func (a *App) apiCreateImportRule(w http.ResponseWriter, r *http.Request) {
+	rule := &model.ImportRule{}
+	if !a.decodeAndValidate(w, r, rule) {
+		return
+	}
+
+	created, err := a.createImportRule(currentUserID(r), rule)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (a *App) apiDeleteImportRule(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := a.ImportRules.Delete(currentUserID(r), id); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BROWSER
+
+func (a *App) getImport(w http.ResponseWriter, r *http.Request) {
+	data, err := a.getImportData(currentUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	_ = a.render(w, r, imports, data)
+}
+
+// Receive --> file, format, account, currency and the columns of a CSV statement
+func (a *App) previewImport(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	statement, err := a.parseStatement(userID, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := a.getImportData(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data.Statement = *statement
+
+	_ = a.render(w, r, "importPreview", data)
+}
+
+// Receive --> account, rows and for each row i: date_i, amount_i, type_i, currency_i, description_i, category_i;
+// accept holds the accepted rows
+func (a *App) importForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	statement, err := parseStatementForm(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.Validator.Struct(statement); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if _, err := a.importStatement(currentUserID(r), statement); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+history, http.StatusFound)
+}
+
+// Receive --> pattern, category
+func (a *App) createImportRuleForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		_, _ = fmt.Fprintf(w, "ParseForm() err: %v", err)
+		return
+	}
+	rule := &model.ImportRule{Pattern: strings.TrimSpace(r.FormValue("pattern")), Category: r.FormValue("category")}
+	if err := a.Validator.Struct(rule); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(errs.Translate(a.Translator), w)
+		return
+	}
+
+	if _, err := a.createImportRule(currentUserID(r), rule); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+imports, http.StatusFound)
+}
+
+func (a *App) deleteImportRule(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := a.ImportRules.Delete(currentUserID(r), id); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/"+index+"/"+imports, http.StatusFound)
+}
+
+// HELPERS
+
+// getImportData returns the rules of the user and the choices of the import page
+func (a *App) getImportData(userID int) (*model.ImportTemplate, error) {
+	importRules, err := a.ImportRules.Find(userID)
+	if err != nil {
+		return nil, err
+	}
+	expenses, err := a.Categories.FindExpenses(userID)
+	if err != nil {
+		return nil, err
+	}
+	incomes, err := a.Categories.FindIncomes(userID)
+	if err != nil {
+		return nil, err
+	}
+	balance := a.getBalance(userID)
+
+	return &model.ImportTemplate{
+		Rules:      importRules,
+		Expenses:   userCategories(expenses),
+		Incomes:    userCategories(incomes),
+		Balance:    balance,
+		Currencies: a.getCurrencies(),
+		Currency:   balance.Total.Currency,
+		Account:    model.DefaultAccount,
+	}, nil
+}
+
+// parseStatement reads the statement in the "file" of a multipart form and previews its rows.
+// The format is the "format" value, or follows from the extension of the file.
+// The "currency" value, the base currency of the user if not set, is the currency of the rows which have none.
+func (a *App) parseStatement(userID int, r *http.Request) (*model.Statement, error) {
+	if err := r.ParseMultipartForm(maxStatementSize); err != nil {
+		return nil, fmt.Errorf("invalid statement: %v", err)
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New("there is no statement file")
+	}
+	defer file.Close()
+
+	currency, err := a.findCurrency(userID, r.FormValue("currency"))
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = model.CSVFormat
+		if ext := strings.ToLower(filepath.Ext(header.Filename)); ext == ".ofx" || ext == ".qfx" {
+			format = model.OFXFormat
+		}
+	}
+
+	var rows []model.ImportRow
+	switch format {
+	case model.CSVFormat:
+		m := model.ImportMapping{
+			Date:        r.FormValue("date"),
+			Amount:      r.FormValue("amount"),
+			Debit:       r.FormValue("debit"),
+			Credit:      r.FormValue("credit"),
+			Description: r.FormValue("description"),
+			Currency:    r.FormValue("currencyColumn"),
+			DateLayout:  r.FormValue("dateLayout"),
+			Comma:       r.FormValue("comma"),
+			NoHeader:    r.FormValue("noHeader") != "",
+		}
+		if err := a.Validator.Struct(m); err != nil {
+			return nil, errors.New("the date column and the amount, or the debit and credit, columns are required")
+		}
+		rows, err = model.ParseCSV(file, m, currency)
+	case model.OFXFormat:
+		rows, err = model.ParseOFX(file, currency)
+	default:
+		return nil, fmt.Errorf("unknown format: %v", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid statement: %v", err)
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("the statement has more than %d rows", maxImportRows)
+	}
+
+	// The days of a statement are in the local time zone, as the dates of the forms
+	for i, row := range rows {
+		rows[i].Date = time.Date(row.Date.Year(), row.Date.Month(), row.Date.Day(), 0, 0, 0, 0, time.Local)
+	}
+	if err := a.previewRows(userID, rows); err != nil {
+		return nil, err
+	}
+	return &model.Statement{Account: r.FormValue("account"), Rows: rows}, nil
+}
+
+// previewRows chooses the categories of the rows by the rules of the user and marks the duplicates
+func (a *App) previewRows(userID int, rows []model.ImportRow) error {
+	importRules, err := a.ImportRules.Find(userID)
+	if err != nil {
+		return err
+	}
+	model.Categorize(rows, importRules)
+
+	h, err := a.Payment.FindHistory(userID, model.StatementPeriod(rows))
+	if err != nil {
+		return err
+	}
+	model.MarkDuplicates(rows, h.HistoryShowAll)
+	return nil
+}
+
+// importStatement records the accepted rows of the statement in the order of their dates,
+// and returns how many were recorded. The budgets are not checked, since the bank has already paid.
+func (a *App) importStatement(userID int, statement *model.Statement) (int, error) {
+	if len(statement.Rows) > maxImportRows {
+		return 0, fmt.Errorf("the statement has more than %d rows", maxImportRows)
+	}
+	entries := []model.History{}
+	for i, row := range statement.Rows {
+		if !row.Accept {
+			continue
+		}
+		if row.Category == "" {
+			return 0, fmt.Errorf("row %d: choose a category", i+1)
+		}
+		category, err := a.findCategory(userID, row.Category, row.CType)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		currency, err := a.findCurrency(userID, row.Currency)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		entries = append(entries, model.History{
+			UserID:      userID,
+			Amount:      row.Amount,
+			Currency:    currency,
+			Account:     statement.Account,
+			CategoryID:  category.ID,
+			Description: row.Description,
+			Date:        row.Date,
+		})
+	}
+	if len(entries) == 0 {
+		return 0, errors.New("no rows are accepted")
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date.Before(entries[j].Date) })
+	if err := a.Payment.Import(entries); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// parseStatementForm reads the rows of a previewed statement from the import form
+func parseStatementForm(r *http.Request) (*model.Statement, error) {
+	count, err := strconv.Atoi(r.FormValue("rows"))
+	if err != nil || count < 0 || count > maxImportRows {
+		return nil, errors.New("invalid rows")
+	}
+	accepted := map[string]bool{}
+	for _, i := range r.Form["accept"] {
+		accepted[i] = true
+	}
+
+	statement := &model.Statement{Account: r.FormValue("account"), Rows: make([]model.ImportRow, count)}
+	for i := range statement.Rows {
+		n := strconv.Itoa(i)
+		row := &statement.Rows[i]
+		row.Currency = r.FormValue("currency_" + n)
+		if row.Amount, err = parseAmount(r.FormValue("amount_"+n), row.Currency); err != nil {
+			return nil, fmt.Errorf("row %d: invalid amount", i+1)
+		}
+		if row.Date, err = parseDate(r.FormValue("date_" + n)); err != nil || row.Date.IsZero() {
+			return nil, fmt.Errorf("row %d: invalid date", i+1)
+		}
+		row.CType = r.FormValue("type_" + n)
+		row.Description = r.FormValue("description_" + n)
+		row.Category = r.FormValue("category_" + n)
+		row.Accept = accepted[n]
+	}
+	return statement, nil
+}
+
+// createImportRule creates a rule of the user for one of the expense or income categories of the user
+func (a *App) createImportRule(userID int, rule *model.ImportRule) (*model.ImportRule, error) {
+	category, err := a.Categories.FindByName(userID, rule.Category)
+	if err != nil || category.Archived || model.IsSystemCategory(category.Name) {
+		return nil, fmt.Errorf("there is no category: %v", rule.Category)
+	}
+	return a.ImportRules.Create(&model.ImportRule{
+		UserID:     userID,
+		Pattern:    rule.Pattern,
+		CategoryID: category.ID,
+		Category:   category.Name,
+		CType:      category.CType,
+	})
+}
@@ -0,0 +1,163 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"strings"
+)
+
+// KeyConfig describes the keys used for the JWT tokens.
+//
+// New tokens are signed with the active key and carry its ID in the "kid" header.
+// PreviousKeys only verify tokens, so that tokens signed before a key rotation stay valid
+// until they expire. It is a comma separated list of "kid:algorithm:key" entries,
+// where key is the secret for HMAC algorithms or the path to a PEM public key otherwise.
+type KeyConfig struct {
+	Algorithm      string // HS256 by default
+	KeyID          string
+	Secret         string // HMAC algorithms
+	PrivateKeyFile string // RSA and ECDSA algorithms
+	PreviousKeys   string
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// KeySet signs new tokens and verifies received ones by their key ID
+type KeySet struct {
+	keyID      string
+	method     jwt.SigningMethod
+	signingKey interface{}
+	keys       map[string]verificationKey
+}
+
+const defaultKeyID = "default"
+
+func NewKeySet(c KeyConfig) (*KeySet, error) {
+	if c.Algorithm == "" {
+		c.Algorithm = jwt.SigningMethodHS256.Alg()
+	}
+	if c.KeyID == "" {
+		c.KeyID = defaultKeyID
+	}
+
+	method := jwt.GetSigningMethod(c.Algorithm)
+	if method == nil || method == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("unsupported JWT algorithm: %v", c.Algorithm)
+	}
+
+	ks := &KeySet{keyID: c.KeyID, method: method, keys: map[string]verificationKey{}}
+
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if c.Secret == "" {
+			return nil, errors.New("JWT secret is not set")
+		}
+		ks.signingKey = []byte(c.Secret)
+		ks.keys[c.KeyID] = verificationKey{method: method, key: ks.signingKey}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		pem, err := ioutil.ReadFile(c.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWT private key: %v", err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWT private key: %v", err)
+		}
+		ks.signingKey = key
+		ks.keys[c.KeyID] = verificationKey{method: method, key: &key.PublicKey}
+	case *jwt.SigningMethodECDSA:
+		pem, err := ioutil.ReadFile(c.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWT private key: %v", err)
+		}
+		key, err := jwt.ParseECPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWT private key: %v", err)
+		}
+		ks.signingKey = key
+		ks.keys[c.KeyID] = verificationKey{method: method, key: &key.PublicKey}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %v", c.Algorithm)
+	}
+
+	if err := ks.addPreviousKeys(c.PreviousKeys); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) addPreviousKeys(previous string) error {
+	for _, entry := range strings.Split(previous, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("invalid previous JWT key %q: expected kid:algorithm:key", entry)
+		}
+		kid, alg, value := parts[0], parts[1], parts[2]
+		if _, ok := ks.keys[kid]; ok {
+			return fmt.Errorf("duplicate JWT key ID: %v", kid)
+		}
+
+		method := jwt.GetSigningMethod(alg)
+		var key interface{}
+		var err error
+		switch method.(type) {
+		case *jwt.SigningMethodHMAC:
+			key = []byte(value)
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			var pem []byte
+			if pem, err = ioutil.ReadFile(value); err == nil {
+				key, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+			}
+		case *jwt.SigningMethodECDSA:
+			var pem []byte
+			if pem, err = ioutil.ReadFile(value); err == nil {
+				key, err = jwt.ParseECPublicKeyFromPEM(pem)
+			}
+		default:
+			err = fmt.Errorf("unsupported JWT algorithm: %v", alg)
+		}
+		if err != nil {
+			return fmt.Errorf("previous JWT key %v: %v", kid, err)
+		}
+		ks.keys[kid] = verificationKey{method: method, key: key}
+	}
+	return nil
+}
+
+// Sign returns a token with the given claims, signed with the active key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.method, claims)
+	token.Header["kid"] = ks.keyID
+	return token.SignedString(ks.signingKey)
+}
+
+// Parse verifies the token with the key named by its "kid" header and reads its claims.
+// Tokens without a key ID are verified with the active key.
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = ks.keyID
+		}
+
+		vk, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID: %v", kid)
+		}
+		// The algorithm must be the one of the key, otherwise a public key could be used as an HMAC secret
+		if token.Method.Alg() != vk.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Method.Alg())
+		}
+		return vk.key, nil
+	})
+}
@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/hpmalinova/Money-Manager/model"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeySet_Rotation(t *testing.T) {
+	old, err := NewKeySet(KeyConfig{KeyID: "2021-01", Secret: "old"})
+	assert.NoError(t, err)
+	token, err := old.Sign(&model.UserToken{UserID: "1", Username: "Hrisi"})
+	assert.NoError(t, err)
+
+	t.Run("previous key still verifies", func(t *testing.T) {
+		current, err := NewKeySet(KeyConfig{KeyID: "2021-02", Secret: "new", PreviousKeys: "2021-01:HS256:old"})
+		assert.NoError(t, err)
+
+		claims := &model.UserToken{}
+		_, err = current.Parse(token, claims)
+		assert.NoError(t, err)
+		assert.Equal(t, "Hrisi", claims.Username)
+	})
+	t.Run("retired key is rejected", func(t *testing.T) {
+		current, err := NewKeySet(KeyConfig{KeyID: "2021-02", Secret: "new"})
+		assert.NoError(t, err)
+
+		_, err = current.Parse(token, &model.UserToken{})
+		assert.Error(t, err)
+	})
+	t.Run("invalid previous keys", func(t *testing.T) {
+		_, err := NewKeySet(KeyConfig{Secret: "new", PreviousKeys: "2021-01:old"})
+		assert.Error(t, err)
+	})
+}
+
+func TestKeySet_ECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "jwt.pem")
+	err = ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	assert.NoError(t, err)
+
+	ks, err := NewKeySet(KeyConfig{Algorithm: "ES256", PrivateKeyFile: file})
+	assert.NoError(t, err)
+
+	token, err := ks.Sign(&model.UserToken{UserID: "1"})
+	assert.NoError(t, err)
+	_, err = ks.Parse(token, &model.UserToken{})
+	assert.NoError(t, err)
+
+	// A token signed with HMAC must not be accepted for an ECDSA key ID
+	hmac, err := NewKeySet(KeyConfig{Secret: "secret"})
+	assert.NoError(t, err)
+	forged, err := hmac.Sign(&model.UserToken{UserID: "1"})
+	assert.NoError(t, err)
+	_, err = ks.Parse(forged, &model.UserToken{})
+	assert.Error(t, err)
+}
@@ -1,8 +1,11 @@
 package rest
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"github.com/go-playground/validator/v10"
+	"github.com/hpmalinova/Money-Manager/repository"
 	"net/http"
 )
 
@@ -10,6 +13,22 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
 
+// respondWithRepoError maps a repository error to a status code: missing rows are 404,
+// acting on a debt of someone else is 403, a repository.BadRequestError is 400 and anything else is 500.
+func respondWithRepoError(w http.ResponseWriter, err error) {
+	var badRequest *repository.BadRequestError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusNotFound, "Not found")
+	case errors.Is(err, repository.ErrNotParty):
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+	case errors.As(err, &badRequest):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 func respondWithValidationError(fields validator.ValidationErrorsTranslations, w http.ResponseWriter) {
 	//Create a new map and fill it
 	response := make(map[string]interface{})
@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"context"
+	"github.com/hpmalinova/Money-Manager/model"
+	"github.com/hpmalinova/Money-Manager/repository"
+	"log"
+	"time"
+)
+
+// The scheduler records the due occurrences of the recurring rules through Pay and Earn.
+// Every entry keeps its rule and the number of its occurrence, which the database keeps unique,
+// so an occurrence is recorded once even if the service restarts before the rule is advanced.
+// The occurrences missed while the service was stopped are recorded, with their own dates, at the next run.
+
+// schedulerInterval is how often the scheduler looks for due occurrences
+const schedulerInterval = time.Minute
+
+// RunScheduler records the due occurrences now and then every interval, until ctx is done
+func (a *App) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.recordDue(time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordDue records the occurrences of the active rules which are due at now
+func (a *App) recordDue(now time.Time) {
+	rules, err := a.Recurring.FindActive()
+	if err != nil {
+		log.Println("recurring:", err)
+		return
+	}
+	for _, r := range rules {
+		if err := a.recordRule(r, now); err != nil {
+			log.Printf("recurring rule %d: %v", r.ID, err)
+		}
+	}
+}
+
+// recordRule records the occurrences of the rule which are due at now, in order.
+// An occurrence which fails, such as a payment without enough money, stops the rule until the next run.
+func (a *App) recordRule(r model.Recurring, now time.Time) error {
+	for n := r.Done; r.Due(n, now); n++ {
+		h := &model.History{
+			UserID:      r.UserID,
+			Amount:      r.Amount,
+			Currency:    r.Currency,
+			Account:     r.Account,
+			CategoryID:  r.CategoryID,
+			Description: r.Description,
+			Date:        r.Occurrence(n),
+			RecurringID: r.ID,
+			Occurrence:  n,
+		}
+		var err error
+		if r.CategoryType == model.IncomeType {
+			err = a.Payment.Earn(h)
+		} else {
+			err = a.Payment.Pay(h)
+		}
+		if err != nil && err != repository.ErrRecorded {
+			return err
+		}
+		if err := a.Recurring.Advance(r.ID, n+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
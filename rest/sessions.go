@@ -0,0 +1,259 @@
+package rest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hpmalinova/Money-Manager/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	accessTokenTTL  = 30 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+	// Access tokens from cookies that expire sooner are renewed by JwtVerify
+	renewBefore = 10 * time.Minute
+
+	tokenCookie   = "token"
+	refreshCookie = "refresh_token"
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// signAccessToken returns a new access token of the session
+func (a *App) signAccessToken(user *model.User, sessionID string) (string, *model.UserToken, error) {
+	now := time.Now()
+	claims := &model.UserToken{
+		UserID:   strconv.Itoa(user.ID),
+		Username: user.Username,
+		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(accessTokenTTL).Unix(),
+		},
+	}
+	token, err := a.Keys.Sign(claims)
+	return token, claims, err
+}
+
+// startSession creates a new session of the user and returns its tokens.
+// The refresh token is "<session ID>.<secret>".
+func (a *App) startSession(user *model.User) (*model.Tokens, error) {
+	sessionID, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := sessionID + "." + secret
+
+	session := &model.Session{
+		ID:          sessionID,
+		UserID:      user.ID,
+		RefreshHash: hashToken(refreshToken),
+		ExpiresAt:   time.Now().Add(refreshTokenTTL),
+	}
+	if err := a.Sessions.Create(session); err != nil {
+		return nil, err
+	}
+
+	token, _, err := a.signAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Tokens{Token: token, RefreshToken: refreshToken, Username: user.Username, ID: strconv.Itoa(user.ID)}, nil
+}
+
+// refreshSession exchanges a refresh token for a new access token and a new refresh token.
+// The old refresh token cannot be used again.
+func (a *App) refreshSession(refreshToken string) (*model.Tokens, *model.UserToken, error) {
+	dot := strings.IndexByte(refreshToken, '.')
+	if dot <= 0 {
+		return nil, nil, errInvalidRefreshToken
+	}
+	sessionID := refreshToken[:dot]
+
+	session, err := a.Sessions.FindByID(sessionID)
+	if err != nil || !session.Active(time.Now()) || session.RefreshHash != hashToken(refreshToken) {
+		return nil, nil, errInvalidRefreshToken
+	}
+	user, err := a.Users.FindByID(session.UserID)
+	if err != nil {
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	newRefreshToken := sessionID + "." + secret
+	err = a.Sessions.Refresh(sessionID, session.RefreshHash, hashToken(newRefreshToken), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	token, claims, err := a.signAccessToken(user, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens := &model.Tokens{Token: token, RefreshToken: newRefreshToken, Username: user.Username, ID: strconv.Itoa(user.ID)}
+	return tokens, claims, nil
+}
+
+// renewAccessToken signs a new access token of the session and extends the session
+func (a *App) renewAccessToken(claims *model.UserToken) (string, *model.UserToken, error) {
+	userID, _ := strconv.Atoi(claims.UserID)
+	user := &model.User{ID: userID, Username: claims.Username}
+	if err := a.Sessions.Extend(claims.Id, time.Now().Add(refreshTokenTTL)); err != nil {
+		return "", nil, err
+	}
+	return a.signAccessToken(user, claims.Id)
+}
+
+// CookieConfig sets the attributes of the auth cookies
+type CookieConfig struct {
+	Insecure bool          // Sends the cookies over plain HTTP as well, for local development
+	SameSite http.SameSite // Lax by default
+}
+
+// NewCookieConfig parses the secure flag, true by default, and the SameSite mode: lax, strict or none
+func NewCookieConfig(secure, sameSite string) (CookieConfig, error) {
+	c := CookieConfig{}
+	if secure != "" {
+		s, err := strconv.ParseBool(secure)
+		if err != nil {
+			return c, fmt.Errorf("invalid secure cookie flag: %v", secure)
+		}
+		c.Insecure = !s
+	}
+
+	switch strings.ToLower(sameSite) {
+	case "", "lax":
+		c.SameSite = http.SameSiteLaxMode
+	case "strict":
+		c.SameSite = http.SameSiteStrictMode
+	case "none":
+		c.SameSite = http.SameSiteNoneMode
+	default:
+		return c, fmt.Errorf("SameSite must be lax, strict or none: %v", sameSite)
+	}
+	return c, nil
+}
+
+func (a *App) cookie(name, value string, expires time.Time) *http.Cookie {
+	sameSite := a.Cookies.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !a.Cookies.Insecure,
+		SameSite: sameSite,
+	}
+}
+
+func (a *App) setAuthCookies(w http.ResponseWriter, tokens *model.Tokens) {
+	http.SetCookie(w, a.cookie(tokenCookie, tokens.Token, time.Now().Add(accessTokenTTL)))
+	if tokens.RefreshToken != "" {
+		http.SetCookie(w, a.cookie(refreshCookie, tokens.RefreshToken, time.Now().Add(refreshTokenTTL)))
+	}
+}
+
+func (a *App) clearAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{tokenCookie, refreshCookie} {
+		http.SetCookie(w, a.cookie(name, "", time.Unix(0, 0)))
+	}
+}
+
+// refreshFromCookie renews the session of a browser whose access token has expired.
+// It returns nil if there is no valid refresh token cookie.
+func (a *App) refreshFromCookie(w http.ResponseWriter, r *http.Request) *model.UserToken {
+	c, err := r.Cookie(refreshCookie)
+	if err != nil || c.Value == "" {
+		return nil
+	}
+	tokens, claims, err := a.refreshSession(c.Value)
+	if err != nil {
+		return nil
+	}
+	a.setAuthCookies(w, tokens)
+	return claims
+}
+
+// Browser
+
+func (a *App) logoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	if err := a.Sessions.RevokeAll(currentUserID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.clearAuthCookies(w)
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// API
+
+// Receive --> refreshToken
+// Return --> {token, refreshToken}
+func (a *App) apiRefresh(w http.ResponseWriter, r *http.Request) {
+	body := &struct {
+		RefreshToken string `json:"refreshToken" validate:"required"`
+	}{}
+	if !a.decodeAndValidate(w, r, body) {
+		return
+	}
+
+	tokens, _, err := a.refreshSession(body.RefreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+func (a *App) apiLogout(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*model.UserToken)
+	if err := a.Sessions.Revoke(claims.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) apiLogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	if err := a.Sessions.RevokeAll(currentUserID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,48 +2,38 @@ package rest
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"github.com/hpmalinova/Money-Manager/model"
+	"github.com/hpmalinova/Money-Manager/repository"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func (a *App) checkCredentials(w http.ResponseWriter, username, password string) (map[string]string, error) {
+func (a *App) checkCredentials(w http.ResponseWriter, username, password string) (*model.Tokens, error) {
 	user, err := a.Users.FindByUsername(username)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Username not found")
 		return nil, err
 	}
-	expiresAt := time.Now().Add(time.Minute * 30).Unix()
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword { //Password does not match!
+	if err != nil { //Password does not match!
 		respondWithError(w, http.StatusUnauthorized, "Invalid login credentials. Please try again")
 		return nil, err
 	}
 
-	claims := &model.UserToken{
-		UserID:   strconv.Itoa(user.ID),
-		Username: user.Username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expiresAt,
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, error := token.SignedString([]byte("secret"))
-	if error != nil {
-		fmt.Println(error)
+	tokens, err := a.startSession(user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not create session")
+		return nil, err
 	}
-
-	var resp = map[string]string{"token": tokenString, "username": user.Username, "id": strconv.Itoa(user.ID)}
-	return resp, nil
+	return tokens, nil
 }
 
 func (a *App) getFriendsData(start, count, userID int) (*model.Friends, error) {
@@ -71,6 +61,280 @@ func (a *App) getPendingFriendsData(start, count, userID int) (*model.Friends, e
 	return &model.Friends{Usernames: friendNames}, nil
 }
 
+func (a *App) getDebtsData(userID int) (*model.DebtsTemplate, error) {
+	// Show balance
+	balance := a.getBalance(userID)
+
+	// Show debts:
+	activeDebts, err := a.Payment.FindActiveDebts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := make([]model.DebtTemplate, 0, len(activeDebts))
+	for _, d := range activeDebts {
+		creditor, _ := a.Users.FindByID(d.CreditorID)
+		ds = append(ds, model.DebtTemplate{
+			Creditor: creditor.Username,
+			DLTemplate: model.DLTemplate{
+				StatusID:     d.StatusID,
+				Amount:       d.Amount,
+				Currency:     d.Currency,
+				Description:  d.Description,
+				DueDate:      dueDate(d.DueDate),
+				InterestRate: d.InterestRate,
+				Interest:     d.Interest,
+				Overdue:      d.Overdue,
+			},
+		})
+	}
+
+	// Show pending debts:
+	pendingDebts, err := a.Payment.FindPendingDebts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pds := make([]model.DebtTemplate, 0, len(pendingDebts))
+	for _, pd := range pendingDebts {
+		creditor, _ := a.Users.FindByID(pd.CreditorID)
+		pds = append(pds, model.DebtTemplate{
+			Creditor: creditor.Username,
+			DLTemplate: model.DLTemplate{
+				Amount:      pd.Amount,
+				Currency:    pd.Currency,
+				Description: pd.Description,
+			},
+		})
+	}
+
+	// Show proposed loans and splits:
+	proposedDebts, err := a.Payment.FindProposedDebts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prds := make([]model.DebtTemplate, 0, len(proposedDebts))
+	for _, prd := range proposedDebts {
+		creditor, _ := a.Users.FindByID(prd.CreditorID)
+		prds = append(prds, model.DebtTemplate{Creditor: creditor.Username, DLTemplate: proposalTemplate(prd)})
+	}
+
+	// Show forgiven debts:
+	forgivenDebts, err := a.Payment.FindForgiven(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fds := make([]model.ForgivenTemplate, 0, len(forgivenDebts))
+	for _, fd := range forgivenDebts {
+		creditor, _ := a.Users.FindByID(fd.CreditorID)
+		fds = append(fds, model.ForgivenTemplate{
+			ID:          fd.ID,
+			Creditor:    creditor.Username,
+			Amount:      fd.Amount,
+			Currency:    fd.Currency,
+			Description: fd.Description,
+			Date:        fd.Date,
+			Closed:      fd.Closed,
+		})
+	}
+	return &model.DebtsTemplate{Active: ds, Pending: pds, Proposed: prds, Forgiven: fds, Balance: balance,
+		Account: model.DefaultAccount}, nil
+}
+
+func (a *App) getLoansData(userID int) (*model.LoansTemplate, error) {
+	// Show balance
+	balance := a.getBalance(userID)
+
+	// Show loans:
+	activeLoans, err := a.Payment.FindActiveLoans(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	als := make([]model.LoanTemplate, 0, len(activeLoans))
+	for _, al := range activeLoans {
+		debtor, _ := a.Users.FindByID(al.DebtorID)
+		als = append(als, model.LoanTemplate{
+			Debtor: debtor.Username,
+			DLTemplate: model.DLTemplate{
+				StatusID:     al.StatusID,
+				Amount:       al.Amount,
+				Currency:     al.Currency,
+				Description:  al.Description,
+				DueDate:      dueDate(al.DueDate),
+				InterestRate: al.InterestRate,
+				Interest:     al.Interest,
+				Overdue:      al.Overdue,
+			},
+		})
+	}
+
+	// Show pending requests:
+	pendingRequests, err := a.Payment.FindPendingRequests(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prs := make([]model.LoanTemplate, 0, len(pendingRequests))
+	for _, pr := range pendingRequests {
+		debtor, _ := a.Users.FindByID(pr.DebtorID)
+		prs = append(prs, model.LoanTemplate{
+			Debtor: debtor.Username,
+			DLTemplate: model.DLTemplate{
+				StatusID:    pr.StatusID,
+				Amount:      pr.Amount,
+				Currency:    pr.Currency,
+				Description: pr.Description,
+			},
+		})
+	}
+
+	// Show proposed loans and splits:
+	proposedLoans, err := a.Payment.FindProposedLoans(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pls := make([]model.LoanTemplate, 0, len(proposedLoans))
+	for _, pl := range proposedLoans {
+		debtor, _ := a.Users.FindByID(pl.DebtorID)
+		pls = append(pls, model.LoanTemplate{Debtor: debtor.Username, DLTemplate: proposalTemplate(pl)})
+	}
+	return &model.LoansTemplate{Active: als, Pending: prs, Proposed: pls, Balance: balance,
+		Account: model.DefaultAccount}, nil
+}
+
+// proposalTemplate shows a proposed loan, or a split with the share which the payer has paid
+func proposalTemplate(p model.Proposal) model.DLTemplate {
+	t := model.DLTemplate{
+		StatusID:     p.StatusID,
+		Amount:       p.Amount,
+		Currency:     p.Currency,
+		Description:  p.Description,
+		DueDate:      dueDate(p.DueDate),
+		InterestRate: p.InterestRate,
+	}
+	if p.Split {
+		t.Total = p.Total
+	}
+	return t
+}
+
+func (a *App) getHistoryData(userID int, period model.Period) (*model.HistoryAndStatistics, error) {
+	h, err := a.Payment.FindHistory(userID, period)
+	if err != nil {
+		return nil, fmt.Errorf("error getting history: %v", err)
+	}
+
+	for i, hs := range h.HistoryShowAll {
+		h.HistoryShowAll[i].Editable = !model.IsSystemCategory(hs.CategoryName)
+	}
+
+	// Statistics:
+	exp, err := a.Payment.FindStatistics(userID, true, period)
+	if err != nil {
+		return nil, fmt.Errorf("error getting expense statistics: %v", err)
+	}
+	inc, err := a.Payment.FindStatistics(userID, false, period)
+	if err != nil {
+		return nil, fmt.Errorf("error getting income statistics: %v", err)
+	}
+
+	budgets, err := a.Budgets.Find(userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error getting budgets: %v", err)
+	}
+
+	return &model.HistoryAndStatistics{
+		HistoryShowAll: *h,
+		Expense:        *exp,
+		Income:         *inc,
+		Budgets:        budgets,
+	}, nil
+}
+
+// getBalance returns the balance of the user, or an empty one if it cannot be checked
+func (a *App) getBalance(userID int) model.Balance {
+	balance, err := a.Payment.CheckBalance(userID)
+	if err != nil {
+		return model.Balance{}
+	}
+	return *balance
+}
+
+// getCurrencies returns the currencies which have an exchange rate
+func (a *App) getCurrencies() []string {
+	rates, _ := a.Rates.FindAll()
+	currencies := make([]string, 0, len(rates))
+	for _, rate := range rates {
+		currencies = append(currencies, rate.Currency)
+	}
+	return currencies
+}
+
+// findCurrency returns the currency, which must have an exchange rate.
+// An empty currency is the base currency of the user.
+func (a *App) findCurrency(userID int, currency string) (string, error) {
+	if currency == "" {
+		user, err := a.Users.FindByID(userID)
+		if err != nil {
+			return "", err
+		}
+		return user.Currency, nil
+	}
+	if _, err := a.Rates.Find(currency); err != nil {
+		return "", fmt.Errorf("there is no exchange rate for %v", currency)
+	}
+	return currency, nil
+}
+
+// debtCurrency returns the currency of the active debt of the user with the status.
+// It is the base currency of the user if the user has no such debt, which the repository rejects.
+func (a *App) debtCurrency(userID, statusID int) (string, error) {
+	ds, err := a.Payment.FindActiveDebts(userID)
+	if err != nil {
+		return "", err
+	}
+	for _, d := range ds {
+		if d.StatusID == statusID {
+			return d.Currency, nil
+		}
+	}
+	return a.findCurrency(userID, "")
+}
+
+// loanCurrency returns the currency of the active loan of the user with the status,
+// or the base currency of the user if the user has no such loan.
+func (a *App) loanCurrency(userID, statusID int) (string, error) {
+	ls, err := a.Payment.FindActiveLoans(userID)
+	if err != nil {
+		return "", err
+	}
+	for _, l := range ls {
+		if l.StatusID == statusID {
+			return l.Currency, nil
+		}
+	}
+	return a.findCurrency(userID, "")
+}
+
+// entryCurrency returns the currency of the history entry of the user,
+// or the base currency of the user if the user has no such entry.
+func (a *App) entryCurrency(userID, entryID int) (string, error) {
+	hs, err := a.Payment.FindHistory(userID, model.Period{})
+	if err != nil {
+		return "", err
+	}
+	for _, h := range hs.HistoryShowAll {
+		if h.ID == entryID {
+			return h.Currency, nil
+		}
+	}
+	return a.findCurrency(userID, "")
+}
+
 func (a *App) convertToUsername(ids []int) ([]string, error) {
 	usernames, err := a.Users.FindNamesByIDs(ids)
 	if err != nil {
@@ -79,6 +343,73 @@ func (a *App) convertToUsername(ids []int) ([]string, error) {
 	return usernames, nil
 }
 
+const dateLayout = "2006-01-02"
+
+// parseDate parses an optional date form value (yyyy-mm-dd).
+// An empty value returns the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(dateLayout, value, time.Local)
+}
+
+// dueDate returns nil for a loan without a due date, so that it is left out of the JSON
+func dueDate(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// parseTerms parses the optional due date (yyyy-mm-dd) and interest rate, in percent per year, of a loan form
+func parseTerms(dueDate, interestRate string) (model.Terms, error) {
+	terms := model.Terms{}
+	var err error
+	if terms.DueDate, err = parseDate(dueDate); err != nil {
+		return terms, errors.New("Invalid due date")
+	}
+	if interestRate != "" {
+		terms.InterestRate, err = strconv.ParseFloat(interestRate, 64)
+		if err != nil || !(terms.InterestRate >= 0 && terms.InterestRate <= 100) {
+			return terms, errors.New("Invalid interest rate")
+		}
+	}
+	return terms, nil
+}
+
+// parseAmount parses a positive amount form value, such as 12.49
+func parseAmount(value, currency string) (model.Amount, error) {
+	amount, err := model.ParseAmountIn(value, currency)
+	if err != nil {
+		return 0, err
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("amount must be positive: %v", value)
+	}
+	return amount, nil
+}
+
+// parsePeriod reads the "from" and "to" form values.
+// Both dates are inclusive, so the end of the period is the start of the day after "to".
+func parsePeriod(r *http.Request) (model.Period, error) {
+	from, err := parseDate(r.FormValue("from"))
+	if err != nil {
+		return model.Period{}, fmt.Errorf("invalid from date: %v", r.FormValue("from"))
+	}
+	to, err := parseDate(r.FormValue("to"))
+	if err != nil {
+		return model.Period{}, fmt.Errorf("invalid to date: %v", r.FormValue("to"))
+	}
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return model.Period{}, fmt.Errorf("from date must not be after to date")
+	}
+	return model.Period{From: from, To: to}, nil
+}
+
 // TODO
 func (a *App) getStartCount(w http.ResponseWriter, r *http.Request) (int, error, int, bool) {
 	count, err := strconv.Atoi(r.FormValue("count"))
@@ -136,86 +467,496 @@ func (a *App) getUser(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, user)
 }
 
-// Receives name + participantNames[]
-// A user cannot participate in two groups with the same name
-// TODO Redirect to page /group/{id}
-func (a *App) addGroup(w http.ResponseWriter, r *http.Request) {
-	// todo add the logged user id?
-	// var1: as query parameter /addGroup/{my_id} --> da ne moje drug acc da go otvarq
-	// var2: creatorID in the createGroup model
+// GROUPS
 
-	createGroupModel := &model.CreateGroup{}
-	err := json.NewDecoder(r.Body).Decode(createGroupModel)
+// getGroupsData returns the groups which the user has joined and the groups the user is invited to
+func (a *App) getGroupsData(userID int) (*model.GroupsTemplate, error) {
+	joined, err := a.Groups.Find(0, 100, userID)
+	if err != nil {
+		return nil, err
+	}
+	invites, err := a.Groups.FindInvites(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.GroupsTemplate{Groups: joined, Invites: invites}, nil
+}
 
+// findGroup returns the group if the user has joined it.
+// Otherwise it returns sql.ErrNoRows, so that the groups of other users are not revealed.
+func (a *App) findGroup(userID, groupID int) (*model.Group, error) {
+	group, err := a.Groups.FindByID(groupID)
 	if err != nil {
-		fmt.Printf("Error creating group %v: %v", createGroupModel.Name, err)
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		//var resp = map[string]interface{}{"status": false, "message": "Invalid request"}
-		//_ = json.NewEncoder(w).Encode(resp)
-		return
+		return nil, err
+	}
+	if !group.IsMember(userID) {
+		return nil, sql.ErrNoRows
 	}
+	return group, nil
+}
 
-	// todo convert usernames to uids
-	participants := []int{}
+// findFriends returns the IDs of the users with the given usernames, who must be friends of the user
+func (a *App) findFriends(userID int, usernames []string) ([]int, error) {
+	ids := []int{}
+	for _, username := range usernames {
+		friend, err := a.findFriend(userID, username)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := a.Friendship.AreFriends(orderedPair(userID, friend.ID))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%v is not your friend", username)
+		}
+		ids = append(ids, friend.ID)
+	}
+	return ids, nil
+}
 
-	if err := a.Groups.Create(createGroupModel.Name, participants); err != nil {
-		prefix := "Bad Request: "
-		if strings.HasPrefix(err.Error(), prefix) {
-			respondWithError(w, http.StatusBadRequest, strings.TrimPrefix(err.Error(), prefix))
-			return
+// participantID returns the ID of a participant of a split expense of the user.
+// In a group the participant must be a member of it, otherwise the user or a friend of the user.
+func (a *App) participantID(userID int, group *model.Group, username string) (int, error) {
+	if group != nil {
+		for _, m := range group.Members {
+			if m.Username == username && m.Status == model.MemberStatus {
+				return m.UserID, nil
+			}
 		}
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return 0, fmt.Errorf("%v is not a member of the group", username)
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	user, err := a.Users.FindByUsername(username)
+	if err != nil {
+		return 0, fmt.Errorf("there is no user: %v", username)
+	}
+	if user.ID == userID {
+		return userID, nil
+	}
+	ids, err := a.findFriends(userID, []string{username})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
 }
 
-func (a *App) getGroups(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID, err := strconv.Atoi(vars["id"])
+// recordSplit records an expense which the user paid for the participants of the request.
+// The expense of a group is shared equally by all its members if the request names no participants.
+func (a *App) recordSplit(userID int, group *model.Group, s *model.SplitRequest) error {
+	currency, err := a.findCurrency(userID, s.Currency)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
-		return
+		return err
+	}
+	expenseC, err := a.findCategory(userID, s.CategoryName, model.ExpenseType)
+	if err != nil {
+		return err
+	}
+	loanC := a.getCategoryByName(model.LoanCategory)
+	if loanC == nil {
+		return fmt.Errorf("loan categories are missing")
 	}
 
-	// todo in function? repeated code
-	count, err := strconv.Atoi(r.FormValue("count"))
-	if err != nil && r.FormValue("count") != "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid request count parameter")
-		return
+	participants := s.Participants
+	if group != nil && len(participants) == 0 {
+		for _, m := range group.Members {
+			if m.Status == model.MemberStatus {
+				participants = append(participants, model.SplitParticipant{Username: m.Username})
+			}
+		}
 	}
-	start, err := strconv.Atoi(r.FormValue("start"))
-	if err != nil && r.FormValue("start") != "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid request start parameter")
-		return
+
+	// The payer goes first, so that the payer pays the minor units left over
+	ids := make([]int, 0, len(participants))
+	ordered := make([]model.SplitParticipant, 0, len(participants))
+	seen := map[int]bool{}
+	for _, p := range participants {
+		id, err := a.participantID(userID, group, p.Username)
+		if err != nil {
+			return err
+		}
+		if seen[id] {
+			return fmt.Errorf("%v participates twice", p.Username)
+		}
+		seen[id] = true
+
+		if id == userID {
+			ids = append([]int{id}, ids...)
+			ordered = append([]model.SplitParticipant{p}, ordered...)
+		} else {
+			ids = append(ids, id)
+			ordered = append(ordered, p)
+		}
 	}
 
-	const (
-		minOffset = 0
-		minLimit  = 1
-		maxLimit  = 10
-	)
+	amounts, err := model.Allocate(s.Method, s.Amount, currency, ordered)
+	if err != nil {
+		return err
+	}
 
-	start--
-	if count > maxLimit || count < minLimit {
-		count = maxLimit
+	e := &model.SplitExpense{
+		PayerID:          userID,
+		Account:          s.Account,
+		LoanCategoryID:   loanC.ID,
+		Expense:          *expenseC,
+		DebtCategoryName: a.debtCategory(userID, expenseC),
+		Amount:           s.Amount,
+		Currency:         currency,
+		Description:      s.Description,
+		Date:             s.Date,
 	}
-	if start < minOffset {
-		start = minOffset
+	if group != nil {
+		e.GroupID = group.ID
+	}
+	for i, id := range ids {
+		if id == userID {
+			e.Own = amounts[i]
+		} else {
+			e.Shares = append(e.Shares, model.Share{DebtorID: id, Amount: amounts[i]})
+		}
 	}
+	return a.Payment.SplitExpense(e)
+}
 
-	groups, err := a.Groups.Find(start, count, userID)
+// parseSplitForm reads a split expense of the user from a form. The participants are checked
+// and the part of each participant is named after them, such as part_Lily.
+func (a *App) parseSplitForm(userID int, r *http.Request) (*model.SplitRequest, error) {
+	currency, err := a.findCurrency(userID, r.FormValue("currency"))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return nil, err
+	}
+	amount, err := parseAmount(r.FormValue("amount"), currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount")
+	}
+	date, err := parseDate(r.FormValue("date"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid date")
+	}
+
+	s := &model.SplitRequest{
+		Amount:       amount,
+		Currency:     currency,
+		Account:      r.FormValue("account"),
+		CategoryName: r.FormValue("category"),
+		Description:  r.FormValue("description"),
+		Date:         date,
+		Method:       r.FormValue("method"),
+	}
+	for _, username := range r.Form["participant"] {
+		p := model.SplitParticipant{Username: username}
+		part := r.FormValue("part_" + username)
+		if part != "" {
+			switch s.Method {
+			case model.ExactSplit:
+				p.Amount, err = parseAmount(part, currency)
+			case model.PercentSplit:
+				p.Percent, err = strconv.ParseFloat(part, 64)
+			case model.SharesSplit:
+				p.Shares, err = strconv.Atoi(part)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid part of %v", username)
+			}
+		}
+		s.Participants = append(s.Participants, p)
+	}
+	return s, nil
+}
+
+// SETTLEMENT
+
+// circleScope selects the debts outside of groups between the user and the friends of the user.
+// The debts between two friends are theirs to settle, so they are left out.
+func (a *App) circleScope(userID int) (model.DebtScope, error) {
+	friendIDs, err := a.Friendship.Find(0, 100, userID)
+	if err != nil {
+		return model.DebtScope{}, err
+	}
+	return model.DebtScope{UserIDs: append([]int{userID}, friendIDs...), PartyID: userID}, nil
+}
+
+// getSettlementPlan returns the settlement plan of the debts of the scope
+func (a *App) getSettlementPlan(name string, scope model.DebtScope) (*model.SettlementPlan, error) {
+	debts, err := a.Payment.FindOpenDebts(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &model.SettlementPlan{Name: name, Debts: len(debts), Settlements: model.Simplify(debts)}
+	for _, d := range debts {
+		plan.Pending = plan.Pending || d.Pending
+	}
+	for i, s := range plan.Settlements {
+		usernames, err := a.convertToUsername([]int{s.FromID, s.ToID})
+		if err != nil {
+			return nil, err
+		}
+		plan.Settlements[i].From, plan.Settlements[i].To = usernames[0], usernames[1]
+	}
+	return plan, nil
+}
+
+// BUDGETS
+
+// userCategories returns the categories without the ones which are reserved for loans
+func userCategories(categories []model.Category) []model.Category {
+	result := []model.Category{}
+	for _, c := range categories {
+		if !model.IsSystemCategory(c.Name) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// setBudget creates or replaces the budget of the user for the expense category
+func (a *App) setBudget(userID int, categoryName string, req *model.BudgetRequest) error {
+	category, err := a.findCategory(userID, categoryName, model.ExpenseType)
+	if err != nil {
+		return err
+	}
+	currency, err := a.findCurrency(userID, req.Currency)
+	if err != nil {
+		return err
+	}
+	return a.Budgets.Set(&model.Budget{
+		UserID:     userID,
+		CategoryID: category.ID,
+		Amount:     req.Amount,
+		Currency:   currency,
+		Period:     req.Period,
+		Block:      req.Block,
+	})
+}
+
+// checkBudget checks a payment against the budgets of its category and of the parent of its category
+// in the period of its date. A payment which exceeds a blocking budget is a BadRequestError;
+// otherwise a warning is returned if it exceeds a budget.
+func (a *App) checkBudget(h *model.History) (string, error) {
+	categoryIDs := []int{h.CategoryID}
+	if category, err := a.Categories.FindByID(h.UserID, h.CategoryID); err == nil && category.ParentID != 0 {
+		categoryIDs = append(categoryIDs, category.ParentID)
+	}
+
+	warnings := []string{}
+	for _, categoryID := range categoryIDs {
+		warning, err := a.checkCategoryBudget(h, categoryID)
+		if err != nil {
+			return "", err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return strings.Join(warnings, "; "), nil
+}
+
+// checkCategoryBudget checks a payment against the budget of the category in the period of its date
+func (a *App) checkCategoryBudget(h *model.History, categoryID int) (string, error) {
+	date := h.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	budget, err := a.Budgets.FindByCategory(h.UserID, categoryID, date)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	amount := h.Amount
+	if h.Currency != budget.Currency {
+		rates := model.Rates{}
+		for _, currency := range []string{h.Currency, budget.Currency} {
+			rate, err := a.Rates.Find(currency)
+			if err != nil {
+				return "", err
+			}
+			rates[currency] = rate.Rate
+		}
+		if amount, err = rates.Convert(h.Amount, h.Currency, budget.Currency); err != nil {
+			return "", err
+		}
+	}
+
+	warning := budget.Exceeded(amount)
+	if warning != "" && budget.Block {
+		return "", &repository.BadRequestError{Message: warning}
+	}
+	return warning, nil
+}
+
+// RECURRING
+
+// createRecurring stores the rule of the request for the user and records its occurrences which are already due
+func (a *App) createRecurring(userID int, req *model.RecurringRequest) (*model.Recurring, error) {
+	category, err := a.Categories.FindByName(userID, req.CategoryName)
+	if err != nil || category.Archived || model.IsSystemCategory(category.Name) {
+		return nil, fmt.Errorf("there is no category: %v", req.CategoryName)
+	}
+	currency, err := a.findCurrency(userID, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if !req.EndsAt.IsZero() && !req.StartsAt.IsZero() && req.EndsAt.Before(req.StartsAt) {
+		return nil, fmt.Errorf("the rule must not end before it starts")
+	}
+
+	rule, err := a.Recurring.Create(&model.Recurring{
+		UserID:       userID,
+		Amount:       req.Amount,
+		Currency:     currency,
+		Account:      req.Account,
+		CategoryID:   category.ID,
+		CategoryName: category.Name,
+		CategoryType: category.CType,
+		Description:  req.Description,
+		Frequency:    req.Frequency,
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+		Count:        req.Count,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// An occurrence which cannot be recorded yet is retried by the scheduler
+	if err := a.recordRule(*rule, time.Now().UTC()); err != nil {
+		log.Printf("recurring rule %d: %v", rule.ID, err)
+	}
+	return a.findRecurring(userID, rule.ID)
+}
+
+// findRecurring returns the rule of the user with its next occurrence
+func (a *App) findRecurring(userID, id int) (*model.Recurring, error) {
+	rule, err := a.Recurring.FindByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	setNext(rule)
+	return rule, nil
+}
+
+// getRecurringRules returns the rules of the user with their next occurrences
+func (a *App) getRecurringRules(userID int) ([]model.Recurring, error) {
+	rules, err := a.Recurring.FindByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		setNext(&rules[i])
+	}
+	return rules, nil
+}
+
+func setNext(r *model.Recurring) {
+	if !r.Ended(r.Done) {
+		next := r.Occurrence(r.Done)
+		r.Next = &next
+	}
+}
+
+// pauseRecurring pauses or resumes the rule of the user.
+// A resumed rule skips the occurrences which fell into the pause.
+func (a *App) pauseRecurring(userID, id int, paused bool) error {
+	rule, err := a.Recurring.FindByID(userID, id)
+	if err != nil {
+		return err
+	}
+	if paused {
+		return a.Recurring.Pause(userID, id)
+	}
+	return a.Recurring.Resume(userID, id, rule.Upcoming(time.Now().UTC()))
+}
+
+// parseRecurringForm reads a recurring rule of the user from the form values
+// amount, currency, account, category, description, frequency, starts, ends and count
+func (a *App) parseRecurringForm(userID int, r *http.Request) (*model.RecurringRequest, error) {
+	currency, err := a.findCurrency(userID, r.FormValue("currency"))
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(r.FormValue("amount"), currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount")
+	}
+	starts, err := parseDate(r.FormValue("starts"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date")
 	}
+	ends, err := parseDate(r.FormValue("ends"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date")
+	}
+	count := 0
+	if value := r.FormValue("count"); value != "" {
+		if count, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid count")
+		}
+	}
+
+	return &model.RecurringRequest{
+		Amount:       amount,
+		Currency:     currency,
+		Account:      r.FormValue("account"),
+		CategoryName: r.FormValue("category"),
+		Description:  r.FormValue("description"),
+		Frequency:    r.FormValue("frequency"),
+		StartsAt:     starts,
+		EndsAt:       ends,
+		Count:        count,
+	}, nil
+}
+
+// CATEGORIES
 
-	respondWithJSON(w, http.StatusOK, groups)
+// createCategory creates a category of the user, nested under the parent of the request if it names one.
+// The parent must be a top level category of the same type.
+func (a *App) createCategory(userID int, req *model.CategoryRequest) (*model.Category, error) {
+	category := &model.Category{UserID: userID, CType: req.CType, Name: req.Name}
+	if req.Parent != "" {
+		parent, err := a.findCategory(userID, req.Parent, req.CType)
+		if err != nil {
+			return nil, &repository.BadRequestError{Message: err.Error()}
+		}
+		if parent.ParentID != 0 {
+			return nil, &repository.BadRequestError{Message: "the subcategory " + parent.Name + " cannot have subcategories"}
+		}
+		category.ParentID = parent.ID
+	}
+	return a.Categories.Create(category)
+}
+
+// parentCategories returns the categories which the user can nest new categories under:
+// the top level ones which are neither archived nor reserved for loans
+func (a *App) parentCategories(userID int) ([]model.Category, error) {
+	expenses, err := a.Categories.FindExpenses(userID)
+	if err != nil {
+		return nil, err
+	}
+	incomes, err := a.Categories.FindIncomes(userID)
+	if err != nil {
+		return nil, err
+	}
+	return userCategories(append(expenses, incomes...)), nil
+}
+
+// debtCategory returns the name of the shared category in which the friends of the user record
+// their part of an expense in the category when they repay it, as they do not see the categories of the user.
+// It is the category itself if it is shared, or its shared parent; the other categories of the user count as repayments.
+func (a *App) debtCategory(userID int, category *model.Category) string {
+	if category.Shared() {
+		return category.Name
+	}
+	if parent, err := a.Categories.FindByID(userID, category.ParentID); err == nil && parent.Shared() {
+		return parent.Name
+	}
+	return model.RepayCategory
 }
 
 func (a *App) getCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := a.Categories.FindAll()
+	categories, err := a.Categories.FindAll(currentUserID(r))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -224,19 +965,56 @@ func (a *App) getCategories(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, categories)
 }
 
+// getCategoryByName returns the shared category with the given name
 func (a *App) getCategoryByName(categoryName string) *model.Category {
 	fmt.Println("IN getCategoryByName", categoryName)
-	c, err := a.Categories.FindByName(categoryName)
+	c, err := a.Categories.FindByName(0, categoryName)
 	if err != nil {
 		fmt.Println(err.Error())
 	}
 	return c
 }
 
-func (a *App) getCategoryByStatus(statusID int) string {
-	cName, err := a.Payment.FindCategoryName(statusID)
+// acceptRepayment accepts the pending repayment of a debt to the creditor into the account.
+// The debtor records it in the category of the debt, and the creditor as received.
+func (a *App) acceptRepayment(creditorID, statusID int, account string) error {
+	categoryName, err := a.Payment.FindCategoryName(creditorID, statusID)
 	if err != nil {
-		fmt.Println(err.Error())
+		return err
+	}
+
+	expenseC := a.getCategoryByName(categoryName)
+	repayC := a.getCategoryByName(model.ReceiveCategory)
+	if expenseC == nil || repayC == nil {
+		return errors.New("repay categories are missing")
 	}
-	return cName
+
+	return a.Payment.AcceptPayment(creditorID, &model.Accept{StatusID: statusID, RepayC: *repayC, ExpenseC: *expenseC,
+		Account: account})
+}
+
+// acceptProposal accepts a loan or a split proposed to the debtor, who receives a loan into the account.
+// The creditor records the loan, and the debtor records a received loan as debt.
+func (a *App) acceptProposal(debtorID, statusID int, account string) error {
+	loanC := a.getCategoryByName(model.LoanCategory)
+	debtC := a.getCategoryByName(model.DebtCategory)
+	if loanC == nil || debtC == nil {
+		return errors.New("loan categories are missing")
+	}
+
+	return a.Payment.AcceptProposal(debtorID, &model.Consent{StatusID: statusID, LoanCategoryID: loanC.ID,
+		DebtCategoryID: debtC.ID, Account: account})
+}
+
+// forgiveDebt forgives the debtor the amount of the debt, or the whole debt if the amount is zero.
+// The creditor records it as forgiven to the debtor, and the debtor as forgiven by the creditor.
+func (a *App) forgiveDebt(creditorID, statusID int, amount model.Amount) error {
+	forgiveC := a.getCategoryByName(model.ForgiveCategory)
+	forgivenC := a.getCategoryByName(model.ForgivenCategory)
+	if forgiveC == nil || forgivenC == nil {
+		return errors.New("forgiveness categories are missing")
+	}
+
+	return a.Payment.Forgive(creditorID, &model.Forgive{StatusID: statusID, Amount: amount, ForgiveC: *forgiveC,
+		ForgivenC: *forgivenC})
 }